@@ -0,0 +1,156 @@
+package telegramify
+
+import (
+	"strconv"
+	"strings"
+)
+
+// TraceKeyChunk is the ContentTrace.Extra key holding the ChunkInfo of a Text
+// produced from the document body. Use ContentTrace.Chunk to read it.
+const TraceKeyChunk = "chunk"
+
+// minChunkSimilarity is the word overlap below which MatchChunks does not
+// pair two chunks from different sections.
+const minChunkSimilarity = 0.5
+
+// ChunkInfo identifies a Text within the output of one Process call, so that
+// a bot editing sent messages in place can match the chunks of an updated
+// document with the old ones (see MatchChunks).
+type ChunkInfo struct {
+	// Index is the position among the document's body Texts and Total their
+	// number. The table of contents and header-only Texts are not counted.
+	Index int
+	Total int
+	// Section is the path of headings enclosing the start of the chunk, such
+	// as ["Guide", "Install"]; it is nil before the first heading.
+	Section []string
+	// SectionIndex is the position among the chunks with the same Section.
+	SectionIndex int
+	// Hash is a hex digest of the chunk text without header or footer.
+	Hash string
+}
+
+// Chunk returns the ChunkInfo recorded under TraceKeyChunk, if any.
+func (ct ContentTrace) Chunk() (ChunkInfo, bool) {
+	info, ok := ct.Extra[TraceKeyChunk].(ChunkInfo)
+	return info, ok
+}
+
+// ChunkMatch pairs a Text of an old Process result with one of a new result.
+// Old and New are indexes into the slices passed to MatchChunks; -1 means
+// the chunk has no counterpart and should be deleted (New == -1) or sent
+// (Old == -1).
+type ChunkMatch struct {
+	Old     int
+	New     int
+	Changed bool
+}
+
+// MatchChunks pairs the Texts of two Process results of the same document,
+// for example before and after an edit. Chunks are paired by section path
+// and position within the section first, then remaining chunks by word
+// overlap. Changed reports whether a paired chunk's text differs, so only
+// those messages need editing. Contents without ChunkInfo are ignored.
+//
+// Matches are ordered by New, followed by the unmatched old chunks.
+func MatchChunks(old, new []Content) []ChunkMatch {
+	oldChunks, newChunks := collectChunks(old), collectChunks(new)
+
+	byKey := make(map[string]int, len(oldChunks))
+	for i, c := range oldChunks {
+		byKey[c.key] = i
+	}
+	oldUsed := make([]bool, len(oldChunks))
+	newMatch := make([]int, len(newChunks))
+	for j, c := range newChunks {
+		newMatch[j] = -1
+		if i, ok := byKey[c.key]; ok {
+			newMatch[j], oldUsed[i] = i, true
+		}
+	}
+	for j, c := range newChunks {
+		if newMatch[j] >= 0 {
+			continue
+		}
+		best, bestScore := -1, minChunkSimilarity
+		for i, o := range oldChunks {
+			if oldUsed[i] {
+				continue
+			}
+			if score := wordSimilarity(o.words, c.words); score >= bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best >= 0 {
+			newMatch[j], oldUsed[best] = best, true
+		}
+	}
+
+	matches := make([]ChunkMatch, 0, len(newChunks))
+	for j, c := range newChunks {
+		m := ChunkMatch{Old: -1, New: c.index, Changed: true}
+		if i := newMatch[j]; i >= 0 {
+			m.Old, m.Changed = oldChunks[i].index, oldChunks[i].hash != c.hash
+		}
+		matches = append(matches, m)
+	}
+	for i, o := range oldChunks {
+		if !oldUsed[i] {
+			matches = append(matches, ChunkMatch{Old: o.index, New: -1, Changed: true})
+		}
+	}
+	return matches
+}
+
+// chunkRef is a Text with ChunkInfo, as seen by MatchChunks.
+type chunkRef struct {
+	index int
+	key   string
+	hash  string
+	words map[string]bool
+}
+
+// collectChunks returns the Texts of contents that carry ChunkInfo.
+func collectChunks(contents []Content) []chunkRef {
+	var refs []chunkRef
+	for i, content := range contents {
+		text, ok := content.(*Text)
+		if !ok {
+			continue
+		}
+		info, ok := text.ContentTrace.Chunk()
+		if !ok {
+			continue
+		}
+		words := make(map[string]bool)
+		for _, w := range strings.Fields(text.Text) {
+			words[w] = true
+		}
+		refs = append(refs, chunkRef{
+			index: i,
+			key:   sectionKey(info.Section) + "\x00" + strconv.Itoa(info.SectionIndex),
+			hash:  info.Hash,
+			words: words,
+		})
+	}
+	return refs
+}
+
+// sectionKey joins a section path into a map key.
+func sectionKey(section []string) string {
+	return strings.Join(section, "\x1f")
+}
+
+// wordSimilarity returns the Jaccard index of two word sets.
+func wordSimilarity(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	common := 0
+	for w := range a {
+		if b[w] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(a)+len(b)-common)
+}
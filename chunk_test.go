@@ -0,0 +1,93 @@
+package telegramify
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestChunkInfo 测试每个 Text 记录的序号、章节路径和哈希
+func TestChunkInfo(t *testing.T) {
+	md := "intro\n\n# Guide\n\ntext\n\n## Install\n\n" + strings.Repeat("step one two\n\n", 20) + "# Other\n\nend"
+	contents, err := Process(context.Background(), md, WithMaxMessageLength(120), WithSplitStrategy(SplitPerHeading))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var infos []ChunkInfo
+	for _, c := range contents {
+		info, ok := c.GetContentTrace().Chunk()
+		if !ok {
+			t.Fatalf("%#v has no chunk info", c)
+		}
+		infos = append(infos, info)
+	}
+	if len(infos) < 5 {
+		t.Fatalf("got %d chunks, want the install section split", len(infos))
+	}
+	for i, info := range infos {
+		if info.Index != i || info.Total != len(infos) || len(info.Hash) != 16 {
+			t.Errorf("chunk %d: %+v", i, info)
+		}
+	}
+	if infos[0].Section != nil {
+		t.Errorf("intro section = %q, want nil", infos[0].Section)
+	}
+	if want := []string{"Guide"}; !reflect.DeepEqual(infos[1].Section, want) {
+		t.Errorf("chunk 1 section = %q, want %q", infos[1].Section, want)
+	}
+	last := len(infos) - 1
+	if want := []string{"Other"}; !reflect.DeepEqual(infos[last].Section, want) {
+		t.Errorf("last section = %q, want %q", infos[last].Section, want)
+	}
+	install := 0
+	for _, info := range infos {
+		if reflect.DeepEqual(info.Section, []string{"Guide", "Install"}) {
+			if info.SectionIndex != install {
+				t.Errorf("install chunk %d has SectionIndex %d", install, info.SectionIndex)
+			}
+			install++
+		}
+	}
+	if install < 2 {
+		t.Errorf("%d chunks in Guide/Install, want several", install)
+	}
+}
+
+// TestMatchChunks 测试文档中间的章节修改后，未修改的章节一一对应，修改的章节被标记
+func TestMatchChunks(t *testing.T) {
+	section := func(title, body string) string {
+		return "## " + title + "\n\n" + body + "\n\n"
+	}
+	before := section("One", "first section text") + section("Two", "second section with some words") + section("Three", "third section text")
+	after := section("One", "first section text") + section("Two", "second section with some other words") + section("Three", "third section text")
+
+	process := func(md string) []Content {
+		contents, err := Process(context.Background(), md, WithSplitStrategy(SplitPerHeading))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return contents
+	}
+	old, updated := process(before), process(after)
+	want := []ChunkMatch{
+		{Old: 0, New: 0},
+		{Old: 1, New: 1, Changed: true},
+		{Old: 2, New: 2},
+	}
+	if got := MatchChunks(old, updated); !reflect.DeepEqual(got, want) {
+		t.Errorf("MatchChunks() = %+v, want %+v", got, want)
+	}
+
+	// 重命名的章节按内容相似度对应，删除的章节和新增的章节没有对应
+	renamed := section("One", "first section text") + section("Second", "second section with some words") + section("Four", "brand new content here")
+	want = []ChunkMatch{
+		{Old: 0, New: 0},
+		{Old: 1, New: 1, Changed: true},
+		{Old: -1, New: 2, Changed: true},
+		{Old: 2, New: -1, Changed: true},
+	}
+	if got := MatchChunks(old, process(renamed)); !reflect.DeepEqual(got, want) {
+		t.Errorf("MatchChunks() after renaming = %+v, want %+v", got, want)
+	}
+}
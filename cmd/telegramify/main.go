@@ -0,0 +1,229 @@
+// Command telegramify converts Markdown into Telegram-ready text and entities.
+//
+// It reads Markdown from a file argument or stdin and writes one of:
+//
+//	-format text      plain text of every message, separated by blank lines
+//	-format json      a JSON array with one object per produced item
+//	-format contents  every item written into the -out directory
+//
+// Usage:
+//
+//	telegramify [flags] [file.md]
+//
+// Exit status is 0 on success, 1 on failure, 2 on bad usage and 3 when the
+// conversion succeeded with warnings (entity diagnostics or a mermaid
+// diagram that fell back to a file).
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tg "github.com/riverfjs/telegramify-go"
+)
+
+const (
+	exitOK       = 0
+	exitFailure  = 1
+	exitUsage    = 2
+	exitWarnings = 3
+)
+
+func main() {
+	os.Exit(run(context.Background(), os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// jsonItem is the JSON shape of one produced item for -format json.
+type jsonItem struct {
+	Type     string             `json:"type"`
+	Text     string             `json:"text,omitempty"`
+	Entities []tg.MessageEntity `json:"entities,omitempty"`
+	FileName string             `json:"file_name,omitempty"`
+	Size     int                `json:"size,omitempty"`
+	Caption  string             `json:"caption,omitempty"`
+}
+
+// run executes the command with explicit IO so it can be tested in-process.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("telegramify", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	format := fs.String("format", "text", "output format: text, json or contents")
+	maxLength := fs.Int("max-length", 4096, "maximum UTF-16 length of each message")
+	latex := fs.Bool("latex", true, "convert LaTeX formulas to Unicode")
+	noMermaid := fs.Bool("no-mermaid", false, "do not render mermaid diagrams (no network access)")
+	outDir := fs.String("out", "", "output directory for -format contents")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	switch *format {
+	case "text", "json":
+	case "contents":
+		if *outDir == "" {
+			fmt.Fprintln(stderr, "telegramify: -format contents requires -out")
+			return exitUsage
+		}
+	default:
+		fmt.Fprintf(stderr, "telegramify: unknown -format %q\n", *format)
+		return exitUsage
+	}
+	if fs.NArg() > 1 {
+		fmt.Fprintln(stderr, "telegramify: at most one input file")
+		return exitUsage
+	}
+
+	input := stdin
+	if fs.NArg() == 1 {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			fmt.Fprintf(stderr, "telegramify: %v\n", err)
+			return exitFailure
+		}
+		defer f.Close()
+		input = f
+	}
+	markdown, err := io.ReadAll(input)
+	if err != nil {
+		fmt.Fprintf(stderr, "telegramify: read input: %v\n", err)
+		return exitFailure
+	}
+
+	config := tg.DefaultConfig()
+	config.Debug = true
+	contents, err := tg.Process(ctx, string(markdown),
+		tg.WithConfig(config),
+		tg.WithLatexEscape(*latex),
+		tg.WithMaxMessageLength(*maxLength),
+		tg.WithMermaid(!*noMermaid),
+	)
+	if err != nil {
+		fmt.Fprintf(stderr, "telegramify: %v\n", err)
+		return exitFailure
+	}
+
+	switch *format {
+	case "text":
+		err = writeText(stdout, contents)
+	case "json":
+		err = writeJSON(stdout, contents)
+	case "contents":
+		err = writeContents(*outDir, contents)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "telegramify: %v\n", err)
+		return exitFailure
+	}
+
+	if reportWarnings(stderr, contents) {
+		return exitWarnings
+	}
+	return exitOK
+}
+
+func writeText(w io.Writer, contents []tg.Content) error {
+	parts := make([]string, 0, len(contents))
+	for _, content := range contents {
+		switch c := content.(type) {
+		case *tg.Text:
+			parts = append(parts, c.Text)
+		case *tg.File:
+			parts = append(parts, fmt.Sprintf("[file %s, %d bytes]", c.FileName, c.DataSize()))
+		case *tg.Photo:
+			parts = append(parts, fmt.Sprintf("[photo %s, %d bytes]", c.FileName, len(c.FileData)))
+		}
+	}
+	_, err := fmt.Fprintln(w, strings.Join(parts, "\n\n"))
+	return err
+}
+
+func writeJSON(w io.Writer, contents []tg.Content) error {
+	items := make([]jsonItem, 0, len(contents))
+	for _, content := range contents {
+		item := jsonItem{Type: content.GetContentType().String()}
+		switch c := content.(type) {
+		case *tg.Text:
+			item.Text = c.Text
+			item.Entities = c.Entities
+		case *tg.File:
+			item.FileName = c.FileName
+			item.Size = int(c.DataSize())
+			item.Caption = c.CaptionText
+		case *tg.Photo:
+			item.FileName = c.FileName
+			item.Size = len(c.FileData)
+			item.Caption = c.CaptionText
+		}
+		items = append(items, item)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(items)
+}
+
+// writeContents writes every item into dir, prefixed with its position so
+// that the original order survives a directory listing.
+func writeContents(dir string, contents []tg.Content) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for i, content := range contents {
+		prefix := fmt.Sprintf("%03d-", i+1)
+		switch c := content.(type) {
+		case *tg.Text:
+			if err := os.WriteFile(filepath.Join(dir, prefix+"message.txt"), []byte(c.Text), 0o644); err != nil {
+				return err
+			}
+			data, err := json.MarshalIndent(c.Entities, "", "  ")
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(filepath.Join(dir, prefix+"message.entities.json"), data, 0o644); err != nil {
+				return err
+			}
+		case *tg.File:
+			if err := writeFile(filepath.Join(dir, prefix+filepath.Base(c.FileName)), c.Data()); err != nil {
+				return err
+			}
+		case *tg.Photo:
+			if err := os.WriteFile(filepath.Join(dir, prefix+filepath.Base(c.FileName)), c.FileData, 0o644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeFile streams r into a new file at path.
+func writeFile(path string, r io.Reader) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// reportWarnings prints non-fatal problems to w and reports whether any were found.
+func reportWarnings(w io.Writer, contents []tg.Content) bool {
+	found := false
+	for i, content := range contents {
+		for _, err := range content.GetContentTrace().Diagnostics() {
+			fmt.Fprintf(w, "warning: item %d: %v\n", i+1, err)
+			found = true
+		}
+		if f, ok := content.(*tg.File); ok && f.ContentTrace.SourceType == tg.ContentTypeMermaid {
+			fmt.Fprintf(w, "warning: item %d: mermaid diagram could not be rendered, sent as %s\n", i+1, f.FileName)
+			found = true
+		}
+	}
+	return found
+}
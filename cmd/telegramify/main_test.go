@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runCLI(t *testing.T, input string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, strings.NewReader(input), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun_TextFormat(t *testing.T) {
+	code, out, errOut := runCLI(t, "# Title\n\nHello **world**", "-no-mermaid")
+	if code != exitOK {
+		t.Fatalf("exit code = %d, want %d (stderr: %s)", code, exitOK, errOut)
+	}
+	if out != "📌 Title\n\nHello world\n" {
+		t.Errorf("stdout = %q", out)
+	}
+}
+
+func TestRun_JSONFormat(t *testing.T) {
+	code, out, _ := runCLI(t, "line one\n\nline **two**", "-format", "json", "-max-length", "10", "-no-mermaid")
+	if code != exitOK {
+		t.Fatalf("exit code = %d, want %d", code, exitOK)
+	}
+	var items []jsonItem
+	if err := json.Unmarshal([]byte(out), &items); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, out)
+	}
+	if len(items) != 2 {
+		t.Fatalf("got %d items, want 2: %+v", len(items), items)
+	}
+	if items[1].Type != "text" || items[1].Text != "line two" {
+		t.Errorf("items[1] = %+v", items[1])
+	}
+	if len(items[1].Entities) != 1 || items[1].Entities[0].Type != "bold" || items[1].Entities[0].Offset != 5 {
+		t.Errorf("items[1].Entities = %+v", items[1].Entities)
+	}
+}
+
+func TestRun_ContentsFormat(t *testing.T) {
+	code := "```go\n" + strings.Repeat("x := 1\n", 60) + "```"
+	dir := t.TempDir()
+	exit, _, errOut := runCLI(t, "intro\n\n"+code+"\n\noutro", "-format", "contents", "-out", dir, "-no-mermaid")
+	if exit != exitOK {
+		t.Fatalf("exit code = %d, want %d (stderr: %s)", exit, exitOK, errOut)
+	}
+	for _, name := range []string{"001-message.txt", "001-message.entities.json", "002-readable.go", "003-message.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("missing output %s: %v", name, err)
+		}
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "002-readable.go"))
+	if strings.Count(string(data), "x := 1") != 60 {
+		t.Errorf("extracted file has wrong content: %q", data)
+	}
+}
+
+func TestRun_InputFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "in.md")
+	if err := os.WriteFile(path, []byte("from *file*"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	code, out, _ := runCLI(t, "ignored stdin", path)
+	if code != exitOK || out != "from file\n" {
+		t.Errorf("code = %d, stdout = %q", code, out)
+	}
+}
+
+func TestRun_WarningsExitCode(t *testing.T) {
+	code, out, errOut := runCLI(t, "see [seventeen letters](tg://emoji?id=5368324170671202286)", "-no-mermaid")
+	if code != exitWarnings {
+		t.Fatalf("exit code = %d, want %d", code, exitWarnings)
+	}
+	if out != "see seventeen letters\n" {
+		t.Errorf("stdout = %q", out)
+	}
+	if !strings.Contains(errOut, "warning: item 1") {
+		t.Errorf("stderr = %q, want a warning for item 1", errOut)
+	}
+}
+
+func TestRun_Failures(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"unknown format", []string{"-format", "xml"}, exitUsage},
+		{"contents without out", []string{"-format", "contents"}, exitUsage},
+		{"bad flag", []string{"-nope"}, exitUsage},
+		{"missing file", []string{filepath.Join(t.TempDir(), "missing.md")}, exitFailure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _, _ := runCLI(t, "", tt.args...); code != tt.want {
+				t.Errorf("exit code = %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
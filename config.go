@@ -1,24 +1,64 @@
 package telegramify
 
 import (
-	"sync"
 	"github.com/riverfjs/telegramify-go/internal/types"
 )
 
 // 导出类型别名
 type Symbol = types.Symbol
 type RenderConfig = types.RenderConfig
+type MathDelimiters = types.MathDelimiters
+type UnknownLatexCommands = types.UnknownLatexCommands
+type LinkStyle = types.LinkStyle
+type Spacing = types.Spacing
+type CustomEmojiMode = types.CustomEmojiMode
+type LimitError = types.LimitError
 
-var (
-	defaultConfig     *RenderConfig
-	defaultConfigOnce sync.Once
+// MathDelimiters 取值
+const (
+	MathDelimitersKeep  = types.MathDelimitersKeep
+	MathDelimitersStrip = types.MathDelimitersStrip
+	MathDelimitersCode  = types.MathDelimitersCode
 )
 
-// DefaultConfig returns the default render configuration (singleton).
+// UnknownLatexCommands 取值
+const (
+	UnknownLatexCommandsKeep  = types.UnknownLatexCommandsKeep
+	UnknownLatexCommandsStrip = types.UnknownLatexCommandsStrip
+	UnknownLatexCommandsDrop  = types.UnknownLatexCommandsDrop
+)
+
+// LinkStyle 取值
+const (
+	LinkStyleEntity    = types.LinkStyleEntity
+	LinkStyleFootnote  = types.LinkStyleFootnote
+	LinkStyleInlineURL = types.LinkStyleInlineURL
+)
+
+// Spacing 取值
+const (
+	SpacingNormal  = types.SpacingNormal
+	SpacingCompact = types.SpacingCompact
+)
+
+// CustomEmojiMode 取值
+const (
+	CustomEmojiOn  = types.CustomEmojiOn
+	CustomEmojiOff = types.CustomEmojiOff
+)
+
+// RenderConfig 安全上限的默认值
+const (
+	DefaultMaxEntities     = types.DefaultMaxEntities
+	DefaultMaxNestingDepth = types.DefaultMaxNestingDepth
+	DefaultMaxOutputBytes  = types.DefaultMaxOutputBytes
+)
+
+// DefaultConfig returns a new copy of the default render configuration.
+//
+// Each call allocates a fresh RenderConfig and Symbol, so callers may modify
+// the result freely without affecting other goroutines. Use Clone to derive
+// several configurations from a customized one.
 func DefaultConfig() *RenderConfig {
-	defaultConfigOnce.Do(func() {
-		defaultConfig = types.DefaultRenderConfig()
-	})
-	return defaultConfig
+	return types.DefaultRenderConfig()
 }
-
@@ -1,5 +1,25 @@
 package telegramify
 
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	_ "golang.org/x/image/webp"
+
+	"github.com/riverfjs/telegramify-go/internal/util"
+)
+
+// previewEllipsis is appended to previews that were cut short.
+const previewEllipsis = "…"
+
 // ContentType represents the type of content.
 type ContentType int
 
@@ -28,14 +48,46 @@ func (ct ContentType) String() string {
 
 const (
 	ContentTypeMermaid = "mermaid"
+	// ContentTypeDuplicate is the ContentTrace.SourceType of the Text that
+	// DedupeReference puts in place of a repeated attachment.
+	ContentTypeDuplicate = "duplicate"
+	// ContentTypeOverflow is the ContentTrace.SourceType of the summary and
+	// the file that WithOverflow sends instead of a long split text.
+	ContentTypeOverflow = "overflow"
+	// ContentTypeTOC is the ContentTrace.SourceType of the table of contents
+	// generated by WithTOC.
+	ContentTypeTOC = "toc"
 )
 
+// TraceKeyDiagnostics is the ContentTrace.Extra key holding a []error of
+// problems found while producing the content (see RenderConfig.Debug).
+const TraceKeyDiagnostics = "diagnostics"
+
+// TraceKeyFrontMatter is the ContentTrace.Extra key holding the
+// map[string]string of top-level YAML front matter keys. It is set on the
+// first Text of a document that starts with front matter.
+const TraceKeyFrontMatter = "front_matter"
+
+// TraceKeyDuplicateOf is the ContentTrace.Extra key holding the file name of
+// the earlier attachment that a Text produced by DedupeReference stands for.
+const TraceKeyDuplicateOf = "duplicate_of"
+
+// TraceKeyDuplicates is the ContentTrace.Extra key holding the number of
+// later copies of an attachment that WithDedupe replaced or dropped.
+const TraceKeyDuplicates = "duplicates"
+
 // ContentTrace tracks the source and metadata of content.
 type ContentTrace struct {
 	SourceType string
 	Extra      map[string]interface{}
 }
 
+// Diagnostics returns the errors recorded under TraceKeyDiagnostics, if any.
+func (ct ContentTrace) Diagnostics() []error {
+	errs, _ := ct.Extra[TraceKeyDiagnostics].([]error)
+	return errs
+}
+
 // Content represents a piece of content ready to be sent via Telegram.
 type Content interface {
 	GetContentType() ContentType
@@ -59,15 +111,134 @@ func (t *Text) GetContentTrace() ContentTrace {
 	return t.ContentTrace
 }
 
+// Equal reports whether t and other have the same text and, as by
+// EntitiesEqual, the same entities. ContentTrace is not compared.
+func (t *Text) Equal(other *Text) bool {
+	if t == nil || other == nil {
+		return t == other
+	}
+	return t.Text == other.Text && EntitiesEqual(t.Entities, other.Entities)
+}
+
+// Preview returns the first maxRunes runes of the text for logs and
+// listings, followed by an ellipsis when the text is longer. The cut never
+// falls inside a character: emoji sequences and letters with combining marks
+// are kept whole or left out entirely.
+func (t *Text) Preview(maxRunes int) string {
+	return preview(t.Text, maxRunes, func(rune) int { return 1 }, false)
+}
+
+// PreviewUTF16 is like Preview but limits the preview to max UTF-16 code
+// units, the unit Telegram uses for message lengths.
+func (t *Text) PreviewUTF16(max int) string {
+	return preview(t.Text, max, utf16RuneLen, false)
+}
+
+// PreviewData returns the first n bytes of the file as text, cut at a
+// character boundary and followed by an ellipsis when the file is longer.
+// Invalid UTF-8 is replaced with U+FFFD, so binary data prints safely.
+// Only FileData is previewed; a FileReader is never consumed.
+func (f *File) PreviewData(n int) string {
+	data := f.FileData
+	truncated := false
+	if len(data) > n+utf8.UTFMax {
+		// one extra rune is enough to tell whether the cut splits a character
+		data, truncated = data[:n+utf8.UTFMax], true
+	}
+	return preview(strings.ToValidUTF8(string(data), "\uFFFD"), n, utf8.RuneLen, truncated)
+}
+
+// preview cuts s at the last cluster boundary where the summed width of the
+// runes before it is at most limit. truncated forces the ellipsis for input
+// that was already shortened by the caller.
+func preview(s string, limit int, width func(rune) int, truncated bool) string {
+	used, cut := 0, 0
+	prev := rune(-1)
+	for i, r := range s {
+		if prev < 0 || !util.ContinuesCluster(prev, r) {
+			cut = i
+		}
+		if used += width(r); used > limit {
+			return strings.TrimRight(s[:cut], " \t\n") + previewEllipsis
+		}
+		prev = r
+	}
+	if truncated {
+		return strings.TrimRight(s, " \t\n") + previewEllipsis
+	}
+	return s
+}
+
+// utf16RuneLen returns the number of UTF-16 code units needed to encode r.
+func utf16RuneLen(r rune) int {
+	if r > 0xFFFF {
+		return 2
+	}
+	return 1
+}
+
+// MaxJSONFileSize is the largest FileReader payload, in bytes, that
+// File.MarshalJSON materializes. It matches Telegram's upload limit for bots.
+const MaxJSONFileSize = 50 << 20
+
 // File represents a file attachment.
+//
+// The payload is either FileData or, for large files produced by pipeline
+// extensions, FileReader, which takes precedence when set. Size is a hint of
+// the payload length in bytes; zero means unknown for a reader. Use Data and
+// DataSize to handle both representations.
 type File struct {
 	FileName        string
 	FileData        []byte
+	FileReader      io.Reader
+	Size            int64
 	CaptionText     string
 	CaptionEntities []MessageEntity
 	ContentTrace    ContentTrace
 }
 
+// Data returns the payload as a reader: FileReader when set, otherwise a
+// reader over FileData. A FileReader can be read only once.
+func (f *File) Data() io.Reader {
+	if f.FileReader != nil {
+		return f.FileReader
+	}
+	return bytes.NewReader(f.FileData)
+}
+
+// DataSize returns the payload length in bytes: Size when set, otherwise
+// the length of FileData. It returns 0 for a reader of unknown size.
+func (f *File) DataSize() int64 {
+	if f.Size > 0 || f.FileReader != nil {
+		return f.Size
+	}
+	return int64(len(f.FileData))
+}
+
+// MarshalJSON encodes the file like a plain struct, with FileData in base64.
+// A FileReader is read into FileData of the encoded copy, so the output has
+// the same shape for both representations; the File itself is not modified,
+// but its reader is consumed. A reader longer than MaxJSONFileSize is an
+// error.
+func (f *File) MarshalJSON() ([]byte, error) {
+	type plainFile File // drops the MarshalJSON method
+	out := plainFile(*f)
+	if out.FileReader != nil {
+		if out.Size > MaxJSONFileSize {
+			return nil, fmt.Errorf("telegramify: file %q is %d bytes, more than MaxJSONFileSize", out.FileName, out.Size)
+		}
+		data, err := io.ReadAll(io.LimitReader(out.FileReader, MaxJSONFileSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("telegramify: reading file %q: %w", out.FileName, err)
+		}
+		if len(data) > MaxJSONFileSize {
+			return nil, fmt.Errorf("telegramify: file %q is more than MaxJSONFileSize bytes", out.FileName)
+		}
+		out.FileData, out.FileReader, out.Size = data, nil, int64(len(data))
+	}
+	return json.Marshal(out)
+}
+
 // GetContentType returns ContentTypeFile.
 func (f *File) GetContentType() ContentType {
 	return ContentTypeFile
@@ -79,13 +250,52 @@ func (f *File) GetContentTrace() ContentTrace {
 }
 
 // Photo represents a photo attachment.
+//
+// Width, Height and MIME describe the decoded image and are zero when the
+// data could not be decoded (or, in a Plan, was not downloaded).
 type Photo struct {
 	FileName        string
 	FileData        []byte
-	Caption         string
 	CaptionText     string
 	CaptionEntities []MessageEntity
+	Width           int
+	Height          int
+	MIME            string
 	ContentTrace    ContentTrace
+
+	// Caption mirrors CaptionText.
+	//
+	// Deprecated: Use CaptionText, or GetCaption to read a Photo that may have
+	// been built with only Caption set. The pipeline and SetCaption keep both
+	// fields in sync.
+	Caption string
+}
+
+// SetCaption sets the caption text and entities, mirroring the text into the
+// deprecated Caption field.
+func (p *Photo) SetCaption(text string, entities []MessageEntity) {
+	p.CaptionText = text
+	p.CaptionEntities = entities
+	p.Caption = text
+}
+
+// GetCaption returns CaptionText, falling back to the deprecated Caption for
+// photos built by older code.
+func (p *Photo) GetCaption() string {
+	if p.CaptionText != "" {
+		return p.CaptionText
+	}
+	return p.Caption
+}
+
+// decodeDimensions fills Width, Height and MIME from the image header in
+// FileData. Data that is not a known image format leaves them zero.
+func (p *Photo) decodeDimensions() {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(p.FileData))
+	if err != nil {
+		return
+	}
+	p.Width, p.Height, p.MIME = cfg.Width, cfg.Height, "image/"+format
 }
 
 // GetContentType returns ContentTypePhoto.
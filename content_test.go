@@ -0,0 +1,197 @@
+package telegramify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// TestText_Preview 测试预览在字符边界截断并追加省略号
+func TestText_Preview(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		max  int
+		want string
+	}{
+		{"short text unchanged", "hello", 10, "hello"},
+		{"exact length unchanged", "hello", 5, "hello"},
+		{"ascii", "hello world", 5, "hello…"},
+		{"trailing space trimmed", "hello world", 6, "hello…"},
+		{"cjk", "你好世界，欢迎", 4, "你好世界…"},
+		{"emoji", "ok 🎉🎉🎉", 4, "ok 🎉…"},
+		{"zwj sequence kept whole", "ab\U0001F468\u200d\U0001F469\u200d\U0001F467cd", 4, "ab…"},
+		{"zwj sequence fits", "ab\U0001F468\u200d\U0001F469\u200d\U0001F467cd", 7, "ab\U0001F468\u200d\U0001F469\u200d\U0001F467…"},
+		{"combining mark at cut", "cafe\u0301 au lait", 4, "caf…"},
+		{"variation selector at cut", "ok \u2611\ufe0f done", 4, "ok…"},
+		{"zero", "hello", 0, "…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (&Text{Text: tt.text}).Preview(tt.max); got != tt.want {
+				t.Errorf("Preview(%d) = %q, want %q", tt.max, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestText_PreviewUTF16 测试按 UTF-16 长度截断时不拆开代理对
+func TestText_PreviewUTF16(t *testing.T) {
+	text := &Text{Text: "a😀b"}
+	for max, want := range map[int]string{1: "a…", 2: "a…", 3: "a😀…", 4: "a😀b"} {
+		if got := text.PreviewUTF16(max); got != want {
+			t.Errorf("PreviewUTF16(%d) = %q, want %q", max, got, want)
+		}
+	}
+}
+
+// TestFile_PreviewData 测试文件预览不截断多字节字符并替换非法字节
+func TestFile_PreviewData(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		n    int
+		want string
+	}{
+		{"short", []byte("print(1)"), 20, "print(1)"},
+		{"ascii", []byte("print(1)\nprint(2)"), 8, "print(1)…"},
+		{"cut inside rune", []byte("ab世界"), 4, "ab…"},
+		{"cut inside long file", []byte("ab世界" + "0123456789"), 6, "ab世…"},
+		{"invalid bytes", []byte{'o', 'k', 0xff, 0xfe, '!'}, 10, "ok�!"},
+		{"binary cut", []byte{0x89, 'P', 'N', 'G', 0, 0, 0, 0, 0, 0, 0, 0}, 3, "�…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (&File{FileData: tt.data}).PreviewData(tt.n); got != tt.want {
+				t.Errorf("PreviewData(%d) = %q, want %q", tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestText_Equal 测试 Text 比较文本和实体，忽略 ContentTrace
+func TestText_Equal(t *testing.T) {
+	a := &Text{
+		Text:         "bold link",
+		Entities:     []MessageEntity{{Type: EntityBold, Offset: 0, Length: 4}, {Type: EntityTextLink, Offset: 5, Length: 4, URL: "https://example.com"}},
+		ContentTrace: ContentTrace{SourceType: "text"},
+	}
+	b := &Text{
+		Text:     "bold link",
+		Entities: []MessageEntity{{Type: EntityTextLink, Offset: 5, Length: 4, URL: "https://example.com"}, {Type: EntityBold, Offset: 0, Length: 4}},
+	}
+	if !a.Equal(b) {
+		t.Error("Equal() = false for reordered entities")
+	}
+	if a.Equal(&Text{Text: "bold link"}) {
+		t.Error("Equal() = true with entities missing")
+	}
+	if a.Equal(&Text{Text: "bold  link", Entities: a.Entities}) {
+		t.Error("Equal() = true for different text")
+	}
+	if a.Equal(nil) || !(*Text)(nil).Equal(nil) {
+		t.Error("Equal() mishandles nil")
+	}
+}
+
+// TestPhoto_Dimensions 测试渲染后的图片带有尺寸和 MIME，且已弃用的 Caption 仍可读取
+func TestPhoto_Dimensions(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 120, 45))); err != nil {
+		t.Fatal(err)
+	}
+	saved := renderMermaid
+	renderMermaid = func(ctx context.Context, code string) (*bytes.Buffer, string, error) {
+		return bytes.NewBuffer(buf.Bytes()), "https://mermaid.live/edit#x", nil
+	}
+	defer func() { renderMermaid = saved }()
+
+	contents, err := Process(context.Background(), "```mermaid\ngraph TD\n  A-->B\n```")
+	if err != nil {
+		t.Fatal(err)
+	}
+	photo, ok := contents[0].(*Photo)
+	if !ok {
+		t.Fatalf("contents[0] = %#v, want a Photo", contents[0])
+	}
+	if photo.Width != 120 || photo.Height != 45 || photo.MIME != "image/png" {
+		t.Errorf("dimensions = %dx%d %q, want 120x45 \"image/png\"", photo.Width, photo.Height, photo.MIME)
+	}
+	if photo.CaptionText != "https://mermaid.live/edit#x" || photo.Caption != photo.CaptionText {
+		t.Errorf("CaptionText = %q, Caption = %q", photo.CaptionText, photo.Caption)
+	}
+
+	legacy := &Photo{Caption: "old"}
+	if got := legacy.GetCaption(); got != "old" {
+		t.Errorf("GetCaption() = %q, want the deprecated Caption", got)
+	}
+	legacy.SetCaption("new", nil)
+	if legacy.Caption != "new" || legacy.GetCaption() != "new" {
+		t.Errorf("after SetCaption: Caption = %q, GetCaption() = %q", legacy.Caption, legacy.GetCaption())
+	}
+
+	garbage := &Photo{FileData: []byte("not an image")}
+	garbage.decodeDimensions()
+	if garbage.Width != 0 || garbage.MIME != "" {
+		t.Errorf("undecodable data got dimensions %dx%d %q", garbage.Width, garbage.Height, garbage.MIME)
+	}
+}
+
+// zeroReader 无限输出零字节
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// TestFile_Reader 测试 FileData 与 FileReader 两种载荷表示以及 JSON 大小上限
+func TestFile_Reader(t *testing.T) {
+	inMemory := &File{FileName: "a.txt", FileData: []byte("hello"), Size: 5, ContentTrace: ContentTrace{SourceType: "code_block"}}
+	streamed := &File{FileName: "a.txt", FileReader: strings.NewReader("hello"), Size: 5, ContentTrace: ContentTrace{SourceType: "code_block"}}
+	for _, f := range []*File{inMemory, streamed} {
+		if f.DataSize() != 5 {
+			t.Errorf("DataSize() = %d, want 5", f.DataSize())
+		}
+	}
+	want, err := json.Marshal(inMemory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{`"FileName":"a.txt"`, `"FileData":"aGVsbG8="`, `"Size":5`, `"ContentTrace":{`} {
+		if !strings.Contains(string(want), key) {
+			t.Errorf("MarshalJSON() = %s, want it to contain %s", want, key)
+		}
+	}
+	got, err := json.Marshal(streamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("MarshalJSON() of a reader = %s, want %s", got, want)
+	}
+	if streamed.FileReader == nil || streamed.FileData != nil {
+		t.Errorf("MarshalJSON() modified the File: %+v", streamed)
+	}
+
+	unknown := &File{FileReader: strings.NewReader("abc")}
+	if unknown.DataSize() != 0 {
+		t.Errorf("DataSize() of a reader without a hint = %d, want 0", unknown.DataSize())
+	}
+	if data, err := json.Marshal(unknown); err != nil || !strings.Contains(string(data), `"Size":3`) {
+		t.Errorf("MarshalJSON() = %s, %v", data, err)
+	}
+
+	hinted := &File{FileName: "big.log", FileReader: zeroReader{}, Size: MaxJSONFileSize + 1}
+	if _, err := json.Marshal(hinted); err == nil || !strings.Contains(err.Error(), "MaxJSONFileSize") {
+		t.Errorf("MarshalJSON() of an oversized hint: err = %v", err)
+	}
+	endless := &File{FileName: "big.log", FileReader: zeroReader{}}
+	if _, err := json.Marshal(endless); err == nil || !strings.Contains(err.Error(), "MaxJSONFileSize") {
+		t.Errorf("MarshalJSON() of an oversized reader: err = %v", err)
+	}
+}
@@ -1,11 +1,33 @@
 package telegramify
 
 import (
+	"bytes"
+	"context"
+	"log/slog"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"golang.org/x/text/unicode/norm"
+
 	"github.com/riverfjs/telegramify-go/internal/converter"
 	"github.com/riverfjs/telegramify-go/internal/latex"
 	"github.com/riverfjs/telegramify-go/internal/parser"
 )
 
+// Segment 记录转换结果中代码块或 Mermaid 图的位置信息
+//
+// Kind 为 SegmentCodeBlock 或 SegmentMermaid，TextStart/TextEnd 与 UTF16Start/UTF16End
+// 是代码在转换结果中的范围，SourceStart/SourceEnd 是代码块在原文中的字节范围。
+type Segment = converter.Segment
+
+// Segment.Kind 的取值
+const (
+	SegmentCodeBlock = converter.SegmentCodeBlock
+	SegmentMermaid   = converter.SegmentMermaid
+)
+
 // Convert 将 Markdown 转换为 (plain_text, entities) 用于 Telegram
 //
 // 参数:
@@ -15,7 +37,7 @@ import (
 //
 // 返回:
 //   - string: 纯文本
-//   - []MessageEntity: 实体列表
+//   - []MessageEntity: 实体列表，按 NormalizeEntities 的顺序排列
 func Convert(markdown string, latexEscape bool, config *RenderConfig) (string, []MessageEntity) {
 	text, entities, _ := ConvertWithSegments(markdown, latexEscape, config)
 	return text, entities
@@ -32,23 +54,317 @@ func Convert(markdown string, latexEscape bool, config *RenderConfig) (string, [
 //
 // 返回:
 //   - string: 纯文本
-//   - []MessageEntity: 实体列表
-//   - []converter.Segment: 代码块/Mermaid 片段信息
-func ConvertWithSegments(markdown string, latexEscape bool, config *RenderConfig) (string, []MessageEntity, []converter.Segment) {
+//   - []MessageEntity: 实体列表，按 NormalizeEntities 的顺序排列
+//   - []Segment: 代码块/Mermaid 片段信息
+func ConvertWithSegments(markdown string, latexEscape bool, config *RenderConfig) (string, []MessageEntity, []Segment) {
+	return convertBytes([]byte(markdown), latexEscape, config)
+}
+
+// ConvertE 与 Convert 相同，但转换中发生的 panic 以 *PanicError 返回，
+// 不会传递给调用方
+//
+// Convert 遇到 panic 时记录日志后继续 panic，保持原有行为。
+func ConvertE(markdown string, latexEscape bool, config *RenderConfig) (string, []MessageEntity, error) {
+	return defaultConverter().convertE([]byte(markdown), latexEscape, config)
+}
+
+// ConvertAST 将已解析的 goldmark AST 转换为 (plain_text, entities, segments)
+//
+// 供已经用 goldmark 解析过文档（例如同时渲染 HTML）的调用方使用，避免重复解析。
+// node 必须由 source 解析得到，解析器应启用与 StandardOptions 相同的扩展
+// （GFM、定义列表、脚注）；缺少的扩展对应的语法按普通文本处理，
+// 额外扩展产生的未知节点只转换其子节点，不会出错。
+//
+// 由于 AST 已经生成，LaTeX 转换、剧透和可展开引用标记、front matter
+// 等基于源文本的预处理不会执行，其余渲染与 Convert 相同。
+//
+// 参数:
+//   - node: source 的 AST 根节点
+//   - source: 解析 node 所用的原文
+//   - config: 渲染配置，如为 nil 则使用默认配置
+func ConvertAST(node ast.Node, source []byte, config *RenderConfig) (string, []MessageEntity, []Segment) {
+	return defaultConverter().convertAST(node, source, config)
+}
+
+// StandardOptions 返回 Convert 解析 Markdown 时使用的 goldmark 选项，
+// 供 ConvertAST 的调用方构建相同配置的解析器。
+// 要更改 Converter 和 Process 的解析器配置，使用 WithGoldmarkOptions
+func StandardOptions() []goldmark.Option {
+	return append([]goldmark.Option(nil), parser.StandardOptions...)
+}
+
+// convertBytes 是 ConvertWithSegments 的 []byte 实现，使用默认 Converter
+func convertBytes(source []byte, latexEscape bool, config *RenderConfig) (string, []MessageEntity, []Segment) {
+	return defaultConverter().convertBytes(source, latexEscape, config)
+}
+
+// Converter 是可复用的转换器
+//
+// 它在内部池化 goldmark 解析器、EventWalker 缓冲区和 LaTeX 解析器，
+// 避免每次转换都重新构建扩展管道。Converter 可以被多个 goroutine 并发使用。
+type Converter struct {
+	options *ConvertOptions
+	parsers sync.Pool // *parser.Parser
+	latex   sync.Pool // *latex.Parser
+
+	symbolPresets converterPresets // RegisterSymbolPreset 注册的符号预设
+}
+
+// NewConverter 使用给定选项创建 Converter
+//
+// WithGoldmarkOptions 和 WithStandardOptions 决定该 Converter 的 goldmark 解析器配置。
+func NewConverter(opts ...Option) *Converter {
+	return newConverter(applyOptions(opts...))
+}
+
+// newConverter 使用已应用的选项创建 Converter
+func newConverter(options *ConvertOptions) *Converter {
+	c := &Converter{options: options}
+	goldmarkOptions := options.goldmarkOptions()
+	c.parsers.New = func() interface{} { return parser.NewWithOptions(goldmarkOptions...) }
+	c.latex.New = func() interface{} { return latex.NewParser() }
+	return c
+}
+
+var (
+	defaultConverterOnce sync.Once
+	defaultConverterInst *Converter
+)
+
+// defaultConverter 返回包级函数共用的 Converter，首次使用时创建
+func defaultConverter() *Converter {
+	defaultConverterOnce.Do(func() {
+		defaultConverterInst = NewConverter()
+	})
+	return defaultConverterInst
+}
+
+// converterFor 返回按 options 配置解析器的 Converter：没有自定义 goldmark 选项时
+// 使用默认 Converter，否则为这次调用创建新的 Converter
+func converterFor(options *ConvertOptions) *Converter {
+	if !options.customParser() {
+		return defaultConverter()
+	}
+	return newConverter(options)
+}
+
+// Convert 与包级 Convert 相同，使用创建 Converter 时的选项
+func (c *Converter) Convert(markdown string) (string, []MessageEntity) {
+	text, entities, _ := c.ConvertWithSegments(markdown)
+	return text, entities
+}
+
+// ConvertWithSegments 与包级 ConvertWithSegments 相同，使用创建 Converter 时的选项
+func (c *Converter) ConvertWithSegments(markdown string) (string, []MessageEntity, []Segment) {
+	return c.convertBytes([]byte(markdown), c.options.LatexEscape, c.options.Config)
+}
+
+// LanguageExtensions 返回该 Converter 提取代码块时使用的语言到扩展名映射（副本）
+func (c *Converter) LanguageExtensions() map[string]string {
+	return mergeLanguageExtensions(c.options.LanguageExtensions)
+}
+
+// ConvertE 与包级 ConvertE 相同，使用创建 Converter 时的选项
+func (c *Converter) ConvertE(markdown string) (string, []MessageEntity, error) {
+	return c.convertE([]byte(markdown), c.options.LatexEscape, c.options.Config)
+}
+
+// ConvertAST 与包级 ConvertAST 相同，使用创建 Converter 时的配置
+func (c *Converter) ConvertAST(node ast.Node, source []byte) (string, []MessageEntity, []Segment) {
+	return c.convertAST(node, source, c.options.Config)
+}
+
+// Process 与包级 Process 相同，使用创建 Converter 时的选项
+func (c *Converter) Process(ctx context.Context, content string) ([]Content, error) {
+	return c.processMarkdown(ctx, []byte(content), c.options)
+}
+
+// convertBytes 不需要预处理时直接解析 source，不再复制；返回值不引用 source
+func (c *Converter) convertBytes(source []byte, latexEscape bool, config *RenderConfig) (string, []MessageEntity, []Segment) {
+	logger := resolveLogger(c.options.Logger)
+	defer logPanic(logger)
+	doc := c.convertDocument(source, latexEscape, config)
+	// Convert 无法返回错误，超出安全上限时总是保留已生成的部分
+	doc.logLimit(context.Background(), logger)
+	return doc.text, doc.entities, doc.segments
+}
+
+// convertE 与 convertBytes 相同，panic 转换为错误返回
+func (c *Converter) convertE(source []byte, latexEscape bool, config *RenderConfig) (text string, entities []MessageEntity, err error) {
+	defer recoverPanic(&err)
+	if config != nil {
+		if err := config.MarkdownSymbol.Validate(); err != nil {
+			return "", nil, err
+		}
+	}
+	doc := c.convertDocument(source, latexEscape, config)
+	if err := doc.limitError(config); err != nil {
+		return "", nil, err
+	}
+	return doc.text, doc.entities, nil
+}
+
+// document 是一次转换的完整结果
+type document struct {
+	text        string
+	entities    []MessageEntity
+	segments    []Segment
+	headings    []converter.Heading     // 文档顶层标题
+	dropped     []converter.DroppedLink // 地址不可用、只渲染为文字的链接
+	droppedHTML []string                // HTML 块中被丢弃的元素的标签名
+	images      int                     // 图片数量
+	frontMatter map[string]string       // 从 front matter 解析出的键值，没有时为 nil
+	limit       *LimitError             // 超出的安全上限，此时结果只有停止遍历前的部分
+}
+
+// convertDocument 与 convertBytes 相同，另外返回标题和 front matter 等管道需要的信息
+func (c *Converter) convertDocument(source []byte, latexEscape bool, config *RenderConfig) document {
 	if config == nil {
 		config = DefaultConfig()
 	}
 	
 	// 预处理
-	preprocessed := markdown
-	if latexEscape {
-		latexHelper := latex.NewParser()
-		preprocessed = converter.EscapeLatex(preprocessed, latexHelper)
-	}
-	preprocessed = converter.PreprocessSpoilers(preprocessed)
+	var offsets converter.OffsetMap
+	var doc document
+	original := source
+	source, doc.frontMatter = c.preprocess(source, latexEscape, config, &offsets)
 	
 	// 解析（类型已通过别名统一）
-	text, entities, segments := parser.Parse(preprocessed, config)
-	return text, entities, segments
+	p := c.parsers.Get().(*parser.Parser)
+	doc.text, doc.entities, doc.segments = p.Parse(source, config)
+	doc.headings = p.Headings()
+	doc.dropped = p.DroppedLinks()
+	doc.droppedHTML = p.DroppedHTML()
+	doc.images = p.Images()
+	doc.limit = p.Limit()
+	c.parsers.Put(p)
+	doc.finish(config)
+	
+	// 片段的源位置还原到用户原文；代码按原文的换行符还原，提取的文件与原文逐字节一致
+	crlf := bytes.IndexByte(original, '\r') >= 0
+	for i := range doc.segments {
+		seg := &doc.segments[i]
+		if seg.SourceStart >= 0 {
+			seg.SourceStart = offsets.ToOriginal(seg.SourceStart)
+			seg.SourceEnd = offsets.ToOriginal(seg.SourceEnd)
+			if crlf {
+				seg.RawCode = converter.RestoreCRLF(seg.RawCode, string(original[seg.SourceStart:seg.SourceEnd]))
+			}
+		}
+	}
+	return doc
+}
+
+// convertAST 遍历调用方解析好的 AST，不做预处理
+func (c *Converter) convertAST(node ast.Node, source []byte, config *RenderConfig) (string, []MessageEntity, []Segment) {
+	defer logPanic(resolveLogger(c.options.Logger))
+	if config == nil {
+		config = DefaultConfig()
+	}
+	var doc document
+	p := c.parsers.Get().(*parser.Parser)
+	doc.text, doc.entities, doc.segments = p.Walk(node, source, config)
+	doc.headings = p.Headings()
+	c.parsers.Put(p)
+	doc.finish(config)
+	return doc.text, doc.entities, doc.segments
+}
+
+// limitError 返回超出安全上限时应报告的错误；未超出或 TruncateOnLimit 时为 nil
+func (doc *document) limitError(config *RenderConfig) error {
+	if doc.limit == nil || (config != nil && config.TruncateOnLimit) {
+		return nil
+	}
+	return doc.limit
 }
 
+// logLimit 在结果因安全上限被截断时记录 Warn 日志
+func (doc *document) logLimit(ctx context.Context, logger *slog.Logger) {
+	if doc.limit != nil {
+		logger.WarnContext(ctx, "output truncated at safety limit", "limit", doc.limit.Limit, "max", doc.limit.Max)
+	}
+}
+
+// finish 对遍历结果做空白整理和实体排序
+func (doc *document) finish(config *RenderConfig) {
+	if config.TrimTrailingSpaces {
+		doc.text, doc.entities, doc.segments, doc.headings = converter.TrimTrailingSpaces(doc.text, doc.entities, doc.segments, doc.headings)
+	}
+	doc.text, doc.entities, doc.segments, doc.headings = converter.CollapseBlankLines(doc.text, doc.entities, doc.segments, doc.headings)
+	if config.MergeEntities {
+		doc.entities = MergeEntities(doc.entities)
+	} else {
+		NormalizeEntities(doc.entities)
+	}
+}
+
+// preprocess 依次执行各预处理步骤，返回改写后的 source 和 front matter 键值
+//
+// 每一步都先做廉价检查，无需改写时原样返回 source，避免整份文本的复制。
+// 各步骤的改写记录到 offsets。
+func (c *Converter) preprocess(source []byte, latexEscape bool, config *RenderConfig, offsets *converter.OffsetMap) ([]byte, map[string]string) {
+	if !utf8.Valid(source) {
+		source = []byte(converter.ReplaceInvalidUTF8(string(source), offsets))
+	}
+	// 换行统一为 \n，其余步骤和切分都只识别 \n
+	if bytes.HasPrefix(source, []byte("\ufeff")) {
+		source = []byte(converter.StripBOM(string(source), offsets))
+	}
+	if bytes.IndexByte(source, '\r') >= 0 {
+		source = []byte(converter.NormalizeLineEndings(string(source), offsets))
+	}
+	if config.NormalizeNFC && !norm.NFC.IsNormal(source) {
+		source = []byte(converter.NormalizeNFC(string(source), config.NormalizeNFCSkipCode, offsets))
+	}
+	var frontMatter map[string]string
+	if bytes.HasPrefix(bytes.TrimPrefix(source, []byte("\ufeff")), []byte("---\n")) {
+		var stripped string
+		stripped, frontMatter = converter.StripFrontMatter(string(source), config.FrontMatterHeading, offsets)
+		source = []byte(stripped)
+	}
+	if latexEscape && containsLatex(source) {
+		latexHelper := c.latex.Get().(*latex.Parser)
+		latexHelper.UnknownCommands = unknownCommandMode(config.UnknownLatexCommands)
+		source = []byte(converter.EscapeLatex(string(source), latexHelper, mathStyle(config), offsets))
+		c.latex.Put(latexHelper)
+	}
+	if bytes.Contains(source, []byte("**>")) || bytes.Contains(source, []byte("||")) ||
+		bytes.Contains(bytes.ToLower(source), []byte("<blockquote expandable>")) {
+		source = []byte(converter.PreprocessExpandableQuotes(string(source), offsets))
+	}
+	if bytes.Contains(source, []byte("||")) {
+		source = []byte(converter.PreprocessSpoilers(string(source), offsets))
+	}
+	return source, frontMatter
+}
+
+// containsLatex 判断 source 中是否可能有需要 EscapeLatex 处理的内容：
+// 公式定界符，或者 \textbf 这类文本样式命令
+func containsLatex(source []byte) bool {
+	return bytes.Contains(source, []byte(`\(`)) ||
+		bytes.Contains(source, []byte(`\[`)) ||
+		bytes.IndexByte(source, '$') >= 0 ||
+		bytes.Contains(source, []byte(`\text`)) ||
+		bytes.Contains(source, []byte(`\emph{`)) ||
+		bytes.Contains(source, []byte(`\underline{`))
+}
+
+// mathStyle 返回 EscapeLatex 使用的公式呈现方式
+func mathStyle(config *RenderConfig) converter.MathStyle {
+	return converter.MathStyle{
+		Delimiters: config.MathDelimiters,
+		Inline:     config.MathEntity != "",
+		Block:      config.MathBlockEntity != "",
+	}
+}
+
+// unknownCommandMode 将配置值映射为 LaTeX 解析器的未知命令模式
+func unknownCommandMode(mode UnknownLatexCommands) latex.UnknownCommandMode {
+	switch mode {
+	case UnknownLatexCommandsStrip:
+		return latex.UnknownStrip
+	case UnknownLatexCommandsDrop:
+		return latex.UnknownDrop
+	}
+	return latex.UnknownKeep
+}
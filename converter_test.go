@@ -1,8 +1,24 @@
 package telegramify
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/riverfjs/telegramify-go/internal/parser"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	gmparser "github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
 )
 
 // findEntity 查找指定类型的第一个 entity
@@ -28,30 +44,7 @@ func findEntities(entities []MessageEntity, etype string) []MessageEntity {
 
 // extractEntityText 从纯文本中提取 entity 覆盖的子串
 func extractEntityText(text string, entity *MessageEntity) string {
-	utf16Offset := 0
-	pyStart := -1
-	pyEnd := -1
-	for i, ch := range text {
-		if utf16Offset == entity.Offset && pyStart == -1 {
-			pyStart = i
-		}
-		if utf16Offset == entity.Offset+entity.Length && pyEnd == -1 {
-			pyEnd = i
-			break
-		}
-		if ch > 0xFFFF {
-			utf16Offset += 2
-		} else {
-			utf16Offset++
-		}
-	}
-	if pyStart != -1 && pyEnd == -1 {
-		pyEnd = len(text)
-	}
-	if pyStart == -1 {
-		return ""
-	}
-	return text[pyStart:pyEnd]
+	return EntityText(text, *entity)
 }
 
 // TestBold_Simple 测试简单的粗体
@@ -60,7 +53,7 @@ func TestBold_Simple(t *testing.T) {
 	if !strings.Contains(text, "hello") {
 		t.Errorf("Convert() text should contain 'hello'")
 	}
-	bold := findEntity(entities, "bold")
+	bold := findEntity(entities, EntityBold)
 	if bold == nil {
 		t.Fatal("Convert() should have bold entity")
 	}
@@ -72,7 +65,7 @@ func TestBold_Simple(t *testing.T) {
 // TestBold_InSentence 测试句子中的粗体
 func TestBold_InSentence(t *testing.T) {
 	text, entities := Convert("foo **bar** baz", false, nil)
-	bold := findEntity(entities, "bold")
+	bold := findEntity(entities, EntityBold)
 	if bold == nil {
 		t.Fatal("Convert() should have bold entity")
 	}
@@ -84,7 +77,7 @@ func TestBold_InSentence(t *testing.T) {
 // TestItalic_Simple 测试简单的斜体
 func TestItalic_Simple(t *testing.T) {
 	text, entities := Convert("*hello*", false, nil)
-	italic := findEntity(entities, "italic")
+	italic := findEntity(entities, EntityItalic)
 	if italic == nil {
 		t.Fatal("Convert() should have italic entity")
 	}
@@ -96,7 +89,7 @@ func TestItalic_Simple(t *testing.T) {
 // TestStrikethrough_Simple 测试简单的删除线
 func TestStrikethrough_Simple(t *testing.T) {
 	text, entities := Convert("~~hello~~", false, nil)
-	s := findEntity(entities, "strikethrough")
+	s := findEntity(entities, EntityStrikethrough)
 	if s == nil {
 		t.Fatal("Convert() should have strikethrough entity")
 	}
@@ -108,8 +101,8 @@ func TestStrikethrough_Simple(t *testing.T) {
 // TestNestedFormatting_BoldItalic 测试嵌套格式
 func TestNestedFormatting_BoldItalic(t *testing.T) {
 	text, entities := Convert("**bold *italic* bold**", false, nil)
-	bold := findEntity(entities, "bold")
-	italic := findEntity(entities, "italic")
+	bold := findEntity(entities, EntityBold)
+	italic := findEntity(entities, EntityItalic)
 	if bold == nil {
 		t.Fatal("Convert() should have bold entity")
 	}
@@ -131,7 +124,7 @@ func TestNestedFormatting_BoldItalic(t *testing.T) {
 // TestInlineCode 测试行内代码
 func TestInlineCode(t *testing.T) {
 	text, entities := Convert("use `print()` here", false, nil)
-	code := findEntity(entities, "code")
+	code := findEntity(entities, EntityCode)
 	if code == nil {
 		t.Fatal("Convert() should have code entity")
 	}
@@ -144,7 +137,7 @@ func TestInlineCode(t *testing.T) {
 func TestCodeBlock_Fenced(t *testing.T) {
 	md := "```python\nprint('hello')\n```"
 	text, entities := Convert(md, false, nil)
-	pre := findEntity(entities, "pre")
+	pre := findEntity(entities, EntityPre)
 	if pre == nil {
 		t.Fatal("Convert() should have pre entity")
 	}
@@ -161,7 +154,7 @@ func TestCodeBlock_Fenced(t *testing.T) {
 func TestCodeBlock_NoLanguage(t *testing.T) {
 	md := "```\nsome code\n```"
 	_, entities := Convert(md, false, nil)
-	pre := findEntity(entities, "pre")
+	pre := findEntity(entities, EntityPre)
 	if pre == nil {
 		t.Fatal("Convert() should have pre entity")
 	}
@@ -170,16 +163,71 @@ func TestCodeBlock_NoLanguage(t *testing.T) {
 	}
 }
 
+// TestCodeBlock_LanguageDetection 测试没有语言标识的代码块根据内容识别语言，且可以关闭
+func TestCodeBlock_LanguageDetection(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want string
+	}{
+		{"python shebang", "#!/usr/bin/env python3\nprint('hi')", "python"},
+		{"versioned interpreter", "#!/usr/bin/python3.11 -u\nprint('hi')", "python"},
+		{"env with flags", "#!/usr/bin/env -S bash -e\necho hi", "bash"},
+		{"unknown interpreter", "#!/opt/tool/run\nstuff", ""},
+		{"json object", "{\n  \"key\": \"value\",\n  \"n\": [1, 2]\n}", "json"},
+		{"braces that are not json", "{\n  key: value\n}", ""},
+		{"php", "<?php\necho 'hi';", "php"},
+		{"xml", "<?xml version=\"1.0\"?>\n<a/>", "xml"},
+		{"yaml", "---\nname: test\nitems:\n  - a", "yaml"},
+		{"sql", "SELECT id, name\nFROM users\nWHERE id = 1;", "sql"},
+		{"select without from", "select the option you want", ""},
+		{"go", "package main\n\nfunc main() {}", "go"},
+		{"ambiguous", "some code\nwith words = 1", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md := "```\n" + tt.code + "\n```"
+			_, entities := Convert(md, false, nil)
+			if pre := findEntity(entities, EntityPre); pre == nil || pre.Language != tt.want {
+				t.Errorf("pre entity = %+v, want language %q", pre, tt.want)
+			}
+			_, _, segments := ConvertWithSegments(md, false, nil)
+			if len(segments) != 1 || segments[0].Language != tt.want {
+				t.Errorf("segments = %+v, want language %q", segments, tt.want)
+			}
+		})
+	}
+
+	// 标注的语言优先
+	if _, entities := Convert("```text\n#!/bin/bash\n```", false, nil); entities[0].Language != "text" {
+		t.Errorf("labeled fence language = %q, want text", entities[0].Language)
+	}
+	config := DefaultConfig()
+	config.DisableLanguageDetection = true
+	if _, entities := Convert("```\n#!/usr/bin/env python3\n```", false, config); entities[0].Language != "" {
+		t.Errorf("language with detection disabled = %q, want empty", entities[0].Language)
+	}
+
+	// 提取为文件时使用识别出的语言的扩展名
+	contents, err := Process(context.Background(), "```\n#!/usr/bin/env python3\n"+strings.Repeat("print(1)\n", 60)+"```")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f, ok := contents[0].(*File); !ok || f.FileName != "readable.py" {
+		t.Errorf("contents[0] = %#v, want readable.py", contents[0])
+	}
+}
+
 // TestHeading_H1 测试 H1 标题
 func TestHeading_H1(t *testing.T) {
 	text, entities := Convert("# Title", false, nil)
 	if !strings.Contains(text, "📌") {
 		t.Errorf("H1 should contain emoji 📌")
 	}
-	if findEntity(entities, "bold") == nil {
+	if findEntity(entities, EntityBold) == nil {
 		t.Error("H1 should have bold entity")
 	}
-	if findEntity(entities, "underline") == nil {
+	if findEntity(entities, EntityUnderline) == nil {
 		t.Error("H1 should have underline entity")
 	}
 }
@@ -190,10 +238,10 @@ func TestHeading_H2(t *testing.T) {
 	if !strings.Contains(text, "📝") {
 		t.Errorf("H2 should contain emoji 📝")
 	}
-	if findEntity(entities, "bold") == nil {
+	if findEntity(entities, EntityBold) == nil {
 		t.Error("H2 should have bold entity")
 	}
-	if findEntity(entities, "underline") == nil {
+	if findEntity(entities, EntityUnderline) == nil {
 		t.Error("H2 should have underline entity")
 	}
 }
@@ -204,19 +252,223 @@ func TestHeading_H3(t *testing.T) {
 	if !strings.Contains(text, "📋") {
 		t.Errorf("H3 should contain emoji 📋")
 	}
-	if findEntity(entities, "bold") == nil {
+	if findEntity(entities, EntityBold) == nil {
 		t.Error("H3 should have bold entity")
 	}
 	// H3 无下划线
-	if findEntity(entities, "underline") != nil {
+	if findEntity(entities, EntityUnderline) != nil {
 		t.Error("H3 should not have underline entity")
 	}
 }
 
+// TestHeading_Setext 测试 setext 标题与对应的 ATX 标题输出一致，空行后的 --- 仍是分隔线
+func TestHeading_Setext(t *testing.T) {
+	tests := []struct {
+		name   string
+		setext string
+		atx    string
+	}{
+		{"h1", "Title\n=====\n\nbody", "# Title\n\nbody"},
+		{"h2", "Title\n-----\n\nbody", "## Title\n\nbody"},
+		{"short underline", "Title\n-\n\nbody", "## Title\n\nbody"},
+		{"inline formatting", "A *b* `c`\n===", "# A *b* `c`"},
+		{"after paragraph", "para\n\nTitle\n---", "para\n\n## Title"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities := Convert(tt.setext, false, nil)
+			wantText, wantEntities := Convert(tt.atx, false, nil)
+			if text != wantText {
+				t.Errorf("Convert(%q) = %q, want %q", tt.setext, text, wantText)
+			}
+			if !reflect.DeepEqual(entities, wantEntities) {
+				t.Errorf("entities = %+v, want %+v", entities, wantEntities)
+			}
+		})
+	}
+
+	// 空行隔开的 --- 是分隔线而不是标题下划线
+	text, entities := Convert("para\n\n---\n\nmore", false, nil)
+	if text != "para\n\n————————\n\nmore" || len(entities) != 0 {
+		t.Errorf("rule after blank line = %q %+v", text, entities)
+	}
+}
+
+// TestRule_Symbol 测试自定义分隔线文字、按 RuleWidth 重复单个字符，以及空分隔线只保留段落间距
+func TestRule_Symbol(t *testing.T) {
+	md := "para\n\n---\n\nmore\n\n- item\n\n  ***\n\n  next"
+	tests := []struct {
+		name  string
+		rule  string
+		width int
+		want  string
+	}{
+		{"default", "————————", 0, "para\n\n————————\n\nmore\n\n⦁ item\n————————\n  next"},
+		{"custom", "· · ·", 0, "para\n\n· · ·\n\nmore\n\n⦁ item\n· · ·\n  next"},
+		{"width", "─", 12, "para\n\n────────────\n\nmore\n\n⦁ item\n────────────\n  next"},
+		{"width ignored for several characters", "-=", 12, "para\n\n-=\n\nmore\n\n⦁ item\n-=\n  next"},
+		{"empty", "", 12, "para\n\nmore\n\n⦁ item\n  next"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.MarkdownSymbol.Rule = tt.rule
+			config.RuleWidth = tt.width
+			text, entities := Convert(md, false, config)
+			if text = strings.TrimRight(text, "\n"); text != tt.want {
+				t.Errorf("Convert() = %q, want %q", text, tt.want)
+			}
+			if len(entities) != 0 {
+				t.Errorf("unexpected entities %+v", entities)
+			}
+		})
+	}
+	if text, _ := Convert("<hr>\n\nafter", false, nil); text != "————————\n\nafter" {
+		t.Errorf("Convert(<hr>) = %q", text)
+	}
+}
+
+// TestHeading_InlineContent 测试标题中的行内代码、链接和粗体，包括占两个 UTF-16 单位的标题符号
+func TestHeading_InlineContent(t *testing.T) {
+	astral := DefaultConfig()
+	astral.MarkdownSymbol.HeadingLevel1 = "🧪"
+	astral.MarkdownSymbol.HeadingLevel2 = "\U0001F468\u200d\U0001F4BB"
+
+	type span struct{ etype, text string }
+	tests := []struct {
+		name   string
+		md     string
+		config *RenderConfig
+		want   []span
+	}{
+		{
+			"code span in h2", "## Using `go test` flags", nil,
+			[]span{{EntityBold, "Using go test flags"}, {EntityUnderline, "Using go test flags"}, {EntityCode, "go test"}},
+		},
+		{
+			"link and bold in h1", "# A [link](https://example.com) and **bold**", nil,
+			[]span{{EntityBold, "A link and bold"}, {EntityUnderline, "A link and bold"}, {EntityTextLink, "link"}, {EntityBold, "bold"}},
+		},
+		{
+			"code first in h3", "### `code` first", nil,
+			[]span{{EntityBold, "code first"}, {EntityCode, "code"}},
+		},
+		{
+			"astral symbol and code", "# Using `go 😀 test` flags", astral,
+			[]span{{EntityBold, "Using go 😀 test flags"}, {EntityUnderline, "Using go 😀 test flags"}, {EntityCode, "go 😀 test"}},
+		},
+		{
+			"zwj symbol with link", "## [**bold link** `c`](https://example.com) tail", astral,
+			[]span{
+				{EntityBold, "bold link c tail"}, {EntityUnderline, "bold link c tail"},
+				{EntityTextLink, "bold link c"}, {EntityBold, "bold link"}, {EntityCode, "c"},
+			},
+		},
+		{
+			"after a table", "| a |\n|---|\n| b |\n\n## after `t`", nil,
+			[]span{{EntityPre, "a\n-\nb"}, {EntityBold, "after t"}, {EntityUnderline, "after t"}, {EntityCode, "t"}},
+		},
+		{
+			"in list items", "- # item `c`\n- ## two **b**", astral,
+			[]span{
+				{EntityBold, "item c"}, {EntityUnderline, "item c"}, {EntityCode, "c"},
+				{EntityBold, "two b"}, {EntityUnderline, "two b"}, {EntityBold, "b"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities := Convert(tt.md, false, tt.config)
+			var got []span
+			for _, e := range entities {
+				got = append(got, span{e.Type, extractEntityText(text, &e)})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entities of %q = %q, want %q", text, got, tt.want)
+			}
+			if errs := ValidateEntities(text, entities); len(errs) > 0 {
+				t.Errorf("invalid entities: %v", errs)
+			}
+		})
+	}
+}
+
+// TestHeading_SymbolWidths 测试各级标题使用 BMP、astral、ZWJ 序列和 ASCII 符号时，
+// 在各种上下文中实体都准确覆盖标题文字
+func TestHeading_SymbolWidths(t *testing.T) {
+	symbols := map[string]string{
+		"ascii":     "#",
+		"bmp":       "★",
+		"astral":    "🧪",
+		"skin tone": "👍🏽",
+		"zwj":       "🧑‍💻",
+		"keycap":    "1️⃣",
+		"flag":      "🇺🇦",
+	}
+	contexts := map[string]string{
+		"alone":           "%s",
+		"after paragraph": "para\n\n%s\n\nafter",
+		"in quote":        "> %s\n> more",
+		"after quote":     "> quote\n\n%s",
+		"in list":         "- a\n- %s",
+		"after table":     "| a |\n|---|\n| b |\n\n%s",
+		"after code":      "```\ncode\n```\n%s",
+		"twice":           "%[1]s\n%[1]s",
+	}
+	for name, symbol := range symbols {
+		for level := 1; level <= 6; level++ {
+			config := DefaultConfig()
+			s := config.MarkdownSymbol
+			*[]*string{&s.HeadingLevel1, &s.HeadingLevel2, &s.HeadingLevel3, &s.HeadingLevel4, &s.HeadingLevel5, &s.HeadingLevel6}[level-1] = symbol
+			heading := strings.Repeat("#", level) + " Title *it* ~~s~~"
+			for ctxName, format := range contexts {
+				md := fmt.Sprintf(format, heading)
+				text, entities := Convert(md, false, config)
+				if errs := ValidateEntities(text, entities); errs != nil {
+					t.Errorf("%s/h%d/%s: %v", name, level, ctxName, errs)
+				}
+				headingEntities := 0
+				for _, e := range entities {
+					got := EntityText(text, e)
+					switch {
+					case e.Type == EntityBlockquote || e.Type == EntityExpandableBlockquote:
+					case strings.Contains(got, "Title"):
+						headingEntities++
+						if got != "Title it s" {
+							t.Errorf("%s/h%d/%s: %s covers %q, want %q", name, level, ctxName, e.Type, got, "Title it s")
+						}
+					case e.Type == EntityItalic && got != "it", e.Type == EntityStrikethrough && got != "s":
+						t.Errorf("%s/h%d/%s: %s covers %q", name, level, ctxName, e.Type, got)
+					}
+				}
+				if headingEntities == 0 {
+					t.Errorf("%s/h%d/%s: no heading entity in %q", name, level, ctxName, text)
+				}
+			}
+		}
+	}
+}
+
+// TestSymbol_Validate 测试包含换行的符号在 Process 和 ConvertE 中报错
+func TestSymbol_Validate(t *testing.T) {
+	if err := DefaultConfig().MarkdownSymbol.Validate(); err != nil {
+		t.Fatalf("default symbols: %v", err)
+	}
+	config := DefaultConfig()
+	config.MarkdownSymbol.HeadingLevel2 = "📝\n"
+	if _, _, err := ConvertE("## Title", false, config); err == nil || !strings.Contains(err.Error(), "HeadingLevel2") {
+		t.Errorf("ConvertE() error = %v, want one naming HeadingLevel2", err)
+	}
+	_, err := Process(context.Background(), "## Title", WithHeadingSymbols("📌", "a\r\nb"))
+	if err == nil || !strings.Contains(err.Error(), "HeadingLevel2") {
+		t.Errorf("Process() error = %v, want one naming HeadingLevel2", err)
+	}
+}
+
 // TestLink_Inline 测试行内链接
 func TestLink_Inline(t *testing.T) {
 	text, entities := Convert("[Google](https://google.com)", false, nil)
-	link := findEntity(entities, "text_link")
+	link := findEntity(entities, EntityTextLink)
 	if link == nil {
 		t.Fatal("Convert() should have text_link entity")
 	}
@@ -228,13 +480,217 @@ func TestLink_Inline(t *testing.T) {
 	}
 }
 
+// TestLink_Autolink 测试自动链接：邮箱地址加上 mailto: 协议，显示文字保持原样
+func TestLink_Autolink(t *testing.T) {
+	tests := []struct {
+		name  string
+		md    string
+		label string
+		url   string
+	}{
+		{"angle-bracket email", "mail <user@example.com> now", "user@example.com", "mailto:user@example.com"},
+		{"bare email", "write to user@example.com today", "user@example.com", "mailto:user@example.com"},
+		{"explicit mailto", "<mailto:user@example.com>", "mailto:user@example.com", "mailto:user@example.com"},
+		{"angle-bracket url", "see <https://example.com/a?b=1>", "https://example.com/a?b=1", "https://example.com/a?b=1"},
+		{"bare url", "see https://example.com/x here", "https://example.com/x", "https://example.com/x"},
+		{"bare www", "see www.example.com here", "www.example.com", "http://www.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities := Convert(tt.md, false, nil)
+			links := findEntities(entities, EntityTextLink)
+			if len(links) != 1 {
+				t.Fatalf("got %d text_link entities, want 1: %+v", len(links), entities)
+			}
+			if got := extractEntityText(text, &links[0]); got != tt.label {
+				t.Errorf("link text = %q, want %q", got, tt.label)
+			}
+			if links[0].URL != tt.url {
+				t.Errorf("link URL = %q, want %q", links[0].URL, tt.url)
+			}
+		})
+	}
+}
+
+// TestLink_UnsafeURL 测试不安全或相对的链接只保留文字
+func TestLink_UnsafeURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		md      string
+		baseURL string
+		showURL bool
+		text    string
+		url     string // 为空表示不应有 text_link
+	}{
+		{"https", "[site](https://example.com/a)", "", false, "site", "https://example.com/a"},
+		{"javascript", "[click](javascript:alert(1))", "", false, "click", ""},
+		{"data", "[img](data:text/html;base64,PHA+)", "", false, "img", ""},
+		{"empty", "[nothing]()", "", false, "nothing", ""},
+		{"no host", "[x](https:foo)", "", false, "x", ""},
+		{"relative dropped", "[docs](./docs/x.md)", "", false, "docs", ""},
+		{"relative resolved", "[docs](./docs/x.md)", "https://github.com/o/r/blob/main/", false, "docs", "https://github.com/o/r/blob/main/docs/x.md"},
+		{"show dropped url", "[click](javascript:void(0))", "", true, "click (javascript:void(0))", ""},
+		{"show ignores valid", "[site](https://example.com)", "", true, "site", "https://example.com"},
+		{"autolink", "<javascript:alert(1)>", "", false, "javascript:alert(1)", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.BaseURL = tt.baseURL
+			config.ShowDroppedLinkURL = tt.showURL
+			text, entities := Convert(tt.md, false, config)
+			if text != tt.text {
+				t.Errorf("text = %q, want %q", text, tt.text)
+			}
+			links := findEntities(entities, EntityTextLink)
+			if tt.url == "" {
+				if len(links) != 0 {
+					t.Errorf("got text_link entities %+v, want none", links)
+				}
+				return
+			}
+			if len(links) != 1 || links[0].URL != tt.url {
+				t.Fatalf("text_link entities = %+v, want one with URL %q", links, tt.url)
+			}
+			if got := extractEntityText(text, &links[0]); got != tt.text {
+				t.Errorf("link text = %q, want %q", got, tt.text)
+			}
+		})
+	}
+
+	// 自定义表情链接不受影响
+	_, entities := Convert("[👍](tg://emoji?id=5368324170671202286)", false, nil)
+	if e := findEntity(entities, EntityCustomEmoji); e == nil || e.CustomEmojiID != "5368324170671202286" {
+		t.Errorf("custom emoji link entities = %+v", entities)
+	}
+}
+
+// TestCustomEmoji_Off 测试 CustomEmoji 为 off 时自定义表情的链接、图片和 <tg-entity> 只保留后备表情，没有实体，
+// 与禁用 custom_emoji 相同
+func TestCustomEmoji_Off(t *testing.T) {
+	md := "a [😀](tg://emoji?id=5368324170671202286) b ![👍](tg://emoji?id=5368324170671202287) c <tg-entity type=\"custom_emoji\" custom_emoji_id=\"5368324170671202288\">🎉</tg-entity> [link](https://example.com)"
+	want := "a 😀 b 👍 c 🎉 link"
+
+	text, entities := Convert(md, false, nil)
+	if text != want || len(findEntities(entities, EntityCustomEmoji)) != 3 {
+		t.Errorf("CustomEmoji on: %q %+v", text, entities)
+	}
+
+	config := DefaultConfig()
+	config.CustomEmoji = CustomEmojiOff
+	text, entities = Convert(md, false, config)
+	if text != want {
+		t.Errorf("CustomEmoji off: text = %q, want %q", text, want)
+	}
+	wantEntities := []MessageEntity{{Type: EntityTextLink, Offset: 15, Length: 4, URL: "https://example.com"}}
+	if !EntitiesEqual(entities, wantEntities) {
+		t.Errorf("CustomEmoji off: entities differ: %v", DiffEntities(entities, wantEntities))
+	}
+
+	// 与 DisabledEntities 中的 custom_emoji 效果相同
+	if !config.EntityDisabled(EntityCustomEmoji) {
+		t.Error("EntityDisabled(custom_emoji) = false with CustomEmojiOff")
+	}
+	disabled := DefaultConfig()
+	disabled.DisabledEntities = []string{EntityCustomEmoji}
+	if text, entities := Convert(md, false, disabled); text != want || !EntitiesEqual(entities, wantEntities) {
+		t.Errorf("custom_emoji disabled: %q %+v", text, entities)
+	}
+}
+
+// TestLink_URLEncoding 测试链接地址的百分号编码、IDNA 和长度限制
+func TestLink_URLEncoding(t *testing.T) {
+	tests := []struct {
+		name string
+		md   string
+		url  string
+	}{
+		{"space", "[doc](<https://ex.com/a b.pdf>)", "https://ex.com/a%20b.pdf"},
+		{"cjk path", "[doc](https://ex.com/路径/文件)", "https://ex.com/%E8%B7%AF%E5%BE%84/%E6%96%87%E4%BB%B6"},
+		{"query and fragment", "[doc](<https://ex.com/s?q=日本 語#第 1>)", "https://ex.com/s?q=%E6%97%A5%E6%9C%AC%20%E8%AA%9E#%E7%AC%AC%201"},
+		{"already encoded", "[doc](https://ex.com/a%20b/%E8%B7%AF?x=%2F&y=100%25)", "https://ex.com/a%20b/%E8%B7%AF?x=%2F&y=100%25"},
+		{"stray percent", "[doc](https://ex.com/?p=100%)", "https://ex.com/?p=100%25"},
+		{"idna host", "[doc](https://münchen.de/karte)", "https://xn--mnchen-3ya.de/karte"},
+		{"idna host with port", "[doc](https://例え.テスト:8443/)", "https://xn--r8jz45g.xn--zckzah:8443/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, entities := Convert(tt.md, false, nil)
+			links := findEntities(entities, EntityTextLink)
+			if len(links) != 1 || links[0].URL != tt.url {
+				t.Errorf("text_link entities = %+v, want one with URL %q", links, tt.url)
+			}
+		})
+	}
+
+	// 编码后超长的地址不生成实体，保留文字并记录日志
+	md := "[long](https://ex.com/" + strings.Repeat("a", 5000) + ")"
+	text, entities := Convert(md, false, nil)
+	if text != "long" || len(entities) != 0 {
+		t.Errorf("Convert() = %q, %+v, want plain text", text, entities)
+	}
+	h := newRecordHandler()
+	if _, err := Process(context.Background(), md, WithLogger(slog.New(h))); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if level, attrs, ok := h.find("link rendered as plain text"); !ok || level != slog.LevelWarn || !strings.Contains(attrs["reason"], "limit is 2048") {
+		t.Errorf("log record = %v %v %v, want a warning about the length limit", level, attrs, ok)
+	}
+}
+
+// TestLinkStyle 测试链接的三种呈现方式
+func TestLinkStyle(t *testing.T) {
+	md := "see [docs](https://ex.com/docs) and [api](https://ex.com/api), or [docs again](https://ex.com/docs)\n\n- [item](https://ex.com/item)"
+	tests := []struct {
+		style LinkStyle
+		text  string
+		links int
+	}{
+		{"", "see docs and api, or docs again\n\n⦁ item\n", 4},
+		{LinkStyleEntity, "see docs and api, or docs again\n\n⦁ item\n", 4},
+		{LinkStyleFootnote, "see docs [1] and api [2], or docs again [1]\n\n⦁ item [3]\n\n" +
+			"[1] https://ex.com/docs\n[2] https://ex.com/api\n[3] https://ex.com/item", 0},
+		{LinkStyleInlineURL, "see docs (https://ex.com/docs) and api (https://ex.com/api), " +
+			"or docs again (https://ex.com/docs)\n\n⦁ item (https://ex.com/item)\n", 0},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.style), func(t *testing.T) {
+			config := DefaultConfig()
+			config.LinkStyle = tt.style
+			text, entities := Convert(md, false, config)
+			if text != tt.text {
+				t.Errorf("text = %q, want %q", text, tt.text)
+			}
+			if got := len(findEntities(entities, EntityTextLink)); got != tt.links {
+				t.Errorf("got %d text_link entities, want %d", got, tt.links)
+			}
+		})
+	}
+
+	// 自动链接的文字就是地址，不再追加编号
+	config := DefaultConfig()
+	config.LinkStyle = LinkStyleFootnote
+	if text, _ := Convert("see <https://ex.com>", false, config); text != "see https://ex.com" {
+		t.Errorf("autolink text = %q", text)
+	}
+
+	// 脚注列表在切分之前写入，短文档中与引用在同一条消息里
+	contents, err := Process(context.Background(), md, WithConfig(config))
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if len(contents) != 1 || !strings.HasSuffix(contents[0].(*Text).Text, "[3] https://ex.com/item") {
+		t.Errorf("Process() = %+v, want one text ending with the reference list", contents)
+	}
+}
+
 // TestBlockquote_Simple 测试简单引用
 func TestBlockquote_Simple(t *testing.T) {
 	text, entities := Convert("> quoted text", false, nil)
-	bq := findEntity(entities, "blockquote")
+	bq := findEntity(entities, EntityBlockquote)
 	if bq == nil {
 		// 可能是 expandable_blockquote
-		bq = findEntity(entities, "expandable_blockquote")
+		bq = findEntity(entities, EntityExpandableBlockquote)
 	}
 	if bq == nil {
 		t.Fatal("Convert() should have blockquote entity")
@@ -245,6 +701,214 @@ func TestBlockquote_Simple(t *testing.T) {
 	}
 }
 
+// TestBlockquote_SplitAroundCode 测试引用块中的代码块把引用拆成前后两段，pre 不嵌套在引用中
+func TestBlockquote_SplitAroundCode(t *testing.T) {
+	md := "> before\n>\n> ```go\n> x := 1\n> ```\n>\n> after"
+	text, entities := Convert(md, false, nil)
+	quotes := append(findEntities(entities, EntityBlockquote), findEntities(entities, EntityExpandableBlockquote)...)
+	if len(quotes) != 2 {
+		t.Fatalf("got %d blockquote entities, want 2: %+v", len(quotes), entities)
+	}
+	pres := findEntities(entities, EntityPre)
+	if len(pres) != 1 || extractEntityText(text, &pres[0]) != "x := 1" {
+		t.Fatalf("pre entities = %+v, want one covering the code", pres)
+	}
+	got := []string{extractEntityText(text, &quotes[0]), extractEntityText(text, &quotes[1])}
+	sort.Strings(got)
+	if got[0] != "after" || got[1] != "before" {
+		t.Errorf("blockquotes cover %q, want before and after", got)
+	}
+	pre := pres[0]
+	for _, q := range quotes {
+		if q.Offset < pre.Offset+pre.Length && pre.Offset < q.Offset+q.Length {
+			t.Errorf("blockquote %+v overlaps pre %+v", q, pre)
+		}
+	}
+}
+
+// TestBlockquote_BlockContent 测试引用块中的分隔线、标题和列表都落在引用实体范围内
+func TestBlockquote_BlockContent(t *testing.T) {
+	tests := []struct {
+		name  string
+		md    string
+		quote string
+	}{
+		{"rule", "before\n\n> a\n>\n> ---\n>\n> b\n\nafter", "a\n\n————————\n\nb"},
+		{"rule first", "> ---\n> text", "————————\n\ntext"},
+		{"heading", "before\n\n> ## title\n> body\n\nafter", "📝 title\n\nbody"},
+		{"heading last", "> body\n> # end", "body\n\n📌 end"},
+		{"list", "> - x\n> - y\n\nafter", "⦁ x\n⦁ y"},
+		{"nested quote", "> > inner\n>\n> outer", "inner\n\nouter"},
+		{"inside list item", "- item\n\n  > one\n  >\n  > ---\n  >\n  > two", "one\n————————\ntwo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities := Convert(tt.md, false, nil)
+			quotes := append(findEntities(entities, EntityBlockquote), findEntities(entities, EntityExpandableBlockquote)...)
+			if len(quotes) != 1 {
+				t.Fatalf("got %d blockquote entities, want 1: %+v", len(quotes), entities)
+			}
+			if got := extractEntityText(text, &quotes[0]); got != tt.quote {
+				t.Errorf("blockquote covers %q, want %q (text %q)", got, tt.quote, text)
+			}
+		})
+	}
+}
+
+// TestBlockquote_Paragraphs 测试引用中以单独的 > 行分隔的段落之间保留空行，且空行计入实体长度
+func TestBlockquote_Paragraphs(t *testing.T) {
+	tests := []struct {
+		name  string
+		md    string
+		quote string
+	}{
+		{"two paragraphs", "> para1\n>\n> para2", "para1\n\npara2"},
+		{"three paragraphs", "before\n\n> a\n>\n> b\n>\n> c\n\nafter", "a\n\nb\n\nc"},
+		{"several blank quote lines", "> a\n>\n>\n>\n> b", "a\n\nb"},
+		{"lazy lines stay together", "> a\nb\n>\n> c", "a\nb\n\nc"},
+		{"inside list item", "- item\n\n  > one\n  >\n  > two", "one\n\ntwo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities := Convert(tt.md, false, nil)
+			quotes := findEntities(entities, EntityBlockquote)
+			if len(quotes) != 1 {
+				t.Fatalf("got %d blockquote entities, want 1: %+v", len(quotes), entities)
+			}
+			if got := extractEntityText(text, &quotes[0]); got != tt.quote {
+				t.Errorf("blockquote covers %q, want %q (text %q)", got, tt.quote, text)
+			}
+			if quotes[0].Length != UTF16Len(tt.quote) {
+				t.Errorf("blockquote length = %d, want %d", quotes[0].Length, UTF16Len(tt.quote))
+			}
+		})
+	}
+}
+
+// TestBlockquote_Expandable 测试显式可展开标记、按长度自动升级以及不升级的情况
+func TestBlockquote_Expandable(t *testing.T) {
+	long := strings.Repeat("word ", 50)                             // 一行 250 个字符，约 4 行
+	threeLines := strings.Repeat(strings.Repeat("x", 70)+"\n> ", 3) // 3 行，超过 200 单元
+	noCite := &RenderConfig{MarkdownSymbol: DefaultConfig().MarkdownSymbol}
+	tests := []struct {
+		name   string
+		md     string
+		config *RenderConfig
+		want   string // 引用实体的类型
+		text   string // 引用覆盖的文本，为空时不检查
+	}{
+		{"markdownv2 marker", "**>short\n>two||", nil, EntityExpandableBlockquote, "short\ntwo"},
+		{"markdownv2 without pipes", "**>short\n>two", nil, EntityExpandableBlockquote, "short\ntwo"},
+		{"trailing pipes", "> short quote||", nil, EntityExpandableBlockquote, "short quote"},
+		{"spoiler is not a marker", "> ||secret|| text", nil, EntityBlockquote, "secret text"},
+		{"html", "<blockquote expandable>\nhidden *a*\nmore\n</blockquote>\n\nafter", nil, EntityExpandableBlockquote, "hidden a\nmore"},
+		{"forced without CiteExpandable", "> short||", noCite, EntityExpandableBlockquote, "short"},
+		{"auto long", "> " + long, nil, EntityExpandableBlockquote, ""},
+		{"auto disabled", "> " + long, noCite, EntityBlockquote, ""},
+		{"contains heading", "> # Warning\n> " + long, nil, EntityBlockquote, ""},
+		{"within preview lines", "> " + threeLines, nil, EntityBlockquote, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities := Convert(tt.md, false, tt.config)
+			quotes := append(findEntities(entities, EntityBlockquote), findEntities(entities, EntityExpandableBlockquote)...)
+			if len(quotes) != 1 {
+				t.Fatalf("got %d blockquote entities, want 1: %+v", len(quotes), entities)
+			}
+			if quotes[0].Type != tt.want {
+				t.Errorf("quote type = %s, want %s", quotes[0].Type, tt.want)
+			}
+			if got := extractEntityText(text, &quotes[0]); tt.text != "" && got != tt.text {
+				t.Errorf("quote covers %q, want %q", got, tt.text)
+			}
+		})
+	}
+
+	// 代码块中的 **> 不是引用
+	if text, _ := Convert("```\n**>not\n```", false, nil); text != "**>not" {
+		t.Errorf("code block changed: %q", text)
+	}
+}
+
+// TestBlockquote_Attribution 测试引用最后一行的署名渲染为斜体且不计入自动折叠的长度
+func TestBlockquote_Attribution(t *testing.T) {
+	body := strings.Repeat(strings.Repeat("y", 60)+"\n> ", 3)                       // 3 行，180 个字符
+	attribution := "— " + strings.Repeat("Someone Famous, ", 5) + "Collected Works" // 约 97 个字符
+	disabled := DefaultConfig()
+	disabled.DisableQuoteAttribution = true
+	tests := []struct {
+		name   string
+		md     string
+		config *RenderConfig
+		italic string // 署名的斜体覆盖的文本，为空时不应有斜体
+		quote  string // 引用实体的类型
+	}{
+		{"em dash", "> Be yourself.\n> — Oscar Wilde", nil, "— Oscar Wilde", EntityBlockquote},
+		{"double hyphen paragraph", "> Simple is better.\n>\n> -- The Zen of Python", nil, "-- The Zen of Python", EntityBlockquote},
+		{"indented", "> quote\n>    — Author", nil, "— Author", EntityBlockquote},
+		{"dialogue", "> — Is it done?\n> — Yes.", nil, "", EntityBlockquote},
+		{"dash inside body", "> — a remark first\n> and a plain ending", nil, "", EntityBlockquote},
+		{"single line", "> — just a dash", nil, "", EntityBlockquote},
+		{"horizontal rule dashes", "> text\n> --- not an author", nil, "", EntityBlockquote},
+		{"long attribution not counted", "> " + body + attribution, nil, attribution, EntityBlockquote},
+		{"disabled", "> " + body + attribution, disabled, "", EntityExpandableBlockquote},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities := Convert(tt.md, false, tt.config)
+			quotes := append(findEntities(entities, EntityBlockquote), findEntities(entities, EntityExpandableBlockquote)...)
+			if len(quotes) != 1 || quotes[0].Type != tt.quote {
+				t.Fatalf("quote entities = %+v, want one %s", quotes, tt.quote)
+			}
+			if quotes[0].Offset != 0 || quotes[0].Length != UTF16Len(text) {
+				t.Errorf("quote covers %q, want the whole text %q", extractEntityText(text, &quotes[0]), text)
+			}
+			italic := findEntity(entities, EntityItalic)
+			switch {
+			case tt.italic == "" && italic != nil:
+				t.Errorf("unexpected italic over %q", extractEntityText(text, italic))
+			case tt.italic != "" && (italic == nil || extractEntityText(text, italic) != tt.italic):
+				t.Errorf("italic = %+v in %q, want it over %q", italic, text, tt.italic)
+			}
+		})
+	}
+
+	// 代码块的最后一行（SQL 注释）不是署名
+	if _, entities := Convert("> intro\n> ```sql\n> SELECT 1;\n> -- comment\n> ```", false, nil); findEntity(entities, EntityItalic) != nil {
+		t.Errorf("code line taken as attribution: %+v", entities)
+	}
+}
+
+// TestBlockquote_AdjacentBlocks 测试引用与列表、标题、代码块之间没有空行时，
+// 引用实体只覆盖引用本身，输出中两者以空行分隔
+func TestBlockquote_AdjacentBlocks(t *testing.T) {
+	tests := []struct {
+		name string
+		md   string
+		want string
+	}{
+		{"quote then list", "> quote\n- item", "quote\n\n⦁ item\n"},
+		{"quote then ordered list", "> quote\n1. item", "quote\n\n1. item\n"},
+		{"quote then heading", "> quote\n# Head", "quote\n\n📌 Head"},
+		{"quote then code", "> quote\n```\ncode\n```", "quote\n\ncode"},
+		{"list then quote", "- item\n> quote", "⦁ item\n\nquote"},
+		{"heading then quote", "# Head\n> quote", "📌 Head\n\nquote"},
+		{"code then quote", "```\ncode\n```\n> quote", "code\n\nquote"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities := Convert(tt.md, false, nil)
+			if text != tt.want {
+				t.Errorf("Convert(%q) = %q, want %q", tt.md, text, tt.want)
+			}
+			quotes := findEntities(entities, EntityBlockquote)
+			if len(quotes) != 1 || extractEntityText(text, &quotes[0]) != "quote" {
+				t.Errorf("blockquote entities = %+v, want one covering %q", quotes, "quote")
+			}
+		})
+	}
+}
+
 // TestList_Unordered 测试无序列表
 func TestList_Unordered(t *testing.T) {
 	md := "- item1\n- item2"
@@ -269,6 +933,45 @@ func TestList_Ordered(t *testing.T) {
 	}
 }
 
+// TestList_OrderedNumbering 测试起始编号、两位数编号的对齐以及嵌套内容的缩进
+func TestList_OrderedNumbering(t *testing.T) {
+	var long strings.Builder
+	var want strings.Builder
+	for i := 1; i <= 15; i++ {
+		fmt.Fprintf(&long, "%d. item %d\n", i, i)
+		fmt.Fprintf(&want, "%2d. item %d\n", i, i)
+		if i == 12 {
+			long.WriteString("    - nested\n    - **bold**\n")
+			want.WriteString("    ⦁ nested\n    ⦁ bold\n")
+		}
+	}
+	tests := []struct {
+		name string
+		md   string
+		want string
+	}{
+		{"start at 7", "7. seven\n8. eight\n9. nine", "7. seven\n8. eight\n9. nine\n"},
+		{"two digits", "9. nine\n10. ten", " 9. nine\n10. ten\n"},
+		{"continuation paragraph", "9. nine\n10. ten\n\n    more ten\n", " 9. nine\n10. ten\n    more ten\n"},
+		{"soft-wrapped line", "9. nine\n10. ten\n    wrapped line", " 9. nine\n10. ten\n    wrapped line\n"},
+		{"hard break in nested item", "- a\n  - b  \n    **bold**", "⦁ a\n  ⦁ b\n    bold\n"},
+		{"nested under item 12", long.String(), want.String()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities := Convert(tt.md, false, nil)
+			if text != tt.want {
+				t.Errorf("Convert(%q) = %q, want %q", tt.md, text, tt.want)
+			}
+			for i := range entities {
+				if got := extractEntityText(text, &entities[i]); got != "bold" {
+					t.Errorf("%s entity covers %q, want %q", entities[i].Type, got, "bold")
+				}
+			}
+		})
+	}
+}
+
 // TestList_Task 测试任务列表
 func TestList_Task(t *testing.T) {
 	md := "- [x] done\n- [ ] todo"
@@ -281,10 +984,145 @@ func TestList_Task(t *testing.T) {
 	}
 }
 
+// TestList_TaskNested 测试嵌套任务列表替换 bullet 后 entity 偏移仍正确
+func TestList_TaskNested(t *testing.T) {
+	md := "- parent\n  - [x] **done**\n- [ ] todo"
+	text, entities := Convert(md, false, nil)
+	if strings.Contains(text, "⦁ ✅") || strings.Contains(text, "⦁ ☑") {
+		t.Errorf("bullet should be replaced by the task marker: %q", text)
+	}
+	bold := findEntity(entities, EntityBold)
+	if bold == nil || extractEntityText(text, bold) != "done" {
+		t.Errorf("bold entity should cover 'done' in %q, got %+v", text, bold)
+	}
+}
+
+// TestList_TaskFormatting 测试任务项以格式开头、嵌套任务项和自定义标记时实体偏移正确
+func TestList_TaskFormatting(t *testing.T) {
+	custom := &RenderConfig{
+		MarkdownSymbol: &Symbol{
+			HeadingLevel1:   "#",
+			TaskCompleted:   "[done 🎉]",
+			TaskUncompleted: "[ ]",
+		},
+		CiteExpandable: true,
+	}
+	tests := []struct {
+		name   string
+		md     string
+		config *RenderConfig
+		want   string
+		covers map[string]string // entity type -> covered text
+	}{
+		{"bold first", "- [x] **done** task", nil, "✅ done task\n", map[string]string{EntityBold: "done"}},
+		{"nested", "- parent\n  - [x] child **b**\n  - [ ] *other*", nil, "⦁ parent\n  ✅ child b\n  ☑️ other\n",
+			map[string]string{EntityBold: "b", EntityItalic: "other"}},
+		{"ordered", "1. [x] ordered `code`", nil, "✅ ordered code\n", map[string]string{EntityCode: "code"}},
+		{"custom symbols", "- [x] ~~gone~~ [link](https://example.com)\n- [ ] **next**", custom,
+			"[done 🎉] gone link\n[ ] next\n",
+			map[string]string{EntityStrikethrough: "gone", EntityTextLink: "link", EntityBold: "next"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities := Convert(tt.md, false, tt.config)
+			if text != tt.want {
+				t.Errorf("Convert(%q) = %q, want %q", tt.md, text, tt.want)
+			}
+			if len(entities) != len(tt.covers) {
+				t.Errorf("got %d entities, want %d: %+v", len(entities), len(tt.covers), entities)
+			}
+			for i := range entities {
+				if want, ok := tt.covers[entities[i].Type]; !ok || extractEntityText(text, &entities[i]) != want {
+					t.Errorf("%s entity covers %q, want %q", entities[i].Type, extractEntityText(text, &entities[i]), want)
+				}
+			}
+		})
+	}
+}
+
+// TestTrimTrailingSpaces 测试删除行尾空白后实体的裁剪与平移，代码块保持原样
+func TestTrimTrailingSpaces(t *testing.T) {
+	trim := &RenderConfig{MarkdownSymbol: DefaultConfig().MarkdownSymbol, CiteExpandable: true, TrimTrailingSpaces: true}
+	tests := []struct {
+		name   string
+		md     string
+		want   string
+		covers []string // 按实体顺序覆盖的文本
+	}{
+		{"entity ends at whitespace", "**a** `b `\n\n*c*", "a b\n\nc", []string{"a", "b", "c"}},
+		{"entity spans whitespace", "**a `c `\nd**", "a c\nd", []string{"a c\nd", "c"}},
+		{"whitespace-only entity", "`  `\n\n**x**", "x", []string{"x"}},
+		{"empty items and headings", "- \n- [ ] \n- y\n\n#\n\n**z**", "⦁\n☑️\n⦁ y\n\n📌\n\nz", []string{"z"}},
+		{"code block untouched", "```\ncode  \n```\n\n`k `", "code  \n\nk", []string{"code  ", "k"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities := Convert(tt.md, false, trim)
+			if text != tt.want {
+				t.Errorf("Convert(%q) = %q, want %q", tt.md, text, tt.want)
+			}
+			if len(entities) != len(tt.covers) {
+				t.Fatalf("got %d entities, want %d: %+v", len(entities), len(tt.covers), entities)
+			}
+			for i := range entities {
+				if got := extractEntityText(text, &entities[i]); got != tt.covers[i] {
+					t.Errorf("%s entity covers %q, want %q", entities[i].Type, got, tt.covers[i])
+				}
+			}
+		})
+	}
+
+	// 片段位置随之平移
+	md := "`a `\n\n```go\nx := 1 \n```"
+	text, _, segments := ConvertWithSegments(md, false, trim)
+	if len(segments) != 1 {
+		t.Fatalf("got %d segments, want 1", len(segments))
+	}
+	if got := text[segments[0].TextStart:segments[0].TextEnd]; got != "x := 1 " {
+		t.Errorf("segment covers %q in %q", got, text)
+	}
+
+	// 未开启时保留行尾空白
+	if text, _ := Convert("`b `", false, nil); text != "b " {
+		t.Errorf("default config trimmed output: %q", text)
+	}
+}
+
+// TestNormalizeNFC 测试 NFC 规范化后实体偏移基于规范化文本，关闭时保留原始字节
+func TestNormalizeNFC(t *testing.T) {
+	nfc := &RenderConfig{MarkdownSymbol: DefaultConfig().MarkdownSymbol, CiteExpandable: true, NormalizeNFC: true}
+	md := "Cafe\u0301 **re\u0301sume\u0301** `e\u0301`"
+
+	text, entities := Convert(md, false, nfc)
+	if want := "Caf\u00e9 r\u00e9sum\u00e9 \u00e9"; text != want {
+		t.Errorf("Convert(%q) = %q, want %q", md, text, want)
+	}
+	bold := findEntity(entities, EntityBold)
+	if bold == nil || extractEntityText(text, bold) != "r\u00e9sum\u00e9" {
+		t.Errorf("bold entity = %+v, want it to cover the composed word in %q", bold, text)
+	}
+	code := findEntity(entities, EntityCode)
+	if code == nil || code.Offset != 12 || code.Length != 1 {
+		t.Errorf("code entity = %+v, want offset 12 length 1", code)
+	}
+
+	skip := *nfc
+	skip.NormalizeNFCSkipCode = true
+	text, _ = Convert(md, false, &skip)
+	if want := "Caf\u00e9 r\u00e9sum\u00e9 e\u0301"; text != want {
+		t.Errorf("with NormalizeNFCSkipCode, Convert(%q) = %q, want %q", md, text, want)
+	}
+
+	text, _ = Convert(md, false, nil)
+	if want := "Cafe\u0301 re\u0301sume\u0301 e\u0301"; text != want {
+		t.Errorf("default config changed the input bytes: %q", text)
+	}
+}
+
 // TestSpoiler 测试剧透
 func TestSpoiler(t *testing.T) {
 	text, entities := Convert("this is ||secret|| text", false, nil)
-	spoiler := findEntity(entities, "spoiler")
+	spoiler := findEntity(entities, EntitySpoiler)
 	if spoiler == nil {
 		t.Fatal("Convert() should have spoiler entity")
 	}
@@ -293,6 +1131,243 @@ func TestSpoiler(t *testing.T) {
 	}
 }
 
+// TestSpoiler_CodeRegions 测试代码块和行内代码中的 || 不成为剧透：
+// 四个以上 ` 的围栏中可以包含 ``` 围栏，~~~ 围栏同样跳过；围栏前只能有缩进、引用符号和列表标记
+func TestSpoiler_CodeRegions(t *testing.T) {
+	tests := []struct {
+		name     string
+		md       string
+		code     string
+		spoilers []string
+	}{
+		{
+			name:     "four backticks",
+			md:       "````markdown\n```go\na || b\n```\n||not a spoiler||\n````\n\n||outside||",
+			code:     "```go\na || b\n```\n||not a spoiler||",
+			spoilers: []string{"outside"},
+		},
+		{
+			name:     "unbalanced inner fence",
+			md:       "`````\n````\n||a||\n`````\n\n||b|| and `||c||`",
+			code:     "````\n||a||",
+			spoilers: []string{"b"},
+		},
+		{
+			name:     "tilde fence",
+			md:       "~~~\n```\n||t||\n~~~\n||s||",
+			code:     "```\n||t||",
+			spoilers: []string{"s"},
+		},
+		{
+			name:     "between inline code",
+			md:       "`a` ||x|| ``b ` c`` ||y||",
+			spoilers: []string{"x", "y"},
+		},
+		{
+			name:     "backticks after digits are not a fence",
+			md:       "1999```\n||x||",
+			spoilers: []string{"x"},
+		},
+		{
+			name:     "fence in list items",
+			md:       "- ```\n  ||a||\n  ```\n1. > ```\n   > ||b||\n   > ```\n\n||c||",
+			spoilers: []string{"c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities, segments := ConvertWithSegments(tt.md, false, nil)
+			if tt.code != "" && (len(segments) != 1 || segments[0].RawCode != tt.code) {
+				t.Errorf("segments = %+v, want RawCode %q", segments, tt.code)
+			}
+			var spoilers []string
+			for _, e := range findEntities(entities, EntitySpoiler) {
+				spoilers = append(spoilers, extractEntityText(text, &e))
+			}
+			if !reflect.DeepEqual(spoilers, tt.spoilers) {
+				t.Errorf("spoilers = %q, want %q in %q", spoilers, tt.spoilers, text)
+			}
+		})
+	}
+}
+
+// TestHTMLBlock 测试块级 HTML 的文字提取
+func TestHTMLBlock(t *testing.T) {
+	tests := []struct {
+		name     string
+		md       string
+		text     string
+		entities []MessageEntity
+	}{
+		{
+			name: "paragraph",
+			md:   "before\n\n<p>Hello <b>world</b>, see <a href=\"https://ex.com\">this &amp; that</a>.</p>\n\nafter",
+			text: "before\n\nHello world, see this & that.\n\nafter",
+			entities: []MessageEntity{
+				{Type: EntityBold, Offset: 14, Length: 5},
+				{Type: EntityTextLink, Offset: 25, Length: 11, URL: "https://ex.com"},
+			},
+		},
+		{
+			name: "image",
+			md:   "<p align=\"center\">\n  <img src=\"https://ex.com/logo.png\" alt=\"Logo\">\n</p>\n\ntext",
+			text: "🖼Logo\n\ntext",
+			entities: []MessageEntity{
+				{Type: EntityTextLink, Offset: 2, Length: 4, URL: "https://ex.com/logo.png"},
+			},
+		},
+		{
+			name:     "blockquote",
+			md:       "<blockquote>\n<p>quoted <i>words</i></p>\n</blockquote>",
+			text:     "quoted words",
+			entities: []MessageEntity{{Type: EntityBlockquote, Offset: 0, Length: 12}, {Type: EntityItalic, Offset: 7, Length: 5}},
+		},
+		{
+			name:     "table",
+			md:       "<table>\n<tr><th>Name</th><th>Value</th></tr>\n<tr><td>a</td><td>1</td></tr>\n</table>",
+			text:     "Name | Value\n-----+------\na    | 1    ",
+			entities: []MessageEntity{{Type: EntityPre, Offset: 0, Length: 38}},
+		},
+		{
+			name: "nested unsupported tag",
+			md:   "<div>\n<p>kept</p>\n<video controls><source src=\"x.mp4\"><video>inner</video><p>fallback</p></video>\n<p>more</p>\n</div>",
+			text: "kept\n\nmore",
+		},
+		{
+			name: "comment",
+			md:   "<!-- note -->\n\ntext",
+			text: "text",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities := Convert(tt.md, false, nil)
+			if text != tt.text {
+				t.Errorf("text = %q, want %q", text, tt.text)
+			}
+			if !EntitiesEqual(entities, tt.entities) {
+				t.Errorf("entities differ: %v", DiffEntities(entities, tt.entities))
+			}
+		})
+	}
+
+	// 丢弃的元素记录为警告
+	h := newRecordHandler()
+	if _, err := Process(context.Background(), "<div><script>x()</script>text</div>", WithLogger(slog.New(h))); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if level, attrs, ok := h.find("unsupported html element dropped"); !ok || level != slog.LevelWarn || attrs["tag"] != "script" {
+		t.Errorf("log record = %v %v %v, want a warning for <script>", level, attrs, ok)
+	}
+}
+
+// TestInlineHTML_KbdMark 测试 <kbd> 和 <mark> 转换为实体
+func TestInlineHTML_KbdMark(t *testing.T) {
+	text, entities := Convert("Press <kbd>Ctrl</kbd>+<kbd class=\"key\">C</kbd> to copy", false, nil)
+	if text != "Press Ctrl+C to copy" {
+		t.Fatalf("text = %q", text)
+	}
+	want := []MessageEntity{{Type: EntityCode, Offset: 6, Length: 4}, {Type: EntityCode, Offset: 11, Length: 1}}
+	if !EntitiesEqual(entities, want) {
+		t.Errorf("entities differ: %v", DiffEntities(entities, want))
+	}
+
+	text, entities = Convert("a <mark>highlight</mark> and <KBD/>b", false, nil)
+	if text != "a highlight and b" {
+		t.Fatalf("text = %q", text)
+	}
+	want = []MessageEntity{{Type: EntityUnderline, Offset: 2, Length: 9}}
+	if !EntitiesEqual(entities, want) {
+		t.Errorf("entities differ: %v", DiffEntities(entities, want))
+	}
+
+	config := DefaultConfig()
+	config.MarkEntity = EntityBold
+	_, entities = Convert("a <mark>highlight</mark>", false, config)
+	if e := findEntity(entities, EntityBold); e == nil || e.Offset != 2 || e.Length != 9 {
+		t.Errorf("MarkEntity = bold: entities = %+v", entities)
+	}
+}
+
+// TestInlineHTML_EntityTag 测试 <tg-entity> 生成允许的实体类型，不允许的类型只保留文字，以及嵌套的标签；
+// 嵌套或不在行首的引用和 code、pre 中的实体不生成
+func TestInlineHTML_EntityTag(t *testing.T) {
+	text, entities := Convert(`a <tg-entity type="underline">b</tg-entity> <tg-entity type="text_link" url="https://example.com">c</tg-entity> <tg-entity type="pre" language="go">d</tg-entity> <tg-entity type="custom_emoji" custom_emoji_id="5368324170671202286">👍</tg-entity>`, false, nil)
+	if text != "a b c d 👍" {
+		t.Fatalf("text = %q", text)
+	}
+	want := []MessageEntity{
+		{Type: EntityUnderline, Offset: 2, Length: 1},
+		{Type: EntityTextLink, Offset: 4, Length: 1, URL: "https://example.com"},
+		{Type: EntityPre, Offset: 6, Length: 1, Language: "go"},
+		{Type: EntityCustomEmoji, Offset: 8, Length: 2, CustomEmojiID: "5368324170671202286"},
+	}
+	if !EntitiesEqual(entities, want) {
+		t.Errorf("entities differ: %v", DiffEntities(entities, want))
+	}
+
+	// 不在允许列表中的类型、缺少必需属性或地址不安全时只保留文字
+	for _, md := range []string{
+		`a <tg-entity type="date_time">b</tg-entity> c`,
+		`a <tg-entity type="text_mention">b</tg-entity> c`,
+		`a <tg-entity type="text_link" url="javascript:alert(1)">b</tg-entity> c`,
+		`a <tg-entity type="custom_emoji">b</tg-entity> c`,
+		`a <tg-entity>b</tg-entity> c`,
+	} {
+		text, entities := Convert(md, false, nil)
+		if text != "a b c" || len(entities) != 0 {
+			t.Errorf("Convert(%q) = %q %+v, want the text only", md, text, entities)
+		}
+	}
+
+	config := DefaultConfig()
+	config.EntityTagTypes = []string{"date_time", EntityBold}
+	_, entities = Convert(`a <tg-entity type="date_time">b</tg-entity> <tg-entity type="italic">c</tg-entity>`, false, config)
+	want = []MessageEntity{{Type: "date_time", Offset: 2, Length: 1}}
+	if !EntitiesEqual(entities, want) {
+		t.Errorf("custom EntityTagTypes: entities differ: %v", DiffEntities(entities, want))
+	}
+
+	// 嵌套的标签各自结束最近一个未结束的标签，不允许的内层标签不影响外层
+	md := `<tg-entity type="bold">a <tg-entity type="italic">b <tg-entity type="nope">c</tg-entity> d</tg-entity> e</tg-entity>`
+	for _, doc := range []string{md, "<p>" + md + "</p>"} {
+		text, entities := Convert(doc, false, nil)
+		if text != "a b c d e" {
+			t.Fatalf("Convert(%q) text = %q", doc, text)
+		}
+		want := []MessageEntity{
+			{Type: EntityItalic, Offset: 2, Length: 5},
+			{Type: EntityBold, Offset: 0, Length: 9},
+		}
+		if !EntitiesEqual(entities, want) {
+			t.Errorf("Convert(%q): entities differ: %v", doc, DiffEntities(entities, want))
+		}
+	}
+
+	// 结果必须能通过 ValidateEntities：引用不嵌套且从行首开始，code 和 pre 中没有其他实体
+	tests := []struct {
+		md       string
+		text     string
+		entities []MessageEntity
+	}{
+		{"> q <tg-entity type=\"blockquote\">x</tg-entity>", "q x", []MessageEntity{{Type: EntityBlockquote, Offset: 0, Length: 3}}},
+		{"<tg-entity type=\"blockquote\">a <tg-entity type=\"expandable_blockquote\">b</tg-entity></tg-entity>", "a b", []MessageEntity{{Type: EntityBlockquote, Offset: 0, Length: 3}}},
+		{"p <tg-entity type=\"blockquote\">x</tg-entity>", "p x", nil},
+		{"<tg-entity type=\"code\">x **b** y</tg-entity>", "x b y", []MessageEntity{{Type: EntityCode, Offset: 0, Length: 5}}},
+		{"<tg-entity type=\"pre\" language=\"go\">x *i* `c` [l](https://example.com)</tg-entity>", "x i c l", []MessageEntity{{Type: EntityPre, Offset: 0, Length: 7, Language: "go"}}},
+		{"<code>a <b>b</b></code> **c**", "a b c", []MessageEntity{{Type: EntityCode, Offset: 0, Length: 3}, {Type: EntityBold, Offset: 4, Length: 1}}},
+	}
+	for _, tt := range tests {
+		text, entities := Convert(tt.md, false, nil)
+		if text != tt.text || !EntitiesEqual(entities, tt.entities) {
+			t.Errorf("Convert(%q) = %q %+v, want %q %+v", tt.md, text, entities, tt.text, tt.entities)
+		}
+		if errs := ValidateEntities(text, entities); len(errs) > 0 {
+			t.Errorf("Convert(%q): %v", tt.md, errs)
+		}
+	}
+}
+
 // TestRule_HorizontalRule 测试水平线
 func TestRule_HorizontalRule(t *testing.T) {
 	text, _ := Convert("above\n\n---\n\nbelow", false, nil)
@@ -305,7 +1380,7 @@ func TestRule_HorizontalRule(t *testing.T) {
 func TestUTF16Offset_Emoji(t *testing.T) {
 	// 📌 is 2 UTF-16 code units
 	_, entities := Convert("📌 **bold**", false, nil)
-	bold := findEntity(entities, "bold")
+	bold := findEntity(entities, EntityBold)
 	if bold == nil {
 		t.Fatal("Convert() should have bold entity")
 	}
@@ -321,7 +1396,7 @@ func TestUTF16Offset_Emoji(t *testing.T) {
 // TestUTF16Offset_CJK 测试中日韩字符的 UTF-16 偏移
 func TestUTF16Offset_CJK(t *testing.T) {
 	_, entities := Convert("你好 **世界**", false, nil)
-	bold := findEntity(entities, "bold")
+	bold := findEntity(entities, EntityBold)
 	if bold == nil {
 		t.Fatal("Convert() should have bold entity")
 	}
@@ -383,3 +1458,946 @@ This is **bold** and *italic* text.
 	}
 }
 
+
+// TestConverter_MatchesConvert 测试 Converter 与包级 Convert 输出一致，且复用不影响之前的结果
+func TestConverter_MatchesConvert(t *testing.T) {
+	c := NewConverter()
+	docs := []string{
+		"# Title\n\n> quote with **bold**\n\n- a\n- [x] b",
+		"| a | b |\n|---|---|\n| 1 | 2 |",
+		"```go\nfmt.Println(1)\n```\n\nformula \\(\\frac{1}{2}\\)",
+	}
+	var first, snapshot []MessageEntity
+	for i, md := range docs {
+		wantText, wantEntities := Convert(md, true, nil)
+		gotText, gotEntities := c.Convert(md)
+		if gotText != wantText || !reflect.DeepEqual(gotEntities, wantEntities) {
+			t.Errorf("Converter.Convert(%q) = %q %+v, want %q %+v", md, gotText, gotEntities, wantText, wantEntities)
+		}
+		if i == 0 {
+			first = gotEntities
+			snapshot = append([]MessageEntity(nil), gotEntities...)
+		}
+	}
+	if !reflect.DeepEqual(first, snapshot) {
+		t.Errorf("entities of the first conversion changed after reuse: %+v", first)
+	}
+}
+
+// TestConverter_Options 测试 Converter 使用创建时的选项
+func TestConverter_Options(t *testing.T) {
+	c := NewConverter(WithLatexEscape(false), WithMaxMessageLength(10))
+	if text, _ := c.Convert("\\(\\alpha\\)"); !strings.Contains(text, "alpha") {
+		t.Errorf("Convert() with latex escaping disabled = %q", text)
+	}
+	contents, err := c.Process(context.Background(), "line one\n\nline two")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contents) != 2 {
+		t.Errorf("Process() returned %d contents, want 2", len(contents))
+	}
+}
+
+// TestSymbolOverrides 测试单独覆盖符号的选项只改变指定的符号
+func TestSymbolOverrides(t *testing.T) {
+	md := "# One\n\n## Two\n\n- [x] done\n- [ ] todo"
+
+	text, _ := NewConverter(WithTaskSymbols("✔", "✘")).Convert(md)
+	for _, want := range []string{"📌 One", "📝 Two", "✔ done", "✘ todo"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("WithTaskSymbols: Convert() = %q, want it to contain %q", text, want)
+		}
+	}
+
+	text, _ = NewConverter(WithHeadingSymbols("#")).Convert(md)
+	for _, want := range []string{"# One", "📝 Two", "✅ done"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("WithHeadingSymbols: Convert() = %q, want it to contain %q", text, want)
+		}
+	}
+
+	// 覆盖在 WithConfig 之前或之后都生效，且不修改传入的配置
+	custom := DefaultConfig()
+	custom.MarkdownSymbol.HeadingLevel2 = "§"
+	for _, opts := range [][]Option{
+		{WithConfig(custom), WithSymbolOverride(func(s *Symbol) { s.HeadingLevel1 = "¶" })},
+		{WithSymbolOverride(func(s *Symbol) { s.HeadingLevel1 = "¶" }), WithConfig(custom)},
+	} {
+		text, _ = NewConverter(opts...).Convert(md)
+		if !strings.Contains(text, "¶ One") || !strings.Contains(text, "§ Two") {
+			t.Errorf("WithSymbolOverride with WithConfig: Convert() = %q", text)
+		}
+	}
+	if custom.MarkdownSymbol.HeadingLevel1 != "📌" {
+		t.Errorf("override modified the config passed to WithConfig: %+v", custom.MarkdownSymbol)
+	}
+	if text, _ := Convert(md, false, nil); !strings.Contains(text, "📌 One") || !strings.Contains(text, "✅ done") {
+		t.Errorf("overrides leaked into the defaults: %q", text)
+	}
+}
+
+// TestConverter_Concurrent 测试多个 goroutine 并发使用同一个 Converter（配合 -race 运行）
+func TestConverter_Concurrent(t *testing.T) {
+	c := NewConverter(WithMermaid(false))
+	docs := []string{
+		"# Heading\n\n**bold** and *italic* with `code`",
+		"> quote\n\n1. one\n2. two",
+		"||spoiler|| and [link](https://example.com)",
+		"```python\nprint(1)\n```",
+	}
+	want := make([]string, len(docs))
+	for i, md := range docs {
+		want[i], _ = Convert(md, true, nil)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 50; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				idx := (g + i) % len(docs)
+				if text, _ := c.Convert(docs[idx]); text != want[idx] {
+					t.Errorf("goroutine %d: Convert(%q) = %q, want %q", g, docs[idx], text, want[idx])
+					return
+				}
+				if _, err := c.Process(context.Background(), docs[idx]); err != nil {
+					t.Errorf("goroutine %d: Process() error = %v", g, err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+const benchmarkMarkdown = "# Title\n\nSome **bold** text with a [link](https://example.com) and `code`.\n\n" +
+	"> a quote\n\n- item one\n- item two\n\n| a | b |\n|---|---|\n| 1 | 2 |\n"
+
+// TestDefaultConfig_Isolated 测试修改 DefaultConfig 和 Clone 的结果不影响其他配置
+func TestDefaultConfig_Isolated(t *testing.T) {
+	custom := DefaultConfig()
+	custom.MarkdownSymbol.HeadingLevel1 = "#"
+	custom.FrontMatterHeading = []string{"title"}
+	if got := DefaultConfig().MarkdownSymbol.HeadingLevel1; got != "📌" {
+		t.Errorf("DefaultConfig() heading symbol = %q after modifying an earlier copy", got)
+	}
+
+	clone := custom.Clone()
+	clone.MarkdownSymbol.HeadingLevel1 = "##"
+	clone.FrontMatterHeading[0] = "date"
+	if custom.MarkdownSymbol.HeadingLevel1 != "#" || custom.FrontMatterHeading[0] != "title" {
+		t.Errorf("modifying a clone changed the original: %+v %v", custom.MarkdownSymbol, custom.FrontMatterHeading)
+	}
+	if (*RenderConfig)(nil).Clone() != nil || (*Symbol)(nil).Clone() != nil {
+		t.Error("Clone() of nil should be nil")
+	}
+}
+
+// TestDefaultConfig_Concurrent 测试两个 goroutine 各自修改默认配置并同时转换（配合 -race 运行）
+func TestDefaultConfig_Concurrent(t *testing.T) {
+	symbols := []string{"🅰", "🅱"}
+	var wg sync.WaitGroup
+	for _, symbol := range symbols {
+		wg.Add(1)
+		go func(symbol string) {
+			defer wg.Done()
+			config := DefaultConfig()
+			config.MarkdownSymbol.HeadingLevel1 = symbol
+			for i := 0; i < 200; i++ {
+				text, _ := Convert("# Title", false, config)
+				if want := symbol + " Title"; !strings.HasPrefix(text, want) {
+					t.Errorf("Convert() = %q, want prefix %q", text, want)
+					return
+				}
+				if text, _ := Convert("# Title", false, nil); !strings.HasPrefix(text, "📌 Title") {
+					t.Errorf("Convert() with nil config = %q, want the default symbol", text)
+					return
+				}
+			}
+		}(symbol)
+	}
+	wg.Wait()
+}
+
+// TestConvertAST 测试转换调用方解析好的 AST 与直接转换 Markdown 的结果一致
+func TestConvertAST(t *testing.T) {
+	md := goldmark.New(StandardOptions()...)
+	docs := []string{
+		"# Title\n\n> quote with **bold** and [link](https://example.com)\n\n- a\n- [x] b",
+		"| a | b |\n|---|---|\n| 1 | 2 |",
+		"1. one\n2. two\n\n```go\nfmt.Println(1)\n```\n\n---\n\n~~gone~~ `code`",
+	}
+	for _, doc := range docs {
+		source := []byte(doc)
+		node := md.Parser().Parse(text.NewReader(source))
+
+		wantText, wantEntities, wantSegments := ConvertWithSegments(doc, false, nil)
+		gotText, gotEntities, gotSegments := ConvertAST(node, source, nil)
+		if gotText != wantText || !reflect.DeepEqual(gotEntities, wantEntities) || !reflect.DeepEqual(gotSegments, wantSegments) {
+			t.Errorf("ConvertAST(%q) = %q %+v %+v, want %q %+v %+v",
+				doc, gotText, gotEntities, gotSegments, wantText, wantEntities, wantSegments)
+		}
+		if gotText, _, _ := NewConverter().ConvertAST(node, source); gotText != wantText {
+			t.Errorf("Converter.ConvertAST(%q) = %q, want %q", doc, gotText, wantText)
+		}
+	}
+}
+
+// TestConvertAST_OtherExtensions 测试解析器的扩展与 StandardOptions 不同时仍能转换
+func TestConvertAST_OtherExtensions(t *testing.T) {
+	source := []byte("| a | b |\n|---|---|\n| 1 | 2 |\n\n- [x] done\n\n\"quoted\" **bold**")
+	tests := []struct {
+		name string
+		md   goldmark.Markdown
+		want []string
+	}{
+		{"no extensions", goldmark.New(), []string{"| a | b |", "[x] done", "bold"}},
+		{"extra extension", goldmark.New(append(StandardOptions(), goldmark.WithExtensions(extension.Typographer))...),
+			[]string{"a", "2", "done", "quoted", "bold"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := tt.md.Parser().Parse(text.NewReader(source))
+			got, entities, _ := ConvertAST(node, source, nil)
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("ConvertAST() = %q, want it to contain %q", got, want)
+				}
+			}
+			if e := findEntity(entities, EntityBold); e == nil || extractEntityText(got, e) != "bold" {
+				t.Errorf("bold entity = %+v in %q", e, got)
+			}
+		})
+	}
+}
+
+// TestGoldmarkOptions 测试替换或追加 goldmark 选项：关闭脚注后脚注语法保留为文字，
+// 扩展产生的未知节点不会导致 panic
+func TestGoldmarkOptions(t *testing.T) {
+	md := "see [^1] here\n\n[^1]: the note"
+	noFootnotes := []Option{
+		WithStandardOptions(false),
+		WithGoldmarkOptions(goldmark.WithExtensions(extension.GFM, extension.DefinitionList)),
+	}
+	if got, _ := NewConverter(noFootnotes...).Convert(md); got != md {
+		t.Errorf("without footnotes Convert(%q) = %q, want it unchanged", md, got)
+	}
+	if got, _ := NewConverter().Convert(md); got == md {
+		t.Errorf("with footnotes Convert(%q) kept the footnote syntax", md)
+	}
+	contents, err := Process(context.Background(), md, noFootnotes...)
+	if err != nil || len(contents) != 1 || contents[0].(*Text).Text != md {
+		t.Errorf("Process() = %+v, %v, want a single Text %q", contents, err, md)
+	}
+
+	custom := WithGoldmarkOptions(goldmark.WithParserOptions(
+		gmparser.WithASTTransformers(util.Prioritized(customNodeTransformer{}, 999)),
+	))
+	got, entities := NewConverter(custom).Convert("**bold** text\n\nsecond")
+	if want := "bold text\n\nlabel\n\nsecond"; got != want {
+		t.Errorf("with custom nodes Convert() = %q, want %q", got, want)
+	}
+	if e := findEntity(entities, EntityBold); e == nil || extractEntityText(got, e) != "bold" {
+		t.Errorf("bold entity = %+v in %q", e, got)
+	}
+}
+
+var (
+	kindCustomInline = ast.NewNodeKind("CustomInline")
+	kindCustomBlock  = ast.NewNodeKind("CustomBlock")
+)
+
+// customInline 和 customBlock 模拟其他扩展产生的、转换器不认识的节点
+type customInline struct{ ast.BaseInline }
+
+func (n *customInline) Kind() ast.NodeKind            { return kindCustomInline }
+func (n *customInline) Dump(source []byte, level int) { ast.DumpHelper(n, source, level, nil, nil) }
+
+type customBlock struct{ ast.BaseBlock }
+
+func (n *customBlock) Kind() ast.NodeKind            { return kindCustomBlock }
+func (n *customBlock) Dump(source []byte, level int) { ast.DumpHelper(n, source, level, nil, nil) }
+
+// customNodeTransformer 在文档开头插入一个没有子节点的未知块，把第一段的内容包进
+// 未知的行内节点，并在第一段后插入一个只含文字的未知块
+type customNodeTransformer struct{}
+
+func (customNodeTransformer) Transform(doc *ast.Document, reader text.Reader, pc gmparser.Context) {
+	first := doc.FirstChild()
+	wrapper := &customInline{}
+	for child := first.FirstChild(); child != nil; child = first.FirstChild() {
+		wrapper.AppendChild(wrapper, child)
+	}
+	first.AppendChild(first, wrapper)
+
+	label := &customBlock{}
+	label.AppendChild(label, ast.NewString([]byte("label")))
+	doc.InsertAfter(doc, first, label)
+	doc.InsertBefore(doc, first, &customBlock{})
+}
+
+// TestDisabledEntities 测试禁用的实体类型不再生成，对应的文字保留
+func TestDisabledEntities(t *testing.T) {
+	config := DefaultConfig()
+	config.DisabledEntities = []string{EntitySpoiler, EntityUnderline, EntityCustomEmoji, EntityBlockquote}
+	md := "# Title\n\nthe ||secret|| is <u>here</u> ![👍](tg://emoji?id=5368324170671202286)\n\n**>" + strings.Repeat("long quote ", 30) + "||"
+	text, entities := Convert(md, false, config)
+	for _, want := range []string{"Title", "the secret is here 👍", "long quote"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Convert() = %q, want it to contain %q", text, want)
+		}
+	}
+	for _, e := range entities {
+		switch e.Type {
+		case EntitySpoiler, EntityUnderline, EntityCustomEmoji, EntityBlockquote, EntityExpandableBlockquote:
+			t.Errorf("disabled entity emitted: %+v", e)
+		}
+	}
+	if e := findEntity(entities, EntityBold); e == nil || extractEntityText(text, e) != "Title" {
+		t.Errorf("bold entity = %+v in %q", e, text)
+	}
+
+	if _, entities := Convert(md, false, nil); findEntity(entities, EntitySpoiler) == nil || findEntity(entities, EntityCustomEmoji) == nil {
+		t.Errorf("default config entities = %+v, want spoiler and custom emoji", entities)
+	}
+}
+
+// TestTypographer 测试排版替换：紧挨粗体标记的引号、破折号和省略号被替换，
+// 行内代码、代码块、剧透标签和链接地址保持原样，实体偏移对应替换后的文本
+func TestTypographer(t *testing.T) {
+	c := NewConverter(WithTypographer(true))
+	tests := []struct {
+		name     string
+		md       string
+		want     string
+		wantType string
+		wantText string
+	}{
+		{"quotes around bold", `"**bold**" and it's`, "“bold” and it’s", EntityBold, "bold"},
+		{"single quotes around italic", "say '*hi*' -- then --- end...", "say ‘hi’ – then — end…", EntityItalic, "hi"},
+		{"code span", "wait... `x... \"y\" --`", "wait… x... \"y\" --", EntityCode, `x... "y" --`},
+		{"code block", "```\n\"a\" -- ...\n```", "\"a\" -- ...", EntityPre, "\"a\" -- ..."},
+		{"spoiler", `||"secret"|| and <tg-spoiler>don't</tg-spoiler>`, "“secret” and don’t", EntitySpoiler, "“secret”"},
+		{"link", `[say "hi"](https://example.com/a--b...)`, "say “hi”", EntityTextLink, "say “hi”"},
+		{"shift operators", "a << b >> c", "a << b >> c", "", ""},
+		{"quote attribution", "> first line\n> second line\n> -- Author", "first line\nsecond line\n– Author", EntityItalic, "– Author"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities := c.Convert(tt.md)
+			if text != tt.want {
+				t.Errorf("Convert(%q) = %q, want %q", tt.md, text, tt.want)
+			}
+			if tt.wantType == "" {
+				return
+			}
+			e := findEntity(entities, tt.wantType)
+			if e == nil || extractEntityText(text, e) != tt.wantText {
+				t.Errorf("%s entity = %+v in %q, want it to cover %q", tt.wantType, e, text, tt.wantText)
+			}
+			if e != nil && e.Type == EntityTextLink && e.URL != "https://example.com/a--b..." {
+				t.Errorf("link URL = %q", e.URL)
+			}
+		})
+	}
+	if text, _ := NewConverter().Convert(`"a" -- b...`); text != `"a" -- b...` {
+		t.Errorf("without WithTypographer Convert() = %q", text)
+	}
+}
+
+// TestUnknownNodes 测试不认识的节点：行内节点保留子节点的文字，没有子节点的块保留原文行，
+// OnUnknownNode 被调用并可以代替默认处理
+func TestUnknownNodes(t *testing.T) {
+	md := "intro\n\n```math\nx^2 + y^2\n```\nafter"
+	c := NewConverter(WithGoldmarkOptions(goldmark.WithParserOptions(
+		gmparser.WithASTTransformers(util.Prioritized(mathBlockTransformer{}, 999)),
+	)))
+	if got, _ := c.Convert(md); got != "intro\n\nx^2 + y^2\n\nafter" {
+		t.Errorf("Convert() = %q, want the math block kept as a paragraph", got)
+	}
+
+	var seen []ast.NodeKind
+	config := DefaultConfig()
+	config.OnUnknownNode = func(node ast.Node, source []byte) (string, bool) {
+		seen = append(seen, node.Kind())
+		if node.Kind() != kindCustomBlock {
+			return "", false
+		}
+		return "[" + string(node.Lines().Value(source)) + "]", true
+	}
+	c = NewConverter(WithConfig(config), WithGoldmarkOptions(goldmark.WithParserOptions(
+		gmparser.WithASTTransformers(util.Prioritized(mathBlockTransformer{}, 999)),
+	)))
+	if got, _ := c.Convert(md); got != "intro\n\n[x^2 + y^2\n]\n\nafter" {
+		t.Errorf("with OnUnknownNode Convert() = %q", got)
+	}
+	if len(seen) != 1 || seen[0] != kindCustomBlock {
+		t.Errorf("OnUnknownNode called for %v, want [%v]", seen, kindCustomBlock)
+	}
+}
+
+// mathBlockTransformer 把语言为 math 的代码块换成没有子节点、只有原文行的未知块，
+// 模拟公式扩展
+type mathBlockTransformer struct{}
+
+func (mathBlockTransformer) Transform(doc *ast.Document, reader text.Reader, pc gmparser.Context) {
+	source := reader.Source()
+	for n := doc.FirstChild(); n != nil; n = n.NextSibling() {
+		code, ok := n.(*ast.FencedCodeBlock)
+		if !ok || string(code.Language(source)) != "math" {
+			continue
+		}
+		block := &customBlock{}
+		block.SetLines(code.Lines())
+		doc.ReplaceChild(doc, code, block)
+		n = block
+	}
+}
+
+// BenchmarkConvert_500KB 大文档转换，关注文本缓冲区的开销
+func BenchmarkConvert_500KB(b *testing.B) {
+	var sb strings.Builder
+	for i := 0; sb.Len() < 500<<10; i++ {
+		// 标题互不相同，避免 goldmark 生成重复 heading ID 的额外开销
+		fmt.Fprintf(&sb, "## Part %d\n\n", i)
+		sb.WriteString("Some **bold** text with a [link](https://example.com) and `code`.\n\n> a quote\n\n")
+		sb.WriteString("\n```go\nfmt.Println(1)\n```\n\n- [x] done\n\n")
+	}
+	md := sb.String()
+	b.SetBytes(int64(len(md)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Convert(md, true, nil)
+	}
+}
+
+// BenchmarkConvert_FreshConverter 基线：每次转换都重新构建解析器
+func BenchmarkConvert_FreshConverter(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		NewConverter().Convert(benchmarkMarkdown)
+	}
+}
+
+// BenchmarkConverter_Convert 复用同一个 Converter
+func BenchmarkConverter_Convert(b *testing.B) {
+	c := NewConverter()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Convert(benchmarkMarkdown)
+	}
+}
+
+// TestLatex_DollarMath 测试 $...$ 和 $$...$$ 公式的识别
+func TestLatex_DollarMath(t *testing.T) {
+	tests := []struct {
+		name string
+		md   string
+		want string
+	}{
+		{"currency", "It costs $5 and $10 today.", "It costs $5 and $10 today."},
+		{"currency pair", "between $5 - $10", "between $5 - $10"},
+		{"inline formula", "Energy: $E = mc^2$ holds.", "Energy: $E = mc²$ holds."},
+		{"greek formula", "angle $\\alpha + \\beta$ here", "angle $α + β$ here"},
+		{"space after opening", "a $ \\alpha + \\beta$ b", "a $ \\alpha + \\beta$ b"},
+		{"escaped dollar", "price \\$\\alpha + \\beta$", "price \\$\\alpha + \\beta$"},
+		{"display multiline", "$$\n\\frac{1}{2} + \\pi r^2\n$$", "$$½ + π r²$$"},
+		{"inside code span", "use `$\\alpha + \\beta$` literally", "use $\\alpha + \\beta$ literally"},
+		{"accent only", "velocity $\\vec{v}$ here", "velocity $v\u20d7$ here"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if text, _ := Convert(tt.md, true, nil); text != tt.want {
+				t.Errorf("Convert(%q) = %q, want %q", tt.md, text, tt.want)
+			}
+		})
+	}
+
+	// 关闭 LaTeX 转义时不做任何处理
+	if text, _ := Convert("$E = mc^2$", false, nil); text != "$E = mc^2$" {
+		t.Errorf("Convert() without latex escape = %q", text)
+	}
+}
+
+// TestLatex_DollarMathInCodeBlock 测试围栏代码块和缩进代码块中的 $ 不被转换
+func TestLatex_DollarMathInCodeBlock(t *testing.T) {
+	md := "```sh\necho $HOME $\\alpha + \\beta$\n```"
+	text, _ := Convert(md, true, nil)
+	if !strings.Contains(text, "$\\alpha + \\beta$") {
+		t.Errorf("code block content should be untouched, got %q", text)
+	}
+
+	for _, md := range []string{"    $\\alpha$ indented code", "text\n\n    $$\\frac{1}{2}$$\n    $x^2$"} {
+		text, entities := Convert(md, true, nil)
+		pre := findEntity(entities, EntityPre)
+		want := strings.ReplaceAll(md[strings.Index(md, "    ")+4:], "\n    ", "\n")
+		if pre == nil || extractEntityText(text, pre) != want {
+			t.Errorf("Convert(%q) = %q %+v, want indented code %q untouched", md, text, entities, want)
+		}
+	}
+}
+
+// TestLatex_Multiline 测试跨行公式、引用块中的公式和代码块（包括缩进代码块）中的公式
+func TestLatex_Multiline(t *testing.T) {
+	tests := []struct {
+		name string
+		md   string
+		want string
+	}{
+		{"display formula over three lines", "before\n\\[\n\\frac{1}{2}\n+ \\alpha\n\\]\nafter", "before\n$$½ + α$$\nafter"},
+		{"inline in quote", "> The energy is \\(E=mc^2\\)", "The energy is $E=mc²$"},
+		{"display in quote", "> quote\n> \\[\n> \\alpha +\n> \\beta\n> \\]\n> end", "quote\n$$α + β$$\nend"},
+		{"line break in quote", "> \\[\\alpha \\\\ \\beta\\]", "$$α\nβ$$"},
+		{"tight list", "- item \\(\\alpha\\)\n- item \\(\\beta\\)", "⦁ item $α$\n⦁ item $β$\n"},
+		{"fenced code untouched", "```\n\\[\\alpha\\]\n```", "\\[\\alpha\\]"},
+		{"blank line ends formula", "a \\[\\alpha\n\nb\\]", "a \\[\\alpha\n\nb\\]"},
+		{"blank line in quote ends formula", "> a \\(\\alpha\n>\n> b\\)", "a \\(\\alpha\n\nb\\)"},
+		{"unclosed delimiter before blank line", "Use \\( for grouping.\n\nThen \\(\\alpha + \\beta\\) holds.", "Use \\( for grouping.\n\nThen $α + β$ holds."},
+		{"indented code untouched", "para\n\n    x = \\(\\alpha + y\\) and ||z||\n\tand \\[\\beta\\]", "para\n\nx = \\(\\alpha + y\\) and ||z||\nand \\[\\beta\\]"},
+		{"indented line continues paragraph", "para\n    \\(\\alpha\\)", "para\n$α$"},
+		{"indented paragraph in list item", "- item\n\n    \\(\\alpha\\)", "⦁ item\n  $α$\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, entities := Convert(tt.md, true, nil)
+			if text != tt.want {
+				t.Errorf("Convert(%q) = %q, want %q", tt.md, text, tt.want)
+			}
+			if strings.HasPrefix(tt.md, ">") && findEntity(entities, EntityBlockquote) == nil {
+				t.Errorf("Convert(%q): formula broke out of the quote, entities %+v", tt.md, entities)
+			}
+		})
+	}
+}
+
+// TestLatex_CommandOnlyFormulas 测试只含重音、换行、编号等命令而不含其他符号的公式也会被转换
+func TestLatex_CommandOnlyFormulas(t *testing.T) {
+	tests := []struct {
+		md   string
+		want string
+	}{
+		{"\\(\\vec{v}\\)", "$v\u20d7$"},
+		{"\\(\\hat{x} + \\bar{y}\\)", "$x\u0302 + y\u0304$"},
+		{"\\[\\overline{AB}\\]", "$$A\u0305B\u0305$$"},
+		{"\\(a \\\\ b\\)", "$a\nb$"},
+		{"\\[x = 1 \\\\ y = 2\\]", "$$x = 1\ny = 2$$"},
+		{"see \\(\\ref{x}\\)", "see $x$"},
+		{"see \\(\\eqref{eq:1}\\)", "see $(eq:1)$"},
+		{"\\[x = 1 \\tag{1}\\]", "$$x = 1  (1)$$"},
+		{"\\(\\tag{1}\\)", "$(1)$"},
+		{"\\(A \\xrightarrow{f} B\\)", "$A →(f) B$"},
+	}
+	for _, tt := range tests {
+		if text, _ := Convert(tt.md, true, nil); text != tt.want {
+			t.Errorf("Convert(%q) = %q, want %q", tt.md, text, tt.want)
+		}
+	}
+}
+
+// TestLatex_AlignedBlock 测试 aligned 环境的对齐补位经过 Markdown 转换后仍然保留
+func TestLatex_AlignedBlock(t *testing.T) {
+	md := "\\[\\begin{aligned} x &= a + b \\\\ &= c \\\\ yyy &= d \\end{aligned}\\]"
+	rows := "\u00a0\u00a0x = a + b\n\u00a0\u00a0\u00a0 = c\nyyy = d"
+	tests := []struct {
+		mode MathDelimiters
+		want string
+	}{
+		{MathDelimitersKeep, "$$" + rows + "$$"},
+		{MathDelimitersStrip, rows},
+		{MathDelimitersCode, rows},
+	}
+	for _, tt := range tests {
+		config := DefaultConfig()
+		config.MathDelimiters = tt.mode
+		text, entities := Convert(md, true, config)
+		if text != tt.want {
+			t.Errorf("mode %q: Convert(%q) = %q, want %q", tt.mode, md, text, tt.want)
+		}
+		if tt.mode == MathDelimitersCode {
+			if pre := findEntity(entities, EntityPre); pre == nil || extractEntityText(text, pre) != rows {
+				t.Errorf("mode %q: pre entity %+v should cover all rows", tt.mode, pre)
+			}
+		}
+	}
+
+	// 带星号的环境同样按等号对齐，& 不会原样输出
+	text, _ := Convert("\\[\\begin{align*} a &= b \\\\ cc &= d \\end{align*}\\]", true, nil)
+	if want := "$$\u00a0a = b\ncc = d$$"; text != want {
+		t.Errorf("align*: Convert() = %q, want %q", text, want)
+	}
+}
+
+// TestLatex_ArrayColumns 测试 array 环境右对齐、居中列的补位经过 Markdown 转换后仍然保留
+func TestLatex_ArrayColumns(t *testing.T) {
+	md := "\\[\\begin{array}{rc} 1 & x \\\\ 100 & yyy \\end{array}\\]"
+	rows := "\u00a0\u00a01  \u00a0x\n100  yyy"
+	tests := []struct {
+		mode MathDelimiters
+		want string
+	}{
+		{MathDelimitersKeep, "$$" + rows + "$$"},
+		{MathDelimitersStrip, rows},
+		{MathDelimitersCode, rows},
+	}
+	for _, tt := range tests {
+		config := DefaultConfig()
+		config.MathDelimiters = tt.mode
+		if text, _ := Convert(md, true, config); text != tt.want {
+			t.Errorf("mode %q: Convert(%q) = %q, want %q", tt.mode, md, text, tt.want)
+		}
+	}
+}
+
+// TestLatex_TextStyles 测试公式外的 \textbf 等命令转换为实体，公式内保持数学字体
+func TestLatex_TextStyles(t *testing.T) {
+	md := "This is \\textbf{important}: \\(x^2 + \\textbf{v}\\), \\textit{see} \\underline{notes} and \\texttt{go vet}."
+	text, entities := Convert(md, true, nil)
+	want := "This is important: $x² + 𝐯$, see notes and go vet."
+	if text != want {
+		t.Fatalf("Convert() = %q, want %q", text, want)
+	}
+	checks := []struct {
+		entityType string
+		inner      string
+	}{
+		{EntityBold, "important"},
+		{EntityItalic, "see"},
+		{EntityUnderline, "notes"},
+		{EntityCode, "go vet"},
+	}
+	for _, c := range checks {
+		e := findEntity(entities, c.entityType)
+		if e == nil || extractEntityText(text, e) != c.inner {
+			t.Errorf("%s entity = %+v, want it to cover %q", c.entityType, e, c.inner)
+		}
+	}
+	if len(entities) != len(checks) {
+		t.Errorf("got %d entities, want %d: %+v", len(entities), len(checks), entities)
+	}
+
+	// 代码中的命令原样保留，关闭 LaTeX 转换时也不改写
+	text, _ = Convert("`\\textbf{x}` and \\textbf{y}", false, nil)
+	if text != "\\textbf{x} and \\textbf{y}" {
+		t.Errorf("latexEscape off: Convert() = %q", text)
+	}
+	text, _ = Convert("`\\textbf{x}` and \\textbf{y}", true, nil)
+	if text != "\\textbf{x} and y" {
+		t.Errorf("code span: Convert() = %q", text)
+	}
+}
+
+// TestLatex_UnknownCommands 测试 UnknownLatexCommands 传递到公式转换
+func TestLatex_UnknownCommands(t *testing.T) {
+	md := "see \\(\\alpha \\foo + \\hspace{1em}\\beta\\)"
+	tests := []struct {
+		mode UnknownLatexCommands
+		want string
+	}{
+		{"", "see $α \\foo + \\hspace1emβ$"},
+		{UnknownLatexCommandsKeep, "see $α \\foo + \\hspace1emβ$"},
+		{UnknownLatexCommandsStrip, "see $α foo + hspace1emβ$"},
+		{UnknownLatexCommandsDrop, "see $α  + β$"},
+	}
+	for _, tt := range tests {
+		config := &RenderConfig{
+			MarkdownSymbol:       DefaultConfig().MarkdownSymbol,
+			CiteExpandable:       true,
+			UnknownLatexCommands: tt.mode,
+		}
+		if text, _ := Convert(md, true, config); text != tt.want {
+			t.Errorf("mode %q: Convert(%q) = %q, want %q", tt.mode, md, text, tt.want)
+		}
+	}
+}
+
+// TestLatex_MathDelimiters 测试三种公式包裹模式
+func TestLatex_MathDelimiters(t *testing.T) {
+	inline := "the answer is \\(x^2 + \\alpha\\) here"
+	block := "before\n\n\\[\\frac{1}{2} + \\beta\\]\n\nafter"
+	tests := []struct {
+		mode      MathDelimiters
+		md        string
+		wantText  string
+		wantType  string
+		wantInner string
+	}{
+		{MathDelimitersKeep, inline, "the answer is $x² + α$ here", "", ""},
+		{MathDelimitersKeep, block, "before\n\n$$½ + β$$\n\nafter", "", ""},
+		{"", inline, "the answer is $x² + α$ here", "", ""},
+		{MathDelimitersStrip, inline, "the answer is x² + α here", "", ""},
+		{MathDelimitersStrip, block, "before\n\n½ + β\n\nafter", "", ""},
+		{MathDelimitersCode, inline, "the answer is x² + α here", EntityCode, "x² + α"},
+		{MathDelimitersCode, block, "before\n\n½ + β\n\nafter", EntityPre, "½ + β"},
+		{MathDelimitersCode, "inline $E = mc^2$ too", "inline E = mc² too", EntityCode, "E = mc²"},
+		// 列表项中的块级公式不插入空行，之后的文字仍属于该项
+		{MathDelimitersCode, "- item $$\\frac{1}{2}\\alpha$$ x\n- next", "⦁ item\n½α\n  x\n⦁ next\n", EntityPre, "½α"},
+		{MathDelimitersCode, "10. item \\[\\frac{1}{2}\\alpha\\] x", "10. item\n½α\n    x\n", EntityPre, "½α"},
+		{MathDelimitersCode, "> q $$\\frac{1}{2}\\alpha$$ x", "q\n\n½α\n\nx", EntityPre, "½α"},
+	}
+	for _, tt := range tests {
+		config := &RenderConfig{
+			MarkdownSymbol: DefaultConfig().MarkdownSymbol,
+			CiteExpandable: true,
+			MathDelimiters: tt.mode,
+		}
+		text, entities := Convert(tt.md, true, config)
+		if text != tt.wantText {
+			t.Errorf("mode %q: Convert(%q) = %q, want %q", tt.mode, tt.md, text, tt.wantText)
+			continue
+		}
+		if tt.wantType == "" {
+			if len(entities) != 0 {
+				t.Errorf("mode %q: unexpected entities %+v", tt.mode, entities)
+			}
+			continue
+		}
+		e := findEntity(entities, tt.wantType)
+		if e == nil || strings.TrimRight(extractEntityText(text, e), "\n") != tt.wantInner {
+			t.Errorf("mode %q: %s entity = %+v in %q, want it to cover %q", tt.mode, tt.wantType, e, text, tt.wantInner)
+		}
+	}
+}
+
+// TestLatex_MathEntity 测试 MathEntity 和 MathBlockEntity：实体只覆盖公式，
+// 数学字母都在 BMP 之外，偏移和长度按 UTF-16 代理对计算；列表项中的块级公式留在项内，
+// 不生成不从行首开始的引用
+func TestLatex_MathEntity(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     MathDelimiters
+		md       string
+		text     string
+		entities []MessageEntity
+	}{
+		{
+			name:     "inline math bold",
+			mode:     MathDelimitersStrip,
+			md:       "𝒜 let \\(\\mathbf{xy} + 1\\) be",
+			text:     "𝒜 let 𝐱𝐲 + 1 be",
+			entities: []MessageEntity{{Type: EntityItalic, Offset: 7, Length: 8}},
+		},
+		{
+			name:     "keep delimiters outside",
+			md:       "so $\\mathbb{R}^2$ holds",
+			text:     "so $ℝ²$ holds",
+			entities: []MessageEntity{{Type: EntityItalic, Offset: 4, Length: 2}},
+		},
+		{
+			name:     "block in its own paragraph",
+			mode:     MathDelimitersStrip,
+			md:       "see $$\\mathbf{v} \\\\ \\alpha$$ below",
+			text:     "see\n\n𝐯\nα\n\nbelow",
+			entities: []MessageEntity{{Type: EntityBlockquote, Offset: 5, Length: 4}},
+		},
+		{
+			name:     "block inside a quote",
+			mode:     MathDelimitersStrip,
+			md:       "> where \\[\\mathbf{F} = m\\mathbf{a}\\]",
+			text:     "where\n\n𝐅 = m𝐚",
+			entities: []MessageEntity{{Type: EntityBlockquote, Offset: 0, Length: 15}},
+		},
+		{
+			name:     "keep block delimiters inside the quote",
+			md:       "see $$\\mathbf{v}$$ below",
+			text:     "see\n\n$$𝐯$$\n\nbelow",
+			entities: []MessageEntity{{Type: EntityBlockquote, Offset: 5, Length: 6}},
+		},
+		{
+			name:     "block stays in its list item",
+			mode:     MathDelimitersStrip,
+			md:       "- item $$\\frac{1}{2}\\alpha$$ more\n- next",
+			text:     "⦁ item\n  ½α\n  more\n⦁ next\n",
+			entities: []MessageEntity{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.MathDelimiters = tt.mode
+			config.MathEntity = EntityItalic
+			config.MathBlockEntity = EntityBlockquote
+			text, entities := Convert(tt.md, true, config)
+			if text != tt.text {
+				t.Errorf("Convert(%q) = %q, want %q", tt.md, text, tt.text)
+			}
+			if !reflect.DeepEqual(entities, tt.entities) {
+				t.Errorf("entities = %+v, want %+v", entities, tt.entities)
+			}
+			if errs := ValidateEntities(text, entities); len(errs) > 0 {
+				t.Errorf("ValidateEntities() = %v", errs)
+			}
+		})
+	}
+
+	// 不设置时公式照常只输出文字
+	if _, entities := Convert("let \\(\\mathbf{x}\\) be", true, nil); len(entities) != 0 {
+		t.Errorf("default config entities = %+v, want none", entities)
+	}
+}
+
+// TestLeadingBlocks_NoLeadingSpace 测试文档以列表、引用、代码块、剧透开头（包括前面有
+// BOM 或没有输出的块）时，渲染结果不以空白开头，第一个实体位于预期的偏移
+func TestLeadingBlocks_NoLeadingSpace(t *testing.T) {
+	tests := []struct {
+		name       string
+		md         string
+		wantType   string
+		wantOffset int
+	}{
+		{"list", "- **a**\n- b", EntityBold, 2},
+		{"ordered list", "1. **a**\n   - b", EntityBold, 3},
+		{"quote", "> **q**", EntityBlockquote, 0},
+		{"code fence", "```go\nx\n```\n\ntext", EntityPre, 0},
+		{"spoiler", "||**s**|| text", EntitySpoiler, 0},
+		{"spoiler tag", "<tg-spoiler>s</tg-spoiler> text", EntitySpoiler, 0},
+		{"BOM list", "\ufeff- **a**", EntityBold, 2},
+		{"BOM quote", "\ufeff> q", EntityBlockquote, 0},
+		{"comment then list", "<!-- c -->\n\n- **a**", EntityBold, 2},
+		{"empty fence then quote", "```\n```\n\n> q", EntityBlockquote, 0},
+		{"empty div then code", "<div></div>\n\n```go\nx\n```", EntityPre, 0},
+		{"br then spoiler", "<br>\n\n||s|| text", EntitySpoiler, 0},
+		{"reference then quote", "[ref]: https://example.com\n\n> q", EntityBlockquote, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 直接检查解析结果，确认不是依靠 CollapseBlankLines 去掉开头空行
+			source, _ := defaultConverter().preprocess([]byte(tt.md), true, DefaultConfig(), nil)
+			raw, _, _ := parser.New().Parse(source, DefaultConfig())
+			if strings.TrimLeft(raw, " \n") != raw {
+				t.Errorf("raw output %q starts with whitespace", raw)
+			}
+
+			text, entities := Convert(tt.md, true, nil)
+			if strings.TrimLeft(text, " \n") != text {
+				t.Errorf("Convert(%q) = %q, starts with whitespace", tt.md, text)
+			}
+			e := findEntity(entities, tt.wantType)
+			if e == nil || e.Offset != tt.wantOffset {
+				t.Errorf("%s entity = %+v in %q, want offset %d", tt.wantType, e, text, tt.wantOffset)
+			}
+		})
+	}
+}
+
+// TestSafetyLimits 测试深层嵌套、大量实体和超长输出的异常输入在上限处停止：
+// 默认返回 *LimitError，TruncateOnLimit 时保留已生成的部分，且耗时有界
+func TestSafetyLimits(t *testing.T) {
+	var list strings.Builder
+	for i := 0; i < 100; i++ {
+		list.WriteString(strings.Repeat("  ", i) + "- item\n")
+	}
+	tests := []struct {
+		name   string
+		md     string
+		config func(*RenderConfig)
+		limit  string
+	}{
+		{"nested quotes", strings.Repeat(">", 10000) + " deep", nil, "MaxNestingDepth"},
+		{"nested list", list.String(), nil, "MaxNestingDepth"},
+		{"nested emphasis", strings.Repeat("*", 50000) + "a" + strings.Repeat("*", 50000), nil, "MaxNestingDepth"},
+		{"many entities", strings.Repeat("**a** ", 50000), func(c *RenderConfig) { c.MaxEntities = 1000 }, "MaxEntities"},
+		{"long output", strings.Repeat("word ", 100000), func(c *RenderConfig) { c.MaxOutputBytes = 1000 }, "MaxOutputBytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			if tt.config != nil {
+				tt.config(config)
+			}
+			start := time.Now()
+			_, _, err := ConvertE(tt.md, false, config)
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("ConvertE() took %v", elapsed)
+			}
+			var le *LimitError
+			if !errors.As(err, &le) || le.Limit != tt.limit {
+				t.Fatalf("ConvertE() error = %v, want %s exceeded", err, tt.limit)
+			}
+			if _, err := Process(context.Background(), tt.md, WithConfig(config)); !errors.As(err, &le) {
+				t.Errorf("Process() error = %v, want *LimitError", err)
+			}
+			if _, err := Stats(tt.md, WithConfig(config)); !errors.As(err, &le) {
+				t.Errorf("Stats() error = %v, want *LimitError", err)
+			}
+
+			config.TruncateOnLimit = true
+			text, entities, err := ConvertE(tt.md, false, config)
+			if err != nil {
+				t.Fatalf("ConvertE() with TruncateOnLimit error = %v", err)
+			}
+			for _, e := range entities {
+				if e.Offset < 0 || e.Length <= 0 || e.Offset+e.Length > UTF16Len(text) {
+					t.Fatalf("entity %+v outside the truncated text", e)
+				}
+			}
+			if config.MaxEntities > 0 && len(entities) > config.MaxEntities {
+				t.Errorf("%d entities, want at most %d", len(entities), config.MaxEntities)
+			}
+		})
+	}
+
+	// 上限内的文档和不限制（负数）时照常转换
+	_, entities, err := ConvertE(strings.Repeat("**a** ", 50000), false, nil)
+	if err != nil || len(entities) != 50000 {
+		t.Errorf("ConvertE() = %d entities, %v, want 50000 under the default limit", len(entities), err)
+	}
+	config := DefaultConfig()
+	config.MaxOutputBytes = -1
+	if _, _, err := ConvertE(strings.Repeat("word ", 100000), false, config); err != nil {
+		t.Errorf("ConvertE() without an output limit error = %v", err)
+	}
+}
+
+// TestSpacingCompact 测试紧凑间距：同一文档在两种模式下实体覆盖相同的文字，
+// 紧凑模式只在 pre 块前后留空行
+func TestSpacingCompact(t *testing.T) {
+	md := "# Title\n\nFirst **paragraph**.\n\n## Sub\n\n- one\n- two\n\n  > quoted\n\n> quote\n>\n> more\n\n" +
+		"```go\nx := 1\n```\n\nAfter `code`.\n\n| a | b |\n|---|---|\n| 1 | 2 |\n\nEnd *italic*.\n\n---\n\nlast"
+	normalText, normalEntities := Convert(md, false, nil)
+	config := DefaultConfig()
+	config.Spacing = SpacingCompact
+	text, entities := Convert(md, false, config)
+
+	if !strings.Contains(normalText, "Title\n\nFirst") {
+		t.Errorf("normal spacing lost the blank line after the heading: %q", normalText)
+	}
+	if strings.Contains(text, "\n\n\n") || !strings.Contains(text, "Title\nFirst") {
+		t.Errorf("compact text = %q", text)
+	}
+	// 紧凑模式下的空行都与 pre 实体相邻
+	for i := strings.Index(text, "\n\n"); i >= 0; {
+		at := UTF16Len(text[:i])
+		padded := false
+		for _, e := range entities {
+			if e.Type == EntityPre && (e.Offset+e.Length == at || e.Offset == at+2) {
+				padded = true
+			}
+		}
+		if !padded {
+			t.Errorf("blank line at %d not next to a pre block: %q", at, text)
+		}
+		next := strings.Index(text[i+2:], "\n\n")
+		if next < 0 {
+			break
+		}
+		i += 2 + next
+	}
+
+	if errs := ValidateEntities(text, entities); len(errs) > 0 {
+		t.Errorf("ValidateEntities = %v", errs)
+	}
+	if len(entities) != len(normalEntities) {
+		t.Fatalf("compact has %d entities, normal has %d", len(entities), len(normalEntities))
+	}
+	for i := range entities {
+		got := extractEntityText(text, &entities[i])
+		want := strings.ReplaceAll(extractEntityText(normalText, &normalEntities[i]), "\n\n", "\n")
+		if entities[i].Type != normalEntities[i].Type || got != want {
+			t.Errorf("entity %d = %s %q, want %s %q", i, entities[i].Type, got, normalEntities[i].Type, want)
+		}
+	}
+}
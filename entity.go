@@ -1,12 +1,48 @@
 package telegramify
 
 import (
+	"fmt"
+	"sort"
 	"strings"
+	"unicode/utf8"
+
 	"github.com/riverfjs/telegramify-go/internal/types"
+	"github.com/riverfjs/telegramify-go/internal/util"
 )
 
 // 导出类型别名
 type MessageEntity = types.MessageEntity
+type EntityUser = types.EntityUser
+
+// Entity type names as used in MessageEntity.Type.
+const (
+	EntityMention              = types.EntityMention
+	EntityHashtag              = types.EntityHashtag
+	EntityCashtag              = types.EntityCashtag
+	EntityBotCommand           = types.EntityBotCommand
+	EntityURL                  = types.EntityURL
+	EntityEmail                = types.EntityEmail
+	EntityPhoneNumber          = types.EntityPhoneNumber
+	EntityBold                 = types.EntityBold
+	EntityItalic               = types.EntityItalic
+	EntityUnderline            = types.EntityUnderline
+	EntityStrikethrough        = types.EntityStrikethrough
+	EntitySpoiler              = types.EntitySpoiler
+	EntityBlockquote           = types.EntityBlockquote
+	EntityExpandableBlockquote = types.EntityExpandableBlockquote
+	EntityCode                 = types.EntityCode
+	EntityPre                  = types.EntityPre
+	EntityTextLink             = types.EntityTextLink
+	EntityTextMention          = types.EntityTextMention
+	EntityCustomEmoji          = types.EntityCustomEmoji
+)
+
+// StandardEntityTypes returns the entity types a <tg-entity> tag may produce
+// when RenderConfig.EntityTagTypes is empty: every Bot API type except
+// text_mention, which needs a user the tag cannot carry.
+func StandardEntityTypes() []string {
+	return types.StandardEntityTypes()
+}
 
 // UTF16Len returns the length of text measured in UTF-16 code units.
 //
@@ -25,10 +61,237 @@ func UTF16Len(text string) int {
 	return count
 }
 
+// UTF16ToByteOffsets converts UTF-16 offsets in text to byte offsets, walking
+// text once for the whole batch. The result has one byte offset per input, in
+// the same order.
+//
+// Offsets below 0 map to 0 and offsets past the end of text map to len(text).
+// An offset between the two halves of a surrogate pair snaps back to the
+// start of that character, so the result is always a valid slice index at a
+// rune boundary.
+func UTF16ToByteOffsets(text string, utf16Offsets []int) []int {
+	result := make([]int, len(utf16Offsets))
+	order := make([]int, len(utf16Offsets))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return utf16Offsets[order[i]] < utf16Offsets[order[j]] })
+
+	next := 0 // position in order of the next offset to resolve
+	utf16 := 0
+	for i, r := range text {
+		width := 1
+		if r > 0xFFFF {
+			width = 2
+		}
+		// every pending offset before the end of this rune resolves to its start
+		for next < len(order) && utf16Offsets[order[next]] < utf16+width {
+			result[order[next]] = i
+			next++
+		}
+		utf16 += width
+	}
+	for ; next < len(order); next++ {
+		result[order[next]] = len(text)
+	}
+	return result
+}
+
+// ByteToUTF16 returns the UTF-16 offset of the byte offset byteOff in text.
+// byteOff is clamped to [0, len(text)]; an offset inside a multi-byte rune
+// counts as the start of that rune.
+func ByteToUTF16(text string, byteOff int) int {
+	count := 0
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if i+size > byteOff {
+			break
+		}
+		if r > 0xFFFF {
+			count += 2
+		} else {
+			count++
+		}
+		i += size
+	}
+	return count
+}
+
+// EntityText returns the part of text covered by e, with the entity's range
+// converted and clamped as by UTF16ToByteOffsets.
+func EntityText(text string, e MessageEntity) string {
+	offsets := UTF16ToByteOffsets(text, []int{e.Offset, e.Offset + e.Length})
+	if offsets[1] < offsets[0] {
+		return ""
+	}
+	return text[offsets[0]:offsets[1]]
+}
+
+// NormalizeEntities sorts entities in place by offset, then by descending
+// length, then by type, and returns the slice.
+//
+// Enclosing entities therefore come before the entities they contain, which
+// is the order the Bot API documents and strict clients expect. The sort is
+// stable, so entities that compare equal keep their relative order.
+func NormalizeEntities(entities []MessageEntity) []MessageEntity {
+	sort.SliceStable(entities, func(i, j int) bool {
+		a, b := entities[i], entities[j]
+		if a.Offset != b.Offset {
+			return a.Offset < b.Offset
+		}
+		if a.Length != b.Length {
+			return a.Length > b.Length
+		}
+		return a.Type < b.Type
+	})
+	return entities
+}
+
+// entityKey identifies entities that render identically and can be merged.
+type entityKey struct {
+	Type          string
+	URL           string
+	User          *EntityUser
+	Language      string
+	CustomEmojiID string
+}
+
+// MergeEntities coalesces entities of the same type and attributes that
+// overlap or abut, which also removes exact duplicates. Entities that differ
+// in URL, language, user or custom emoji ID are never merged. The input is
+// left unchanged; the result is sorted as by NormalizeEntities.
+func MergeEntities(entities []MessageEntity) []MessageEntity {
+	sorted := NormalizeEntities(append([]MessageEntity(nil), entities...))
+	merged := make([]MessageEntity, 0, len(sorted))
+	last := make(map[entityKey]int) // index in merged of the latest entity per key
+	for _, ent := range sorted {
+		key := entityKey{ent.Type, ent.URL, ent.User, ent.Language, ent.CustomEmojiID}
+		if i, ok := last[key]; ok && merged[i].Offset+merged[i].Length >= ent.Offset {
+			merged[i].Length = max(merged[i].Length, ent.Offset+ent.Length-merged[i].Offset)
+			continue
+		}
+		last[key] = len(merged)
+		merged = append(merged, ent)
+	}
+	return NormalizeEntities(merged)
+}
+
+// EntitiesEqual reports whether a and b describe the same formatting. Order
+// does not matter, and both lists are compared after MergeEntities, so an
+// entity split into abutting pieces equals the whole. Users are compared by
+// value.
+func EntitiesEqual(a, b []MessageEntity) bool {
+	return len(DiffEntities(a, b)) == 0
+}
+
+// DiffEntities returns a human-readable line for every entity that appears in
+// only one of a and b, compared as by EntitiesEqual. Entities only in a come
+// first, then entities only in b, each in NormalizeEntities order. The result
+// is empty when the lists are equal.
+func DiffEntities(a, b []MessageEntity) []string {
+	ma, mb := MergeEntities(a), MergeEntities(b)
+	matched := make([]bool, len(mb))
+	var diffs []string
+	for _, ea := range ma {
+		found := false
+		for j, eb := range mb {
+			if !matched[j] && sameEntity(ea, eb) {
+				matched[j], found = true, true
+				break
+			}
+		}
+		if !found {
+			diffs = append(diffs, "only in a: "+describeEntity(ea))
+		}
+	}
+	for j, eb := range mb {
+		if !matched[j] {
+			diffs = append(diffs, "only in b: "+describeEntity(eb))
+		}
+	}
+	return diffs
+}
+
+// sameEntity compares all fields of two entities, following User pointers.
+func sameEntity(a, b MessageEntity) bool {
+	if a.Type != b.Type || a.Offset != b.Offset || a.Length != b.Length ||
+		a.URL != b.URL || a.Language != b.Language || a.CustomEmojiID != b.CustomEmojiID {
+		return false
+	}
+	if a.User == nil || b.User == nil {
+		return a.User == b.User
+	}
+	return *a.User == *b.User
+}
+
+// describeEntity formats an entity as its type, UTF-16 range and attributes,
+// e.g. "text_link [4, 9) url=https://example.com".
+func describeEntity(e MessageEntity) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s [%d, %d)", e.Type, e.Offset, e.Offset+e.Length)
+	if e.URL != "" {
+		fmt.Fprintf(&b, " url=%s", e.URL)
+	}
+	if e.Language != "" {
+		fmt.Fprintf(&b, " language=%s", e.Language)
+	}
+	if e.User != nil {
+		fmt.Fprintf(&b, " user=%d", e.User.ID)
+	}
+	if e.CustomEmojiID != "" {
+		fmt.Fprintf(&b, " custom_emoji_id=%s", e.CustomEmojiID)
+	}
+	return b.String()
+}
+
 // TextChunk represents a chunk of text with its entities.
 type TextChunk struct {
 	Text     string
 	Entities []MessageEntity
+	// Dropped lists atomic entities (see SplitEntities) that start in this
+	// chunk but are longer than the limit. They are dropped rather than
+	// clipped and keep the offsets they had in the unsplit text; their text
+	// is kept.
+	Dropped []MessageEntity
+}
+
+// atomicEntityTypes are entity types that must cover exactly the text they
+// were made for: Telegram rejects a clipped custom_emoji or text_mention.
+var atomicEntityTypes = map[string]bool{
+	EntityCustomEmoji: true,
+	EntityTextMention: true,
+}
+
+// atomicSpans returns the byte ranges in text of the atomic entities,
+// widened to whole characters.
+func atomicSpans(text string, entities []MessageEntity, boundaries []bool) [][2]int {
+	var units []int
+	for _, e := range entities {
+		if atomicEntityTypes[e.Type] {
+			start, end := util.SnapToClusters(boundaries, e.Offset, e.Offset+e.Length)
+			units = append(units, start, end)
+		}
+	}
+	if len(units) == 0 {
+		return nil
+	}
+	bytes := UTF16ToByteOffsets(text, units)
+	spans := make([][2]int, 0, len(bytes)/2)
+	for i := 0; i < len(bytes); i += 2 {
+		spans = append(spans, [2]int{bytes[i], bytes[i+1]})
+	}
+	return spans
+}
+
+// atomicSpanAt returns the earliest atomic span that pos falls strictly
+// inside.
+func atomicSpanAt(spans [][2]int, pos int) (span [2]int, ok bool) {
+	for _, sp := range spans {
+		if sp[0] < pos && pos < sp[1] && (!ok || sp[0] < span[0]) {
+			span, ok = sp, true
+		}
+	}
+	return span, ok
 }
 
 // findNewlinePositions finds newline positions in text suitable for splitting.
@@ -72,9 +335,44 @@ func buildUTF16OffsetTable(text string) []int {
 
 // SplitEntities splits (text, entities) into chunks not exceeding maxUTF16Len UTF-16 code units.
 //
-// Tries to split at newline boundaries. Entities that span a split boundary
-// are clipped into both chunks.
+// Tries to split at newline boundaries. A run with no newline that fits, such
+// as a pasted token or base64 blob, is hard-split to fill the budget, never
+// inside a character or emoji sequence. Entities that span a split boundary
+// are clipped into both chunks, so a code entity around a long token resumes
+// at offset 0 of the next chunk and every piece still renders monospace.
+//
+// custom_emoji and text_mention entities are atomic: a split that would cut
+// through one moves before it instead. One longer than maxUTF16Len cannot be
+// kept whole; it is dropped, keeping its text, and listed in
+// TextChunk.Dropped.
 func SplitEntities(text string, entities []MessageEntity, maxUTF16Len int) []TextChunk {
+	return SplitEntitiesWith(text, entities, maxUTF16Len, SplitOptions{MinTailSize: -1})
+}
+
+// DefaultMinTailSize is the MinTailSize used when SplitOptions.MinTailSize
+// or ConvertOptions.MinTailSize is zero.
+const DefaultMinTailSize = 200
+
+// SplitOptions tunes SplitEntitiesWith.
+type SplitOptions struct {
+	// MinTailSize is the UTF-16 length below which the last chunk is
+	// considered an orphan, such as a lone closing sentence. The split
+	// before it then moves to an earlier newline so that the last chunk
+	// takes over part of the previous one, provided both still fit the
+	// limit; when no such newline exists the greedy split is kept. Zero
+	// means DefaultMinTailSize and a negative value disables rebalancing.
+	MinTailSize int
+	// Rule is the horizontal rule text the renderer emits, normally
+	// RenderConfig.MarkdownSymbol.Rule. A line equal to it, like a line of
+	// three or more "—", "-", "_" or "*", counts as a rule and does not end
+	// a chunk.
+	Rule string
+}
+
+// SplitEntitiesWith is like SplitEntities but applies opts. SplitEntities
+// does not rebalance the last chunk; the Process pipeline uses
+// SplitEntitiesWith with ConvertOptions.MinTailSize.
+func SplitEntitiesWith(text string, entities []MessageEntity, maxUTF16Len int, opts SplitOptions) []TextChunk {
 	total := UTF16Len(text)
 	if total <= maxUTF16Len {
 		return []TextChunk{{Text: text, Entities: entities}}
@@ -85,6 +383,10 @@ func SplitEntities(text string, entities []MessageEntity, maxUTF16Len int) []Tex
 	// Build list of candidate split points (newline positions)
 	splitPoints := findNewlinePositions(text)
 
+	// Entity edges inside a character would stay there after clipping
+	boundaries := util.UTF16ClusterBoundaries(text)
+	atomic := atomicSpans(text, entities, boundaries)
+
 	// Determine actual split positions using greedy packing
 	var chunksRanges [][2]int // [byteStart, byteEnd]
 	byteStart := 0
@@ -121,15 +423,64 @@ func SplitEntities(text string, entities []MessageEntity, maxUTF16Len int) []Tex
 					break
 				}
 			}
+			// Prefer the end of a sentence or clause to an arbitrary cut
+			if soft := softSplitPoint(text, offsets, byteStart, bestSplit, utf16Start+maxUTF16Len/2); soft > 0 {
+				bestSplit = soft
+			}
+			// Never cut through a character or an emoji sequence
+			for bestSplit > byteStart && !util.IsClusterBoundary(text, bestSplit) {
+				bestSplit--
+			}
 			if bestSplit == byteStart {
-				bestSplit = byteStart + 1 // Force progress
+				// Force progress, keeping the first character whole
+				bestSplit = byteStart + 1
+				for bestSplit < len(text) && !util.IsClusterBoundary(text, bestSplit) {
+					bestSplit++
+				}
+				// A cluster longer than the budget is cut between runes
+				if offsets[bestSplit] > utf16Budget {
+					bestSplit = runeSplitPoint(text, offsets, byteStart, utf16Budget)
+				}
+			}
+		}
+
+		// A rule at the end of a chunk separates nothing; start the next
+		// chunk with it instead
+		if text[bestSplit-1] == '\n' {
+			if ruleStart := trailingRuleLine(text, byteStart, bestSplit, opts.Rule); ruleStart > 0 {
+				bestSplit = ruleStart
 			}
 		}
 
+		// Keep atomic entities whole by splitting before them, or after one
+		// that starts the chunk; one too long for that gets dropped below
+		for {
+			span, ok := atomicSpanAt(atomic, bestSplit)
+			if !ok {
+				break
+			}
+			if span[0] > byteStart {
+				bestSplit = span[0]
+				continue
+			}
+			if offsets[span[1]] <= utf16Budget {
+				bestSplit = span[1]
+			}
+			break
+		}
+
 		chunksRanges = append(chunksRanges, [2]int{byteStart, bestSplit})
 		byteStart = bestSplit
 	}
 
+	minTail := opts.MinTailSize
+	if minTail == 0 {
+		minTail = DefaultMinTailSize
+	}
+	if minTail > 0 && len(chunksRanges) > 1 {
+		rebalanceTail(text, offsets, splitPoints, atomic, chunksRanges, maxUTF16Len, minTail, opts.Rule)
+	}
+
 	// Assign entities to chunks, clipping as needed
 	var result []TextChunk
 	for _, chunkRange := range chunksRanges {
@@ -137,11 +488,10 @@ func SplitEntities(text string, entities []MessageEntity, maxUTF16Len int) []Tex
 		chunkText := text[chunkByteStart:chunkByteEnd]
 		chunkUTF16Start := offsets[chunkByteStart]
 		chunkUTF16End := offsets[chunkByteEnd]
-		var chunkEntities []MessageEntity
+		var chunkEntities, dropped []MessageEntity
 
 		for _, ent := range entities {
-			entStart := ent.Offset
-			entEnd := ent.Offset + ent.Length
+			entStart, entEnd := util.SnapToClusters(boundaries, ent.Offset, ent.Offset+ent.Length)
 
 			// Check overlap
 			if entEnd <= chunkUTF16Start || entStart >= chunkUTF16End {
@@ -156,92 +506,228 @@ func SplitEntities(text string, entities []MessageEntity, maxUTF16Len int) []Tex
 			if clippedLength <= 0 {
 				continue
 			}
-
-			newEnt := MessageEntity{
-				Type:          ent.Type,
-				Offset:        clippedStart - chunkUTF16Start,
-				Length:        clippedLength,
-				URL:           ent.URL,
-				Language:      ent.Language,
-				CustomEmojiID: ent.CustomEmojiID,
+			if atomicEntityTypes[ent.Type] && clippedLength < entEnd-entStart {
+				if entStart >= chunkUTF16Start {
+					dropped = append(dropped, ent)
+				}
+				continue
 			}
+
+			newEnt := ent
+			newEnt.Offset = clippedStart - chunkUTF16Start
+			newEnt.Length = clippedLength
 			chunkEntities = append(chunkEntities, newEnt)
 		}
 
 		result = append(result, TextChunk{
 			Text:     chunkText,
 			Entities: chunkEntities,
+			Dropped:  dropped,
 		})
 	}
 
 	return result
 }
 
-// stripNewlinesAdjust strips leading/trailing newlines from text and adjusts entity offsets.
-func stripNewlinesAdjust(text string, entities []MessageEntity) (string, []MessageEntity) {
-	// Count leading newlines
-	leading := 0
-	for _, ch := range text {
-		if ch == '\n' {
-			leading++
-		} else {
+// runeSplitPoint returns the last rune start after start whose UTF-16 offset
+// fits the budget, so a cut never splits a surrogate pair. At least one rune
+// is kept to guarantee progress.
+func runeSplitPoint(text string, offsets []int, start, budget int) int {
+	_, size := utf8.DecodeRuneInString(text[start:])
+	split := start + size
+	for i := split; i < len(text); i++ {
+		if !utf8.RuneStart(text[i]) {
+			continue
+		}
+		if offsets[i] > budget {
 			break
 		}
+		split = i
 	}
+	return split
+}
 
-	// Count trailing newlines
-	trailing := 0
-	runes := []rune(text)
-	for i := len(runes) - 1; i >= 0; i-- {
-		if runes[i] == '\n' {
-			trailing++
-		} else {
+// softSplitPoint returns the best position in text(start:limit] to split a
+// line that has no newline within the budget, or -1 when there is none at
+// or after the UTF-16 offset floor. In order of preference it splits after
+// CJK sentence punctuation (。！？) or Western sentence punctuation followed
+// by a space, after clause punctuation (、，；： or ",;:" followed by a
+// space), and after a space. Closing quotes and brackets stay with the
+// punctuation before them, and a space after it stays on the first chunk.
+func softSplitPoint(text string, offsets []int, start, limit, floor int) int {
+	const (
+		tierSentence = iota
+		tierClause
+		tierSpace
+		tiers
+	)
+	var best [tiers]int
+	for i := range best {
+		best[i] = -1
+	}
+	for i := start; i < limit; {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if i+size > limit {
 			break
 		}
+		i += size
+		tier := -1
+		switch r {
+		case '。', '！', '？', '．':
+			tier = tierSentence
+		case '、', '，', '；', '：':
+			tier = tierClause
+		case '.', '!', '?':
+			tier = tierSentence
+		case ',', ';', ':':
+			tier = tierClause
+		case ' ', '\t':
+			best[tierSpace] = max(best[tierSpace], i)
+			continue
+		default:
+			continue
+		}
+		end := i
+		for end < limit {
+			c, n := utf8.DecodeRuneInString(text[end:])
+			if !isClosingPunct(c) || end+n > limit {
+				break
+			}
+			end += n
+		}
+		if r < utf8.RuneSelf {
+			// Western punctuation ends a sentence or clause only before a
+			// space, not inside "3.14" or "a.b"
+			if end >= limit || (text[end] != ' ' && text[end] != '\t') {
+				continue
+			}
+			end++
+		}
+		best[tier] = max(best[tier], end)
 	}
+	for _, sp := range best {
+		if sp > start && offsets[sp] >= floor && util.IsClusterBoundary(text, sp) {
+			return sp
+		}
+	}
+	return -1
+}
 
-	if leading == 0 && trailing == 0 {
-		return text, entities
+// isClosingPunct reports whether r closes a quotation or bracket.
+func isClosingPunct(r rune) bool {
+	switch r {
+	case '"', '\'', ')', ']', '”', '’', '」', '』', '）', '》', '〉', '】', '〕':
+		return true
+	}
+	return false
+}
+
+// rebalanceTail moves the split before the last chunk of ranges to an
+// earlier newline when the last chunk, without its surrounding newlines, is
+// shorter than minTail. It picks the latest newline that makes the last
+// chunk long enough while keeping it within maxUTF16Len, leaves text before
+// it in the previous chunk, does not leave a rule at that chunk's end and
+// does not cut through an atomic span.
+func rebalanceTail(text string, offsets, splitPoints []int, atomic [][2]int, ranges [][2]int, maxUTF16Len, minTail int, rule string) {
+	last, prev := len(ranges)-1, len(ranges)-2
+	if visibleUTF16Len(text, offsets, ranges[last][0], ranges[last][1]) >= minTail {
+		return
+	}
+	end := ranges[last][1]
+	for i := len(splitPoints) - 1; i >= 0; i-- {
+		sp := splitPoints[i]
+		if sp >= ranges[last][0] {
+			continue
+		}
+		if sp <= ranges[prev][0] || offsets[end]-offsets[sp] > maxUTF16Len {
+			return
+		}
+		if visibleUTF16Len(text, offsets, sp, end) < minTail {
+			continue
+		}
+		if strings.Trim(text[ranges[prev][0]:sp], "\n") == "" || trailingRuleLine(text, ranges[prev][0], sp, rule) > 0 {
+			continue
+		}
+		if _, ok := atomicSpanAt(atomic, sp); ok {
+			continue
+		}
+		ranges[prev][1], ranges[last][0] = sp, sp
+		return
+	}
+}
+
+// visibleUTF16Len returns the UTF-16 length of text[start:end] without
+// leading and trailing newlines.
+func visibleUTF16Len(text string, offsets []int, start, end int) int {
+	for start < end && text[start] == '\n' {
+		start++
+	}
+	for end > start && text[end-1] == '\n' {
+		end--
+	}
+	return offsets[end] - offsets[start]
+}
+
+// trailingRuleLine returns the start of the last non-empty line of
+// text[start:end] when that line is a horizontal rule and other text
+// precedes it, or -1. rule is SplitOptions.Rule.
+func trailingRuleLine(text string, start, end int, rule string) int {
+	chunk := strings.TrimRight(text[start:end], "\n")
+	lineStart := strings.LastIndexByte(chunk, '\n') + 1
+	if lineStart == 0 || !isRuleLine(chunk[lineStart:], rule) || strings.Trim(chunk[:lineStart], "\n") == "" {
+		return -1
+	}
+	return start + lineStart
+}
+
+// isRuleLine reports whether line is a rendered horizontal rule: the
+// configured rule text, or at least three repetitions of "—", "-", "_" or
+// "*". Other repeated symbols such as "..." or "===" are ordinary text.
+func isRuleLine(line, rule string) bool {
+	if rule != "" && line == rule {
+		return true
+	}
+	first, _ := utf8.DecodeRuneInString(line)
+	if utf8.RuneCountInString(line) < 3 || !strings.ContainsRune("—-_*", first) {
+		return false
 	}
+	return strings.Count(line, string(first)) == utf8.RuneCountInString(line)
+}
+
+// lineBreaks are the characters stripNewlinesAdjust removes from both ends.
+const lineBreaks = "\r\n"
 
-	end := len(text)
-	if trailing > 0 {
-		end = len(text) - trailing
+// stripNewlinesAdjust strips leading and trailing runs of "\n" and "\r"
+// from text and shifts entities to the stripped text, clipping those that
+// reach into the removed runs and dropping those entirely inside them.
+//
+// When nothing is stripped, text and entities are returned unchanged.
+// Otherwise the entities are a new slice, nil when none overlaps the kept
+// text; in particular text made only of line breaks yields "" and nil.
+// Every stripped character is ASCII, so byte counts equal UTF-16 counts.
+func stripNewlinesAdjust(text string, entities []MessageEntity) (string, []MessageEntity) {
+	stripped := strings.TrimLeft(text, lineBreaks)
+	leading := len(text) - len(stripped)
+	stripped = strings.TrimRight(stripped, lineBreaks)
+	if len(stripped) == len(text) {
+		return text, entities
 	}
-	stripped := text[leading:end]
 	if stripped == "" {
-		return stripped, nil
+		return "", nil
 	}
 
-	// Newlines are each 1 UTF-16 code unit
-	leadingUTF16 := leading
 	newUTF16Len := UTF16Len(stripped)
-
 	var adjusted []MessageEntity
 	for _, ent := range entities {
-		newOffset := ent.Offset - leadingUTF16
-		newEnd := newOffset + ent.Length
-		// Skip entities entirely outside the stripped range
-		if newEnd <= 0 || newOffset >= newUTF16Len {
-			continue
-		}
-		// Clip to boundaries
-		newOffset = max(0, newOffset)
-		newEnd = min(newEnd, newUTF16Len)
-		newLength := newEnd - newOffset
-		if newLength <= 0 {
+		newOffset := max(ent.Offset-leading, 0)
+		newEnd := min(ent.Offset+ent.Length-leading, newUTF16Len)
+		if newEnd <= newOffset {
 			continue
 		}
-		adjusted = append(adjusted, MessageEntity{
-			Type:          ent.Type,
-			Offset:        newOffset,
-			Length:        newLength,
-			URL:           ent.URL,
-			Language:      ent.Language,
-			CustomEmojiID: ent.CustomEmojiID,
-		})
+		ent.Offset = newOffset
+		ent.Length = newEnd - newOffset
+		adjusted = append(adjusted, ent)
 	}
-
 	return stripped, adjusted
 }
 
@@ -296,14 +782,9 @@ func TrimSpace(text string, entities []MessageEntity) (string, []MessageEntity)
 			continue
 		}
 
-		adjusted = append(adjusted, MessageEntity{
-			Type:          ent.Type,
-			Offset:        newOffset,
-			Length:        newLength,
-			URL:           ent.URL,
-			Language:      ent.Language,
-			CustomEmojiID: ent.CustomEmojiID,
-		})
+		ent.Offset = newOffset
+		ent.Length = newLength
+		adjusted = append(adjusted, ent)
 	}
 
 	return trimmed, adjusted
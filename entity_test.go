@@ -1,7 +1,13 @@
 package telegramify
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
+	"unicode/utf8"
 )
 
 // TestUTF16Len_Empty 测试空字符串
@@ -89,7 +95,7 @@ func TestUTF16Len_MatchesEncode(t *testing.T) {
 
 // TestMessageEntity_ToDict 测试 MessageEntity.ToDict
 func TestMessageEntity_ToDict(t *testing.T) {
-	e := MessageEntity{Type: "bold", Offset: 0, Length: 5}
+	e := MessageEntity{Type: EntityBold, Offset: 0, Length: 5}
 	d := e.ToDict()
 	if d["type"] != "bold" || d["offset"] != 0 || d["length"] != 5 {
 		t.Errorf("ToDict() = %v, want type=bold offset=0 length=5", d)
@@ -100,7 +106,7 @@ func TestMessageEntity_ToDict(t *testing.T) {
 }
 
 func TestMessageEntity_ToDictWithURL(t *testing.T) {
-	e := MessageEntity{Type: "text_link", Offset: 0, Length: 5, URL: "https://example.com"}
+	e := MessageEntity{Type: EntityTextLink, Offset: 0, Length: 5, URL: "https://example.com"}
 	d := e.ToDict()
 	if d["url"] != "https://example.com" {
 		t.Errorf("ToDict() url = %v, want https://example.com", d["url"])
@@ -111,7 +117,7 @@ func TestMessageEntity_ToDictWithURL(t *testing.T) {
 }
 
 func TestMessageEntity_ToDictWithLanguage(t *testing.T) {
-	e := MessageEntity{Type: "pre", Offset: 0, Length: 10, Language: "python"}
+	e := MessageEntity{Type: EntityPre, Offset: 0, Length: 10, Language: "python"}
 	d := e.ToDict()
 	if d["language"] != "python" {
 		t.Errorf("ToDict() language = %v, want python", d["language"])
@@ -122,17 +128,61 @@ func TestMessageEntity_ToDictWithLanguage(t *testing.T) {
 }
 
 func TestMessageEntity_ToDictWithCustomEmoji(t *testing.T) {
-	e := MessageEntity{Type: "custom_emoji", Offset: 0, Length: 2, CustomEmojiID: "5368324170671202286"}
+	e := MessageEntity{Type: EntityCustomEmoji, Offset: 0, Length: 2, CustomEmojiID: "5368324170671202286"}
 	d := e.ToDict()
 	if d["custom_emoji_id"] != "5368324170671202286" {
 		t.Errorf("ToDict() custom_emoji_id = %v, want 5368324170671202286", d["custom_emoji_id"])
 	}
 }
 
+// TestMessageEntity_User 测试 text_mention 的 user 字段序列化
+func TestMessageEntity_User(t *testing.T) {
+	e := MessageEntity{Type: EntityTextMention, Offset: 0, Length: 4, User: &EntityUser{ID: 42, FirstName: "Anna"}}
+	d := e.ToDict()
+	user, ok := d["user"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("ToDict() user = %v, want a map", d["user"])
+	}
+	if user["id"] != int64(42) || user["first_name"] != "Anna" {
+		t.Errorf("ToDict() user = %v", user)
+	}
+	if _, exists := user["username"]; exists {
+		t.Error("ToDict() should not include empty username")
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"type":"text_mention","offset":0,"length":4,"user":{"id":42,"first_name":"Anna"}}`
+	if string(data) != want {
+		t.Errorf("json.Marshal() = %s, want %s", data, want)
+	}
+
+	if _, exists := (MessageEntity{Type: EntityBold, Length: 1}).ToDict()["user"]; exists {
+		t.Error("ToDict() should not include user when not set")
+	}
+}
+
+// TestSplitEntities_PreservesUser 测试拆分时保留 user 字段
+func TestSplitEntities_PreservesUser(t *testing.T) {
+	user := &EntityUser{ID: 7, FirstName: "Bob", Username: "bob"}
+	text := "aaaa\nbob"
+	entities := []MessageEntity{{Type: EntityTextMention, Offset: 5, Length: 3, User: user}}
+	result := SplitEntities(text, entities, 6)
+	if len(result) != 2 {
+		t.Fatalf("SplitEntities() returned %d chunks, want 2", len(result))
+	}
+	got := result[1].Entities
+	if len(got) != 1 || got[0].User != user {
+		t.Errorf("SplitEntities() entities = %+v, want user preserved", got)
+	}
+}
+
 // TestSplitEntities_NoSplitNeeded 测试不需要拆分的情况
 func TestSplitEntities_NoSplitNeeded(t *testing.T) {
 	text := "hello"
-	entities := []MessageEntity{{Type: "bold", Offset: 0, Length: 5}}
+	entities := []MessageEntity{{Type: EntityBold, Offset: 0, Length: 5}}
 	result := SplitEntities(text, entities, 100)
 	if len(result) != 1 {
 		t.Errorf("SplitEntities() returned %d chunks, want 1", len(result))
@@ -172,16 +222,128 @@ func TestSplitEntities_SplitAtNewline(t *testing.T) {
 	}
 }
 
+// TestSplitEntities_RuleStartsChunk 测试拆分点紧跟在分隔线之后时改在分隔线之前拆分，
+// 分隔线不会留在块的末尾；只有配置的分隔线和 —、-、_、* 组成的行算作分隔线
+func TestSplitEntities_RuleStartsChunk(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		rule string
+		max  int
+		want []string
+	}{
+		{"default rule", "first part\n\n————————\n\nsecond part", "", 24, []string{"first part\n\n", "————————\n\nsecond part"}},
+		{"custom rule", "first part\n···\nsecond part", "···", 16, []string{"first part\n", "···\nsecond part"}},
+		{"markdown rule", "first part\n***\nsecond part", "", 16, []string{"first part\n", "***\nsecond part"}},
+		{"rule alone", "————————\n\nsecond part that is long", "", 12, []string{"————————\n\n", "second part ", "that is long"}},
+		{"not a rule", "first part\nab\nsecond part", "", 15, []string{"first part\nab\n", "second part"}},
+		{"ellipsis", "first part\n...\nsecond part", "", 16, []string{"first part\n...\n", "second part"}},
+		{"equals", "first part\n===\nsecond part", "", 16, []string{"first part\n===\n", "second part"}},
+		{"plus", "first part\n+++\nsecond part", "", 16, []string{"first part\n+++\n", "second part"}},
+		{"unconfigured symbol", "first part\n···\nsecond part", "", 16, []string{"first part\n···\n", "second part"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, chunk := range SplitEntitiesWith(tt.text, nil, tt.max, SplitOptions{MinTailSize: -1, Rule: tt.rule}) {
+				got = append(got, chunk.Text)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitEntities(%q, %d) = %q, want %q", tt.text, tt.max, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSplitEntitiesWith_MinTailSize 测试最后一块过短时把前一个拆分点提前，
+// 保持文本完整、实体正确且每块不超过上限；无法调整时保持贪心拆分
+func TestSplitEntitiesWith_MinTailSize(t *testing.T) {
+	para := func(word string) string { return strings.Repeat(word+" ", 9) + word }
+	// 三段各 49 个单位加上很短的结尾，上限 110 时贪心拆分的最后一块是第三段和结尾
+	text := para("aaaa") + "\n\n" + para("bbbb") + "\n\n" + para("cccc") + "\n\n以上。"
+	entities := []MessageEntity{
+		{Type: EntityItalic, Offset: strings.Index(text, "bbbb"), Length: 4},
+		{Type: EntityBold, Offset: UTF16Len(text) - 3, Length: 2},
+	}
+
+	greedy := SplitEntitiesWith(text, entities, 110, SplitOptions{MinTailSize: -1})
+	if len(greedy) != 2 || strings.Trim(greedy[1].Text, "\n") != para("cccc")+"\n\n以上。" {
+		t.Fatalf("greedy chunks = %q", chunkTexts(greedy))
+	}
+	if got := SplitEntities(text, entities, 110); !reflect.DeepEqual(got, greedy) {
+		t.Errorf("SplitEntities rebalanced: %q", chunkTexts(got))
+	}
+
+	tests := []struct {
+		name     string
+		minTail  int
+		wantTail string
+	}{
+		{"moves split", 100, para("bbbb") + "\n\n" + para("cccc") + "\n\n以上。"},
+		{"default size cannot fit", 0, para("cccc") + "\n\n以上。"},
+		{"long enough", 40, para("cccc") + "\n\n以上。"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := SplitEntitiesWith(text, entities, 110, SplitOptions{MinTailSize: tt.minTail})
+			if got := strings.Trim(chunks[len(chunks)-1].Text, "\n"); got != tt.wantTail {
+				t.Errorf("last chunk = %q, want %q (chunks %q)", got, tt.wantTail, chunkTexts(chunks))
+			}
+			checkChunks(t, text, entities, chunks, 110)
+		})
+	}
+
+	// 单个超长段落只能硬拆分，没有可提前的换行
+	long := strings.Repeat("x", 250)
+	chunks := SplitEntitiesWith(long, nil, 100, SplitOptions{})
+	if got := chunkTexts(chunks); !reflect.DeepEqual(got, []string{long[:100], long[100:200], long[200:]}) {
+		t.Errorf("single paragraph chunks = %q", got)
+	}
+}
+
+// chunkTexts 返回各块的文本
+func chunkTexts(chunks []TextChunk) []string {
+	texts := make([]string, len(chunks))
+	for i, c := range chunks {
+		texts[i] = c.Text
+	}
+	return texts
+}
+
+// checkChunks 检查拆分结果拼接后等于原文、每块不超过上限，且实体覆盖的文字与原文一致
+func checkChunks(t *testing.T, text string, entities []MessageEntity, chunks []TextChunk, max int) {
+	t.Helper()
+	if got := strings.Join(chunkTexts(chunks), ""); got != text {
+		t.Errorf("chunks join to %q, want %q", got, text)
+	}
+	var covered []string
+	for _, c := range chunks {
+		if UTF16Len(c.Text) > max {
+			t.Errorf("chunk %q exceeds %d", c.Text, max)
+		}
+		for i := range c.Entities {
+			covered = append(covered, extractEntityText(c.Text, &c.Entities[i]))
+		}
+	}
+	var want []string
+	for i := range entities {
+		want = append(want, extractEntityText(text, &entities[i]))
+	}
+	if !reflect.DeepEqual(covered, want) {
+		t.Errorf("entities cover %q, want %q", covered, want)
+	}
+}
+
 // TestSplitEntities_EntityFullyInFirstChunk 测试 entity 完全在第一个块中
 func TestSplitEntities_EntityFullyInFirstChunk(t *testing.T) {
 	text := "bold\nnormal"
-	entities := []MessageEntity{{Type: "bold", Offset: 0, Length: 4}}
+	entities := []MessageEntity{{Type: EntityBold, Offset: 0, Length: 4}}
 	result := SplitEntities(text, entities, 5)
 	if len(result) < 2 {
 		t.Errorf("SplitEntities() returned %d chunks, want >= 2", len(result))
 	}
 	// 第一个块应该有 bold entity
-	if len(result[0].Entities) != 1 || result[0].Entities[0].Type != "bold" {
+	if len(result[0].Entities) != 1 || result[0].Entities[0].Type != EntityBold {
 		t.Errorf("First chunk should have bold entity, got %v", result[0].Entities)
 	}
 }
@@ -189,7 +351,7 @@ func TestSplitEntities_EntityFullyInFirstChunk(t *testing.T) {
 // TestSplitEntities_PreservesTotalText 测试拆分保留完整文本
 func TestSplitEntities_PreservesTotalText(t *testing.T) {
 	text := "line1\nline2\nline3\nline4\nline5"
-	entities := []MessageEntity{{Type: "italic", Offset: 0, Length: 5}}
+	entities := []MessageEntity{{Type: EntityItalic, Offset: 0, Length: 5}}
 	result := SplitEntities(text, entities, 12)
 	combined := ""
 	for _, chunk := range result {
@@ -232,3 +394,443 @@ func TestSplitEntities_HardSplitNoNewlines(t *testing.T) {
 	}
 }
 
+
+// TestSplitEntities_HardSplitPunctuation 测试没有换行的长段落优先在句末标点后拆分，
+// 其次在分句标点和空格后，最后才任意切开
+func TestSplitEntities_HardSplitPunctuation(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&b, "第%d句话用来测试长段落的拆分，里面没有任何换行或空格。", i)
+	}
+	text := b.String()
+	entities := []MessageEntity{{Type: EntityBold, Offset: 0, Length: 3}}
+	chunks := SplitEntities(text, entities, 100)
+	checkChunks(t, text, entities, chunks, 100)
+	for i, c := range chunks[:len(chunks)-1] {
+		if !strings.HasSuffix(c.Text, "。") {
+			t.Errorf("chunk %d = %q, want it to end with 。", i, c.Text)
+		}
+	}
+
+	tests := []struct {
+		name string
+		text string
+		max  int
+		want []string
+	}{
+		{"western sentence", "One sentence here. Another one follows it", 30, []string{"One sentence here. ", "Another one follows it"}},
+		{"closing quote", "他说：“好的。”然后离开了这里", 12, []string{"他说：“好的。”", "然后离开了这里"}},
+		{"clause", "第一部分还有，第二部分还有很多", 12, []string{"第一部分还有，", "第二部分还有很多"}},
+		{"space", "words without sentence punctuation", 20, []string{"words without ", "sentence punctuation"}},
+		{"decimal", "pi is about 3.14159265358979", 16, []string{"pi is about ", "3.14159265358979"}},
+		{"too early", "好。这一段话非常非常长没有标点", 10, []string{"好。这一段话非常非常", "长没有标点"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chunkTexts(SplitEntities(tt.text, nil, tt.max)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitEntities() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSplitEntities_LongCodeToken 测试超长的单个 token（如 base64）在代码实体中硬拆分：
+// 每块填满预算，代码实体在下一块从偏移 0 继续
+func TestSplitEntities_LongCodeToken(t *testing.T) {
+	blob := strings.Repeat("QUJDRGVmZ2g0NTY3ODkrLw==", 417)[:10000]
+	contents, err := Process(context.Background(), "`"+blob+"`", WithMaxMessageLength(4096))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantLengths := []int{4096, 4096, 1808}
+	if len(contents) != len(wantLengths) {
+		t.Fatalf("got %d contents, want %d", len(contents), len(wantLengths))
+	}
+	var combined strings.Builder
+	for i, c := range contents {
+		text := c.(*Text)
+		combined.WriteString(text.Text)
+		want := []MessageEntity{{Type: EntityCode, Offset: 0, Length: wantLengths[i]}}
+		if UTF16Len(text.Text) != wantLengths[i] || !EntitiesEqual(text.Entities, want) {
+			t.Errorf("chunk %d: length %d, entities %+v", i, UTF16Len(text.Text), text.Entities)
+		}
+	}
+	if combined.String() != blob {
+		t.Error("chunks do not add up to the token")
+	}
+
+	// 多字节 token 不会在字符或代理对中间切开
+	text := strings.Repeat("汉😀é", 3000)
+	entities := []MessageEntity{{Type: EntityCode, Offset: 0, Length: UTF16Len(text)}}
+	for i, chunk := range SplitEntities(text, entities, 4095) {
+		if !utf8.ValidString(chunk.Text) {
+			t.Fatalf("chunk %d is not valid UTF-8", i)
+		}
+		want := []MessageEntity{{Type: EntityCode, Offset: 0, Length: UTF16Len(chunk.Text)}}
+		if UTF16Len(chunk.Text) > 4095 || !EntitiesEqual(chunk.Entities, want) {
+			t.Errorf("chunk %d: length %d, entities %+v", i, UTF16Len(chunk.Text), chunk.Entities)
+		}
+	}
+}
+
+// TestSplitEntities_MathAlphanumeric 测试 \mathbf 等转换出的数学字母（每个占两个 UTF-16 单位）
+// 组成的标题在任意预算下拆分：块不超过上限、不切开代理对，粗体实体逐块衔接后覆盖整个标题
+func TestSplitEntities_MathAlphanumeric(t *testing.T) {
+	config := DefaultConfig()
+	config.MathDelimiters = MathDelimitersStrip
+	text, entities := Convert("# $\\mathbf{ABCDEFGHIJKLMNOPQRSTUVWXYZ}$\n\nbody $\\mathfrak{abcdefgh}$", true, config)
+	heading := "𝐀𝐁𝐂𝐃𝐄𝐅𝐆𝐇𝐈𝐉𝐊𝐋𝐌𝐍𝐎𝐏𝐐𝐑𝐒𝐓𝐔𝐕𝐖𝐗𝐘𝐙"
+	if bold := findEntity(entities, EntityBold); bold == nil || extractEntityText(text, bold) != heading || bold.Length != 52 {
+		t.Fatalf("bold entity = %+v in %q", bold, text)
+	}
+
+	for max := 2; max <= 60; max++ {
+		chunks := SplitEntities(text, entities, max)
+		var joined, bold strings.Builder
+		for i, c := range chunks {
+			joined.WriteString(c.Text)
+			if !utf8.ValidString(c.Text) || UTF16Len(c.Text) > max {
+				t.Fatalf("max %d: chunk %d = %q", max, i, c.Text)
+			}
+			if errs := ValidateEntities(c.Text, c.Entities); len(errs) > 0 {
+				t.Fatalf("max %d: chunk %d: %v", max, i, errs)
+			}
+			for j := range c.Entities {
+				e := &c.Entities[j]
+				covered := extractEntityText(c.Text, e)
+				if !utf8.ValidString(covered) || UTF16Len(covered) != e.Length {
+					t.Fatalf("max %d: chunk %d entity %+v covers %q", max, i, *e, covered)
+				}
+				if e.Type == EntityBold {
+					bold.WriteString(covered)
+				}
+			}
+		}
+		if joined.String() != text {
+			t.Fatalf("max %d: chunks join to %q", max, joined.String())
+		}
+		if bold.String() != heading {
+			t.Errorf("max %d: bold entities cover %q, want %q", max, bold.String(), heading)
+		}
+	}
+}
+
+// TestSplitEntities_OversizedCluster 测试超过上限的单个字形簇在上限处按码点切开，
+// 每块都不超过上限且不切开代理对
+func TestSplitEntities_OversizedCluster(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"combining marks", "a" + strings.Repeat("\u0301", 5000)},
+		{"zwj sequence", strings.Repeat("a\u200d", 3000)},
+		{"emoji zwj sequence", strings.Repeat("👍\u200d", 50)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entities := []MessageEntity{{Type: EntityBold, Offset: 0, Length: UTF16Len(tt.text)}}
+			for _, max := range []int{2, 3, 100, 4096} {
+				chunks := SplitEntities(tt.text, entities, max)
+				var joined strings.Builder
+				for i, c := range chunks {
+					joined.WriteString(c.Text)
+					if c.Text == "" || !utf8.ValidString(c.Text) || UTF16Len(c.Text) > max {
+						t.Fatalf("max %d: chunk %d has %d units", max, i, UTF16Len(c.Text))
+					}
+					if errs := ValidateEntities(c.Text, c.Entities); len(errs) > 0 {
+						t.Fatalf("max %d: chunk %d: %v", max, i, errs)
+					}
+				}
+				if joined.String() != tt.text {
+					t.Fatalf("max %d: chunks do not join to the input", max)
+				}
+			}
+		})
+	}
+}
+
+// TestSplitEntities_AtomicEntities 测试 custom_emoji 和 text_mention 不被切开：拆分点移到实体之前，
+// 超过上限的实体被丢弃并记入 Dropped，文字保留
+func TestSplitEntities_AtomicEntities(t *testing.T) {
+	text := "hi👍👍there, Jane\nDoe says hi"
+	user := &EntityUser{ID: 42, FirstName: "Jane"}
+	entities := []MessageEntity{
+		{Type: EntityCustomEmoji, Offset: 2, Length: 4, CustomEmojiID: "5368324170671202286"},
+		{Type: EntityBold, Offset: 0, Length: 12},
+		{Type: EntityTextMention, Offset: 13, Length: 8, User: user},
+	}
+
+	for max := 2; max <= UTF16Len(text); max++ {
+		chunks := SplitEntities(text, entities, max)
+		var joined strings.Builder
+		whole := map[string]int{}
+		for i, c := range chunks {
+			joined.WriteString(c.Text)
+			if UTF16Len(c.Text) > max {
+				t.Fatalf("max %d: chunk %d = %q exceeds the limit", max, i, c.Text)
+			}
+			if errs := ValidateEntities(c.Text, c.Entities); len(errs) > 0 {
+				t.Fatalf("max %d: chunk %d: %v", max, i, errs)
+			}
+			for j := range c.Entities {
+				if e := &c.Entities[j]; e.Type != EntityBold {
+					whole[extractEntityText(c.Text, e)]++
+				}
+			}
+			for _, e := range c.Dropped {
+				if e.Length <= max {
+					t.Errorf("max %d: dropped %+v, which fits", max, e)
+				}
+				whole[extractEntityText(text, &e)]++
+			}
+		}
+		if joined.String() != text {
+			t.Fatalf("max %d: chunks join to %q", max, joined.String())
+		}
+		if want := map[string]int{"👍👍": 1, "Jane\nDoe": 1}; !reflect.DeepEqual(whole, want) {
+			t.Errorf("max %d: atomic entities kept or dropped whole %v, want %v", max, whole, want)
+		}
+	}
+
+	// 硬拆分落在两个表情之间时移到实体之前
+	chunks := SplitEntities(text, entities, 4)
+	if got := chunkTexts(chunks)[:2]; !reflect.DeepEqual(got, []string{"hi", "👍👍"}) {
+		t.Errorf("max 4: chunks start with %q", got)
+	}
+	if len(chunks[1].Entities) != 2 || chunks[1].Entities[0].Type != EntityCustomEmoji || chunks[1].Entities[0].Offset != 0 {
+		t.Errorf("max 4: second chunk entities = %+v", chunks[1].Entities)
+	}
+	// 比上限长的实体被丢弃，粗体照常截断
+	chunks = SplitEntities(text, entities, 3)
+	if len(chunks[1].Dropped) != 1 || chunks[1].Dropped[0].Type != EntityCustomEmoji || findEntity(chunks[1].Entities, EntityCustomEmoji) != nil {
+		t.Errorf("max 3: second chunk = %+v", chunks[1])
+	}
+	if findEntity(chunks[1].Entities, EntityBold) == nil {
+		t.Errorf("max 3: bold entity missing from %+v", chunks[1])
+	}
+}
+
+// TestOffsetConversion 测试 UTF-16 与字节偏移的相互转换，包括越界和代理对中间的偏移
+func TestOffsetConversion(t *testing.T) {
+	text := "a😀b中c" // 字节: a=0 😀=1..4 b=5 中=6..8 c=9；UTF-16: a=0 😀=1,2 b=3 中=4 c=5
+	utf16 := []int{5, 0, 1, 2, 3, 4, 6, -3, 100}
+	want := []int{9, 0, 1, 1, 5, 6, 10, 0, 10}
+	if got := UTF16ToByteOffsets(text, utf16); !reflect.DeepEqual(got, want) {
+		t.Errorf("UTF16ToByteOffsets() = %v, want %v", got, want)
+	}
+	if got := UTF16ToByteOffsets("", []int{0, 3}); !reflect.DeepEqual(got, []int{0, 0}) {
+		t.Errorf("UTF16ToByteOffsets(\"\") = %v", got)
+	}
+
+	for byteOff, want := range map[int]int{-1: 0, 0: 0, 1: 1, 2: 1, 4: 1, 5: 3, 6: 4, 7: 4, 9: 5, 10: 6, 50: 6} {
+		if got := ByteToUTF16(text, byteOff); got != want {
+			t.Errorf("ByteToUTF16(%d) = %d, want %d", byteOff, got, want)
+		}
+	}
+
+	tests := []struct {
+		entity MessageEntity
+		want   string
+	}{
+		{MessageEntity{Offset: 1, Length: 2}, "😀"},
+		{MessageEntity{Offset: 3, Length: 3}, "b中c"},
+		{MessageEntity{Offset: 2, Length: 2}, "😀b"}, // 起点在代理对中间，回退到字符开头
+		{MessageEntity{Offset: 0, Length: 2}, "a"},   // 终点在代理对中间
+		{MessageEntity{Offset: 4, Length: 50}, "中c"},
+		{MessageEntity{Offset: 9, Length: 1}, ""},
+	}
+	for _, tt := range tests {
+		if got := EntityText(text, tt.entity); got != tt.want {
+			t.Errorf("EntityText(%+v) = %q, want %q", tt.entity, got, tt.want)
+		}
+	}
+}
+
+// TestNormalizeEntities 测试实体按偏移、长度降序、类型排序，且排序稳定
+func TestNormalizeEntities(t *testing.T) {
+	entities := []MessageEntity{
+		{Type: EntityTextLink, Offset: 2, Length: 3, URL: "https://a.example"},
+		{Type: EntityItalic, Offset: 0, Length: 5},
+		{Type: EntityBold, Offset: 0, Length: 9},
+		{Type: EntityTextLink, Offset: 2, Length: 3, URL: "https://b.example"},
+		{Type: EntityBold, Offset: 2, Length: 3},
+	}
+	want := []MessageEntity{
+		{Type: EntityBold, Offset: 0, Length: 9},
+		{Type: EntityItalic, Offset: 0, Length: 5},
+		{Type: EntityBold, Offset: 2, Length: 3},
+		{Type: EntityTextLink, Offset: 2, Length: 3, URL: "https://a.example"},
+		{Type: EntityTextLink, Offset: 2, Length: 3, URL: "https://b.example"},
+	}
+	if got := NormalizeEntities(entities); !reflect.DeepEqual(got, want) {
+		t.Errorf("NormalizeEntities() = %+v, want %+v", got, want)
+	}
+}
+
+// TestConvert_EntityOrder 测试嵌套格式的实体顺序，以及同一文档两次转换结果一致
+func TestConvert_EntityOrder(t *testing.T) {
+	md := "**bold [link](https://example.com) *it***\n\n# Title\n\n> quote `code`"
+	text, entities := Convert(md, false, nil)
+	for i := 1; i < len(entities); i++ {
+		a, b := entities[i-1], entities[i]
+		if a.Offset > b.Offset || (a.Offset == b.Offset && a.Length < b.Length) {
+			t.Errorf("entities not sorted at %d: %+v before %+v", i, a, b)
+		}
+	}
+	bold := findEntity(entities, EntityBold)
+	link := findEntity(entities, EntityTextLink)
+	if bold == nil || link == nil || extractEntityText(text, bold) != "bold link it" {
+		t.Fatalf("unexpected entities %+v in %q", entities, text)
+	}
+	if entities[0].Type != EntityBold {
+		t.Errorf("enclosing bold should come first, got %+v", entities[0])
+	}
+
+	_, again := Convert(md, false, nil)
+	if !reflect.DeepEqual(entities, again) {
+		t.Errorf("second conversion differs:\n%+v\n%+v", entities, again)
+	}
+}
+
+// TestMergeEntities 测试相邻和重复的同类实体合并，不同类型或属性的实体保持独立
+func TestMergeEntities(t *testing.T) {
+	tests := []struct {
+		name     string
+		entities []MessageEntity
+		want     []MessageEntity
+	}{
+		{
+			"abutting bolds merge",
+			[]MessageEntity{{Type: EntityBold, Offset: 0, Length: 1}, {Type: EntityBold, Offset: 1, Length: 1}},
+			[]MessageEntity{{Type: EntityBold, Offset: 0, Length: 2}},
+		},
+		{
+			"duplicates removed",
+			[]MessageEntity{{Type: EntityItalic, Offset: 3, Length: 2}, {Type: EntityItalic, Offset: 3, Length: 2}},
+			[]MessageEntity{{Type: EntityItalic, Offset: 3, Length: 2}},
+		},
+		{
+			"bold next to italic",
+			[]MessageEntity{{Type: EntityBold, Offset: 0, Length: 1}, {Type: EntityItalic, Offset: 1, Length: 1}},
+			[]MessageEntity{{Type: EntityBold, Offset: 0, Length: 1}, {Type: EntityItalic, Offset: 1, Length: 1}},
+		},
+		{
+			"links with different URLs",
+			[]MessageEntity{
+				{Type: EntityTextLink, Offset: 0, Length: 2, URL: "https://a.example"},
+				{Type: EntityTextLink, Offset: 2, Length: 2, URL: "https://b.example"},
+			},
+			[]MessageEntity{
+				{Type: EntityTextLink, Offset: 0, Length: 2, URL: "https://a.example"},
+				{Type: EntityTextLink, Offset: 2, Length: 2, URL: "https://b.example"},
+			},
+		},
+		{
+			"separated bolds",
+			[]MessageEntity{{Type: EntityBold, Offset: 0, Length: 1}, {Type: EntityBold, Offset: 2, Length: 1}},
+			[]MessageEntity{{Type: EntityBold, Offset: 0, Length: 1}, {Type: EntityBold, Offset: 2, Length: 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MergeEntities(tt.entities); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MergeEntities() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	config := &RenderConfig{MarkdownSymbol: DefaultConfig().MarkdownSymbol, CiteExpandable: true, MergeEntities: true}
+	text, entities := Convert("**a**__b__ *c*", false, config)
+	want := []MessageEntity{{Type: EntityBold, Offset: 0, Length: 2}, {Type: EntityItalic, Offset: 3, Length: 1}}
+	if text != "ab c" || !reflect.DeepEqual(entities, want) {
+		t.Errorf("Convert() with MergeEntities = %q %+v, want %q %+v", text, entities, "ab c", want)
+	}
+}
+
+// TestEntitiesEqual 测试实体列表比较忽略顺序和拆分方式，只比较渲染效果
+func TestEntitiesEqual(t *testing.T) {
+	bold := MessageEntity{Type: EntityBold, Offset: 0, Length: 4}
+	link := MessageEntity{Type: EntityTextLink, Offset: 5, Length: 3, URL: "https://example.com"}
+	tests := []struct {
+		name string
+		a, b []MessageEntity
+		want []string
+	}{
+		{"nil and empty", nil, []MessageEntity{}, nil},
+		{"reordered", []MessageEntity{bold, link}, []MessageEntity{link, bold}, nil},
+		{
+			"split into abutting pieces",
+			[]MessageEntity{bold},
+			[]MessageEntity{{Type: EntityBold, Offset: 0, Length: 2}, {Type: EntityBold, Offset: 2, Length: 2}},
+			nil,
+		},
+		{
+			"users compared by value",
+			[]MessageEntity{{Type: EntityTextMention, Offset: 0, Length: 3, User: &EntityUser{ID: 7, FirstName: "Ann"}}},
+			[]MessageEntity{{Type: EntityTextMention, Offset: 0, Length: 3, User: &EntityUser{ID: 7, FirstName: "Ann"}}},
+			nil,
+		},
+		{
+			"clipped",
+			[]MessageEntity{bold},
+			[]MessageEntity{{Type: EntityBold, Offset: 0, Length: 3}},
+			[]string{"only in a: bold [0, 4)", "only in b: bold [0, 3)"},
+		},
+		{
+			"different URL",
+			[]MessageEntity{link},
+			[]MessageEntity{{Type: EntityTextLink, Offset: 5, Length: 3, URL: "https://example.org"}},
+			[]string{"only in a: text_link [5, 8) url=https://example.com", "only in b: text_link [5, 8) url=https://example.org"},
+		},
+		{
+			"missing entity",
+			[]MessageEntity{bold, link, {Type: EntityPre, Offset: 9, Length: 4, Language: "go"}},
+			[]MessageEntity{link},
+			[]string{"only in a: bold [0, 4)", "only in a: pre [9, 13) language=go"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DiffEntities(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffEntities() = %q, want %q", got, tt.want)
+			}
+			if got := EntitiesEqual(tt.a, tt.b); got != (len(tt.want) == 0) {
+				t.Errorf("EntitiesEqual() = %v, want %v", got, len(tt.want) == 0)
+			}
+		})
+	}
+}
+
+// TestEntityBoundaries_Clusters 测试实体边界不会落在字符与其变体选择符或 ZWJ 序列之间
+func TestEntityBoundaries_Clusters(t *testing.T) {
+	text, entities := Convert("[done \u2611](https://example.com)\ufe0f and **cafe**\u0301", false, nil)
+	link := findEntity(entities, EntityTextLink)
+	if link == nil || link.Offset != 0 || link.Length != 7 {
+		t.Fatalf("text_link = %+v, want offset 0 length 7 in %q", link, text)
+	}
+	if got := extractEntityText(text, link); got != "done \u2611\ufe0f" {
+		t.Errorf("text_link covers %q", got)
+	}
+	bold := findEntity(entities, EntityBold)
+	if bold == nil || extractEntityText(text, bold) != "cafe\u0301" {
+		t.Errorf("bold = %+v, want it to include the combining accent in %q", bold, text)
+	}
+
+	// 👨‍👩‍👧 占 8 个 UTF-16 单元，剧透从其中的 👩 开始
+	family := "\U0001F468\u200d\U0001F469\u200d\U0001F467"
+	chunks := SplitEntities("ab"+family+"cd", []MessageEntity{{Type: EntitySpoiler, Offset: 5, Length: 5}}, 8)
+	var texts []string
+	for _, c := range chunks {
+		texts = append(texts, c.Text)
+	}
+	if want := []string{"ab", family, "cd"}; !reflect.DeepEqual(texts, want) {
+		t.Fatalf("chunks = %q, want %q", texts, want)
+	}
+	want := []MessageEntity{{Type: EntitySpoiler, Offset: 0, Length: 8}}
+	if !reflect.DeepEqual(chunks[1].Entities, want) {
+		t.Errorf("spoiler = %+v, want %+v", chunks[1].Entities, want)
+	}
+	if len(chunks[0].Entities) != 0 || len(chunks[2].Entities) != 0 {
+		t.Errorf("spoiler leaked into neighbouring chunks: %+v", chunks)
+	}
+}
@@ -57,11 +57,7 @@ func main() {
 	fmt.Printf("实体数量: %d\n\n", len(entities))
 	
 	fmt.Println("前 500 个字符:")
-	if len(text) > 500 {
-		fmt.Println(text[:500] + "...")
-	} else {
-		fmt.Println(text)
-	}
+	fmt.Println((&tg.Text{Text: text}).Preview(500))
 	
 	fmt.Println("\n实体列表:")
 	for i, entity := range entities {
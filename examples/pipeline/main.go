@@ -88,11 +88,7 @@ func main() {
 			fmt.Printf("   来源: %s\n", c.ContentTrace.SourceType)
 			
 			// 显示前 150 个字符
-			preview := c.Text
-			if len(preview) > 150 {
-				preview = preview[:150] + "..."
-			}
-			fmt.Printf("   预览: %s\n\n", preview)
+			fmt.Printf("   预览: %s\n\n", c.Preview(150))
 			
 		case *tg.File:
 			fmt.Printf("%d. 文件附件\n", i+1)
@@ -104,18 +100,17 @@ func main() {
 			fmt.Printf("   来源: %s\n", c.ContentTrace.SourceType)
 			
 			// 显示文件内容的前 100 字节
-			preview := string(c.FileData)
-			if len(preview) > 100 {
-				preview = preview[:100] + "..."
-			}
-			fmt.Printf("   内容预览:\n%s\n\n", preview)
+			fmt.Printf("   内容预览:\n%s\n\n", c.PreviewData(100))
 			
 		case *tg.Photo:
 			fmt.Printf("%d. 图片\n", i+1)
 			fmt.Printf("   文件名: %s\n", c.FileName)
 			fmt.Printf("   大小: %d 字节\n", len(c.FileData))
-			if c.Caption != "" {
-				fmt.Printf("   标题: %s\n", c.Caption)
+			if c.CaptionText != "" {
+				fmt.Printf("   标题: %s\n", c.CaptionText)
+			}
+			if c.Width > 0 {
+				fmt.Printf("   尺寸: %dx%d (%s)\n", c.Width, c.Height, c.MIME)
 			}
 			fmt.Printf("   来源: %s\n\n", c.ContentTrace.SourceType)
 		}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+
+	tg "github.com/riverfjs/telegramify-go"
+)
+
+// codeBlocks 只依赖公开的 tg.Segment，不需要导入 internal 包
+func codeBlocks(markdown string) []tg.Segment {
+	_, _, segments := tg.ConvertWithSegments(markdown, false, nil)
+	blocks := segments[:0]
+	for _, seg := range segments {
+		if seg.Kind == tg.SegmentCodeBlock {
+			blocks = append(blocks, seg)
+		}
+	}
+	return blocks
+}
+
+func main() {
+	markdown := "# 片段示例\n\n```go\nfmt.Println(\"hi\")\n```\n\n```mermaid\ngraph TD\n  A --> B\n```\n"
+
+	fmt.Println("=== 代码块片段示例 ===")
+	for _, seg := range codeBlocks(markdown) {
+		fmt.Printf("语言: %s\n", seg.Language)
+		fmt.Printf("结果中的 UTF-16 范围: [%d, %d)\n", seg.UTF16Start, seg.UTF16End)
+		fmt.Printf("原文中的字节范围: [%d, %d)\n", seg.SourceStart, seg.SourceEnd)
+		fmt.Printf("原始代码:\n%s\n", seg.RawCode)
+	}
+}
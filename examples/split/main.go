@@ -49,11 +49,8 @@ func main() {
 		fmt.Printf("  实体数量: %d\n", len(chunk.Entities))
 		
 		// 显示前 100 个字符
-		preview := chunk.Text
-		if len(preview) > 100 {
-			preview = preview[:100] + "..."
-		}
-		fmt.Printf("  预览: %s\n\n", preview)
+		preview := &tg.Text{Text: chunk.Text, Entities: chunk.Entities}
+		fmt.Printf("  预览: %s\n\n", preview.Preview(100))
 	}
 }
 
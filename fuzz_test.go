@@ -0,0 +1,145 @@
+package telegramify
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// fuzzSeeds 返回模糊测试的初始语料：golden fixture 文档、emoji 边界和 LaTeX
+func fuzzSeeds(f *testing.F) []string {
+	seeds := []string{
+		"",
+		"**bold** *italic* __underline__ ~~strike~~ ||spoiler|| `code`",
+		"[link](https://example.com) ![img](https://example.com/a.png)",
+		"👨‍👩‍👧‍👦 **😀 bold**\n\n🇺🇸🇯🇵 *é́ combining* ☑️",
+		"> quote **bold\n> still** quote\n>\n> — Author",
+		"**>expandable quote\n> more||",
+		"- [ ] task\n- [x] done\n  1. nested\n  2. **list**",
+		"| a | **b** |\n|---|---|\n| 1 | `2` |",
+		"```go\nfmt.Println(\"hi\")\n```\n\n```mermaid\ngraph TD; A-->B\n```",
+		"$$\\frac{a}{b} + \\sqrt{x^2}$$ and $\\alpha_1 \\leq \\beta^{2}$",
+		"\\(\\mathbb{R}\\) \\[x = \\sum_{i=0}^n i\\]",
+		"# Title\n\n## 二级标题\n\n这是中文段落。还有一句！\n\n---\n\n<b>html</b> <!-- c -->",
+		"---\ntitle: x\n---\n\nbody\r\n\r\ntext",
+		"\ufeff\n\n\n   \n\t",
+		"<details><summary>s</summary>\n\n**x**\n\n</details>",
+		"Term\n: definition[^1]\n\n[^1]: note",
+	}
+	inputs, err := filepath.Glob(filepath.Join("testdata", "golden", "*.md"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, path := range inputs {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		seeds = append(seeds, string(data))
+	}
+	return seeds
+}
+
+// checkEntityBounds 检查实体的偏移和长度非负且落在 text 之内
+func checkEntityBounds(t *testing.T, text string, entities []MessageEntity) {
+	t.Helper()
+	n := UTF16Len(text)
+	for _, e := range entities {
+		if e.Offset < 0 || e.Length <= 0 || e.Offset+e.Length > n {
+			t.Fatalf("entity %+v out of bounds of %d-unit text %q", e, n, text)
+		}
+	}
+}
+
+// FuzzConvert 测试任意输入的转换不 panic，实体都落在输出文本之内
+func FuzzConvert(f *testing.F) {
+	for _, seed := range fuzzSeeds(f) {
+		f.Add(seed, true)
+		f.Add(seed, false)
+	}
+	f.Fuzz(func(t *testing.T, markdown string, latexEscape bool) {
+		text, entities := Convert(markdown, latexEscape, nil)
+		if utf8.ValidString(markdown) && !utf8.ValidString(text) {
+			t.Fatalf("Convert(%q) = %q, not valid UTF-8", markdown, text)
+		}
+		checkEntityBounds(t, text, entities)
+	})
+}
+
+// FuzzSplitEntities 测试拆分结果拼接后等于原文，每块不超过上限，
+// 每块的实体都在块内
+func FuzzSplitEntities(f *testing.F) {
+	for _, seed := range fuzzSeeds(f) {
+		for _, max := range []int{2, 7, 64, 4096} {
+			f.Add(seed, max)
+		}
+	}
+	f.Fuzz(func(t *testing.T, markdown string, max int) {
+		// 一个代理对至少需要两个单位
+		if max < 2 || max > 8192 {
+			t.Skip()
+		}
+		text, entities := Convert(markdown, false, nil)
+		chunks := SplitEntities(text, entities, max)
+		var joined strings.Builder
+		for _, c := range chunks {
+			joined.WriteString(c.Text)
+			if UTF16Len(c.Text) > max {
+				t.Fatalf("chunk %q exceeds %d", c.Text, max)
+			}
+			checkEntityBounds(t, c.Text, c.Entities)
+		}
+		if joined.String() != text {
+			t.Fatalf("chunks join to %q, want %q", joined.String(), text)
+		}
+	})
+}
+
+// FuzzStripNewlinesAdjust 测试去掉首尾换行后，每个实体覆盖的文字等于原实体与保留部分的交集
+func FuzzStripNewlinesAdjust(f *testing.F) {
+	f.Add("\n\nhello world\n\n", 0, 7, 8, 10)
+	f.Add("\r\n😀 **x**\r\n\n", 1, 3, 2, 40)
+	f.Add("\n\r\n", 0, 3, 1, 1)
+	f.Add("plain", 1, 2, 0, 5)
+	f.Fuzz(func(t *testing.T, text string, off1, len1, off2, len2 int) {
+		if !utf8.ValidString(text) {
+			t.Skip()
+		}
+		units := utf16.Encode([]rune(text))
+		var entities []MessageEntity
+		for _, e := range [][2]int{{off1, len1}, {off2, len2}} {
+			if e[0] < 0 || e[1] <= 0 || e[0]+e[1] > len(units) {
+				continue
+			}
+			entities = append(entities, MessageEntity{Type: EntityBold, Offset: e[0], Length: e[1]})
+		}
+
+		stripped, adjusted := stripNewlinesAdjust(text, entities)
+		lead := len(text) - len(strings.TrimLeft(text, "\r\n"))
+		if want := strings.Trim(text, "\r\n"); stripped != want {
+			t.Fatalf("stripNewlinesAdjust(%q) = %q, want %q", text, stripped, want)
+		}
+		keptStart, keptEnd := lead, lead+len(utf16.Encode([]rune(stripped)))
+		var want []string
+		for _, e := range entities {
+			start, end := max(e.Offset, keptStart), min(e.Offset+e.Length, keptEnd)
+			if start < end {
+				want = append(want, string(utf16.Decode(units[start:end])))
+			}
+		}
+		keptUnits := utf16.Encode([]rune(stripped))
+		var got []string
+		for _, e := range adjusted {
+			if e.Offset < 0 || e.Length <= 0 || e.Offset+e.Length > len(keptUnits) {
+				t.Fatalf("entity %+v out of bounds of %q", e, stripped)
+			}
+			got = append(got, string(utf16.Decode(keptUnits[e.Offset:e.Offset+e.Length])))
+		}
+		if strings.Join(got, "\x00") != strings.Join(want, "\x00") || len(got) != len(want) {
+			t.Fatalf("entities cover %q, want %q", got, want)
+		}
+	})
+}
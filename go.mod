@@ -7,4 +7,5 @@ toolchain go1.24.6
 require (
 	github.com/yuin/goldmark v1.7.8
 	golang.org/x/image v0.36.0
+	golang.org/x/text v0.34.0
 )
@@ -0,0 +1,59 @@
+package telegramify
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// goldenFixture 与 internal/cmd/genfixtures 写出的 JSON 结构一致
+type goldenFixture struct {
+	Text     string          `json:"text"`
+	Entities []MessageEntity `json:"entities"`
+}
+
+// TestGoldenFixtures 用 testdata/golden 下的 fixture 锁定 Convert 输出
+//
+// 输出有意变化时用 `go run ./internal/cmd/genfixtures -source go` 刷新期望。
+func TestGoldenFixtures(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "golden", "*.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no golden fixtures found")
+	}
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".md")
+		t.Run(name, func(t *testing.T) {
+			md, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(strings.TrimSuffix(input, ".md") + ".json")
+			if err != nil {
+				t.Fatalf("missing expectation: %v", err)
+			}
+			var want goldenFixture
+			if err := json.Unmarshal(data, &want); err != nil {
+				t.Fatalf("bad expectation JSON: %v", err)
+			}
+
+			text, entities := Convert(string(md), true, nil)
+			if text != want.Text {
+				t.Errorf("text mismatch\ngot:  %q\nwant: %q", text, want.Text)
+			}
+			if len(entities) != len(want.Entities) {
+				t.Fatalf("entity count = %d, want %d\ngot:  %+v\nwant: %+v", len(entities), len(want.Entities), entities, want.Entities)
+			}
+			for i := range entities {
+				if entities[i] != want.Entities[i] {
+					t.Errorf("entity[%d] = %+v, want %+v", i, entities[i], want.Entities[i])
+				}
+			}
+		})
+	}
+}
@@ -14,22 +14,32 @@ func utf16Len(text string) int {
 }
 
 // TextBuffer accumulates plain text and tracks the current UTF-16 offset.
+//
+// Text is appended to a single byte slice, so ByteOffset is O(1) and String
+// copies the contents only once.
 type TextBuffer struct {
-	parts       []string
+	data        []byte
 	utf16Offset int
 }
 
 // New creates a new TextBuffer.
 func New() *TextBuffer {
-	return &TextBuffer{
-		parts:       make([]string, 0),
-		utf16Offset: 0,
+	return &TextBuffer{}
+}
+
+// Grow ensures room for another n bytes without reallocating.
+func (tb *TextBuffer) Grow(n int) {
+	if n <= cap(tb.data)-len(tb.data) {
+		return
 	}
+	grown := make([]byte, len(tb.data), len(tb.data)+n)
+	copy(grown, tb.data)
+	tb.data = grown
 }
 
 // Write appends text to the buffer.
 func (tb *TextBuffer) Write(text string) {
-	tb.parts = append(tb.parts, text)
+	tb.data = append(tb.data, text...)
 	tb.utf16Offset += utf16Len(text)
 }
 
@@ -40,62 +50,40 @@ func (tb *TextBuffer) UTF16Offset() int {
 
 // ByteOffset returns the current byte offset (total string length).
 func (tb *TextBuffer) ByteOffset() int {
-	total := 0
-	for _, p := range tb.parts {
-		total += len(p)
-	}
-	return total
+	return len(tb.data)
 }
 
 // TrailingNewlineCount counts trailing newline characters in the buffer.
 func (tb *TextBuffer) TrailingNewlineCount() int {
 	count := 0
-	for i := len(tb.parts) - 1; i >= 0; i-- {
-		part := tb.parts[i]
-		for j := len(part) - 1; j >= 0; j-- {
-			if part[j] == '\n' {
-				count++
-			} else {
-				return count
-			}
-		}
+	for i := len(tb.data) - 1; i >= 0 && tb.data[i] == '\n'; i-- {
+		count++
 	}
 	return count
 }
 
-// PopLast removes and returns the last written part.
-// Used for replacing just-written bullet prefixes in task lists.
-func (tb *TextBuffer) PopLast() string {
-	if len(tb.parts) == 0 {
-		return ""
-	}
-	last := tb.parts[len(tb.parts)-1]
-	tb.parts = tb.parts[:len(tb.parts)-1]
-	tb.utf16Offset -= utf16Len(last)
-	return last
+// Replace replaces the bytes [start, end) with text and returns the change
+// in UTF-16 length. Callers must shift any offsets recorded after end.
+func (tb *TextBuffer) Replace(start, end int, text string) int {
+	delta := utf16Len(text) - utf16Len(string(tb.data[start:end]))
+	tail := append([]byte(text), tb.data[end:]...)
+	tb.data = append(tb.data[:start], tail...)
+	tb.utf16Offset += delta
+	return delta
+}
+
+// Slice returns the text between the byte offsets start and end.
+func (tb *TextBuffer) Slice(start, end int) string {
+	return string(tb.data[start:end])
 }
 
 // String returns the accumulated text.
 func (tb *TextBuffer) String() string {
-	if len(tb.parts) == 0 {
-		return ""
-	}
-	// Calculate total length
-	totalLen := 0
-	for _, p := range tb.parts {
-		totalLen += len(p)
-	}
-	// Build result efficiently
-	result := make([]byte, 0, totalLen)
-	for _, p := range tb.parts {
-		result = append(result, []byte(p)...)
-	}
-	return string(result)
+	return string(tb.data)
 }
 
-// Reset clears the buffer.
+// Reset clears the buffer, keeping its capacity for reuse.
 func (tb *TextBuffer) Reset() {
-	tb.parts = tb.parts[:0]
+	tb.data = tb.data[:0]
 	tb.utf16Offset = 0
 }
-
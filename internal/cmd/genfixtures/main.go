@@ -0,0 +1,118 @@
+// Command genfixtures 为 testdata/golden 下的 Markdown fixture 生成期望输出
+//
+// 每个 fixture 由两个文件组成：
+//
+//	<name>.md    输入 Markdown
+//	<name>.json  期望输出 {"text": "...", "entities": [...]}
+//
+// 期望输出可以来自 Python 版 telegramify-markdown（用于对齐两个实现），
+// 也可以来自当前 Go 实现（用于锁定行为，防止重构悄悄改变输出）：
+//
+//	# 需要 pip install telegramify-markdown
+//	go run ./internal/cmd/genfixtures -source python
+//
+//	# 用当前 Go 输出刷新期望
+//	go run ./internal/cmd/genfixtures -source go
+//
+// 只想刷新部分 fixture 时，把名字作为参数传入：
+//
+//	go run ./internal/cmd/genfixtures -source go headings latex
+//
+// 所有 fixture 都以 latex_escape=True 转换，与 Python 版默认值一致。
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	tg "github.com/riverfjs/telegramify-go"
+)
+
+// fixture 与 golden_test.go 读取的 JSON 结构一致
+type fixture struct {
+	Text     string             `json:"text"`
+	Entities []tg.MessageEntity `json:"entities"`
+}
+
+// pythonScript 从 stdin 读取 Markdown，用 Python 版转换后输出 JSON
+const pythonScript = `
+import json, sys
+from telegramify_markdown import convert
+
+text, entities = convert(sys.stdin.read(), latex_escape=True)
+json.dump({"text": text, "entities": [e.to_dict() for e in entities]}, sys.stdout, ensure_ascii=False)
+`
+
+func main() {
+	dir := flag.String("dir", "testdata/golden", "fixture directory")
+	source := flag.String("source", "python", "where expectations come from: python or go")
+	python := flag.String("python", "python3", "python interpreter used with -source python")
+	flag.Parse()
+
+	names := flag.Args()
+	if len(names) == 0 {
+		matches, err := filepath.Glob(filepath.Join(*dir, "*.md"))
+		if err != nil {
+			fatalf("glob fixtures: %v", err)
+		}
+		for _, m := range matches {
+			names = append(names, strings.TrimSuffix(filepath.Base(m), ".md"))
+		}
+	}
+
+	for _, name := range names {
+		input, err := os.ReadFile(filepath.Join(*dir, name+".md"))
+		if err != nil {
+			fatalf("read %s: %v", name, err)
+		}
+
+		var fx fixture
+		switch *source {
+		case "go":
+			fx.Text, fx.Entities = tg.Convert(string(input), true, nil)
+		case "python":
+			fx, err = convertWithPython(*python, input)
+			if err != nil {
+				fatalf("convert %s with python: %v", name, err)
+			}
+		default:
+			fatalf("unknown -source %q (want python or go)", *source)
+		}
+		if fx.Entities == nil {
+			fx.Entities = []tg.MessageEntity{}
+		}
+
+		data, err := json.MarshalIndent(fx, "", "  ")
+		if err != nil {
+			fatalf("marshal %s: %v", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(*dir, name+".json"), append(data, '\n'), 0o644); err != nil {
+			fatalf("write %s: %v", name, err)
+		}
+		fmt.Printf("wrote %s.json (%d entities)\n", name, len(fx.Entities))
+	}
+}
+
+func convertWithPython(interpreter string, input []byte) (fixture, error) {
+	var fx fixture
+	cmd := exec.Command(interpreter, "-c", pythonScript)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fx, err
+	}
+	err = json.Unmarshal(out, &fx)
+	return fx, err
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "genfixtures: "+format+"\n", args...)
+	os.Exit(1)
+}
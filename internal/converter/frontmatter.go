@@ -0,0 +1,97 @@
+package converter
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// YAML front matter 中的一行 key: value
+	frontMatterKeyRe = regexp.MustCompile(`^([A-Za-z0-9_][\w.-]*)[ \t]*:(?:[ \t]+(.*))?$`)
+
+	// 标题中需要转义的 Markdown 符号
+	markdownEscaper = strings.NewReplacer(
+		`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`,
+		`<`, `\<`, `>`, `\>`, `|`, `\|`, `~`, `\~`, `$`, `\$`,
+	)
+)
+
+// StripFrontMatter 删除文本开头的 YAML front matter，返回剩余文本和其中的顶层键值
+//
+// front matter 以第一行 --- 开始，以单独一行的 --- 或 ... 结束，内容必须是
+// key: value 形式（允许注释和嵌套的缩进行，嵌套内容不解析）。未闭合或不像 YAML 时原样返回。
+// headingKeys 不为空时按顺序取出存在的键：第一个渲染为一级标题，其余渲染为斜体行。
+// offsets 不为 nil 时记录所做的替换
+func StripFrontMatter(text string, headingKeys []string, offsets *OffsetMap) (string, map[string]string) {
+	start := 0
+	if strings.HasPrefix(text, "\ufeff") {
+		start = len("\ufeff")
+	}
+	if !strings.HasPrefix(text[start:], "---\n") {
+		return text, nil
+	}
+
+	meta := make(map[string]string)
+	pos := start + len("---\n")
+	for pos < len(text) {
+		lineEnd := strings.IndexByte(text[pos:], '\n')
+		next := pos + lineEnd + 1
+		if lineEnd < 0 {
+			lineEnd = len(text) - pos
+			next = len(text)
+		}
+		line := strings.TrimRight(text[pos:pos+lineEnd], " \t")
+		switch {
+		case line == "---" || line == "...":
+			if len(meta) == 0 {
+				return text, nil
+			}
+			r := newRewriter(text)
+			r.replace(0, next, frontMatterHeading(meta, headingKeys))
+			return r.finish(offsets), meta
+		case line == "" || strings.HasPrefix(line, "#"):
+			// 空行和注释
+		case line[0] == ' ' || line[0] == '\t' || strings.HasPrefix(line, "- "):
+			// 嵌套内容不解析
+		default:
+			m := frontMatterKeyRe.FindStringSubmatch(line)
+			if m == nil {
+				return text, nil
+			}
+			if value := unquoteYAML(m[2]); value != "" {
+				meta[m[1]] = value
+			}
+		}
+		pos = next
+	}
+	// 没有结束标记
+	return text, nil
+}
+
+// unquoteYAML 去掉标量值两端成对的引号
+func unquoteYAML(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 {
+		if (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			return value[1 : len(value)-1]
+		}
+	}
+	return value
+}
+
+// frontMatterHeading 将选中的键渲染为 Markdown
+func frontMatterHeading(meta map[string]string, keys []string) string {
+	var b strings.Builder
+	for _, key := range keys {
+		value, ok := meta[key]
+		if !ok {
+			continue
+		}
+		if b.Len() == 0 {
+			b.WriteString("# " + markdownEscaper.Replace(value) + "\n\n")
+		} else {
+			b.WriteString("*" + markdownEscaper.Replace(value) + "*\n\n")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,557 @@
+package converter
+
+import (
+	"html"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+
+	"github.com/riverfjs/telegramify-go/internal/types"
+)
+
+// htmlTokenKind HTML 记号类型
+type htmlTokenKind int
+
+const (
+	htmlText htmlTokenKind = iota
+	htmlStartTag
+	htmlEndTag
+)
+
+// htmlToken 扫描 HTML 得到的记号，标签名为小写
+type htmlToken struct {
+	kind        htmlTokenKind
+	name        string
+	attrs       map[string]string
+	selfClosing bool
+	text        string // htmlText 的内容，已解码字符实体
+}
+
+// scanHTML 将 HTML 片段切分为文本和标签记号
+//
+// 只做宽松的词法扫描，不构建 DOM：注释、<!DOCTYPE> 和 <?...?> 被跳过，
+// 不成标签的 < 按普通文本处理，未闭合的标签延续到片段末尾。
+func scanHTML(s string) []htmlToken {
+	var tokens []htmlToken
+	text := func(t string) {
+		if t != "" {
+			tokens = append(tokens, htmlToken{kind: htmlText, text: html.UnescapeString(t)})
+		}
+	}
+	for len(s) > 0 {
+		lt := strings.IndexByte(s, '<')
+		if lt < 0 {
+			text(s)
+			break
+		}
+		text(s[:lt])
+		s = s[lt:]
+		switch {
+		case strings.HasPrefix(s, "<!--"):
+			end := strings.Index(s, "-->")
+			if end < 0 {
+				return tokens
+			}
+			s = s[end+3:]
+			continue
+		case strings.HasPrefix(s, "<!"), strings.HasPrefix(s, "<?"):
+			end := strings.IndexByte(s, '>')
+			if end < 0 {
+				return tokens
+			}
+			s = s[end+1:]
+			continue
+		}
+		tok, n := scanHTMLTag(s)
+		if n == 0 {
+			text("<")
+			s = s[1:]
+			continue
+		}
+		tokens = append(tokens, tok)
+		s = s[n:]
+	}
+	return tokens
+}
+
+// scanHTMLTag 解析 s 开头的标签，返回记号和消耗的字节数；不是标签时返回 0
+func scanHTMLTag(s string) (htmlToken, int) {
+	tok := htmlToken{kind: htmlStartTag}
+	i := 1
+	if i < len(s) && s[i] == '/' {
+		tok.kind = htmlEndTag
+		i++
+	}
+	start := i
+	for i < len(s) && isTagNameByte(s[i]) {
+		i++
+	}
+	if i == start || !isASCIILetter(s[start]) {
+		return htmlToken{}, 0
+	}
+	tok.name = strings.ToLower(s[start:i])
+
+	for i < len(s) {
+		switch c := s[i]; {
+		case c == '>':
+			return tok, i + 1
+		case c == '/' && i+1 < len(s) && s[i+1] == '>':
+			tok.selfClosing = true
+			return tok, i + 2
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '/':
+			i++
+		default:
+			nameStart := i
+			for i < len(s) && !strings.ContainsRune(" \t\n\r/>=", rune(s[i])) {
+				i++
+			}
+			name := strings.ToLower(s[nameStart:i])
+			value := ""
+			if i < len(s) && s[i] == '=' {
+				i++
+				if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+					quote := s[i]
+					end := strings.IndexByte(s[i+1:], quote)
+					if end < 0 {
+						return htmlToken{}, 0
+					}
+					value = s[i+1 : i+1+end]
+					i += end + 2
+				} else {
+					valueStart := i
+					for i < len(s) && !strings.ContainsRune(" \t\n\r>", rune(s[i])) {
+						i++
+					}
+					value = s[valueStart:i]
+				}
+			}
+			if tok.attrs == nil {
+				tok.attrs = make(map[string]string)
+			}
+			tok.attrs[name] = html.UnescapeString(value)
+		}
+	}
+	return htmlToken{}, 0
+}
+
+func isASCIILetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isTagNameByte(c byte) bool {
+	return isASCIILetter(c) || '0' <= c && c <= '9' || c == '-'
+}
+
+// htmlBlockTags 按块处理的标签，前后与其他内容空行分隔
+var htmlBlockTags = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "header": true,
+	"footer": true, "main": true, "aside": true, "nav": true, "figure": true,
+	"figcaption": true, "center": true, "details": true, "summary": true,
+	"ul": true, "ol": true, "dl": true, "dt": true, "dd": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+// htmlInlineEntities 转换为实体的行内标签
+var htmlInlineEntities = map[string]string{
+	"b": types.EntityBold, "strong": types.EntityBold,
+	"i": types.EntityItalic, "em": types.EntityItalic,
+	"u": types.EntityUnderline, "ins": types.EntityUnderline,
+	"s": types.EntityStrikethrough, "strike": types.EntityStrikethrough, "del": types.EntityStrikethrough,
+	"code": types.EntityCode, "tt": types.EntityCode, "kbd": types.EntityCode,
+	"tg-spoiler": types.EntitySpoiler,
+}
+
+// htmlInlineEntity 返回行内标签对应的实体类型，不转换为实体时返回空；
+// <mark> 使用 RenderConfig.MarkEntity，公式标签使用 MathEntity 和 MathBlockEntity
+func (w *EventWalker) htmlInlineEntity(name string) string {
+	switch name {
+	case "mark":
+		if w.config.MarkEntity != "" {
+			return w.config.MarkEntity
+		}
+		return types.EntityUnderline
+	case MathMarker:
+		return w.config.MathEntity
+	case MathBlockMarker:
+		// Telegram 不支持嵌套的引用；列表项中的公式前有缩进，引用不从行首开始
+		if w.config.MathBlockEntity == types.EntityBlockquote && (len(w.blockquoteScopes) > 0 || len(w.listStack) > 0) {
+			return ""
+		}
+		return w.config.MathBlockEntity
+	}
+	return htmlInlineEntities[name]
+}
+
+// entityTag 生成任意类型实体的标签，如 <tg-entity type="underline">，
+// 类型由 RenderConfig.EntityTagTypes 限定
+const entityTag = "tg-entity"
+
+// startEntityTag 处理 <tg-entity> 开始标签：推入 type 属性指定的实体，url、language 和
+// custom_emoji_id 属性随之带上。类型不被允许、text_link 缺少可用的 url、custom_emoji
+// 缺少 custom_emoji_id 或引用不能在此开始时不生成实体，只保留文字
+func (w *EventWalker) startEntityTag(attrs map[string]string) {
+	scope := EntityScope{
+		EntityType:    strings.TrimSpace(attrs["type"]),
+		StartOffset:   w.buf.UTF16Offset(),
+		Language:      strings.TrimSpace(attrs["language"]),
+		CustomEmojiID: strings.TrimSpace(attrs["custom_emoji_id"]),
+	}
+	if dest := attrs["url"]; dest != "" {
+		scope.URL, _ = w.linkURL(dest)
+	}
+	quote := scope.EntityType == types.EntityBlockquote || scope.EntityType == types.EntityExpandableBlockquote
+	if !w.config.EntityTagAllowed(scope.EntityType) ||
+		(scope.EntityType == types.EntityTextLink && scope.URL == "") ||
+		(scope.EntityType == types.EntityCustomEmoji && scope.CustomEmojiID == "") ||
+		(quote && !w.entityTagQuoteAllowed()) {
+		w.entityTags = append(w.entityTags, "")
+		return
+	}
+	w.entityStack = append(w.entityStack, scope)
+	w.entityTags = append(w.entityTags, scope.EntityType)
+}
+
+// entityTagQuoteAllowed 报告当前位置能否开始 <tg-entity> 引用：Telegram 不支持嵌套的引用，
+// 引用也必须从行首开始
+func (w *EventWalker) entityTagQuoteAllowed() bool {
+	if len(w.blockquoteScopes) > 0 {
+		return false
+	}
+	for _, scope := range w.entityStack {
+		if scope.EntityType == types.EntityBlockquote || scope.EntityType == types.EntityExpandableBlockquote {
+			return false
+		}
+	}
+	return w.buf.ByteOffset() == 0 || w.buf.TrailingNewlineCount() > 0
+}
+
+// endEntityTag 结束最近一个未结束的 <tg-entity> 标签，没有时忽略
+func (w *EventWalker) endEntityTag() {
+	if len(w.entityTags) == 0 {
+		return
+	}
+	entityType := w.entityTags[len(w.entityTags)-1]
+	w.entityTags = w.entityTags[:len(w.entityTags)-1]
+	if entityType != "" {
+		w.popEntity(entityType)
+	}
+}
+
+// htmlTransparentTags 只输出内容的标签
+var htmlTransparentTags = map[string]bool{
+	"span": true, "font": true, "small": true, "big": true, "sup": true,
+	"sub": true, "abbr": true, "cite": true, "q": true,
+	"time": true, "label": true, "picture": true, "thead": true,
+	"tbody": true, "tfoot": true, "html": true, "body": true,
+}
+
+// htmlVoidTags 没有结束标签的元素
+var htmlVoidTags = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"param": true, "source": true, "track": true, "wbr": true,
+}
+
+// htmlRenderer 渲染一个 HTML 块的状态
+type htmlRenderer struct {
+	w      *EventWalker
+	blocks []int    // 未结束的块标签开始时的字节偏移
+	open   []string // 未结束的行内标签，用于忽略不配对的结束标签
+	space  bool     // 有待输出的空白
+
+	// 未结束的不支持元素，其内容整体丢弃
+	skip      string
+	skipDepth int
+
+	// 表格状态
+	table   [][]string
+	row     []string
+	cell    *strings.Builder
+	inTable bool
+}
+
+// onHTMLBlock 尽量保留 HTML 块中的内容：段落和 div 输出文字，blockquote、img、
+// 简单的 table 以及常见行内标签转换为对应的渲染；不支持的元素连同内容一起丢弃，
+// 并记录到 DroppedHTML
+func (w *EventWalker) onHTMLBlock(n *ast.HTMLBlock) {
+	raw := w.htmlBlockText(n)
+	if raw == ExpandableMarker {
+		w.forceExpandable()
+		return
+	}
+	r := &htmlRenderer{w: w}
+	start := w.buf.ByteOffset()
+	r.startBlock()
+	for _, tok := range scanHTML(raw) {
+		r.token(tok)
+	}
+	for i := len(r.open) - 1; i >= 0; i-- {
+		r.endInline(r.open[i])
+	}
+	for len(r.blocks) > 0 {
+		r.endBlock()
+	}
+	if r.inTable {
+		r.endTable()
+	}
+	if w.buf.ByteOffset() == start {
+		return
+	}
+	if len(w.listStack) == 0 {
+		w.blockCount++
+	} else if w.buf.TrailingNewlineCount() == 0 {
+		w.buf.Write("\n")
+	}
+}
+
+func (r *htmlRenderer) token(tok htmlToken) {
+	if r.skip != "" {
+		if tok.name == r.skip && !htmlVoidTags[tok.name] {
+			if tok.kind == htmlStartTag && !tok.selfClosing {
+				r.skipDepth++
+			} else if tok.kind == htmlEndTag {
+				r.skipDepth--
+			}
+			if r.skipDepth == 0 {
+				r.skip = ""
+			}
+		}
+		return
+	}
+	if tok.kind == htmlText {
+		r.text(tok.text)
+		return
+	}
+	if r.inTable {
+		r.tableToken(tok)
+		return
+	}
+	if tok.kind == htmlEndTag {
+		r.endTag(tok.name)
+		return
+	}
+
+	switch name := tok.name; {
+	case htmlBlockTags[name]:
+		if !tok.selfClosing {
+			r.startBlock()
+			if name[0] == 'h' && len(name) == 2 {
+				r.startInline(name, types.EntityBold)
+			}
+		}
+	case name == "blockquote":
+		r.space = false
+		r.w.onStartBlockquote()
+		r.blocks = append(r.blocks, -1)
+	case name == "li":
+		r.space = false
+		if r.w.buf.ByteOffset() > 0 && r.w.buf.TrailingNewlineCount() == 0 {
+			r.w.buf.Write("\n")
+		}
+		r.w.buf.Write("⦁ ")
+	case name == "br":
+		r.space = false
+		if r.w.buf.ByteOffset() > 0 {
+			r.w.buf.Write("\n")
+		}
+	case name == "hr":
+		r.space = false
+		r.w.onRule()
+	case name == "img":
+		r.flushSpace()
+		r.w.startImage(tok.attrs["src"])
+		r.w.buf.Write(strings.TrimSpace(tok.attrs["alt"]))
+		r.w.onEndLink()
+	case name == "a":
+		r.flushSpace()
+		r.w.startLink(tok.attrs["href"])
+		r.open = append(r.open, name)
+	case name == "table":
+		r.startBlock()
+		r.inTable = true
+	case name == entityTag:
+		if !tok.selfClosing {
+			r.flushSpace()
+			r.w.startEntityTag(tok.attrs)
+			r.open = append(r.open, name)
+		}
+	case r.w.htmlInlineEntity(name) != "":
+		if !tok.selfClosing {
+			r.flushSpace()
+			r.startInline(name, r.w.htmlInlineEntity(name))
+		}
+	case htmlTransparentTags[name]:
+	default:
+		r.w.droppedHTML = append(r.w.droppedHTML, name)
+		if !tok.selfClosing && !htmlVoidTags[name] {
+			r.skip, r.skipDepth = name, 1
+		}
+	}
+}
+
+func (r *htmlRenderer) endTag(name string) {
+	switch {
+	case htmlBlockTags[name]:
+		if name[0] == 'h' && len(name) == 2 {
+			r.endInline(name)
+		}
+		if len(r.blocks) > 0 && r.blocks[len(r.blocks)-1] >= 0 {
+			r.endBlock()
+		}
+	case name == "blockquote":
+		if len(r.blocks) > 0 && r.blocks[len(r.blocks)-1] < 0 {
+			r.blocks = r.blocks[:len(r.blocks)-1]
+			r.space = false
+			r.w.onEndBlockquote()
+		}
+	case name == "a" || name == entityTag || r.w.htmlInlineEntity(name) != "":
+		r.endInline(name)
+	}
+}
+
+// startBlock 开始一个块：与之前的内容空行分隔（列表内只换行）
+func (r *htmlRenderer) startBlock() {
+	r.space = false
+	if len(r.w.listStack) > 0 {
+		r.w.ensureLineStart()
+	} else {
+		r.w.ensureBlockSpacing()
+	}
+	r.blocks = append(r.blocks, r.w.buf.ByteOffset())
+}
+
+func (r *htmlRenderer) endBlock() {
+	start := r.blocks[len(r.blocks)-1]
+	r.blocks = r.blocks[:len(r.blocks)-1]
+	if start < 0 {
+		r.w.onEndBlockquote()
+		return
+	}
+	r.space = false
+	if r.w.buf.ByteOffset() > start && len(r.w.listStack) == 0 {
+		r.w.blockCount++
+	}
+}
+
+func (r *htmlRenderer) startInline(name, entityType string) {
+	r.w.pushEntity(entityType, "")
+	r.open = append(r.open, name)
+}
+
+// endInline 结束最近一个名为 name 的行内标签；没有对应的开始标签时忽略
+func (r *htmlRenderer) endInline(name string) {
+	for i := len(r.open) - 1; i >= 0; i-- {
+		if r.open[i] != name {
+			continue
+		}
+		r.open = append(r.open[:i], r.open[i+1:]...)
+		switch {
+		case name == "a":
+			r.w.onEndLink()
+		case name == entityTag:
+			r.w.endEntityTag()
+		case name[0] == 'h' && len(name) == 2:
+			r.w.popEntity(types.EntityBold)
+		default:
+			r.w.popEntity(r.w.htmlInlineEntity(name))
+		}
+		return
+	}
+}
+
+// text 按 HTML 规则把连续空白折叠为一个空格，行首的空白丢弃
+func (r *htmlRenderer) text(s string) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		if s != "" {
+			r.space = true
+		}
+		return
+	}
+	if s[0] == ' ' || s[0] == '\t' || s[0] == '\n' || s[0] == '\r' {
+		r.space = true
+	}
+	r.flushSpace()
+	joined := strings.Join(fields, " ")
+	if r.cell != nil {
+		r.cell.WriteString(joined)
+	} else if !r.inTable {
+		r.w.buf.Write(joined)
+	}
+	last := s[len(s)-1]
+	r.space = last == ' ' || last == '\t' || last == '\n' || last == '\r'
+}
+
+// flushSpace 输出待定的空白，行首和单元格开头除外
+func (r *htmlRenderer) flushSpace() {
+	if !r.space {
+		return
+	}
+	r.space = false
+	if r.cell != nil {
+		if r.cell.Len() > 0 {
+			r.cell.WriteByte(' ')
+		}
+		return
+	}
+	if r.inTable || r.w.buf.ByteOffset() == 0 || r.w.buf.TrailingNewlineCount() > 0 {
+		return
+	}
+	if len(r.blocks) > 0 && r.w.buf.ByteOffset() == r.blocks[len(r.blocks)-1] {
+		return
+	}
+	r.w.buf.Write(" ")
+}
+
+// tableToken 处理表格中的标签，单元格只保留文字
+func (r *htmlRenderer) tableToken(tok htmlToken) {
+	switch tok.name {
+	case "tr":
+		r.endCell()
+		if len(r.row) > 0 {
+			r.table = append(r.table, r.row)
+		}
+		r.row = nil
+	case "td", "th":
+		r.endCell()
+		if tok.kind == htmlStartTag {
+			r.cell = new(strings.Builder)
+		}
+	case "table":
+		if tok.kind == htmlEndTag {
+			r.endTable()
+		} else {
+			// 嵌套表格无法对齐，只保留文字
+			r.w.droppedHTML = append(r.w.droppedHTML, "table")
+		}
+	case "br":
+		r.space = true
+	case "img":
+		if r.cell != nil {
+			r.text(tok.attrs["alt"])
+		}
+	}
+}
+
+func (r *htmlRenderer) endCell() {
+	if r.cell != nil {
+		r.row = append(r.row, r.cell.String())
+		r.cell = nil
+	}
+	r.space = false
+}
+
+// endTable 以 Markdown 表格相同的格式输出收集到的单元格
+func (r *htmlRenderer) endTable() {
+	r.endCell()
+	if len(r.row) > 0 {
+		r.table = append(r.table, r.row)
+	}
+	r.inTable = false
+	r.w.tableRows = r.table
+	r.w.onEndTable()
+	r.table, r.row = nil, nil
+	if len(r.blocks) > 0 {
+		r.blocks = r.blocks[:len(r.blocks)-1]
+	}
+}
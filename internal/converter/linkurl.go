@@ -0,0 +1,161 @@
+package converter
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/riverfjs/telegramify-go/internal/types"
+	"github.com/riverfjs/telegramify-go/internal/util"
+)
+
+// MaxLinkURLLength 是 text_link 地址编码后的最大字节数，更长的地址会被 Telegram 拒绝
+const MaxLinkURLLength = 2048
+
+// allowedLinkSchemes 可以生成 text_link 实体的 URL 协议
+var allowedLinkSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"tg":     true,
+	"mailto": true,
+}
+
+// DroppedLink 记录一个因地址不可用而没有生成实体的链接
+type DroppedLink struct {
+	URL    string // Markdown 中的原地址
+	Reason string
+}
+
+// linkURL 返回链接目标可用于 text_link 的 URL，ok 为 false 时链接只渲染为文字
+//
+// 只接受 http(s)（须有主机）、tg 和 mailto 协议；javascript:、data: 等其他协议一律丢弃。
+// 没有协议的相对地址在配置了 BaseURL 时按其解析，否则丢弃。
+// 接受的地址经过 normalizeURL 编码，编码后超过 MaxLinkURLLength 的同样丢弃。
+func (w *EventWalker) linkURL(dest string) (string, bool) {
+	dest = strings.TrimSpace(dest)
+	if dest == "" {
+		return "", false
+	}
+	u, err := url.Parse(dest)
+	if err != nil {
+		w.dropLink(dest, err.Error())
+		return "", false
+	}
+	if u.Scheme == "" {
+		if w.config.BaseURL == "" {
+			w.dropLink(dest, "relative url without base url")
+			return "", false
+		}
+		base, err := url.Parse(w.config.BaseURL)
+		if err != nil || !base.IsAbs() {
+			w.dropLink(dest, "invalid base url")
+			return "", false
+		}
+		u = base.ResolveReference(u)
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if !allowedLinkSchemes[scheme] {
+		w.dropLink(dest, fmt.Sprintf("scheme %q not allowed", u.Scheme))
+		return "", false
+	}
+	// Telegram 拒绝没有主机的 http(s) 地址，如 "https:foo"
+	if (scheme == "http" || scheme == "https") && u.Host == "" {
+		w.dropLink(dest, "url has no host")
+		return "", false
+	}
+	normalized := normalizeURL(u)
+	if len(normalized) > MaxLinkURLLength {
+		w.dropLink(dest, fmt.Sprintf("url is %d bytes, limit is %d", len(normalized), MaxLinkURLLength))
+		return "", false
+	}
+	return normalized, true
+}
+
+// linkEntities 报告链接是否渲染为 text_link 实体
+func (w *EventWalker) linkEntities() bool {
+	return w.config.LinkStyle == "" || w.config.LinkStyle == types.LinkStyleEntity
+}
+
+// linkReference 返回地址在脚注列表中的编号（从 1 开始），首次出现时分配
+func (w *EventWalker) linkReference(url string) int {
+	if n, ok := w.linkRefIndex[url]; ok {
+		return n
+	}
+	if w.linkRefIndex == nil {
+		w.linkRefIndex = make(map[string]int)
+	}
+	w.linkRefs = append(w.linkRefs, url)
+	w.linkRefIndex[url] = len(w.linkRefs)
+	return len(w.linkRefs)
+}
+
+// writeLinkReferences 在文档末尾写入 "[n] url" 形式的脚注列表。
+// 列表在切分之前写入，短文档中引用和列表会留在同一条消息里
+func (w *EventWalker) writeLinkReferences() {
+	if len(w.linkRefs) == 0 {
+		return
+	}
+	w.ensureBlockSpacing()
+	for i, url := range w.linkRefs {
+		if i > 0 {
+			w.buf.Write("\n")
+		}
+		w.buf.Write(fmt.Sprintf("[%d] %s", i+1, url))
+	}
+	w.blockCount++
+}
+
+func (w *EventWalker) dropLink(dest, reason string) {
+	w.droppedLinks = append(w.droppedLinks, DroppedLink{URL: dest, Reason: reason})
+}
+
+// normalizeURL 将地址编码为 Telegram 接受的形式：主机转为 IDNA（punycode），
+// 路径、查询和片段中的空格、非 ASCII 等字符按 RFC 3986 百分号编码，
+// 已经编码的 %XX 序列保持不变
+func normalizeURL(u *url.URL) string {
+	if u.Host != "" {
+		host := util.HostToASCII(u.Hostname())
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]" // IPv6
+		}
+		if port := u.Port(); port != "" {
+			host += ":" + port
+		}
+		u.Host = host
+	}
+	u.RawQuery = escapeURLPart(u.RawQuery)
+	return u.String()
+}
+
+// escapeURLPart 百分号编码 s 中 URL 不允许出现的字节，保留合法的 %XX 序列
+func escapeURLPart(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]):
+			b.WriteByte(c)
+		case c != '%' && isURLChar(c):
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		}
+	}
+	return b.String()
+}
+
+// isURLChar 判断 c 是否是 RFC 3986 的 unreserved 或 reserved 字符
+func isURLChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("-._~:/?#[]@!$&'()*+,;=", c) >= 0
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
@@ -0,0 +1,275 @@
+package converter
+
+import (
+	"sort"
+	"strings"
+)
+
+// Edit 预处理中的一次替换：原文 [OrigStart, OrigEnd) 被替换为新文本 [NewStart, NewEnd)，单位为字节
+type Edit struct {
+	OrigStart int
+	OrigEnd   int
+	NewStart  int
+	NewEnd    int
+}
+
+// OffsetMap 记录预处理对源文本的改写，用于把预处理后的偏移还原为用户原文中的偏移
+//
+// 每个预处理步骤追加一层替换，还原时按相反顺序逐层映射。零值表示没有任何改写。
+type OffsetMap struct {
+	layers [][]Edit
+}
+
+// add 追加一个预处理步骤产生的替换，edits 必须按位置递增且互不重叠
+func (m *OffsetMap) add(edits []Edit) {
+	if m == nil || len(edits) == 0 {
+		return
+	}
+	m.layers = append(m.layers, edits)
+}
+
+// ToOriginal 将预处理后文本中的字节偏移映射回原文
+//
+// 落在替换结果内部的偏移映射到被替换原文的起点，替换结果末尾映射到原文末尾。
+func (m *OffsetMap) ToOriginal(offset int) int {
+	if m == nil {
+		return offset
+	}
+	for i := len(m.layers) - 1; i >= 0; i-- {
+		offset = mapEdits(m.layers[i], offset)
+	}
+	return offset
+}
+
+// mapEdits 将一层替换之后的偏移映射回替换之前
+func mapEdits(edits []Edit, offset int) int {
+	// 最后一个 NewStart <= offset 的替换
+	i := sort.Search(len(edits), func(i int) bool { return edits[i].NewStart > offset }) - 1
+	if i < 0 {
+		return offset
+	}
+	e := edits[i]
+	if offset >= e.NewEnd {
+		return offset - e.NewEnd + e.OrigEnd
+	}
+	// 替换结果内部没有对应的原文位置
+	return e.OrigStart
+}
+
+// rewriter 在源文本上按顺序做替换，同时记录 Edit
+type rewriter struct {
+	src   string
+	out   strings.Builder
+	last  int // src 中已写出的位置
+	edits []Edit
+}
+
+func newRewriter(src string) *rewriter {
+	return &rewriter{src: src}
+}
+
+// replace 将 src[start:end] 替换为 text，start 不能小于上一次替换的 end
+func (r *rewriter) replace(start, end int, text string) {
+	if r.edits == nil {
+		r.out.Grow(len(r.src))
+	}
+	r.out.WriteString(r.src[r.last:start])
+	newStart := r.out.Len()
+	r.out.WriteString(text)
+	r.edits = append(r.edits, Edit{OrigStart: start, OrigEnd: end, NewStart: newStart, NewEnd: r.out.Len()})
+	r.last = end
+}
+
+// finish 返回改写后的文本，并把替换记录到 offsets（可为 nil）
+func (r *rewriter) finish(offsets *OffsetMap) string {
+	if r.edits == nil {
+		return r.src
+	}
+	r.out.WriteString(r.src[r.last:])
+	offsets.add(r.edits)
+	return r.out.String()
+}
+
+// nonCodeRanges 返回 text 中代码块和行内代码之外的区间
+func nonCodeRanges(text string) [][2]int {
+	var ranges [][2]int
+	last := 0
+	for _, loc := range codeRegions(text) {
+		ranges = append(ranges, [2]int{last, loc[0]})
+		last = loc[1]
+	}
+	return append(ranges, [2]int{last, len(text)})
+}
+
+// codeRegions 返回 text 中围栏代码块和行内代码的区间
+//
+// 围栏由行首（引用符号和列表符号之后）三个以上的 ` 或 ~ 组成，只有同一字符、
+// 不短于开围栏的一行才能关闭它，因此 ```` 围栏中的 ``` 仍是代码内容；
+// 未关闭的围栏延续到文本末尾。行内代码由 n 个 ` 开始，到下一处恰好 n 个 ` 结束，
+// 不跨越空行。缩进代码块见 indentedCodeRegions
+func codeRegions(text string) [][2]int {
+	var regions [][2]int
+	indented := indentedCodeRegions(text)
+	// 每种长度的 ` 在哪个位置之前确定找不到结束位置，避免大量不成对的 ` 反复扫描
+	unclosed := make(map[int]int)
+	for i := 0; i < len(text); {
+		for len(indented) > 0 && indented[0][0] < i {
+			indented = indented[1:]
+		}
+		if len(indented) > 0 && indented[0][0] == i {
+			regions = append(regions, indented[0])
+			i = indented[0][1]
+			continue
+		}
+		c := text[i]
+		if c != '`' && c != '~' {
+			i++
+			continue
+		}
+		n := len(text[i:]) - len(strings.TrimLeft(text[i:], string(c)))
+		lineEnd := len(text)
+		if j := strings.IndexByte(text[i:], '\n'); j >= 0 {
+			lineEnd = i + j
+		}
+		if n >= 3 && fenceIndent(text[strings.LastIndexByte(text[:i], '\n')+1:i]) &&
+			(c == '~' || !strings.Contains(text[i+n:lineEnd], "`")) {
+			end := closingFence(text, lineEnd, c, n)
+			regions = append(regions, [2]int{i, end})
+			i = end
+			continue
+		}
+		if c == '`' && i >= unclosed[n] {
+			end, limit := closingBackticks(text, i+n, n)
+			if end > 0 {
+				regions = append(regions, [2]int{i, end})
+				i = end
+				continue
+			}
+			unclosed[n] = limit
+		}
+		i += n
+	}
+	return regions
+}
+
+// indentedCodeRegions 返回 text 中缩进代码块的区间，每个区间是一行或连续的几行
+//
+// 在文本开头、空行或另一行缩进代码之后，缩进至少四列（制表符补齐到四的倍数）的行
+// 是缩进代码；紧跟段落的缩进行是段落的延续。引用符号之后的缩进同样计算，列表项中
+// 的缩进从正文所在列算起。只是近似：围栏代码块中的行也参与判断列表的开始和结束
+func indentedCodeRegions(text string) [][2]int {
+	var regions [][2]int
+	content := -1 // 当前列表项正文所在的列，不在列表中时为 -1
+	blank, code := true, false
+	for start := 0; start < len(text); {
+		end := len(text)
+		if j := strings.IndexByte(text[start:], '\n'); j >= 0 {
+			end = start + j
+		}
+		line := text[start:end]
+		for {
+			trimmed := strings.TrimLeft(line, " ")
+			if len(line)-len(trimmed) > 3 || !strings.HasPrefix(trimmed, ">") {
+				break
+			}
+			line = strings.TrimPrefix(trimmed[1:], " ")
+		}
+		indent, i := 0, 0
+		for ; i < len(line) && (line[i] == ' ' || line[i] == '\t'); i++ {
+			if line[i] == '\t' {
+				indent += 4 - indent%4
+			} else {
+				indent++
+			}
+		}
+		minIndent := 4
+		if content >= 0 {
+			minIndent = content + 4
+		}
+		switch {
+		case strings.TrimSpace(line) == "":
+			blank = true
+			start = end + 1
+			continue
+		case indent >= minIndent && (blank || code):
+			if n := len(regions); code && n > 0 {
+				regions[n-1][1] = end
+			} else {
+				regions = append(regions, [2]int{start, end})
+			}
+			code = true
+		case indent-max(content, 0) <= 3 && listMarkerLen(line[i:]) > 0:
+			content = indent + listMarkerLen(line[i:])
+			code = false
+		default:
+			if content >= 0 && indent < content && blank {
+				content = -1
+			}
+			code = false
+		}
+		blank = false
+		start = end + 1
+	}
+	return regions
+}
+
+// fenceIndent 报告围栏之前的 prefix 是否只有缩进、引用符号和列表标记
+//
+// 列表标记必须是单个 - * + 或 1. 1) 形式的编号且后跟空格，"1999```" 这样的
+// 行是普通文本。列表项正文可以缩进到任意列，因此缩进不限宽度。
+func fenceIndent(prefix string) bool {
+	for {
+		prefix = strings.TrimLeft(prefix, " \t")
+		if prefix == "" {
+			return true
+		}
+		if prefix[0] == '>' {
+			prefix = prefix[1:]
+			continue
+		}
+		n := listMarkerLen(prefix)
+		if n == 0 {
+			return false
+		}
+		prefix = prefix[n:]
+	}
+}
+
+// closingFence 返回从 from（开围栏所在行的行尾）之后第一行闭围栏的结束位置，
+// 没有闭围栏时返回 len(text)
+func closingFence(text string, from int, c byte, n int) int {
+	for from < len(text) {
+		start := from + 1
+		end := len(text)
+		if j := strings.IndexByte(text[start:], '\n'); j >= 0 {
+			end = start + j
+		}
+		line := strings.TrimLeft(text[start:end], " \t>")
+		run := len(line) - len(strings.TrimLeft(line, string(c)))
+		if run >= n && strings.TrimSpace(line[run:]) == "" {
+			return end
+		}
+		from = end
+	}
+	return len(text)
+}
+
+// closingBackticks 返回从 from 开始恰好 n 个 ` 的结束位置；遇到空行或没有时
+// end 为 -1，limit 为查找停止的位置
+func closingBackticks(text string, from, n int) (end, limit int) {
+	for i := from; i < len(text); {
+		switch {
+		case strings.HasPrefix(text[i:], "\n\n"):
+			return -1, i
+		case text[i] == '`':
+			run := len(text[i:]) - len(strings.TrimLeft(text[i:], "`"))
+			if run == n {
+				return i + run, i + run
+			}
+			i += run
+		default:
+			i++
+		}
+	}
+	return -1, len(text)
+}
@@ -3,59 +3,260 @@ package converter
 import (
 	"regexp"
 	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
 
 	"github.com/riverfjs/telegramify-go/internal/latex"
+	"github.com/riverfjs/telegramify-go/internal/types"
 )
 
 var (
 	// _SPOILER_RE 匹配 ||...|| (非转义的 ||)
 	spoilerRe = regexp.MustCompile(`(?:[^\\]|^)\|\|(.+?)\|\|`)
 	
-	// _CODE_REGION_RE 匹配代码块和行内代码
-	codeRegionRe = regexp.MustCompile("(```[\\s\\S]*?```|`[^`\\n]+`)")
+	// LaTeX 块级公式：\[...\]，可以跨行
+	latexMathRe = regexp.MustCompile(`(?s)\\\[(.*?)\\\]`)
+	
+	// LaTeX 行内公式：\(...\)，可以跨行
+	latexInlineRe = regexp.MustCompile(`(?s)\\\((.*?)\\\)`)
+	
+	// 行首的引用前缀：> 、> > 等
+	quotePrefixRe = regexp.MustCompile(`^[ \t]*(?:>[ \t]?)+`)
 	
-	// LaTeX 块级公式：\[...\]
-	latexMathRe = regexp.MustCompile(`\\\[(.*?)\\\]`)
+	// 空行（包括引用块中只有 > 的行），公式不能跨越段落
+	blankLineRe = regexp.MustCompile(`\n[ \t]*(?:>[ \t]*)*\n`)
 	
-	// LaTeX 行内公式：\(...\)
-	latexInlineRe = regexp.MustCompile(`\\\((.*?)\\\)`)
+	// 公式之外的文本样式命令：\textbf{...} 等
+	textStyleRe = regexp.MustCompile(`\\(textbf|textit|emph|underline|texttt)\{([^{}]*)\}`)
 )
 
-// PreprocessSpoilers 将 ||spoiler|| 替换为 <tg-spoiler>spoiler</tg-spoiler>
-// 跳过代码块和行内代码中的内容
-func PreprocessSpoilers(text string) string {
-	parts := codeRegionRe.Split(text, -1)
-	matches := codeRegionRe.FindAllString(text, -1)
-	
-	var result strings.Builder
-	for i, part := range parts {
-		// 偶数索引：非代码区域，进行替换
-		if i%2 == 0 || i >= len(matches) {
-			// 替换 ||...||
-			part = replaceSpoilerTags(part)
-		}
-		result.WriteString(part)
-		
-		// 添加回代码块（奇数索引）
-		if i < len(matches) {
-			result.WriteString(matches[i])
+// NormalizeLineEndings 将 \r\n 和单独的 \r 统一为 \n，包括代码块中的内容。
+// offsets 不为 nil 时记录所做的替换
+func NormalizeLineEndings(text string, offsets *OffsetMap) string {
+	r := newRewriter(text)
+	for i := strings.IndexByte(text, '\r'); i >= 0; {
+		end := i + 1
+		if end < len(text) && text[end] == '\n' {
+			end++
 		}
+		r.replace(i, end, "\n")
+		next := strings.IndexByte(text[end:], '\r')
+		if next < 0 {
+			break
+		}
+		i = end + next
 	}
-	
-	return result.String()
+	return r.finish(offsets)
+}
+
+// RestoreCRLF 在 original（代码块在用户原文中的范围）的换行全部是 \r\n 时，
+// 将 code 中的 \n 还原为 \r\n，撤销 NormalizeLineEndings 对代码的改写；
+// 混用多种换行时无法逐行对应，code 原样返回
+func RestoreCRLF(code, original string) string {
+	lf := strings.Count(original, "\n")
+	crlf := strings.Count(original, "\r\n")
+	if lf == 0 || crlf != lf || strings.Count(original, "\r") != crlf {
+		return code
+	}
+	return strings.ReplaceAll(code, "\n", "\r\n")
+}
+
+// ReplaceInvalidUTF8 将每段无效的 UTF-8 字节替换为一个 U+FFFD。
+// 否则删除标记后无效字节可能拼成有效字符，与按原文计算的 UTF-16 偏移不一致。
+// offsets 不为 nil 时记录所做的替换
+func ReplaceInvalidUTF8(text string, offsets *OffsetMap) string {
+	r := newRewriter(text)
+	for i := 0; i < len(text); {
+		c, size := utf8.DecodeRuneInString(text[i:])
+		if c != utf8.RuneError || size > 1 {
+			i += size
+			continue
+		}
+		end := i + 1
+		for end < len(text) {
+			if c, size := utf8.DecodeRuneInString(text[end:]); c != utf8.RuneError || size > 1 {
+				break
+			}
+			end++
+		}
+		r.replace(i, end, "\uFFFD")
+		i = end
+	}
+	return r.finish(offsets)
+}
+
+// StripBOM 删除文本开头的 BOM（U+FEFF），否则它会使第一行的列表、引用、标题等
+// 块标记无法识别。offsets 不为 nil 时记录所做的替换
+func StripBOM(text string, offsets *OffsetMap) string {
+	if !strings.HasPrefix(text, "\ufeff") {
+		return text
+	}
+	r := newRewriter(text)
+	r.replace(0, len("\ufeff"), "")
+	return r.finish(offsets)
 }
 
-// replaceSpoilerTags 将 ||...|| 替换为 <tg-spoiler>...</tg-spoiler>
-func replaceSpoilerTags(text string) string {
+// NormalizeNFC 将文本转为 Unicode NFC 形式，skipCode 为 true 时代码块和行内代码保持原样。
+// offsets 不为 nil 时记录所做的替换
+func NormalizeNFC(text string, skipCode bool, offsets *OffsetMap) string {
+	r := newRewriter(text)
+	if !skipCode {
+		normalizeRange(r, 0, len(text))
+		return r.finish(offsets)
+	}
+	for _, rg := range nonCodeRanges(text) {
+		normalizeRange(r, rg[0], rg[1])
+	}
+	return r.finish(offsets)
+}
+
+// normalizeRange 只改写 text[start:end] 中不符合 NFC 的片段，其余部分不复制
+func normalizeRange(r *rewriter, start, end int) {
+	for i := start; i < end; {
+		i += norm.NFC.QuickSpanString(r.src[i:end])
+		if i >= end {
+			return
+		}
+		// 从 i 开始的一个组合片段需要规范化
+		next := i + norm.NFC.NextBoundaryInString(r.src[i:end], true)
+		if normalized := norm.NFC.String(r.src[i:next]); normalized != r.src[i:next] {
+			r.replace(i, next, normalized)
+		}
+		i = next
+	}
+}
+
+// ExpandableMarker 是预处理插入的内联标记，walker 遇到它时把所在引用块强制设为可展开
+const ExpandableMarker = "<tg-expandable>"
+
+// quoteLineRe 匹配引用行的前缀，第 1 组为 MarkdownV2 风格的 **> 标记
+var quoteLineRe = regexp.MustCompile(`^ {0,3}(\*\*)?>`)
+
+// PreprocessExpandableQuotes 识别显式要求可展开的引用块，并在引用末行插入 ExpandableMarker：
+//   - MarkdownV2 风格：首行以 **> 开头（改写为 >）
+//   - 引用末行以未配对的 || 结尾（|| 被替换为标记）
+//   - <blockquote expandable> ... </blockquote>（改写为 > 前缀的引用）
+//
+// 围栏代码块中的内容保持原样。offsets 不为 nil 时记录所做的替换
+func PreprocessExpandableQuotes(text string, offsets *OffsetMap) string {
+	r := newRewriter(text)
+	var (
+		inFence   bool
+		fence     string
+		inHTML    bool // 位于 <blockquote expandable> 中
+		runLast   = -1 // 当前引用块最后一行的 [start, end)
+		runEnd    int
+		runForced bool
+		runPipes  int
+	)
+	endRun := func() {
+		if runLast < 0 {
+			return
+		}
+		line := strings.TrimRight(text[runLast:runEnd], " \t")
+		end := runLast + len(line)
+		switch {
+		case strings.HasSuffix(line, "||") && !strings.HasSuffix(line, `\||`) && runPipes%2 == 1:
+			r.replace(end-2, end, ExpandableMarker)
+		case runForced && fenceMarker(strings.TrimSpace(line)) != "":
+			// 围栏行后不能接其他内容，标记另起一行
+			r.replace(end, end, "\n> "+ExpandableMarker)
+		case runForced:
+			r.replace(end, end, ExpandableMarker)
+		}
+		runLast, runForced, runPipes = -1, false, 0
+	}
+
+	for pos := 0; pos < len(text); {
+		lineEnd := strings.IndexByte(text[pos:], '\n')
+		next := pos + lineEnd + 1
+		if lineEnd < 0 {
+			lineEnd = len(text) - pos
+			next = len(text)
+		}
+		lineEnd += pos
+		line := text[pos:lineEnd]
+		trimmed := strings.TrimSpace(line)
+
+		if marker := fenceMarker(trimmed); marker != "" && !inHTML {
+			if !inFence {
+				inFence, fence = true, marker
+			} else if strings.HasPrefix(trimmed, fence) && strings.TrimLeft(trimmed, fence[:1]) == "" {
+				inFence = false
+			}
+		}
+
+		switch {
+		case inHTML:
+			if strings.EqualFold(trimmed, "</blockquote>") {
+				inHTML = false
+				endRun()
+				r.replace(pos, next, "")
+			} else {
+				r.replace(pos, pos, "> ")
+				runLast, runEnd = pos, lineEnd
+				runPipes += strings.Count(line, "||")
+			}
+		case !inFence && strings.EqualFold(trimmed, "<blockquote expandable>"):
+			endRun()
+			inHTML, runForced = true, true
+			r.replace(pos, next, "")
+		default:
+			m := quoteLineRe.FindStringSubmatchIndex(line)
+			if m == nil || (inFence && runLast < 0) {
+				endRun()
+				break
+			}
+			if m[2] >= 0 {
+				if runLast >= 0 {
+					endRun()
+				}
+				runForced = true
+				r.replace(pos+m[2], pos+m[3], "")
+			}
+			runLast, runEnd = pos, lineEnd
+			runPipes += strings.Count(line, "||")
+		}
+		pos = next
+	}
+	endRun()
+	return r.finish(offsets)
+}
+
+// fenceMarker 返回以围栏开头的行所用的围栏（``` 或 ~~~），否则返回空
+func fenceMarker(line string) string {
+	line = strings.TrimLeft(line, "> ")
+	for _, c := range []string{"`", "~"} {
+		n := len(line) - len(strings.TrimLeft(line, c))
+		if n >= 3 {
+			return strings.Repeat(c, n)
+		}
+	}
+	return ""
+}
+
+// PreprocessSpoilers 将 ||spoiler|| 替换为 <tg-spoiler>spoiler</tg-spoiler>
+// 跳过代码块和行内代码中的内容。offsets 不为 nil 时记录所做的替换
+func PreprocessSpoilers(text string, offsets *OffsetMap) string {
+	r := newRewriter(text)
+	for _, rg := range nonCodeRanges(text) {
+		replaceSpoilerTags(r, rg[0], rg[1])
+	}
+	return r.finish(offsets)
+}
+
+// replaceSpoilerTags 将 text[start:end] 中的 ||...|| 替换为 <tg-spoiler>...</tg-spoiler>
+func replaceSpoilerTags(r *rewriter, start, end int) {
 	// 使用状态机手动处理，避免转义字符问题
-	var result strings.Builder
-	i := 0
+	text := r.src[:end]
+	i := start
 	inSpoiler := false
 	
 	for i < len(text) {
 		// 检查是否是转义的 ||
-		if i > 0 && text[i-1] == '\\' && i+1 < len(text) && text[i] == '|' && text[i+1] == '|' {
-			result.WriteByte(text[i])
+		if i > start && text[i-1] == '\\' && i+1 < len(text) && text[i] == '|' && text[i+1] == '|' {
 			i++
 			continue
 		}
@@ -63,19 +264,16 @@ func replaceSpoilerTags(text string) string {
 		// 检查是否是 ||
 		if i+1 < len(text) && text[i] == '|' && text[i+1] == '|' {
 			if inSpoiler {
-				result.WriteString("</tg-spoiler>")
+				r.replace(i, i+2, "</tg-spoiler>")
 			} else {
-				result.WriteString("<tg-spoiler>")
+				r.replace(i, i+2, "<tg-spoiler>")
 			}
 			inSpoiler = !inSpoiler
 			i += 2
 		} else {
-			result.WriteByte(text[i])
 			i++
 		}
 	}
-	
-	return result.String()
 }
 
 // validateTelegramEmoji 如果 URL 是 tg://emoji?id=<19位数字>，返回 id，否则返回空
@@ -101,95 +299,396 @@ func isDigits(s string) bool {
 	return len(s) > 0
 }
 
-// containsLatexSymbols 检查内容是否包含 LaTeX 符号
-func containsLatexSymbols(content string) bool {
-	if len(content) < 5 {
-		return false
+// MathMarker 和 MathBlockMarker 是预处理包裹行内公式和块级公式转换结果的标签，
+// walker 遇到它们时生成 RenderConfig.MathEntity 和 MathBlockEntity 实体
+const (
+	MathMarker      = "tg-math"
+	MathBlockMarker = "tg-math-block"
+)
+
+// MathStyle 决定公式转换结果的呈现方式
+type MathStyle struct {
+	Delimiters MathDelimiters
+	// Inline / Block 为 true 时行内公式 / 块级公式包在 MathMarker / MathBlockMarker 中，
+	// 包裹之外的分隔符仍按 Delimiters 处理。Delimiters 为 code 时不生效
+	Inline bool
+	Block  bool
+}
+
+// EscapeLatex 预处理 LaTeX \[...\]、\(...\)、$$...$$ 和 $...$ 块转换为 Unicode
+//
+// mode 决定转换结果的呈现方式，见 MathStyle。
+// offsets 不为 nil 时记录每一步所做的替换。
+func EscapeLatex(text string, latexHelper *latex.Parser, mode MathStyle, offsets *OffsetMap) string {
+	// 先处理 $ 公式，避免把后面生成的 $...$ 再转换一次
+	text = escapeDollarMath(text, latexHelper, mode, offsets)
+	
+	if strings.Contains(text, `\[`) {
+		text = replaceBracketMath(text, latexMathRe, true, latexHelper, mode, offsets)
+	}
+	if strings.Contains(text, `\(`) {
+		text = replaceBracketMath(text, latexInlineRe, false, latexHelper, mode, offsets)
 	}
 	
-	// 检查常见的 LaTeX 命令
-	checkSymbols := []string{`\frac`, `\sqrt`, `\begin`}
-	for _, sym := range checkSymbols {
-		if strings.Contains(content, sym) {
-			return true
+	return escapeTextStyles(text, offsets)
+}
+
+// replaceBracketMath 转换代码区域之外 re 匹配到的 \[...\] 或 \(...\) 公式
+//
+// 公式可以跨行，但不能跨越空行。公式位于引用块中时，
+// 续行开头的 > 在转换前去掉，转换结果的每一行再补上同样的前缀；
+// 位于列表项中时同样补上缩进，见 containerPrefix。
+func replaceBracketMath(text string, re *regexp.Regexp, isBlock bool, latexHelper *latex.Parser, mode MathStyle, offsets *OffsetMap) string {
+	r := newRewriter(text)
+	for _, rg := range paragraphRanges(text, nonCodeRanges(text)) {
+		for _, loc := range re.FindAllStringSubmatchIndex(text[rg[0]:rg[1]], -1) {
+			start, end := rg[0]+loc[0], rg[0]+loc[1]
+			prefix, inList := containerPrefix(text, start)
+			content := text[rg[0]+loc[2] : rg[0]+loc[3]]
+			if prefix != "" {
+				content = stripQuotePrefixes(content)
+			}
+			converted, ok := convertMath(content, isBlock, inList, latexHelper, mode)
+			if !ok {
+				continue
+			}
+			if prefix != "" {
+				converted = strings.ReplaceAll(converted, "\n", "\n"+prefix)
+			}
+			r.replace(start, end, converted)
 		}
 	}
-	
-	// 检查 latex.LATEX_SYMBOLS 中的符号
-	for key := range latex.LatexSymbols {
-		if strings.Contains(content, key) {
-			return true
+	return r.finish(offsets)
+}
+
+// paragraphRanges 在空行处切开 ranges 中的每个区间，公式在各段之内分别匹配，
+// 不成对的 \( 不会吞掉下一段中的公式
+func paragraphRanges(text string, ranges [][2]int) [][2]int {
+	var paragraphs [][2]int
+	for _, rg := range ranges {
+		start := rg[0]
+		for _, loc := range blankLineRe.FindAllStringIndex(text[rg[0]:rg[1]], -1) {
+			paragraphs = append(paragraphs, [2]int{start, rg[0] + loc[0]})
+			start = rg[0] + loc[1]
 		}
+		paragraphs = append(paragraphs, [2]int{start, rg[1]})
 	}
-	
-	// 检查 NOT_MAP 中的符号
-	for key := range latex.NotMap {
-		if strings.Contains(content, key) {
-			return true
+	return paragraphs
+}
+
+// containerPrefix 返回 pos 所在行开头的引用前缀和列表项缩进，其中的列表标记换成
+// 同样宽度的空格。转换结果中的换行之后补上它，续行仍处在同一个引用块或列表项中。
+// inList 报告该行是否位于列表项中：以列表标记开头，或缩进了至少两列
+func containerPrefix(text string, pos int) (prefix string, inList bool) {
+	line := text[strings.LastIndexByte(text[:pos], '\n')+1 : pos]
+	var b strings.Builder
+	for i := 0; ; {
+		j := i
+		for j < len(line) && (line[j] == ' ' || line[j] == '\t') {
+			j++
+		}
+		if j < len(line) && line[j] == '>' {
+			j++
+			if j < len(line) && (line[j] == ' ' || line[j] == '\t') {
+				j++
+			}
+			b.WriteString(line[i:j])
+			i = j
+			continue
+		}
+		if n := listMarkerLen(line[j:]); n > 0 {
+			b.WriteString(line[i:j])
+			b.WriteString(strings.Repeat(" ", n))
+			i, inList = j+n, true
+			continue
 		}
+		if j-i >= 2 {
+			inList = true
+		}
+		b.WriteString(line[i:j])
+		return b.String(), inList
 	}
-	
-	// 检查 LATEX_STYLES 中的符号
-	for key := range latex.LatexStyles {
-		if strings.Contains(content, key) {
-			return true
+}
+
+// listMarkerLen 返回 s 开头的列表标记（- * + 或 1. 1) 形式的编号）连同其后空白的
+// 字节长度，即列表项正文的缩进宽度；s 不以列表标记开头时返回 0
+func listMarkerLen(s string) int {
+	n := 0
+	switch {
+	case s != "" && (s[0] == '-' || s[0] == '*' || s[0] == '+'):
+		n = 1
+	default:
+		for n < len(s) && n < 9 && s[n] >= '0' && s[n] <= '9' {
+			n++
+		}
+		if n == 0 || n >= len(s) || (s[n] != '.' && s[n] != ')') {
+			return 0
 		}
+		n++
 	}
-	
-	return false
+	spaces := 0
+	for n+spaces < len(s) && s[n+spaces] == ' ' {
+		spaces++
+	}
+	if spaces == 0 {
+		return 0
+	}
+	// 标记后超过四个空格时正文是缩进代码块，缩进只算一个空格
+	if spaces > 4 {
+		spaces = 1
+	}
+	return n + spaces
 }
 
-// EscapeLatex 预处理 LaTeX \[...\] 和 \(...\) 块转换为 Unicode
-func EscapeLatex(text string, latexHelper *latex.Parser) string {
-	// 按段落分割（\n\n）
-	lines := strings.Split(text, "\n\n")
-	processed := make([]string, len(lines))
-	
-	for i, line := range lines {
-		// 处理块级公式 \[...\]
-		line = latexMathRe.ReplaceAllStringFunc(line, func(match string) string {
-			return convertLatexMatch(match, true, latexHelper)
-		})
-		
-		// 处理行内公式 \(...\)
-		line = latexInlineRe.ReplaceAllStringFunc(line, func(match string) string {
-			return convertLatexMatch(match, false, latexHelper)
-		})
-		
-		processed[i] = line
+// stripQuotePrefixes 去掉公式续行开头的引用前缀
+func stripQuotePrefixes(content string) string {
+	lines := strings.Split(content, "\n")
+	for i := 1; i < len(lines); i++ {
+		lines[i] = quotePrefixRe.ReplaceAllString(lines[i], "")
 	}
-	
-	return strings.Join(processed, "\n\n")
+	return strings.Join(lines, "\n")
 }
 
-// convertLatexMatch 转换单个 LaTeX 匹配
-func convertLatexMatch(match string, isBlock bool, latexHelper *latex.Parser) string {
-	// 提取内容
-	var content string
-	if isBlock {
-		// \[...\] 格式
-		content = strings.TrimPrefix(match, `\[`)
-		content = strings.TrimSuffix(content, `\]`)
-	} else {
-		// \(...\) 格式
-		content = strings.TrimPrefix(match, `\(`)
-		content = strings.TrimSuffix(content, `\)`)
+// escapeTextStyles 将公式之外的 \textbf、\textit、\underline、\texttt 改写为 Markdown，
+// 让后续解析生成对应的实体，而不是数学粗体等 Unicode 字符。跳过代码区域。
+//
+// 公式已在此前转换完毕，剩下的样式命令都处于文本模式。
+func escapeTextStyles(text string, offsets *OffsetMap) string {
+	if !strings.Contains(text, "\\") {
+		return text
 	}
-	
+	r := newRewriter(text)
+	for _, rg := range nonCodeRanges(text) {
+		for _, loc := range textStyleRe.FindAllStringSubmatchIndex(text[rg[0]:rg[1]], -1) {
+			command := text[rg[0]+loc[2] : rg[0]+loc[3]]
+			content := text[rg[0]+loc[4] : rg[0]+loc[5]]
+			r.replace(rg[0]+loc[0], rg[0]+loc[1], textStyleMarkdown(command, content))
+		}
+	}
+	return r.finish(offsets)
+}
+
+// textStyleMarkdown 将单个文本样式命令转换为 Markdown
+func textStyleMarkdown(command, content string) string {
+	if strings.TrimSpace(content) == "" {
+		return content
+	}
+	switch command {
+	case "textbf":
+		return "**" + content + "**"
+	case "textit", "emph":
+		return "*" + content + "*"
+	case "underline":
+		return "<u>" + content + "</u>"
+	}
+	// texttt
+	fence := codeFence(content, 1)
+	if strings.HasPrefix(content, "`") || strings.HasSuffix(content, "`") {
+		return fence + " " + content + " " + fence
+	}
+	return fence + content + fence
+}
+
+// convertMath 将公式内容转换为 Unicode，并按 mode 呈现
+//
+// 内容不含 LaTeX 符号时返回 false，调用方应保留原文。inList 为 true 时公式位于列表项中，
+// 空行会结束列表项，块级公式前后只换行。
+func convertMath(content string, isBlock, inList bool, latexHelper *latex.Parser, mode MathStyle) (string, bool) {
 	// 检查是否包含 LaTeX 符号
-	if !containsLatexSymbols(content) {
-		return match
+	if !latex.ContainsLatexSymbols(content) {
+		return "", false
 	}
 	
+	// 源码中的换行在 LaTeX 里只是空白，换行只由 \\ 产生
+	content = strings.ReplaceAll(content, "\n", " ")
+	
 	// 转换
-	converted := latexHelper.Convert(content)
-	converted = strings.TrimSpace(converted)
-	converted = strings.Trim(converted, "\n")
+	converted := trimMath(latexHelper.Convert(content))
 	
-	// 返回对应格式
+	// 块级公式前后空行使其单独成段；空行会结束列表项，列表项中只换行
+	pad := "\n\n"
+	if inList {
+		pad = "\n"
+	}
+	switch mode.Delimiters {
+	case types.MathDelimitersStrip:
+		converted = markMath(converted, isBlock, mode)
+		if isBlock && mode.Block {
+			return pad + converted + pad, true
+		}
+		return converted, true
+	case types.MathDelimitersCode:
+		if isBlock {
+			// 围栏代码块可以打断段落
+			fence := codeFence(converted, 3)
+			return pad + fence + "\n" + converted + "\n" + fence + pad, true
+		}
+		fence := codeFence(converted, 1)
+		if strings.HasPrefix(converted, "`") || strings.HasSuffix(converted, "`") {
+			return fence + " " + converted + " " + fence, true
+		}
+		return fence + converted + fence, true
+	}
 	if isBlock {
-		return "$$" + strings.TrimSpace(converted) + "$$"
+		if mode.Block {
+			// 定界符在标记之内，引用实体从行首开始
+			return pad + markMath("$$"+converted+"$$", isBlock, mode) + pad, true
+		}
+		return "$$" + converted + "$$", true
+	}
+	return "$" + markMath(converted, isBlock, mode) + "$", true
+}
+
+// trimMath 去掉公式转换结果两端的空白
+//
+// 对齐补位用的不换行空格保留，否则 aligned、array 等环境第一行的缩进会被去掉。
+func trimMath(converted string) string {
+	return strings.TrimFunc(converted, func(r rune) bool {
+		return r != '\u00a0' && unicode.IsSpace(r)
+	})
+}
+
+// markMath 按 mode 将公式的转换结果包在 MathMarker 或 MathBlockMarker 中
+//
+// 连续的换行合并为一个，公式不会被空行拆成两个段落。块级公式由调用方放在单独的段落中
+func markMath(converted string, isBlock bool, mode MathStyle) string {
+	tag := MathMarker
+	if isBlock {
+		if !mode.Block {
+			return converted
+		}
+		tag = MathBlockMarker
+	} else if !mode.Inline {
+		return converted
+	}
+	for strings.Contains(converted, "\n\n") {
+		converted = strings.ReplaceAll(converted, "\n\n", "\n")
+	}
+	return "<" + tag + ">" + converted + "</" + tag + ">"
+}
+
+// codeFence 返回比 text 中最长的连续反引号更长、且至少 min 个的反引号串
+func codeFence(text string, min int) string {
+	longest, run := 0, 0
+	for i := 0; i < len(text); i++ {
+		if text[i] == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	if longest+1 > min {
+		min = longest + 1
+	}
+	return strings.Repeat("`", min)
+}
+
+// escapeDollarMath 转换 $...$ 和 $$...$$ 公式，跳过代码区域
+func escapeDollarMath(text string, latexHelper *latex.Parser, mode MathStyle, offsets *OffsetMap) string {
+	if !strings.Contains(text, "$") {
+		return text
+	}
+	r := newRewriter(text)
+	for _, rg := range nonCodeRanges(text) {
+		replaceDollarMath(r, rg[0], rg[1], latexHelper, mode)
+	}
+	return r.finish(offsets)
+}
+
+// replaceDollarMath 扫描非代码文本 src[start:end] 中的 $ 公式
+//
+// 为避免把货币金额当成公式：行内公式的开头 $ 后和结尾 $ 前不能是空白，
+// 结尾 $ 后不能紧跟数字，且内容必须包含 LaTeX 符号。转义的 \$ 原样保留。
+func replaceDollarMath(r *rewriter, start, end int, latexHelper *latex.Parser, mode MathStyle) {
+	text := r.src[:end]
+	i := start
+	for i < len(text) {
+		switch {
+		case text[i] == '\\' && i+1 < len(text) && text[i+1] == '$':
+			i += 2
+		case text[i] == '$':
+			matchEnd, content, isBlock, ok := matchDollarMath(text, i)
+			if !ok {
+				// 未闭合的 $$ 整体跳过，避免第二个 $ 被当成行内公式的开头
+				if isBlock {
+					i += 2
+				} else {
+					i++
+				}
+				continue
+			}
+			// 与 replaceBracketMath 相同，引用块中续行的 > 在转换前去掉、转换后补上
+			prefix, inList := containerPrefix(text, i)
+			if prefix != "" {
+				content = stripQuotePrefixes(content)
+			}
+			if converted, ok := convertMath(content, isBlock, inList, latexHelper, mode); ok {
+				if prefix != "" {
+					converted = strings.ReplaceAll(converted, "\n", "\n"+prefix)
+				}
+				r.replace(i, matchEnd, converted)
+			}
+			i = matchEnd
+		default:
+			i++
+		}
 	}
-	return "$" + strings.TrimSpace(strings.Trim(converted, "\n")) + "$"
 }
 
+// matchDollarMath 从 text[start]（一个 $）开始匹配公式，返回结束位置和公式内容
+func matchDollarMath(text string, start int) (end int, content string, isBlock bool, ok bool) {
+	if strings.HasPrefix(text[start:], "$$") {
+		close := indexUnescaped(text, start+2, "$$")
+		if close < 0 || strings.TrimSpace(text[start+2:close]) == "" {
+			return 0, "", true, false
+		}
+		return close + 2, text[start+2 : close], true, true
+	}
+	
+	pos := start + 1
+	if pos >= len(text) || isSpaceByte(text[pos]) {
+		return 0, "", false, false
+	}
+	close := -1
+	for j := pos; j < len(text); j++ {
+		if text[j] == '\\' {
+			j++
+			continue
+		}
+		if text[j] == '\n' {
+			break
+		}
+		if text[j] == '$' {
+			close = j
+			break
+		}
+	}
+	if close < 0 || isSpaceByte(text[close-1]) {
+		return 0, "", false, false
+	}
+	if close+1 < len(text) && text[close+1] >= '0' && text[close+1] <= '9' {
+		return 0, "", false, false
+	}
+	return close + 1, text[pos:close], false, true
+}
+
+// indexUnescaped 返回 text[from:] 中第一个未被反斜杠转义的 sep 的位置
+func indexUnescaped(text string, from int, sep string) int {
+	for j := from; j+len(sep) <= len(text); j++ {
+		if text[j] == '\\' {
+			j++
+			continue
+		}
+		if strings.HasPrefix(text[j:], sep) {
+			return j
+		}
+	}
+	return -1
+}
+
+func isSpaceByte(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
@@ -1,20 +1,53 @@
 package converter
 
+// Segment.Kind 的取值
+const (
+	SegmentCodeBlock = "code_block"
+	SegmentMermaid   = "mermaid"
+)
+
 // Segment 记录代码块或 Mermaid 图的位置信息
 type Segment struct {
-	Kind       string // "code_block" or "mermaid"
+	Kind       string // SegmentCodeBlock 或 SegmentMermaid
 	TextStart  int    // 文本起始位置（字节）
 	TextEnd    int    // 文本结束位置（字节）
 	UTF16Start int    // UTF-16 起始位置
 	UTF16End   int    // UTF-16 结束位置
 	Language   string // 编程语言或 "mermaid"
-	RawCode    string // 原始代码内容
+	// RawCode 是围栏之间的代码，逐字节保留作者写下的内容和换行（包括代码末尾的空行），
+	// 只去掉闭围栏之前的那个换行；原文统一使用 \r\n 时换行同样是 \r\n
+	RawCode string
+	// SourceStart / SourceEnd 代码块在用户原文中的字节范围，围栏代码块包含开闭围栏，
+	// 已经过 OffsetMap 还原预处理的改写；无法确定位置时为 -1
+	SourceStart int
+	SourceEnd   int
+	// Inline 为 true 时代码块没有 pre 实体（RenderConfig.DisabledEntities 禁用了 pre），
+	// 只能作为普通文字留在正文中，不提取为文件
+	Inline bool
+	// PrefixLen / PrefixUTF16Len 是紧挨在代码之前、同一行的列表符号（含缩进）的长度，
+	// 如 "- ```mermaid" 生成的 "⦁ "；提取代码块时这段符号随之去掉，否则会成为
+	// 前一条消息末尾孤立的一行
+	PrefixLen      int
+	PrefixUTF16Len int
+}
+
+// Heading 记录文档顶层标题在转换结果中的位置
+type Heading struct {
+	Level      int
+	Text       string // 标题文字，不含标题符号
+	TextStart  int    // 标题行（含符号）的起始位置（字节）
+	UTF16Start int    // 标题行的 UTF-16 起始位置
 }
 
 // EntityScope 用于跟踪未闭合的实体
 type EntityScope struct {
 	EntityType    string
 	StartOffset   int
+	StartByte     int // 起始位置（字节），目前只有引用块使用
+	// 以下两项只用于引用块：Expandable 为显式要求可展开，HasHeading 为引用中包含标题，
+	// 包含标题的引用不做按长度的自动展开
+	Expandable bool
+	HasHeading bool
 	URL           string
 	Language      string
 	CustomEmojiID string
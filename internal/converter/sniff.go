@@ -0,0 +1,92 @@
+package converter
+
+import (
+	"encoding/json"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// shebangLanguages 将 shebang 解释器名（去掉版本号后）映射为代码块语言
+var shebangLanguages = map[string]string{
+	"python": "python",
+	"bash":   "bash",
+	"sh":     "bash",
+	"zsh":    "bash",
+	"dash":   "bash",
+	"ksh":    "bash",
+	"node":   "javascript",
+	"nodejs": "javascript",
+	"deno":   "typescript",
+	"ruby":   "ruby",
+	"perl":   "perl",
+	"php":    "php",
+	"lua":    "lua",
+}
+
+var (
+	// sqlPattern 匹配以常见语句开头的 SQL，SELECT 还要求有 FROM
+	sqlPattern = regexp.MustCompile(`(?is)^(select\s.*\sfrom\s|insert\s+into\s|update\s+\S+\s+set\s|delete\s+from\s|create\s+(or\s+replace\s+)?(table|index|view)\s|alter\s+table\s)`)
+	// yamlKeyPattern 匹配 YAML 的 "key: value" 行
+	yamlKeyPattern = regexp.MustCompile(`^[\w.-]+:(\s|$)`)
+	// goPackagePattern 匹配 Go 文件开头的 package 声明
+	goPackagePattern = regexp.MustCompile(`^package\s+\w+\s*$`)
+)
+
+// sniffLanguage 根据内容猜测没有标注语言的代码块的语言，无法确定时返回空字符串
+//
+// 只识别特征明确的内容：shebang、<?php、<?xml、HTML 文档、合法的 JSON 对象或数组、
+// 以 "---" 开头的 YAML、常见 SQL 语句、Go 源文件和 git diff。
+func sniffLanguage(code string) string {
+	trimmed := strings.TrimSpace(code)
+	if trimmed == "" {
+		return ""
+	}
+	firstLine, rest, _ := strings.Cut(trimmed, "\n")
+	firstLine = strings.TrimSpace(firstLine)
+	lower := strings.ToLower(firstLine)
+
+	switch {
+	case strings.HasPrefix(firstLine, "#!"):
+		return shebangLanguage(firstLine[2:])
+	case strings.HasPrefix(firstLine, "<?php"):
+		return "php"
+	case strings.HasPrefix(firstLine, "<?xml"):
+		return "xml"
+	case strings.HasPrefix(lower, "<!doctype html") || strings.HasPrefix(lower, "<html"):
+		return "html"
+	case strings.HasPrefix(firstLine, "diff --git ") || strings.HasPrefix(firstLine, "--- a/"):
+		return "diff"
+	case (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid([]byte(trimmed)):
+		return "json"
+	case firstLine == "---":
+		if next, _, _ := strings.Cut(strings.TrimSpace(rest), "\n"); yamlKeyPattern.MatchString(strings.TrimSpace(next)) {
+			return "yaml"
+		}
+	case goPackagePattern.MatchString(firstLine) && strings.Contains(rest, "func "):
+		return "go"
+	case sqlPattern.MatchString(trimmed):
+		return "sql"
+	}
+	return ""
+}
+
+// shebangLanguage 返回 shebang 行（不含 "#!"）中解释器对应的语言，
+// "/usr/bin/env python3" 和 "/usr/bin/python3.11" 都识别为 python
+func shebangLanguage(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+	interpreter := path.Base(fields[0])
+	if interpreter == "env" {
+		interpreter = ""
+		for _, f := range fields[1:] {
+			if !strings.HasPrefix(f, "-") && !strings.Contains(f, "=") {
+				interpreter = path.Base(f)
+				break
+			}
+		}
+	}
+	return shebangLanguages[strings.TrimRight(interpreter, "0123456789.")]
+}
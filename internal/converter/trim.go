@@ -0,0 +1,185 @@
+package converter
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/riverfjs/telegramify-go/internal/types"
+)
+
+// trimRun 一段被删除的空白
+//
+// 空白只包含空格、制表符和换行，字节数与 UTF-16 长度相同。
+type trimRun struct {
+	byteStart  int
+	utf16Start int
+	length     int
+	removed    int // 此前各段累计删除的长度
+}
+
+// TrimTrailingSpaces 删除每行末尾的空格和制表符，并平移、裁剪实体、片段与标题的偏移
+//
+// pre 实体和片段覆盖的代码内容保持原样。Markdown 硬换行在解析时已经变成换行符，
+// 这里删除的只是渲染结果中残留的空白。
+func TrimTrailingSpaces(text string, entities []MessageEntity, segments []Segment, headings []Heading) (string, []MessageEntity, []Segment, []Heading) {
+	protected := protectedRanges(entities, segments)
+	var runs []trimRun
+	removed := 0
+	runByte, runUTF16 := -1, 0
+	flush := func(endByte, endUTF16 int) {
+		if runByte >= 0 && !protected(runUTF16, endUTF16) {
+			runs = append(runs, trimRun{byteStart: runByte, utf16Start: runUTF16, length: endByte - runByte, removed: removed})
+			removed += endByte - runByte
+		}
+		runByte = -1
+	}
+	utf16 := 0
+	for i, r := range text {
+		switch r {
+		case ' ', '\t':
+			if runByte < 0 {
+				runByte, runUTF16 = i, utf16
+			}
+		case '\n':
+			flush(i, utf16)
+		default:
+			runByte = -1
+		}
+		utf16 += utf16RuneLen(r)
+	}
+	flush(len(text), utf16)
+	return applyTrim(text, entities, segments, headings, runs)
+}
+
+// CollapseBlankLines 删除开头的换行和结尾的空行，并把正文中连续三个及以上的换行压缩为两个，
+// 同时平移、裁剪实体、片段与标题的偏移。pre 实体和片段覆盖的代码内容保持原样
+func CollapseBlankLines(text string, entities []MessageEntity, segments []Segment, headings []Heading) (string, []MessageEntity, []Segment, []Heading) {
+	if !strings.Contains(text, "\n\n\n") && !strings.HasPrefix(text, "\n") && !strings.HasSuffix(text, "\n\n") {
+		return text, entities, segments, headings
+	}
+	protected := protectedRanges(entities, segments)
+	var runs []trimRun
+	removed := 0
+	utf16 := 0
+	for i := 0; i < len(text); {
+		if text[i] != '\n' {
+			r, size := utf8.DecodeRuneInString(text[i:])
+			utf16 += utf16RuneLen(r)
+			i += size
+			continue
+		}
+		n := len(text[i:]) - len(strings.TrimLeft(text[i:], "\n"))
+		keep := 2
+		if i == 0 {
+			keep = 0
+		} else if i+n == len(text) {
+			// 以换行结束的最后一行（如列表项）保留换行，只删除其后的空行
+			keep = 1
+		}
+		if n > keep && !protected(utf16+keep, utf16+n) {
+			runs = append(runs, trimRun{byteStart: i + keep, utf16Start: utf16 + keep, length: n - keep, removed: removed})
+			removed += n - keep
+		}
+		i += n
+		utf16 += n
+	}
+	return applyTrim(text, entities, segments, headings, runs)
+}
+
+// protectedRanges 返回判断 UTF-16 区间是否与 pre 实体或片段重叠的函数
+func protectedRanges(entities []MessageEntity, segments []Segment) func(start, end int) bool {
+	var keep [][2]int
+	for _, e := range entities {
+		if e.Type == types.EntityPre {
+			keep = append(keep, [2]int{e.Offset, e.Offset + e.Length})
+		}
+	}
+	for _, s := range segments {
+		keep = append(keep, [2]int{s.UTF16Start, s.UTF16End})
+	}
+	return func(start, end int) bool {
+		for _, k := range keep {
+			if start < k[1] && k[0] < end {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// applyTrim 删除 runs 覆盖的文本，并平移、裁剪实体、片段与标题的偏移
+func applyTrim(text string, entities []MessageEntity, segments []Segment, headings []Heading, runs []trimRun) (string, []MessageEntity, []Segment, []Heading) {
+	if len(runs) == 0 {
+		return text, entities, segments, headings
+	}
+	last := runs[len(runs)-1]
+	var b strings.Builder
+	b.Grow(len(text) - last.removed - last.length)
+	pos := 0
+	for _, run := range runs {
+		b.WriteString(text[pos:run.byteStart])
+		pos = run.byteStart + run.length
+	}
+	b.WriteString(text[pos:])
+
+	adjusted := make([]MessageEntity, 0, len(entities))
+	for _, e := range entities {
+		start := mapTrimmed(runs, e.Offset, false)
+		end := mapTrimmed(runs, e.Offset+e.Length, false)
+		if end <= start {
+			continue
+		}
+		e.Offset, e.Length = start, end-start
+		adjusted = append(adjusted, e)
+	}
+	for i := range segments {
+		segments[i].TextStart = mapTrimmed(runs, segments[i].TextStart, true)
+		segments[i].TextEnd = mapTrimmed(runs, segments[i].TextEnd, true)
+		segments[i].UTF16Start = mapTrimmed(runs, segments[i].UTF16Start, false)
+		segments[i].UTF16End = mapTrimmed(runs, segments[i].UTF16End, false)
+	}
+	for i := range headings {
+		headings[i].TextStart = mapTrimmed(runs, headings[i].TextStart, true)
+		headings[i].UTF16Start = mapTrimmed(runs, headings[i].UTF16Start, false)
+	}
+	return b.String(), adjusted, segments, headings
+}
+
+func utf16RuneLen(r rune) int {
+	if r > 0xFFFF {
+		return 2
+	}
+	return 1
+}
+
+// mapTrimmed 将删除空白之前的偏移映射到删除之后，byteUnits 选择按字节还是按 UTF-16 计
+//
+// 落在被删除空白内部的偏移映射到空白的起点。
+func mapTrimmed(runs []trimRun, offset int, byteUnits bool) int {
+	start := func(r trimRun) int {
+		if byteUnits {
+			return r.byteStart
+		}
+		return r.utf16Start
+	}
+	// 第一个没有完全位于 offset 之前的空白
+	i := sort.Search(len(runs), func(i int) bool { return start(runs[i])+runs[i].length > offset })
+	if i < len(runs) && start(runs[i]) < offset {
+		return start(runs[i]) - runs[i].removed
+	}
+	if i == len(runs) {
+		last := runs[len(runs)-1]
+		return offset - last.removed - last.length
+	}
+	return offset - runs[i].removed
+}
+
+// utf16Len 返回 s 的 UTF-16 长度
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16RuneLen(r)
+	}
+	return n
+}
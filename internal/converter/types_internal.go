@@ -7,3 +7,4 @@ type MessageEntity = types.MessageEntity
 type RenderConfig = types.RenderConfig
 type Symbol = types.Symbol
 
+type MathDelimiters = types.MathDelimiters
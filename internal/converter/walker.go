@@ -1,9 +1,12 @@
 package converter
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/yuin/goldmark/ast"
 	east "github.com/yuin/goldmark/extension/ast"
@@ -11,6 +14,8 @@ import (
 
 	"github.com/riverfjs/telegramify-go/internal/buffer"
 	"github.com/riverfjs/telegramify-go/internal/latex"
+	"github.com/riverfjs/telegramify-go/internal/types"
+	"github.com/riverfjs/telegramify-go/internal/util"
 )
 
 var latexHelper = latex.NewParser()
@@ -22,13 +27,19 @@ type EventWalker struct {
 	entityStack  []EntityScope
 	entities     []MessageEntity
 	segments     []Segment
+	headings     []Heading
 	config       *RenderConfig
 
 	// Block-level state
 	blockCount int // 用于段落间距
-	listStack  []interface{} // nil=unordered, *int=ordered(next_number)
+	preEnd     int // 最近一个 pre 块（代码块、表格）结束的字节位置，紧凑间距下其后仍留空行
+	listStack  []listLevel
 	itemStarted bool
 	itemIndent string // 当前 item 的缩进，用于 task list marker 替换
+	// 当前 item 的列表符号在缓冲区中的范围，遇到 TaskCheckBox 时按位置替换
+	bulletStart     int
+	bulletEnd       int
+	bulletUTF16End  int
 
 	// Table state
 	inTable         bool
@@ -42,25 +53,61 @@ type EventWalker struct {
 	inCodeBlock      bool
 	codeBlockLang    string
 	codeBlockParts   []string
+	codeBlockStart   int
+	codeBlockEnd     int
+	codeBlockMerge   bool // MergeCodeBlocks 开启且前一个兄弟节点也是代码块
 
 	// Heading state
 	inHeading        bool
 	headingEntities  []string
+	headingTextStart int // 顶层标题文字（符号之后）的起始字节，不是顶层标题时为 -1
 
 	// Blockquote state
 	blockquoteScopes []EntityScope
+
+	// Link state：每个未结束的链接或图片一项
+	linkStack    []linkState
+	droppedLinks []DroppedLink
+	droppedHTML  []string // 被丢弃的不支持的 HTML 元素的标签名
+	images       int      // 图片数量，不含自定义表情
+	linkRefs     []string       // LinkStyleFootnote 下按编号排列的地址
+	linkRefIndex map[string]int // 地址到编号的映射，同一地址共用编号
+	entityTags   []string       // 未结束的 <tg-entity> 标签推入的实体类型，没有生成实体的为空
+
+	// 安全上限
+	depth int               // 当前节点在 AST 中的深度
+	limit *types.LimitError // 超出的上限，遍历随之停止
+}
+
+// linkState 一个链接或图片的状态
+type linkState struct {
+	entityType string // 推入的实体类型，链接被丢弃时为空
+	suffix     string // 链接文字之后追加的内容
+}
+
+// listLevel 一层列表的状态
+type listLevel struct {
+	ordered bool
+	next    int    // 有序列表的下一个编号
+	width   int    // 有序列表最大编号的位数，编号按此右对齐
+	indent  string // 本层列表项的缩进
+	content string // 当前 item 正文的缩进，嵌套列表和后续段落与其对齐
 }
 
 // NewEventWalker 创建新的 EventWalker
 func NewEventWalker(source []byte, config *RenderConfig) *EventWalker {
+	buf := buffer.New()
+	// 输出文本长度通常与源文本相近
+	buf.Grow(len(source))
 	return &EventWalker{
-		buf:          buffer.New(),
+		buf:          buf,
 		source:       source,
 		entityStack:  make([]EntityScope, 0),
 		entities:     make([]MessageEntity, 0),
 		segments:     make([]Segment, 0),
+		headings:     make([]Heading, 0),
 		config:       config,
-		listStack:    make([]interface{}, 0),
+		listStack:    make([]listLevel, 0),
 		tableRows:    make([][]string, 0),
 		currentRow:   make([]string, 0),
 		cellParts:    make([]string, 0),
@@ -69,20 +116,53 @@ func NewEventWalker(source []byte, config *RenderConfig) *EventWalker {
 	}
 }
 
+// Reset 复用 walker 处理新的文档
+//
+// 文本缓冲区和各类状态栈保留容量；entities 和 segments 重新分配，
+// 因此之前 Result 返回的切片不受影响。
+func (w *EventWalker) Reset(source []byte, config *RenderConfig) {
+	buf := w.buf
+	buf.Reset()
+	buf.Grow(len(source))
+	clear(w.codeBlockParts)
+	clear(w.cellParts)
+	*w = EventWalker{
+		buf:              buf,
+		source:           source,
+		entityStack:      w.entityStack[:0],
+		entities:         make([]MessageEntity, 0),
+		segments:         make([]Segment, 0),
+		headings:         make([]Heading, 0),
+		config:           config,
+		listStack:        w.listStack[:0],
+		tableRows:        make([][]string, 0),
+		currentRow:       make([]string, 0),
+		cellParts:        w.cellParts[:0],
+		codeBlockParts:   w.codeBlockParts[:0],
+		blockquoteScopes: w.blockquoteScopes[:0],
+		headingEntities:  w.headingEntities[:0],
+		linkStack:        w.linkStack[:0],
+		entityTags:       w.entityTags[:0],
+	}
+}
+
 // Walk 遍历 AST 节点
 func (w *EventWalker) Walk(node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		w.depth++
+	} else {
+		w.depth--
+	}
+	if w.overLimit() {
+		return ast.WalkStop, nil
+	}
+	
 	switch n := node.(type) {
 	// --- Document ---
 	case *ast.Document:
+		// 长引用升级为可展开在 onEndBlockquote 中按引用逐个决定
 		if !entering {
-			// Post-process: upgrade long blockquotes to expandable
-			if w.config.CiteExpandable {
-				for i := range w.entities {
-					if w.entities[i].Type == "blockquote" && w.entities[i].Length > 200 {
-						w.entities[i].Type = "expandable_blockquote"
-					}
-				}
-			}
+			w.writeLinkReferences()
 		}
 
 	// --- Inline elements ---
@@ -107,23 +187,23 @@ func (w *EventWalker) Walk(node ast.Node, entering bool) (ast.WalkStatus, error)
 		if entering {
 			// Level 1 = italic, Level 2 = bold
 			if n.Level == 2 {
-				w.pushEntity("bold", "")
+				w.pushEntity(types.EntityBold, "")
 			} else {
-				w.pushEntity("italic", "")
+				w.pushEntity(types.EntityItalic, "")
 			}
 		} else {
 			if n.Level == 2 {
-				w.popEntity("bold")
+				w.popEntity(types.EntityBold)
 			} else {
-				w.popEntity("italic")
+				w.popEntity(types.EntityItalic)
 			}
 		}
 
 	case *east.Strikethrough:
 		if entering {
-			w.pushEntity("strikethrough", "")
+			w.pushEntity(types.EntityStrikethrough, "")
 		} else {
-			w.popEntity("strikethrough")
+			w.popEntity(types.EntityStrikethrough)
 		}
 
 	// --- Links & Images ---
@@ -131,28 +211,45 @@ func (w *EventWalker) Walk(node ast.Node, entering bool) (ast.WalkStatus, error)
 		if entering {
 			w.onStartLink(n)
 		} else {
-			w.popEntity("text_link")
+			w.onEndLink()
 		}
 
 	case *ast.Image:
 		if entering {
 			w.onStartImage(n)
 		} else {
-			w.popEntityAny()
+			w.onEndLink()
 		}
 
 	case *ast.AutoLink:
 		if entering {
+			label := string(n.Label(w.source))
 			url := string(n.URL(w.source))
-			w.pushEntity("text_link", url)
-			w.buf.Write(url)
+			// 邮箱自动链接（<a@b.c> 和 Linkify 识别的裸地址）的 URL 没有协议，
+			// Telegram 会拒绝，显示文字仍用原地址
+			if n.AutoLinkType == ast.AutoLinkEmail && !strings.HasPrefix(strings.ToLower(url), "mailto:") {
+				url = "mailto:" + url
+			}
+			// 自动链接的文字就是地址，非实体样式下不再重复
+			if linkURL, ok := w.linkURL(url); ok && w.linkEntities() {
+				w.pushEntity(types.EntityTextLink, linkURL)
+				w.buf.Write(label)
+				w.popEntity(types.EntityTextLink)
+			} else {
+				w.buf.Write(label)
+			}
 			return ast.WalkSkipChildren, nil
 		}
 
 	// --- Block elements ---
+	case *ast.TextBlock:
+		if entering {
+			w.onStartTextBlock()
+		}
+
 	case *ast.Paragraph:
 		if entering {
-			w.onStartParagraph()
+			w.onStartParagraph(n)
 		} else {
 			w.onEndParagraph()
 		}
@@ -202,7 +299,9 @@ func (w *EventWalker) Walk(node ast.Node, entering bool) (ast.WalkStatus, error)
 		}
 
 	case *ast.HTMLBlock:
-		// Block HTML ignored
+		if entering {
+			w.onHTMLBlock(n)
+		}
 		return ast.WalkSkipChildren, nil
 
 	case *ast.RawHTML:
@@ -239,14 +338,99 @@ func (w *EventWalker) Walk(node ast.Node, entering bool) (ast.WalkStatus, error)
 		} else {
 			w.onEndTableCell()
 		}
+
+	// --- 未知节点 ---
+	default:
+		return w.onUnknownNode(n, entering)
 	}
 
 	return ast.WalkContinue, nil
 }
 
+// Headings 返回文档顶层标题，偏移对应 Result 返回的文本
+func (w *EventWalker) Headings() []Heading {
+	return w.headings
+}
+
+// DroppedLinks 返回因地址不可用而只渲染为文字的链接
+func (w *EventWalker) DroppedLinks() []DroppedLink {
+	return w.droppedLinks
+}
+
+// DroppedHTML 返回 HTML 块中因不支持而连同内容丢弃的元素的标签名
+func (w *EventWalker) DroppedHTML() []string {
+	return w.droppedHTML
+}
+
+// Images 返回文档中图片的数量，包括 HTML 块中的 <img>，不含自定义表情
+func (w *EventWalker) Images() int {
+	return w.images
+}
+
+// overLimit 检查 RenderConfig 的安全上限，超出时记录到 w.limit 并返回 true
+func (w *EventWalker) overLimit() bool {
+	check := func(name string, value, def, current int) bool {
+		limit := types.Limit(value, def)
+		if limit > 0 && current > limit {
+			w.limit = &types.LimitError{Limit: name, Max: limit}
+			return true
+		}
+		return false
+	}
+	if check("MaxEntities", w.config.MaxEntities, types.DefaultMaxEntities, len(w.entities)) {
+		// 截断时保留的实体不超过上限
+		w.entities = w.entities[:w.limit.Max]
+		return true
+	}
+	return check("MaxNestingDepth", w.config.MaxNestingDepth, types.DefaultMaxNestingDepth, w.depth) ||
+		check("MaxOutputBytes", w.config.MaxOutputBytes, types.DefaultMaxOutputBytes, w.buf.ByteOffset())
+}
+
+// Limit 返回遍历因超出安全上限而停止时的错误，未超出时为 nil
+func (w *EventWalker) Limit() *types.LimitError {
+	return w.limit
+}
+
 // Result 返回转换结果
 func (w *EventWalker) Result() (string, []MessageEntity, []Segment) {
-	return w.buf.String(), w.entities, w.segments
+	text := w.buf.String()
+	w.entities = w.dropDisabledEntities(w.entities)
+	snapEntities(text, w.entities)
+	return text, w.entities, w.segments
+}
+
+// dropDisabledEntities 去掉 EntityDisabled 报告禁用的实体，原地过滤
+func (w *EventWalker) dropDisabledEntities(entities []MessageEntity) []MessageEntity {
+	kept := entities[:0]
+	for _, e := range entities {
+		if !w.config.EntityDisabled(e.Type) {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// snapEntities 扩展实体边界，使其不落在基础字符与其后的组合符、变体选择符或 ZWJ 序列之间
+//
+// 实体结束时后续字符（如 ☑️ 的 U+FE0F）可能尚未写入，因此在全文生成后统一处理。
+func snapEntities(text string, entities []MessageEntity) {
+	if len(entities) == 0 || isASCII(text) {
+		return
+	}
+	boundaries := util.UTF16ClusterBoundaries(text)
+	for i := range entities {
+		start, end := util.SnapToClusters(boundaries, entities[i].Offset, entities[i].Offset+entities[i].Length)
+		entities[i].Offset, entities[i].Length = start, end-start
+	}
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
 }
 
 // --- Text handling ---
@@ -276,6 +460,10 @@ func (w *EventWalker) onText(seg text.Segment, softBreak bool, hardBreak bool) {
 	}
 	
 	w.buf.Write(textContent)
+	if (softBreak || hardBreak) && len(w.listStack) > 0 && !w.inItemBlockquote() {
+		// 列表项中折行的续行与正文对齐
+		w.buf.Write(w.listStack[len(w.listStack)-1].content)
+	}
 }
 
 func (w *EventWalker) onTextString(value []byte) {
@@ -293,6 +481,9 @@ func (w *EventWalker) onTextString(value []byte) {
 
 func (w *EventWalker) onInlineCode(n *ast.CodeSpan) {
 	code := extractCodeSpanText(n, w.source)
+	if w.config.CodeSanitizer != nil {
+		code = w.config.CodeSanitizer("", code)
+	}
 	if w.inTableCell {
 		w.cellParts = append(w.cellParts, code)
 		return
@@ -302,7 +493,7 @@ func (w *EventWalker) onInlineCode(n *ast.CodeSpan) {
 	length := w.buf.UTF16Offset() - start
 	if length > 0 {
 		w.entities = append(w.entities, MessageEntity{
-			Type:   "code",
+			Type:   types.EntityCode,
 			Offset: start,
 			Length: length,
 		})
@@ -310,28 +501,84 @@ func (w *EventWalker) onInlineCode(n *ast.CodeSpan) {
 }
 
 func (w *EventWalker) onInlineHTML(n *ast.RawHTML) {
-	html := string(n.Segments.Value(w.source))
-	tag := strings.TrimSpace(strings.ToLower(html))
+	html := strings.TrimSpace(string(n.Segments.Value(w.source)))
+	if strings.EqualFold(html, ExpandableMarker) {
+		w.forceExpandable()
+		return
+	}
 	
-	if tag == "<tg-spoiler>" {
-		w.pushEntity("spoiler", "")
-	} else if tag == "</tg-spoiler>" {
-		w.popEntity("spoiler")
+	// <tg-spoiler>、<u>、<kbd>、<mark> 等标签转换为实体，允许带属性；
+	// 自闭合的形式没有内容，忽略
+	tag, size := scanHTMLTag(html)
+	if size != len(html) || tag.selfClosing {
+		return
+	}
+	if tag.name == entityTag {
+		if tag.kind == htmlStartTag {
+			w.startEntityTag(tag.attrs)
+		} else {
+			w.endEntityTag()
+		}
+		return
+	}
+	entityType := w.htmlInlineEntity(tag.name)
+	if entityType == "" {
+		// Other inline HTML is ignored
+		return
+	}
+	if tag.kind == htmlStartTag {
+		w.pushEntity(entityType, "")
+	} else {
+		w.popEntity(entityType)
 	}
-	// Other inline HTML is ignored
 }
 
 func (w *EventWalker) onRule() {
+	rule := RuleText(w.config)
+	if len(w.listStack) > 0 {
+		// 列表项（包括其中的引用块）内不插入空行，但分隔线必须独占一行
+		w.ensureLineStart()
+		if rule != "" {
+			w.buf.Write(rule + "\n")
+		}
+		return
+	}
+	// Rule 为空时不写入文字，blockCount 增加使前后的段落仍以空行分隔
 	w.ensureBlockSpacing()
-	w.buf.Write("————————")
+	w.buf.Write(rule)
 	w.blockCount++
 }
 
+// RuleText 返回 config 下分隔线的文字：单个字符的 Rule 按 RuleWidth 重复
+func RuleText(config *RenderConfig) string {
+	rule := config.MarkdownSymbol.Rule
+	if config.RuleWidth > 0 && utf8.RuneCountInString(rule) == 1 {
+		return strings.Repeat(rule, config.RuleWidth)
+	}
+	return rule
+}
+
 // --- Paragraph ---
 
-func (w *EventWalker) onStartParagraph() {
+func (w *EventWalker) onStartParagraph(n *ast.Paragraph) {
 	if len(w.listStack) == 0 {
 		w.ensureBlockSpacing()
+	} else if w.inItemBlockquote() {
+		// item 内引用块中的段落由引用条标示，不缩进；引用中相邻的段落之间保留空行，
+		// 与列表外的引用一致
+		if _, ok := n.PreviousSibling().(*ast.Paragraph); ok && !w.compact() && w.buf.TrailingNewlineCount() == 1 {
+			w.buf.Write("\n")
+		}
+	} else if w.buf.ByteOffset() > w.bulletEnd && w.buf.TrailingNewlineCount() > 0 {
+		// item 中的后续段落与正文对齐
+		w.buf.Write(w.listStack[len(w.listStack)-1].content)
+	}
+}
+
+// onStartTextBlock 处理紧凑列表项中的文字：跟在代码块等其他块之后时与正文对齐
+func (w *EventWalker) onStartTextBlock() {
+	if len(w.listStack) > 0 && w.buf.ByteOffset() > w.bulletEnd && w.buf.TrailingNewlineCount() > 0 {
+		w.buf.Write(w.listStack[len(w.listStack)-1].content)
 	}
 }
 
@@ -344,19 +591,67 @@ func (w *EventWalker) onEndParagraph() {
 	}
 }
 
+// --- 未知节点 ---
+
+// onUnknownNode 处理其他扩展（如定义列表、公式）产生的节点
+//
+// 先交给 RenderConfig.OnUnknownNode，处理后写入其返回的文字并跳过子节点。
+// 否则只转换子节点；列表外的块级节点与前后的块之间保留空行，
+// 没有子节点的块级节点（如公式块）输出其原文行，避免内容丢失。
+func (w *EventWalker) onUnknownNode(n ast.Node, entering bool) (ast.WalkStatus, error) {
+	isBlock := n.Type() == ast.TypeBlock
+	spaced := isBlock && len(w.listStack) == 0 && !w.inTableCell
+	if entering && w.config.OnUnknownNode != nil {
+		if text, handled := w.config.OnUnknownNode(n, w.source); handled {
+			if spaced {
+				w.ensureBlockSpacing()
+			}
+			w.onTextString([]byte(text))
+			if spaced {
+				w.blockCount++
+			}
+			return ast.WalkSkipChildren, nil
+		}
+	}
+	if spaced {
+		if entering {
+			w.ensureBlockSpacing()
+		} else {
+			w.blockCount++
+		}
+	}
+	if entering && isBlock && !n.HasChildren() {
+		var sb strings.Builder
+		lines := n.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			seg := lines.At(i)
+			sb.Write(seg.Value(w.source))
+		}
+		w.onTextString([]byte(strings.TrimRight(sb.String(), "\n")))
+	}
+	return ast.WalkContinue, nil
+}
+
 // --- Heading ---
 
 var headingEntitiesMap = map[int][]string{
-	1: {"bold", "underline"},
-	2: {"bold", "underline"},
-	3: {"bold"},
-	4: {"bold"},
-	5: {"italic"},
-	6: {"italic"},
+	1: {types.EntityBold, types.EntityUnderline},
+	2: {types.EntityBold, types.EntityUnderline},
+	3: {types.EntityBold},
+	4: {types.EntityBold},
+	5: {types.EntityItalic},
+	6: {types.EntityItalic},
 }
 
 func (w *EventWalker) onStartHeading(n *ast.Heading) {
-	w.ensureBlockSpacing()
+	if len(w.blockquoteScopes) > 0 {
+		w.blockquoteScopes[0].HasHeading = true
+	}
+	if len(w.listStack) > 0 {
+		w.ensureLineStart()
+	} else {
+		w.ensureBlockSpacing()
+	}
 	
 	// 获取标题符号
 	var symbol string
@@ -375,14 +670,28 @@ func (w *EventWalker) onStartHeading(n *ast.Heading) {
 		symbol = w.config.MarkdownSymbol.HeadingLevel6
 	}
 	
+	// 只记录文档顶层的标题，列表和引用中的标题不参与目录和按标题切分
+	_, topLevel := n.Parent().(*ast.Document)
+	w.headingTextStart = -1
+	if topLevel {
+		w.headings = append(w.headings, Heading{
+			Level:      n.Level,
+			TextStart:  w.buf.ByteOffset(),
+			UTF16Start: w.buf.UTF16Offset(),
+		})
+	}
+	
 	if symbol != "" {
 		w.buf.Write(symbol + " ")
 	}
+	if topLevel {
+		w.headingTextStart = w.buf.ByteOffset()
+	}
 	
 	// 推送标题实体
 	w.headingEntities = headingEntitiesMap[n.Level]
 	if w.headingEntities == nil {
-		w.headingEntities = []string{"bold"}
+		w.headingEntities = []string{types.EntityBold}
 	}
 	
 	for _, etype := range w.headingEntities {
@@ -398,7 +707,16 @@ func (w *EventWalker) onEndHeading() {
 	}
 	w.headingEntities = nil
 	w.inHeading = false
-	w.blockCount++
+	if w.headingTextStart >= 0 {
+		title := strings.TrimSpace(w.buf.Slice(w.headingTextStart, w.buf.ByteOffset()))
+		w.headings[len(w.headings)-1].Text = strings.ReplaceAll(title, "\n", " ")
+		w.headingTextStart = -1
+	}
+	if len(w.listStack) > 0 {
+		w.ensureLineStart()
+	} else {
+		w.blockCount++
+	}
 }
 
 // --- Code block ---
@@ -413,6 +731,15 @@ func (w *EventWalker) onStartCodeBlock(n ast.Node) {
 		w.codeBlockLang = ""
 	}
 	
+	w.codeBlockStart, w.codeBlockEnd = codeBlockSpan(n, w.source)
+	w.codeBlockMerge = false
+	if w.config.MergeCodeBlocks {
+		switch n.PreviousSibling().(type) {
+		case *ast.FencedCodeBlock, *ast.CodeBlock:
+			w.codeBlockMerge = true
+		}
+	}
+	
 	// 提取代码块内容
 	lines := n.Lines()
 	for i := 0; i < lines.Len(); i++ {
@@ -423,6 +750,64 @@ func (w *EventWalker) onStartCodeBlock(n ast.Node) {
 	w.onEndCodeBlock()
 }
 
+// codeBlockSpan 返回代码块在源文本中的字节范围（不含末尾换行），
+// 围栏代码块从开围栏所在行开始，到闭围栏所在行结束
+func codeBlockSpan(n ast.Node, source []byte) (int, int) {
+	lines := n.Lines()
+	start, end := -1, -1
+	if lines.Len() > 0 {
+		start, end = lines.At(0).Start, lines.At(lines.Len()-1).Stop
+	}
+	
+	fenced, ok := n.(*ast.FencedCodeBlock)
+	if !ok {
+		if start < 0 {
+			return -1, -1
+		}
+		return lineStart(source, start), trimNewline(source, end)
+	}
+	
+	// 开围栏：信息串所在的行，没有信息串时是第一行内容的上一行
+	switch {
+	case fenced.Info != nil:
+		start = lineStart(source, fenced.Info.Segment.Start)
+		if end < 0 {
+			end = lineEnd(source, fenced.Info.Segment.Start)
+		}
+	case start > 0:
+		start = lineStart(source, start-1)
+	default:
+		return -1, -1
+	}
+	
+	// 闭围栏：内容之后的一行，文档结尾未闭合时没有
+	if closing := strings.TrimLeft(string(source[end:lineEnd(source, end)]), " \t>"); strings.HasPrefix(closing, "```") || strings.HasPrefix(closing, "~~~") {
+		return start, trimNewline(source, lineEnd(source, end))
+	}
+	return start, trimNewline(source, end)
+}
+
+// lineStart 返回 pos 所在行的起始位置
+func lineStart(source []byte, pos int) int {
+	return bytes.LastIndexByte(source[:pos], '\n') + 1
+}
+
+// lineEnd 返回 pos 所在行的结束位置（换行符之后）
+func lineEnd(source []byte, pos int) int {
+	if i := bytes.IndexByte(source[pos:], '\n'); i >= 0 {
+		return pos + i + 1
+	}
+	return len(source)
+}
+
+// trimNewline 去掉 end 之前的一个换行符
+func trimNewline(source []byte, end int) int {
+	if end > 0 && source[end-1] == '\n' {
+		return end - 1
+	}
+	return end
+}
+
 func (w *EventWalker) onEndCodeBlock() {
 	w.inCodeBlock = false
 	rawCode := strings.Join(w.codeBlockParts, "")
@@ -432,22 +817,63 @@ func (w *EventWalker) onEndCodeBlock() {
 		rawCode = rawCode[:len(rawCode)-1]
 	}
 	
-	w.ensureBlockSpacing()
+	lang := strings.Split(w.codeBlockLang, ",")[0]
+	lang = strings.TrimSpace(lang)
+	if lang == "" && !w.config.DisableLanguageDetection {
+		lang = sniffLanguage(rawCode)
+	}
+	// 在写入前处理，文本、pre 实体和 Segment.RawCode（提取的文件）都只含处理后的代码
+	if w.config.CodeSanitizer != nil {
+		rawCode = w.config.CodeSanitizer(lang, rawCode)
+	}
+	
+	gapStart := w.buf.ByteOffset()
+	if len(w.listStack) > 0 {
+		// 列表项中的代码块独占一行，其后的内容另起一行
+		w.ensureLineStart()
+		defer w.ensureLineStart()
+	} else {
+		w.blockSpacing(!w.inlineCodeBlock(lang, rawCode))
+	}
+	
+	if w.codeBlockMerge && w.mergeCodeBlock(lang, rawCode, gapStart) {
+		w.blockCount++
+		w.codeBlockLang = ""
+		w.codeBlockParts = nil
+		return
+	}
+	
+	if w.inlineCodeBlock(lang, rawCode) {
+		start := w.buf.UTF16Offset()
+		w.buf.Write(rawCode)
+		w.entities = append(w.entities, MessageEntity{
+			Type:   types.EntityCode,
+			Offset: start,
+			Length: w.buf.UTF16Offset() - start,
+		})
+		w.blockCount++
+		w.codeBlockLang = ""
+		w.codeBlockParts = nil
+		return
+	}
 	
 	// Record segment
 	segTextStart := w.buf.ByteOffset()
 	segUTF16Start := w.buf.UTF16Offset()
+	prefixLen, prefixUTF16Len := 0, 0
+	if w.itemStarted && w.bulletEnd == segTextStart && w.bulletStart < w.bulletEnd {
+		// 代码块是列表项的第一个块，与列表符号在同一行
+		prefixLen = w.bulletEnd - w.bulletStart
+		prefixUTF16Len = utf16Len(w.buf.Slice(w.bulletStart, w.bulletEnd))
+	}
 	
 	start := w.buf.UTF16Offset()
 	w.buf.Write(rawCode)
 	length := w.buf.UTF16Offset() - start
 	
-	lang := strings.Split(w.codeBlockLang, ",")[0]
-	lang = strings.TrimSpace(lang)
-	
 	if length > 0 {
 		entity := MessageEntity{
-			Type:   "pre",
+			Type:   types.EntityPre,
 			Offset: start,
 			Length: length,
 		}
@@ -455,22 +881,28 @@ func (w *EventWalker) onEndCodeBlock() {
 			entity.Language = lang
 		}
 		w.entities = append(w.entities, entity)
+		w.preEnd = w.buf.ByteOffset()
 	}
 	
 	// Determine segment kind
-	segKind := "code_block"
+	segKind := SegmentCodeBlock
 	if strings.ToLower(lang) == "mermaid" {
-		segKind = "mermaid"
+		segKind = SegmentMermaid
 	}
 	
 	w.segments = append(w.segments, Segment{
-		Kind:       segKind,
-		TextStart:  segTextStart,
-		TextEnd:    w.buf.ByteOffset(),
-		UTF16Start: segUTF16Start,
-		UTF16End:   w.buf.UTF16Offset(),
-		Language:   lang,
-		RawCode:    rawCode,
+		Kind:           segKind,
+		TextStart:      segTextStart,
+		TextEnd:        w.buf.ByteOffset(),
+		UTF16Start:     segUTF16Start,
+		UTF16End:       w.buf.UTF16Offset(),
+		Language:       lang,
+		RawCode:        rawCode,
+		SourceStart:    w.codeBlockStart,
+		SourceEnd:      w.codeBlockEnd,
+		Inline:         w.config.EntityDisabled(types.EntityPre),
+		PrefixLen:      prefixLen,
+		PrefixUTF16Len: prefixUTF16Len,
 	})
 	
 	w.blockCount++
@@ -478,99 +910,316 @@ func (w *EventWalker) onEndCodeBlock() {
 	w.codeBlockParts = nil
 }
 
+// mergeCodeBlock 把代码块并入紧挨在前、语言相同的代码块：写入代码并延长前一个
+// pre 实体和 Segment，两段代码之间的空行成为代码的一部分。gapStart 是块间距
+// 写入前的位置；前一个代码块是 Mermaid、未生成 pre 实体或之后写过其他内容时
+// 返回 false，由调用方照常输出
+func (w *EventWalker) mergeCodeBlock(lang, code string, gapStart int) bool {
+	if len(w.segments) == 0 || len(w.entities) == 0 {
+		return false
+	}
+	seg := &w.segments[len(w.segments)-1]
+	pre := &w.entities[len(w.entities)-1]
+	if seg.Kind != SegmentCodeBlock || seg.Inline || seg.Language != lang || seg.TextEnd != gapStart {
+		return false
+	}
+	if pre.Type != types.EntityPre || pre.Offset+pre.Length != seg.UTF16End {
+		return false
+	}
+	gap := w.buf.Slice(gapStart, w.buf.ByteOffset())
+	if strings.TrimSpace(gap) != "" {
+		return false
+	}
+	w.buf.Write(code)
+	pre.Length = w.buf.UTF16Offset() - pre.Offset
+	seg.TextEnd = w.buf.ByteOffset()
+	seg.UTF16End = w.buf.UTF16Offset()
+	seg.RawCode += gap + code
+	seg.SourceEnd = w.codeBlockEnd
+	w.preEnd = w.buf.ByteOffset()
+	return true
+}
+
+// inlineCodeBlock 报告代码块是否按 InlineCodeBlockMax 降级为 code 实体：
+// 非空、只有一行、不超过阈值，且不是 Mermaid 图表
+func (w *EventWalker) inlineCodeBlock(lang, code string) bool {
+	limit := w.config.InlineCodeBlockMax
+	if limit <= 0 || code == "" || strings.Contains(code, "\n") {
+		return false
+	}
+	if strings.EqualFold(lang, "mermaid") {
+		return false
+	}
+	return utf16Len(code) <= limit
+}
+
 // --- Blockquote ---
 
 func (w *EventWalker) onStartBlockquote() {
 	w.ensureBlockSpacing()
 	scope := EntityScope{
-		EntityType:  "blockquote",
+		EntityType:  types.EntityBlockquote,
 		StartOffset: w.buf.UTF16Offset(),
+		StartByte:   w.buf.ByteOffset(),
 	}
 	w.blockquoteScopes = append(w.blockquoteScopes, scope)
 }
 
+// onEndBlockquote 结束引用块
+//
+// Telegram 不接受嵌套在 blockquote 中的 pre，因此引用块中的代码块会把
+// 引用拆成前后多段，代码块本身不在任何一段引用之内。
+// Telegram 也不支持嵌套引用，内层引用只并入外层，不单独生成实体。
 func (w *EventWalker) onEndBlockquote() {
 	if len(w.blockquoteScopes) > 0 {
 		scope := w.blockquoteScopes[len(w.blockquoteScopes)-1]
 		w.blockquoteScopes = w.blockquoteScopes[:len(w.blockquoteScopes)-1]
+		if len(w.blockquoteScopes) > 0 {
+			w.blockCount++
+			return
+		}
 		
-		length := w.buf.UTF16Offset() - scope.StartOffset
-		if length > 0 {
-			w.entities = append(w.entities, MessageEntity{
-				Type:   "blockquote",
-				Offset: scope.StartOffset,
-				Length: length,
-			})
+		attribution := -1
+		if !w.config.DisableQuoteAttribution {
+			attribution = w.markQuoteAttribution(scope.StartByte)
+		}
+		startByte, startUTF16 := scope.StartByte, scope.StartOffset
+		for _, seg := range w.segments {
+			// 没有 pre 实体的代码块不需要拆开引用
+			if seg.TextStart < scope.StartByte || seg.Inline {
+				continue
+			}
+			w.appendBlockquote(scope, startByte, startUTF16, seg.TextStart, seg.UTF16Start, attribution)
+			startByte, startUTF16 = seg.TextEnd, seg.UTF16End
 		}
+		w.appendBlockquote(scope, startByte, startUTF16, w.buf.ByteOffset(), w.buf.UTF16Offset(), attribution)
 	}
 	w.blockCount++
 }
 
+const (
+	// expandableMinLength 自动升级为可展开引用的最小长度（UTF-16）
+	expandableMinLength = 200
+	// expandablePreviewLines 折叠的引用仍会显示的大致行数，不超过这些行的引用不自动折叠
+	expandablePreviewLines = 3
+	// quoteLineWidth 估算引用自动换行时每行容纳的字符数
+	quoteLineWidth = 80
+)
+
+// appendBlockquote 为 [start, end) 区间添加一段 blockquote 实体，去掉两端的换行
+//
+// 显式要求可展开的引用总是可展开；否则在 CiteExpandable 开启、引用不含标题、
+// 且长度和估算行数都超过折叠预览时自动升级。attribution 是署名行的字节位置（没有时为 -1），
+// 署名不计入长度和行数。
+func (w *EventWalker) appendBlockquote(scope EntityScope, startByte, startUTF16, endByte, endUTF16, attribution int) {
+	text := w.buf.Slice(startByte, endByte)
+	trimmed := strings.TrimLeft(text, "\n")
+	startUTF16 += len(text) - len(trimmed) // 换行在字节和 UTF-16 中都占 1
+	trimmedRight := strings.TrimRight(trimmed, "\n")
+	endUTF16 -= len(trimmed) - len(trimmedRight)
+	if endUTF16 <= startUTF16 {
+		return
+	}
+	entityType := types.EntityBlockquote
+	length := endUTF16 - startUTF16
+	body, bodyLength := trimmedRight, length
+	if attribution > startByte && attribution <= endByte {
+		bodyEnd := attribution - startByte - (len(text) - len(trimmed))
+		body = strings.TrimRight(trimmed[:bodyEnd], "\n")
+		bodyLength = utf16Len(body)
+	}
+	if scope.Expandable || (w.config.CiteExpandable && !scope.HasHeading &&
+		bodyLength > expandableMinLength && visualLines(body) > expandablePreviewLines) {
+		entityType = types.EntityExpandableBlockquote
+	}
+	w.entities = append(w.entities, MessageEntity{
+		Type:   entityType,
+		Offset: startUTF16,
+		Length: length,
+	})
+}
+
+// quoteAttributionMaxLength 署名行的最大长度（字符），更长的行视为正文
+const quoteAttributionMaxLength = 100
+
+// markQuoteAttribution 识别从 start 开始的引用的最后一行是否为 "— 作者" 或 "-- 作者"
+// 形式的署名，是则为其添加斜体实体并返回该行的字节位置，否则返回 -1
+//
+// 只有一行的引用没有署名；其他行也以破折号开头时视为对话，代码块中的行不是署名。
+func (w *EventWalker) markQuoteAttribution(start int) int {
+	text := strings.TrimRight(w.buf.Slice(start, w.buf.ByteOffset()), "\n")
+	cut := strings.LastIndexByte(text, '\n')
+	if cut < 0 {
+		return -1
+	}
+	body, line := text[:cut], text[cut+1:]
+	if !isAttributionLine(line) || utf8.RuneCountInString(line) > quoteAttributionMaxLength {
+		return -1
+	}
+	for _, l := range strings.Split(body, "\n") {
+		if isAttributionLine(l) {
+			return -1
+		}
+	}
+	lineStart := start + cut + 1
+	for _, seg := range w.segments {
+		if seg.TextStart <= lineStart && lineStart < seg.TextEnd {
+			return -1 // 代码块中的行，如 SQL 注释
+		}
+	}
+	offset := w.buf.UTF16Offset() - utf16Len(w.buf.Slice(lineStart, w.buf.ByteOffset()))
+	w.entities = append(w.entities, MessageEntity{
+		Type:   types.EntityItalic,
+		Offset: offset,
+		Length: utf16Len(line),
+	})
+	return lineStart
+}
+
+// isAttributionLine 报告 line 是否以 "—"、"--"（不是 "---"）或 "–"（启用 Typographer 时
+// "--" 被替换成的短划线）开头
+func isAttributionLine(line string) bool {
+	line = strings.TrimLeft(line, " ")
+	rest, ok := strings.CutPrefix(line, "—")
+	if !ok {
+		rest, ok = strings.CutPrefix(line, "–")
+	}
+	if !ok {
+		rest, ok = strings.CutPrefix(line, "--")
+		ok = ok && !strings.HasPrefix(rest, "-")
+	}
+	return ok && strings.TrimSpace(rest) != ""
+}
+
+// visualLines 估算文本在客户端中显示的行数，长行按 quoteLineWidth 折行
+func visualLines(text string) int {
+	lines := 0
+	for _, line := range strings.Split(text, "\n") {
+		lines += max(1, (utf8.RuneCountInString(line)+quoteLineWidth-1)/quoteLineWidth)
+	}
+	return lines
+}
+
+// forceExpandable 将最外层的引用块标记为可展开（Telegram 不支持嵌套引用）
+func (w *EventWalker) forceExpandable() {
+	if len(w.blockquoteScopes) > 0 {
+		w.blockquoteScopes[0].Expandable = true
+	}
+}
+
+// htmlBlockText 返回 HTML 块去掉首尾空白后的原文
+func (w *EventWalker) htmlBlockText(n *ast.HTMLBlock) string {
+	var b strings.Builder
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		seg := lines.At(i)
+		b.Write(seg.Value(w.source))
+	}
+	return strings.TrimSpace(b.String())
+}
+
 // --- Links & Images ---
 
 func (w *EventWalker) onStartLink(n *ast.Link) {
-	destURL := string(n.Destination)
-	emojiID := validateTelegramEmoji(destURL)
-	
-	if emojiID != "" {
-		w.pushEntity("custom_emoji", emojiID)
-	} else if destURL != "" {
-		w.pushEntity("text_link", destURL)
-	}
-	// Empty URL links are rendered as plain text (no entity)
+	w.startLink(string(n.Destination))
 }
 
 func (w *EventWalker) onStartImage(n *ast.Image) {
-	destURL := string(n.Destination)
-	emojiID := validateTelegramEmoji(destURL)
-	
-	if emojiID != "" {
-		w.pushEntity("custom_emoji", emojiID)
-	} else {
+	w.startImage(string(n.Destination))
+}
+
+// startImage 写入图片符号（自定义表情除外）并开始链接，之后写入的文字为替代文本
+func (w *EventWalker) startImage(destURL string) {
+	if validateTelegramEmoji(destURL) == "" {
+		w.images++
 		w.buf.Write(w.config.MarkdownSymbol.Image)
-		w.pushEntity("text_link", destURL)
+	}
+	w.startLink(destURL)
+}
+
+// startLink 为链接或图片推入实体：自定义表情、可用的 URL 生成 text_link，
+// 其余只保留文字，按配置在文字后附上原地址
+func (w *EventWalker) startLink(destURL string) {
+	var state linkState
+	if emojiID := validateTelegramEmoji(destURL); emojiID != "" {
+		state.entityType = types.EntityCustomEmoji
+		w.pushEntity(types.EntityCustomEmoji, emojiID)
+	} else if linkURL, ok := w.linkURL(destURL); ok {
+		switch w.config.LinkStyle {
+		case types.LinkStyleFootnote:
+			state.suffix = fmt.Sprintf(" [%d]", w.linkReference(linkURL))
+		case types.LinkStyleInlineURL:
+			state.suffix = " (" + linkURL + ")"
+		default:
+			state.entityType = types.EntityTextLink
+			w.pushEntity(types.EntityTextLink, linkURL)
+		}
+	} else if destURL != "" && w.config.ShowDroppedLinkURL {
+		state.suffix = " (" + destURL + ")"
+	}
+	w.linkStack = append(w.linkStack, state)
+}
+
+func (w *EventWalker) onEndLink() {
+	if len(w.linkStack) == 0 {
+		return
+	}
+	state := w.linkStack[len(w.linkStack)-1]
+	w.linkStack = w.linkStack[:len(w.linkStack)-1]
+	if state.entityType != "" {
+		w.popEntity(state.entityType)
+	}
+	if state.suffix != "" {
+		w.onTextString([]byte(state.suffix))
 	}
 }
 
 // --- Lists ---
 
 func (w *EventWalker) onStartList(n *ast.List) {
+	level := listLevel{}
 	if len(w.listStack) == 0 {
 		w.ensureBlockSpacing()
+	} else {
+		// 嵌套列表缩进到父 item 正文的位置
+		level.indent = w.listStack[len(w.listStack)-1].content
 	}
 	
 	if n.IsOrdered() {
-		start := n.Start
-		w.listStack = append(w.listStack, &start)
-	} else {
-		w.listStack = append(w.listStack, nil)
+		level.ordered = true
+		level.next = n.Start
+		last := n.Start + n.ChildCount() - 1
+		level.width = len(strconv.Itoa(max(last, n.Start)))
 	}
+	w.listStack = append(w.listStack, level)
 }
 
 func (w *EventWalker) onStartItem() {
-	depth := len(w.listStack)
-	indent := strings.Repeat("  ", depth-1)
-	
 	// 嵌套列表：父项文本后没有换行时，插入换行确保子项独占一行
 	if w.buf.ByteOffset() > 0 && w.buf.TrailingNewlineCount() == 0 {
 		w.buf.Write("\n")
 	}
 	
-	w.itemIndent = indent
+	w.bulletStart = w.buf.ByteOffset()
 	
 	if len(w.listStack) > 0 {
-		currentList := w.listStack[len(w.listStack)-1]
-		if currentList != nil {
-			// Ordered list
-			num := *(currentList.(*int))
-			w.buf.Write(fmt.Sprintf("%s%d. ", indent, num))
-			*(currentList.(*int)) = num + 1
+		level := &w.listStack[len(w.listStack)-1]
+		w.itemIndent = level.indent
+		if level.ordered {
+			// 编号右对齐，使 "9. " 和 "10. " 之后的正文处于同一列
+			bullet := fmt.Sprintf("%*d. ", level.width, level.next)
+			w.buf.Write(level.indent + bullet)
+			level.content = level.indent + strings.Repeat(" ", len(bullet))
+			level.next++
 		} else {
 			// Unordered list - 先写 bullet，如果后面遇到 TaskCheckBox 会被替换
-			w.buf.Write(fmt.Sprintf("%s⦁ ", indent))
+			w.buf.Write(level.indent + "⦁ ")
+			level.content = level.indent + "  "
 		}
 	}
 	
+	w.bulletEnd = w.buf.ByteOffset()
+	w.bulletUTF16End = w.buf.UTF16Offset()
 	w.itemStarted = true
 }
 
@@ -583,16 +1232,42 @@ func (w *EventWalker) onEndItem() {
 
 // onTaskCheckBox 处理任务列表复选框
 // 对应 Python 的 _on_task_list_marker
+//
+// 按 onStartItem 记录的位置替换列表符号，而不是假定它是最后一次写入；
+// 替换后长度变化，之后记录的实体偏移随之平移。
 func (w *EventWalker) onTaskCheckBox(checked bool) {
-	// 移除 _on_start_item 刚写入的 bullet 前缀（"⦁ " 或缩进+⦁）
-	w.buf.PopLast()
-	
-	// 写入任务标记
 	symbol := w.config.MarkdownSymbol.TaskUncompleted
 	if checked {
 		symbol = w.config.MarkdownSymbol.TaskCompleted
 	}
-	w.buf.Write(fmt.Sprintf("%s%s ", w.itemIndent, symbol))
+	marker := fmt.Sprintf("%s%s ", w.itemIndent, symbol)
+	
+	if !w.itemStarted || w.bulletEnd > w.buf.ByteOffset() {
+		// 不在列表项中（不应出现），直接写入标记
+		w.buf.Write(marker)
+		return
+	}
+	delta := w.buf.Replace(w.bulletStart, w.bulletEnd, marker)
+	w.shiftOffsets(w.bulletUTF16End, delta)
+	w.bulletEnd = w.bulletStart + len(marker)
+	w.bulletUTF16End += delta
+}
+
+// shiftOffsets 将 from 及之后记录的 UTF-16 偏移平移 delta
+func (w *EventWalker) shiftOffsets(from, delta int) {
+	if delta == 0 {
+		return
+	}
+	for i := range w.entityStack {
+		if w.entityStack[i].StartOffset >= from {
+			w.entityStack[i].StartOffset += delta
+		}
+	}
+	for i := range w.entities {
+		if w.entities[i].Offset >= from {
+			w.entities[i].Offset += delta
+		}
+	}
 }
 
 func (w *EventWalker) onEndList() {
@@ -607,7 +1282,7 @@ func (w *EventWalker) onEndList() {
 // --- Tables ---
 
 func (w *EventWalker) onStartTable(n *east.Table) {
-	w.ensureBlockSpacing()
+	w.blockSpacing(true)
 	w.inTable = true
 	w.tableAlignments = n.Alignments
 	w.tableRows = make([][]string, 0)
@@ -635,10 +1310,11 @@ func (w *EventWalker) onEndTable() {
 	
 	if length > 0 {
 		w.entities = append(w.entities, MessageEntity{
-			Type:   "pre",
+			Type:   types.EntityPre,
 			Offset: start,
 			Length: length,
 		})
+		w.preEnd = w.buf.ByteOffset()
 	}
 	
 	w.tableRows = nil
@@ -701,9 +1377,9 @@ func (w *EventWalker) pushEntity(entityType string, urlOrEmojiID string) {
 		StartOffset: w.buf.UTF16Offset(),
 	}
 	
-	if entityType == "text_link" {
+	if entityType == types.EntityTextLink {
 		scope.URL = urlOrEmojiID
-	} else if entityType == "custom_emoji" {
+	} else if entityType == types.EntityCustomEmoji {
 		scope.CustomEmojiID = urlOrEmojiID
 	}
 	
@@ -730,11 +1406,16 @@ func (w *EventWalker) popEntityAny() {
 	}
 }
 
+// finalizeEntity 结束 scope 生成实体。Telegram 不接受 code 和 pre 中的其他实体，
+// 如 <code> 或 <tg-entity type="code"> 中的粗体，结束 code 和 pre 时去掉其中的实体
 func (w *EventWalker) finalizeEntity(scope EntityScope) {
 	length := w.buf.UTF16Offset() - scope.StartOffset
 	if length <= 0 {
 		return
 	}
+	if scope.EntityType == types.EntityCode || scope.EntityType == types.EntityPre {
+		w.dropEntitiesWithin(scope.StartOffset, scope.StartOffset+length)
+	}
 	
 	entity := MessageEntity{
 		Type:   scope.EntityType,
@@ -755,17 +1436,58 @@ func (w *EventWalker) finalizeEntity(scope EntityScope) {
 	w.entities = append(w.entities, entity)
 }
 
+// dropEntitiesWithin 去掉完全位于 [start, end) 中的实体
+func (w *EventWalker) dropEntitiesWithin(start, end int) {
+	kept := w.entities[:0]
+	for _, e := range w.entities {
+		if e.Offset < start || e.Offset+e.Length > end {
+			kept = append(kept, e)
+		}
+	}
+	w.entities = kept
+}
+
 func (w *EventWalker) ensureBlockSpacing() {
-	// Ensure a blank line (\n\n) between blocks, avoiding excess newlines
-	if w.blockCount > 0 {
+	w.blockSpacing(false)
+}
+
+// blockSpacing 在块之前写入换行，使其与前一个块以空行分隔。
+// SpacingCompact 下只换行；pre 为 true（接下来是 pre 块）或前一个块是 pre 块时仍留空行
+func (w *EventWalker) blockSpacing(pre bool) {
+	// Ensure a blank line (\n\n) between blocks, avoiding excess newlines.
+	// 之前的块没有输出（如 HTML 注释、空代码块、被删除的元素）时不写换行，文本不以空行开头
+	if w.blockCount > 0 && w.buf.ByteOffset() > 0 {
 		trailing := w.buf.TrailingNewlineCount()
-		needed := 2 - trailing
+		lines := 2
+		if w.compact() && !pre && w.buf.ByteOffset()-trailing != w.preEnd {
+			lines = 1
+		}
+		needed := lines - trailing
 		if needed > 0 {
 			w.buf.Write(strings.Repeat("\n", needed))
 		}
 	}
 }
 
+// ensureLineStart 保证接下来的输出从新行开始，用于列表内不需要空行的块；
+// 紧跟在列表符号之后时不换行
+func (w *EventWalker) ensureLineStart() {
+	if w.buf.ByteOffset() > w.bulletEnd && w.buf.TrailingNewlineCount() == 0 {
+		w.buf.Write("\n")
+	}
+}
+
+// compact 报告是否使用 SpacingCompact
+func (w *EventWalker) compact() bool {
+	return w.config.Spacing == types.SpacingCompact
+}
+
+// inItemBlockquote 报告当前是否处在列表项内部开始的引用块中
+func (w *EventWalker) inItemBlockquote() bool {
+	n := len(w.blockquoteScopes)
+	return n > 0 && w.blockquoteScopes[n-1].StartByte >= w.bulletEnd
+}
+
 // --- Utilities ---
 
 func extractCodeSpanText(n *ast.CodeSpan, source []byte) string {
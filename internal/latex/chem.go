@@ -0,0 +1,102 @@
+package latex
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// chemArrows mhchem 箭头，长的写法在前，保证 <=> 不会被当成 <= 加 >
+var chemArrows = []struct {
+	from string
+	to   string
+}{
+	{"<=>", "⇌"},
+	{"<->", "↔"},
+	{"->", "→"},
+	{"<-", "←"},
+}
+
+// TranslateChem 将 \ce{...} 的内容转换为 Unicode
+//
+// 只覆盖常见写法，不实现完整的 mhchem 语义：
+//   - 元素符号或右括号后的数字 → 下标（H2O → H₂O）
+//   - ^2+、^{2-} 形式的电荷 → 上标
+//   - ->、<-、<->、<=> → 对应箭头
+//
+// 其他字符（包括化学计量系数）原样保留。
+func TranslateChem(formula string) string {
+	var result strings.Builder
+	i := 0
+	// afterSymbol 表示上一个字符是元素符号或右括号，后面的数字应作为下标
+	afterSymbol := false
+
+	for i < len(formula) {
+		if arrow, size := matchChemArrow(formula[i:]); size > 0 {
+			result.WriteString(arrow)
+			i += size
+			afterSymbol = false
+			continue
+		}
+
+		ch := formula[i]
+		switch {
+		case ch == '^':
+			charge, next := parseChemCharge(formula, i+1)
+			if sup := TryMakeSuperscript(charge); sup != "" {
+				result.WriteString(sup)
+			} else {
+				result.WriteString("^" + charge)
+			}
+			i = next
+			afterSymbol = false
+
+		case ch >= '0' && ch <= '9' && afterSymbol:
+			start := i
+			for i < len(formula) && formula[i] >= '0' && formula[i] <= '9' {
+				i++
+			}
+			result.WriteString(TryMakeSubscript(formula[start:i]))
+
+		case ch == '{' || ch == '}':
+			// 分组括号只用于消歧，输出时去掉
+			i++
+
+		default:
+			r, size := utf8.DecodeRuneInString(formula[i:])
+			result.WriteString(formula[i : i+size])
+			i += size
+			afterSymbol = unicode.IsLetter(r) || r == ')' || r == ']'
+		}
+	}
+	return result.String()
+}
+
+// matchChemArrow 返回 s 开头的箭头及其长度，没有箭头时长度为 0
+func matchChemArrow(s string) (string, int) {
+	for _, arrow := range chemArrows {
+		if strings.HasPrefix(s, arrow.from) {
+			return arrow.to, len(arrow.from)
+		}
+	}
+	return "", 0
+}
+
+// parseChemCharge 读取 ^ 之后的电荷：{...} 分组，或者连续的数字加一个正负号
+func parseChemCharge(formula string, start int) (string, int) {
+	if start < len(formula) && formula[start] == '{' {
+		end := strings.IndexByte(formula[start:], '}')
+		if end < 0 {
+			return formula[start+1:], len(formula)
+		}
+		return formula[start+1 : start+end], start + end + 1
+	}
+	i := start
+	for i < len(formula) && formula[i] >= '0' && formula[i] <= '9' {
+		i++
+	}
+	if i < len(formula) && (formula[i] == '+' || formula[i] == '-') {
+		i++
+	}
+	return formula[start:i], i
+}
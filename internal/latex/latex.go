@@ -10,27 +10,133 @@ var (
 	latexInlineRegex     = regexp.MustCompile(`\\\((.*?)\\\)`)
 )
 
-// ContainsLatexSymbols 检查内容是否包含 LaTeX 符号
-func ContainsLatexSymbols(content string) bool {
-	if len(content) < 5 {
-		return false
+// latexSymbolMatcher 由符号表在初始化时一次性构建，
+// 用一次扫描判断内容是否包含任意已知的 LaTeX 命令或符号
+var latexSymbolMatcher = buildLatexSymbolMatcher()
+
+// parserCommands 是解析器按名称单独处理、不在各符号表中的命令
+var parserCommands = []string{
+	`\binom`, `\dbinom`, `\tbinom`, `\boxed`, `\color`, `\not`, `\pmod`,
+	`\phantom`, `\hphantom`, `\vphantom`, `\left`, `\right`,
+	`\overbrace`, `\underbrace`, `\overset`, `\underset`, `\stackrel`, `\substack`,
+	`\xleftarrow`, `\xrightarrow`, `\label`, `\tag`, `\ref`, `\eqref`,
+}
+
+func buildLatexSymbolMatcher() *symbolMatcher {
+	keys := []string{`\sqrt`, `\begin`, `\ce{`, `\middle`, `\\`}
+	keys = append(keys, parserCommands...)
+	for key := range fracCommands {
+		keys = append(keys, key)
 	}
-	// 检查常见 LaTeX 命令
-	patterns := []string{`\frac`, `\sqrt`, `\begin`}
-	for _, pattern := range patterns {
-		if strings.Contains(content, pattern) {
-			return true
+	for key := range sizeDelimiters {
+		keys = append(keys, key)
+	}
+	for key := range LatexSymbols {
+		keys = append(keys, key)
+	}
+	for key := range NotMap {
+		keys = append(keys, key)
+	}
+	for key := range LatexStyles {
+		keys = append(keys, key)
+	}
+	for key := range Combining {
+		keys = append(keys, key)
+	}
+	return newSymbolMatcher(keys)
+}
+
+// symbolMatcher 是按字节构建的 Aho–Corasick 自动机，只回答“是否包含”
+type symbolMatcher struct {
+	nodes []matcherNode
+}
+
+type matcherNode struct {
+	next map[byte]int32
+	fail int32
+	out  bool
+}
+
+func newSymbolMatcher(keys []string) *symbolMatcher {
+	m := &symbolMatcher{nodes: []matcherNode{{next: map[byte]int32{}}}}
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		state := int32(0)
+		for i := 0; i < len(key); i++ {
+			next, ok := m.nodes[state].next[key[i]]
+			if !ok {
+				next = int32(len(m.nodes))
+				m.nodes = append(m.nodes, matcherNode{next: map[byte]int32{}})
+				m.nodes[state].next[key[i]] = next
+			}
+			state = next
 		}
+		m.nodes[state].out = true
+	}
+
+	// 按层次计算失败指针
+	queue := make([]int32, 0, len(m.nodes))
+	for _, child := range m.nodes[0].next {
+		queue = append(queue, child)
 	}
-	// 检查符号表中的符号
-	for cmd := range LatexSymbols {
-		if len(cmd) > 2 && strings.Contains(content, cmd) {
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for c, child := range m.nodes[state].next {
+			fail := m.nodes[state].fail
+			for {
+				if next, ok := m.nodes[fail].next[c]; ok {
+					m.nodes[child].fail = next
+					break
+				}
+				if fail == 0 {
+					break
+				}
+				fail = m.nodes[fail].fail
+			}
+			if m.nodes[m.nodes[child].fail].out {
+				m.nodes[child].out = true
+			}
+			queue = append(queue, child)
+		}
+	}
+	return m
+}
+
+// MatchString 报告 s 是否包含任意一个关键字
+func (m *symbolMatcher) MatchString(s string) bool {
+	state := int32(0)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		for {
+			if next, ok := m.nodes[state].next[c]; ok {
+				state = next
+				break
+			}
+			if state == 0 {
+				break
+			}
+			state = m.nodes[state].fail
+		}
+		if m.nodes[state].out {
 			return true
 		}
 	}
 	return false
 }
 
+// ContainsLatexSymbols 检查内容是否包含 LaTeX 符号
+//
+// 少于 5 字节的内容一律视为不含符号。
+func ContainsLatexSymbols(content string) bool {
+	if len(content) < 5 {
+		return false
+	}
+	return latexSymbolMatcher.MatchString(content)
+}
+
 // EscapeLaTeX 预处理 LaTeX \[...\] 和 \(...\) 块转为 Unicode
 func EscapeLaTeX(text string) string {
 	parser := NewParser()
@@ -0,0 +1,140 @@
+package latex
+
+import (
+	"strings"
+	"testing"
+)
+
+// containsLatexSymbolsNaive 是原先逐个 strings.Contains 的实现，作为对照
+func containsLatexSymbolsNaive(content string) bool {
+	if len(content) < 5 {
+		return false
+	}
+	for _, sym := range []string{`\frac`, `\dfrac`, `\tfrac`, `\cfrac`, `\sqrt`, `\begin`, `\ce{`, `\middle`, `\\`} {
+		if strings.Contains(content, sym) {
+			return true
+		}
+	}
+	for _, sym := range parserCommands {
+		if strings.Contains(content, sym) {
+			return true
+		}
+	}
+	for key := range sizeDelimiters {
+		if strings.Contains(content, key) {
+			return true
+		}
+	}
+	for key := range LatexSymbols {
+		if strings.Contains(content, key) {
+			return true
+		}
+	}
+	for key := range NotMap {
+		if strings.Contains(content, key) {
+			return true
+		}
+	}
+	for key := range LatexStyles {
+		if strings.Contains(content, key) {
+			return true
+		}
+	}
+	for key := range Combining {
+		if strings.Contains(content, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// TestContainsLatexSymbols_MatchesNaive 测试新实现与原实现结果一致
+func TestContainsLatexSymbols_MatchesNaive(t *testing.T) {
+	samples := []string{
+		"",
+		"x^2",
+		"see the docs here",
+		"plain English words",
+		`\frac{1}{2}`,
+		`\dfrac{a}{b}`,
+		`\ce{H2O}`,
+		`\sqrt{x} + y`,
+		`\begin{matrix} a \end{matrix}`,
+		`a \\alpha b`,
+		`x \\leq y`,
+		`\\mathbb{R} set`,
+		"a ∈ b and c",
+		"well-known fact",
+		"cost ~ 5 dollars",
+		"1,2,3,4,5",
+		`\bigl( x \bigr)`,
+		`a \middle| b`,
+		`a \\ b`,
+		`\eqref{eq:1}`,
+		`\not\exists`,
+		`x \xrightarrow{f} y`,
+	}
+	i := 0
+	for key := range LatexSymbols {
+		samples = append(samples, "abc "+key+" def", key)
+		if i++; i > 200 {
+			break
+		}
+	}
+	for key := range LatexStyles {
+		samples = append(samples, key+"{x}")
+	}
+	for key := range NotMap {
+		samples = append(samples, "x "+key+" y")
+	}
+	for key := range Combining {
+		samples = append(samples, key+"{v}")
+	}
+
+	for _, s := range samples {
+		if got, want := ContainsLatexSymbols(s), containsLatexSymbolsNaive(s); got != want {
+			t.Errorf("ContainsLatexSymbols(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
+
+// TestContainsLatexSymbols_Short 测试少于 5 字节的内容总是返回 false
+func TestContainsLatexSymbols_Short(t *testing.T) {
+	for _, s := range []string{`\pi`, "a-b", "∈∈"[:3]} {
+		if ContainsLatexSymbols(s) {
+			t.Errorf("ContainsLatexSymbols(%q) = true, want false", s)
+		}
+	}
+}
+
+func manyInlineSpans() string {
+	var sb strings.Builder
+	for i := 0; i < 1000; i++ {
+		sb.WriteString(`text \(x^2 + \frac{1}{2}\) and \(some words here\) `)
+	}
+	return sb.String()
+}
+
+// BenchmarkContainsLatexSymbols 1000 个行内公式
+func BenchmarkContainsLatexSymbols(b *testing.B) {
+	spans := strings.Split(manyInlineSpans(), `\(`)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, s := range spans {
+			ContainsLatexSymbols(s)
+		}
+	}
+}
+
+// BenchmarkContainsLatexSymbols_Naive 原实现的对照
+func BenchmarkContainsLatexSymbols_Naive(b *testing.B) {
+	spans := strings.Split(manyInlineSpans(), `\(`)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, s := range spans {
+			containsLatexSymbolsNaive(s)
+		}
+	}
+}
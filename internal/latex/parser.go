@@ -1,9 +1,11 @@
 package latex
 
 import (
+	"fmt"
 	"regexp"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 // Parser 递归下降 LaTeX→Unicode 转换引擎
@@ -13,7 +15,22 @@ import (
 // 2. 鲁棒降级 — 未知命令返回原文，不崩溃
 // 3. 标准 LaTeX 语法 — 可选参数用 [...]
 // 4. Unicode 优先 — 尽量用 Unicode，无法表示时用可读 ASCII 近似
-type Parser struct{}
+type Parser struct {
+	// UnknownCommands 控制未知命令的输出方式，默认原样保留
+	UnknownCommands UnknownCommandMode
+}
+
+// UnknownCommandMode 未知命令的处理方式
+type UnknownCommandMode int
+
+const (
+	// UnknownKeep 原样输出命令文本（如 \foobar），便于排查
+	UnknownKeep UnknownCommandMode = iota
+	// UnknownStrip 去掉反斜杠，只输出命令名
+	UnknownStrip
+	// UnknownDrop 丢弃命令，连同紧跟其后的一个 {...} 参数
+	UnknownDrop
+)
 
 // NewParser 创建新的 LaTeX 解析器
 func NewParser() *Parser {
@@ -38,6 +55,9 @@ func TranslateCombining(command, text string) string {
 	if len(runes) == 0 {
 		return text
 	}
+	if sample.MaxLen > 0 && sample.Fallback != "" && graphemeCount(strings.TrimSpace(text)) > sample.MaxLen {
+		return fmt.Sprintf(sample.Fallback, strings.TrimSpace(text))
+	}
 	
 	switch combiningType {
 	case FirstChar:
@@ -55,9 +75,13 @@ func TranslateCombining(command, text string) string {
 		return text + string(combiningChar)
 		
 	case AllChars:
+		// 应用到每个字符之后（在其已有的组合字符之后），跳过空白
 		var result strings.Builder
-		for _, r := range runes {
+		for i, r := range runes {
 			result.WriteRune(r)
+			if unicode.IsSpace(r) || (i+1 < len(runes) && isCombiningChar(runes[i+1])) {
+				continue
+			}
 			result.WriteRune(combiningChar)
 		}
 		return result.String()
@@ -66,6 +90,18 @@ func TranslateCombining(command, text string) string {
 	return text
 }
 
+// graphemeCount 粗略统计字形数量：组合字符、变体选择符和零宽连接符不单独计数
+func graphemeCount(text string) int {
+	count := 0
+	for _, r := range text {
+		if isCombiningChar(r) || r == '\u200d' || (r >= '\ufe00' && r <= '\ufe0f') {
+			continue
+		}
+		count++
+	}
+	return count
+}
+
 // MakeNot 生成带否定符号的字符
 func MakeNot(negated string) string {
 	trimmed := strings.TrimSpace(negated)
@@ -186,6 +222,10 @@ func TranslateStyles(command, text string) string {
 }
 
 // MakeSqrt 生成根号的 Unicode 表示
+//
+// 被开方数不加上划线：组合上划线只能逐个字符叠加，只加在第一个字符上会改变含义，
+// 全部加上又难以阅读。单个字符或数字直接跟在根号后，其余加括号，
+// 如 \sqrt{a^2 + b^2} → √(a² + b²)
 func MakeSqrt(index, radicand string) string {
 	var radix string
 	switch index {
@@ -203,7 +243,27 @@ func MakeSqrt(index, radicand string) string {
 			radix = "(" + index + ")√"
 		}
 	}
-	return radix + TranslateCombining("\\overline", radicand)
+	if !sqrtAtom(radicand) {
+		radicand = "(" + radicand + ")"
+	}
+	return radix + radicand
+}
+
+// sqrtAtom 报告被开方数是否无需括号：数字、单个字符（可带组合符），或已在括号中
+func sqrtAtom(radicand string) bool {
+	if radicand == "" || strings.Trim(radicand, "0123456789.") == "" {
+		return true
+	}
+	if strings.HasPrefix(radicand, "(") && strings.HasSuffix(radicand, ")") && strings.Count(radicand, "(") == 1 {
+		return true
+	}
+	chars := 0
+	for _, r := range radicand {
+		if !unicode.Is(unicode.Mn, r) {
+			chars++
+		}
+	}
+	return chars == 1
 }
 
 // TranslateSqrt 翻译 \sqrt 命令
@@ -214,21 +274,60 @@ func TranslateSqrt(command, option, param string) string {
 	return MakeSqrt(strings.TrimSpace(option), strings.TrimSpace(param))
 }
 
+// fracCommands \frac 及其显示尺寸变体，转换结果相同
+var fracCommands = map[string]bool{
+	"\\frac": true, "\\dfrac": true, "\\tfrac": true, "\\cfrac": true,
+}
+
 // MakeFraction 生成分数的 Unicode 表示
+//
+// 含有内层分数（即含 /）或运算符的分子、分母会加括号，
+// 例如 \frac{1}{1+\frac{1}{x}} → 1/(1+1/x)。
 func MakeFraction(numerator, denominator string) string {
 	n, d := strings.TrimSpace(numerator), strings.TrimSpace(denominator)
 	if n == "" && d == "" {
 		return ""
 	}
-	key := [2]string{n, d}
+	// 操作数可能已被转换为上下标数字，查表前先还原
+	key := [2]string{plainDigits(n), plainDigits(d)}
 	if frac, ok := FracMap[key]; ok {
 		return frac
 	}
 	return maybeParenthesize(n) + "/" + maybeParenthesize(d)
 }
 
-// maybeParenthesize adds parentheses if text contains special characters.
+// plainDigits 将完全由上标或下标数字组成的文本还原为 ASCII 数字，其他文本原样返回
+func plainDigits(text string) string {
+	var result strings.Builder
+	for _, r := range text {
+		switch {
+		case r >= '0' && r <= '9':
+			result.WriteRune(r)
+		case r >= '₀' && r <= '₉':
+			result.WriteRune('0' + (r - '₀'))
+		case r >= '⁴' && r <= '⁹':
+			result.WriteRune('4' + (r - '⁴'))
+		case r == '⁰':
+			result.WriteRune('0')
+		case r == '¹':
+			result.WriteRune('1')
+		case r == '²':
+			result.WriteRune('2')
+		case r == '³':
+			result.WriteRune('3')
+		default:
+			return text
+		}
+	}
+	return result.String()
+}
+
+// maybeParenthesize adds parentheses if text contains special characters,
+// unless it is already wrapped in a single matching pair.
 func maybeParenthesize(text string) string {
+	if isParenthesized(text) {
+		return text
+	}
 	for _, r := range text {
 		if !unicode.IsLetter(r) && !unicode.IsNumber(r) && !isCombiningChar(r) && r != '_' {
 			return "(" + text + ")"
@@ -237,6 +336,26 @@ func maybeParenthesize(text string) string {
 	return text
 }
 
+// isParenthesized reports whether text is one balanced (...) group.
+func isParenthesized(text string) bool {
+	if len(text) < 2 || text[0] != '(' || text[len(text)-1] != ')' {
+		return false
+	}
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 && i != len(text)-1 {
+				return false
+			}
+		}
+	}
+	return depth == 0
+}
+
 // isCombiningChar returns true if the rune is a Unicode combining character.
 func isCombiningChar(r rune) bool {
 	return (r >= '\u0300' && r <= '\u036F') ||
@@ -248,7 +367,7 @@ func isCombiningChar(r rune) bool {
 
 // TranslateFrac 翻译 \frac 命令
 func TranslateFrac(command, numerator, denominator string) string {
-	if command != "\\frac" {
+	if !fracCommands[command] {
 		return command
 	}
 	return MakeFraction(numerator, denominator)
@@ -275,13 +394,17 @@ func (p *Parser) Parse(latex string) string {
 		if latex[i] == '\\' {
 			command, newIdx := p.parseCommand(latex, i)
 			// 混合分数格式（数字后紧跟 \frac）
-			if command == "\\frac" && len(result) > 0 && len(result[len(result)-1]) > 0 {
+			if fracCommands[command] && len(result) > 0 && len(result[len(result)-1]) > 0 {
 				lastChar := result[len(result)-1][len(result[len(result)-1])-1]
 				if lastChar >= '0' && lastChar <= '9' {
 					result[len(result)-1] += " "
 				}
 			}
 			handled, newIdx := p.handleCommand(command, latex, newIdx)
+			if command == "\\tag" {
+				// 编号紧跟在本行内容之后，去掉前面多余的空白
+				result = trimTrailingSpaces(result)
+			}
 			result = append(result, handled)
 			i = newIdx
 			
@@ -299,7 +422,7 @@ func (p *Parser) Parse(latex string) string {
 				arg, i = p.parseBlock(latex, i)
 			} else if i < len(latex) && latex[i] == '\\' {
 				command, newIdx := p.parseCommand(latex, i)
-				if command == "\\frac" && len(result) > 0 && len(result[len(result)-1]) > 0 {
+				if fracCommands[command] && len(result) > 0 && len(result[len(result)-1]) > 0 {
 					lastChar := result[len(result)-1][len(result[len(result)-1])-1]
 					if lastChar >= '0' && lastChar <= '9' {
 						result[len(result)-1] += " "
@@ -307,8 +430,9 @@ func (p *Parser) Parse(latex string) string {
 				}
 				arg, i = p.handleCommand(command, latex, newIdx)
 			} else if i < len(latex) {
-				arg = string(latex[i])
-				i++
+				ch, size := nextChar(latex, i)
+				arg = ch
+				i += size
 			}
 			
 			if sym == '_' {
@@ -317,25 +441,49 @@ func (p *Parser) Parse(latex string) string {
 				result = append(result, MakeSuperscript(arg))
 			}
 			
-		} else if unicode.IsSpace(rune(latex[i])) {
+		} else if r, _ := utf8.DecodeRuneInString(latex[i:]); unicode.IsSpace(r) {
 			spaces, newIdx := p.parseSpaces(latex, i)
 			result = append(result, spaces)
 			i = newIdx
-			
-		} else {
-			result = append(result, string(latex[i]))
+
+		} else if latex[i] == '~' {
+			// ~ 是不换行空格
+			result = append(result, LatexSymbols["~"])
 			i++
+
+		} else {
+			ch, size := nextChar(latex, i)
+			result = append(result, ch)
+			i += size
 		}
 	}
 	
 	return strings.Join(result, "")
 }
 
+// trimTrailingSpaces 去掉已输出片段末尾的空格
+func trimTrailingSpaces(result []string) []string {
+	for len(result) > 0 {
+		last := strings.TrimRight(result[len(result)-1], " ")
+		if last != "" {
+			result[len(result)-1] = last
+			break
+		}
+		result = result[:len(result)-1]
+	}
+	return result
+}
+
 // ──────────────────────────────────────────────
 // 命令分派（有序优先级）
 // ──────────────────────────────────────────────
 
 func (p *Parser) handleCommand(command, latex string, index int) (string, int) {
+	// 0. 大型运算符及其上下限（\sum_{i=1}^{n}、\lim_{x\to 0} 等）
+	if bigOperators[command] {
+		return p.parseBigOperator(command, latex, index)
+	}
+	
 	// 1. 符号表直查（最常见路径）
 	if _, ok := LatexSymbols[command]; ok {
 		return TranslateEscape(command), index
@@ -352,7 +500,8 @@ func (p *Parser) handleCommand(command, latex string, index int) (string, int) {
 				}
 				return MakeNot(symbol), nextIdx
 			}
-			return MakeNot(string(latex[index])), index + 1
+			ch, size := nextChar(latex, index)
+			return MakeNot(ch), index + size
 		}
 		return "\u0338", index
 	}
@@ -363,13 +512,42 @@ func (p *Parser) handleCommand(command, latex string, index int) (string, int) {
 		return TranslateCombining(command, arg), newIdx
 	}
 	
-	// 4. \frac{num}{den}
-	if command == "\\frac" {
+	// 4. \frac{num}{den}（含 \dfrac、\tfrac、\cfrac）
+	if fracCommands[command] {
 		numer, idx1 := p.parseBlock(latex, index)
 		denom, idx2 := p.parseBlock(latex, idx1)
 		return MakeFraction(numer, denom), idx2
 	}
 	
+	// 4.1 \ce{...} 化学式（mhchem），内容按原文处理
+	if command == "\\ce" {
+		formula, newIdx := p.parseRawBlock(latex, index)
+		return TranslateChem(formula), newIdx
+	}
+	
+	// 4.2 公式编号与交叉引用：\label 静默忽略，\tag 输出 (n)，\ref / \eqref 输出标签文本
+	if command == "\\label" {
+		_, newIdx := p.parseRawBlock(latex, index)
+		return "", newIdx
+	}
+	if command == "\\tag" {
+		if index < len(latex) && latex[index] == '*' {
+			index++ // \tag* 不加括号
+			text, newIdx := p.parseBlock(latex, index)
+			return "  " + strings.TrimSpace(text), newIdx
+		}
+		text, newIdx := p.parseBlock(latex, index)
+		return "  (" + strings.TrimSpace(text) + ")", newIdx
+	}
+	if command == "\\ref" {
+		label, newIdx := p.parseRawBlock(latex, index)
+		return strings.TrimSpace(label), newIdx
+	}
+	if command == "\\eqref" {
+		label, newIdx := p.parseRawBlock(latex, index)
+		return "(" + strings.TrimSpace(label) + ")", newIdx
+	}
+	
 	// 5. \sqrt[n]{x} — 可选参数用 []
 	if command == "\\sqrt" {
 		option, idx1 := p.parseOptional(latex, index)
@@ -393,9 +571,9 @@ func (p *Parser) handleCommand(command, latex string, index int) (string, int) {
 		return text, newIdx
 	}
 	
-	// 8. \left / \right 定界符
-	if command == "\\left" || command == "\\right" {
-		delim, newIdx := p.parseDelimiter(latex, index)
+	// 8. \left / \middle / \right 定界符，以及 \bigl( 等尺寸修饰，只保留定界符本身
+	if command == "\\left" || command == "\\right" || command == "\\middle" || sizeDelimiters[command] {
+		delim, newIdx := p.parseDelimiter(latex, skipSpaces(latex, index))
 		return delim, newIdx
 	}
 	
@@ -421,7 +599,7 @@ func (p *Parser) handleCommand(command, latex string, index int) (string, int) {
 	// 12. \phantom / \hphantom / \vphantom — 等宽空白
 	if command == "\\phantom" || command == "\\hphantom" || command == "\\vphantom" {
 		text, newIdx := p.parseBlock(latex, index)
-		length := len(text)
+		length := utf8.RuneCountInString(text)
 		if length < 1 {
 			length = 1
 		}
@@ -528,16 +706,121 @@ func (p *Parser) handleCommand(command, latex string, index int) (string, int) {
 		return "", newIdx
 	}
 	
-	// 22. 兜底：返回原始命令文本
+	// 22. 兜底：按 UnknownCommands 处理未知命令
+	return p.unknownCommand(command, latex, index)
+}
+
+// unknownCommand 处理未知命令
+//
+// 丢弃模式只吃掉紧贴命令的 {...}，中间有空格的花括号属于后面的内容，不能一起丢掉。
+func (p *Parser) unknownCommand(command, latex string, index int) (string, int) {
+	switch p.UnknownCommands {
+	case UnknownStrip:
+		return strings.TrimPrefix(command, "\\"), index
+	case UnknownDrop:
+		if index < len(latex) && latex[index] == '{' {
+			_, index = p.parseRawBlock(latex, index)
+		}
+		return "", index
+	}
 	return command, index
 }
 
+// ──────────────────────────────────────────────
+// 大型运算符
+// ──────────────────────────────────────────────
+
+// bigOperators 可以带上下限的运算符
+var bigOperators = map[string]bool{
+	"\\sum": true, "\\prod": true, "\\coprod": true,
+	"\\int": true, "\\iint": true, "\\iiint": true, "\\oint": true,
+	"\\bigcup": true, "\\bigcap": true, "\\bigoplus": true, "\\bigotimes": true,
+	"\\bigodot": true, "\\biguplus": true, "\\bigsqcup": true,
+	"\\bigvee": true, "\\bigwedge": true,
+	"\\lim": true, "\\limsup": true, "\\liminf": true,
+	"\\max": true, "\\min": true, "\\sup": true, "\\inf": true,
+}
+
+// sizeDelimiters 定界符尺寸修饰命令，纯文本中无法表达尺寸，直接忽略
+var sizeDelimiters = map[string]bool{
+	"\\big": true, "\\Big": true, "\\bigg": true, "\\Bigg": true,
+	"\\bigl": true, "\\Bigl": true, "\\biggl": true, "\\Biggl": true,
+	"\\bigr": true, "\\Bigr": true, "\\biggr": true, "\\Biggr": true,
+	"\\bigm": true, "\\Bigm": true, "\\biggm": true, "\\Biggm": true,
+}
+
+// parseBigOperator 解析运算符后的 \limits / \nolimits 和上下限
+//
+// 上下限都能完整转为 Unicode 上下标时输出 ∑ᵢ₌₁ⁿ，否则输出 ∑[i=1..n]。
+func (p *Parser) parseBigOperator(command, latex string, index int) (string, int) {
+	op := TranslateEscape(command)
+	var lower, upper string
+	hasLower, hasUpper := false, false
+	
+	for {
+		next := skipSpaces(latex, index)
+		if next >= len(latex) {
+			break
+		}
+		if latex[next] == '\\' {
+			cmd, idx := p.parseCommand(latex, next)
+			if cmd != "\\limits" && cmd != "\\nolimits" {
+				break
+			}
+			index = idx
+			continue
+		}
+		if latex[next] == '_' && !hasLower {
+			lower, index = p.parseBlock(latex, skipSpaces(latex, next+1))
+			hasLower = true
+			continue
+		}
+		if latex[next] == '^' && !hasUpper {
+			upper, index = p.parseBlock(latex, skipSpaces(latex, next+1))
+			hasUpper = true
+			continue
+		}
+		break
+	}
+	// 上下限写得紧凑些：lim[x→0] 而不是 lim[x→ 0]
+	lower = strings.Join(strings.Fields(lower), "")
+	upper = strings.Join(strings.Fields(upper), "")
+	if lower == "" && upper == "" {
+		return op, index
+	}
+	
+	sub, sup := TryMakeSubscript(lower), TryMakeSuperscript(upper)
+	if (lower == "" || sub != "") && (upper == "" || sup != "") {
+		return op + sub + sup, index
+	}
+	if upper == "" {
+		return op + "[" + lower + "]", index
+	}
+	return op + "[" + lower + ".." + upper + "]", index
+}
+
+// skipSpaces 返回 index 之后第一个非 ASCII 空白的位置
+func skipSpaces(latex string, index int) int {
+	for index < len(latex) && (latex[index] == ' ' || latex[index] == '\t' || latex[index] == '\n') {
+		index++
+	}
+	return index
+}
+
 // ──────────────────────────────────────────────
 // 底层解析方法
 // ──────────────────────────────────────────────
 
 var commandRegex = regexp.MustCompile(`^\\([a-zA-Z]+|.)`)
 
+// nextChar 返回 latex[i:] 开头的完整字符及其字节长度
+//
+// 所有按“单个字符”读取的位置都必须经过这里，否则多字节字符会被从中间截断。
+func nextChar(latex string, i int) (string, int) {
+	_, size := utf8.DecodeRuneInString(latex[i:])
+	return latex[i : i+size], size
+}
+
 func (p *Parser) parseCommand(latex string, start int) (string, int) {
 	match := commandRegex.FindStringSubmatch(latex[start:])
 	if match != nil {
@@ -556,7 +839,8 @@ func (p *Parser) parseBlock(latex string, start int) (string, int) {
 			cmd, newIdx := p.parseCommand(latex, start)
 			return p.handleCommand(cmd, latex, newIdx)
 		}
-		return string(latex[start]), start + 1
+		ch, size := nextChar(latex, start)
+		return ch, start + size
 	}
 	
 	// 标准 {...} 块解析
@@ -569,9 +853,34 @@ func (p *Parser) parseBlock(latex string, start int) (string, int) {
 		}
 		pos++
 	}
+	if level > 0 {
+		// 没有闭合的块延续到末尾，不能丢掉最后一个字节
+		return p.Parse(latex[start+1:]), pos
+	}
 	return p.Parse(latex[start+1 : pos-1]), pos
 }
 
+// parseRawBlock 与 parseBlock 相同，但返回未经解析的块内容
+func (p *Parser) parseRawBlock(latex string, start int) (string, int) {
+	start = skipSpaces(latex, start)
+	if start >= len(latex) || latex[start] != '{' {
+		return "", start
+	}
+	level, pos := 1, start+1
+	for pos < len(latex) && level > 0 {
+		if latex[pos] == '{' {
+			level++
+		} else if latex[pos] == '}' {
+			level--
+		}
+		pos++
+	}
+	if level > 0 {
+		return latex[start+1:], pos
+	}
+	return latex[start+1 : pos-1], pos
+}
+
 func (p *Parser) parseOptional(latex string, start int) (string, int) {
 	if start >= len(latex) || latex[start] != '[' {
 		return "", start
@@ -585,17 +894,24 @@ func (p *Parser) parseOptional(latex string, start int) (string, int) {
 		}
 		pos++
 	}
+	if level > 0 {
+		return p.Parse(latex[start+1:]), pos
+	}
 	return p.Parse(latex[start+1 : pos-1]), pos
 }
 
 func (p *Parser) parseSpaces(latex string, start int) (string, int) {
 	end := start
 	hasNewline := false
-	for end < len(latex) && unicode.IsSpace(rune(latex[end])) {
-		if latex[end] == '\n' {
+	for end < len(latex) {
+		r, size := utf8.DecodeRuneInString(latex[end:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		if r == '\n' {
 			hasNewline = true
 		}
-		end++
+		end += size
 	}
 	if hasNewline {
 		return "\n\n", end
@@ -627,7 +943,8 @@ func (p *Parser) parseDelimiter(latex string, index int) (string, int) {
 	if ch == '.' {
 		return "", index + 1 // 不可见定界符
 	}
-	return string(ch), index + 1
+	delim, size := nextChar(latex, index)
+	return delim, index + size
 }
 
 // ──────────────────────────────────────────────
@@ -666,11 +983,15 @@ var matrixTypes = map[string][2]string{
 
 // align 类环境
 var alignTypes = map[string]bool{
-	"align": true, "aligned": true, "gather": true, "gathered": true,
+	"align": true, "align*": true, "aligned": true, "gather": true, "gather*": true, "gathered": true,
+	"alignat": true, "alignat*": true, "alignedat": true,
 	"equation": true, "equation*": true, "multline": true, "multline*": true,
 	"split": true, "flalign": true, "flalign*": true,
 }
 
+// alignPad 是对齐补位用的不换行空格，Markdown 段落不会去掉行首的不换行空格
+const alignPad = "\u00a0"
+
 func (p *Parser) renderEnvironment(envName, content string) string {
 	if delims, ok := matrixTypes[envName]; ok {
 		compact := (envName == "smallmatrix")
@@ -680,6 +1001,14 @@ func (p *Parser) renderEnvironment(envName, content string) string {
 		return p.renderCases(content)
 	}
 	if alignTypes[envName] {
+		// alignat 的第一个 {} 是列数
+		if envName == "alignat" || envName == "alignat*" || envName == "alignedat" {
+			if stripped := strings.TrimSpace(content); strings.HasPrefix(stripped, "{") {
+				if close := strings.IndexByte(stripped, '}'); close != -1 {
+					content = stripped[close+1:]
+				}
+			}
+		}
 		return p.renderAlign(content)
 	}
 	if envName == "array" {
@@ -761,31 +1090,227 @@ func (p *Parser) renderCases(content string) string {
 	return strings.Join(lines, "\n")
 }
 
+// renderAlign 渲染 align 类环境
+//
+// 每行在第一个 & 处分成左右两部分，左列用 alignPad 按最大显示宽度右对齐，
+// 使等号在等宽字体下对齐；之后的 & 视为列分隔，输出两个空格。
 func (p *Parser) renderAlign(content string) string {
-	rows := strings.Split(content, "\\\\")
-	var rendered []string
-	for _, row := range rows {
+	type alignRow struct {
+		left, right string
+	}
+	var rows []alignRow
+	leftWidth := 0
+	for _, row := range strings.Split(content, "\\\\") {
 		trimmed := strings.TrimSpace(row)
 		if trimmed == "" {
 			continue
 		}
-		// 移除 & 符号
-		cleaned := strings.ReplaceAll(trimmed, "&", " ")
-		rendered = append(rendered, p.Parse(cleaned))
+		cells := splitCells(trimmed)
+		left := strings.TrimSpace(p.Parse(strings.TrimSpace(cells[0])))
+		var rest []string
+		for _, cell := range cells[1:] {
+			if parsed := strings.TrimSpace(p.Parse(strings.TrimSpace(cell))); parsed != "" {
+				rest = append(rest, parsed)
+			}
+		}
+		rows = append(rows, alignRow{left: left, right: strings.Join(rest, "  ")})
+		if w := displayWidth(left); w > leftWidth {
+			leftWidth = w
+		}
+	}
+	
+	rendered := make([]string, 0, len(rows))
+	for _, row := range rows {
+		line := strings.Repeat(alignPad, leftWidth-displayWidth(row.left)) + row.left
+		if row.right != "" {
+			if leftWidth > 0 {
+				line += " "
+			}
+			line += row.right
+		}
+		rendered = append(rendered, line)
 	}
 	return strings.Join(rendered, "\n")
 }
 
+// splitCells 按 & 拆分一行，跳过转义的 \&
+func splitCells(row string) []string {
+	var cells []string
+	start := 0
+	for i := 0; i < len(row); i++ {
+		if row[i] == '\\' {
+			i++
+			continue
+		}
+		if row[i] == '&' {
+			cells = append(cells, row[start:i])
+			start = i + 1
+		}
+	}
+	return append(cells, row[start:])
+}
+
+// displayWidth 估算文本在等宽字体下的显示宽度：组合字符不占宽度，CJK 字符占两格
+func displayWidth(text string) int {
+	width := 0
+	for _, r := range text {
+		switch {
+		case isCombiningChar(r):
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			width += 2
+		default:
+			width++
+		}
+	}
+	return width
+}
+
+// arraySpec array 环境的列格式：每列的对齐方式，以及各列边界是否有竖线
+type arraySpec struct {
+	align []byte // 'l'、'c'、'r'
+	bars  []bool // len(align)+1 个边界，bars[i] 表示第 i 列左侧有竖线
+}
+
+// parseArraySpec 解析 {|l|c|r|} 形式的列格式，p{..}、@{..} 等按左对齐处理
+func parseArraySpec(spec string) arraySpec {
+	result := arraySpec{bars: []bool{false}}
+	for i := 0; i < len(spec); i++ {
+		switch ch := spec[i]; ch {
+		case '|':
+			result.bars[len(result.bars)-1] = true
+		case 'l', 'c', 'r':
+			result.align = append(result.align, ch)
+			result.bars = append(result.bars, false)
+		case 'p', 'm', 'b':
+			result.align = append(result.align, 'l')
+			result.bars = append(result.bars, false)
+			fallthrough
+		case '@', '!', '>', '<':
+			// 跳过附带的 {...} 参数
+			if i+1 < len(spec) && spec[i+1] == '{' {
+				if close := strings.IndexByte(spec[i:], '}'); close != -1 {
+					i += close
+				}
+			}
+		}
+	}
+	return result
+}
+
+// renderArray 渲染 array 环境
+//
+// 按列格式对齐单元格，| 渲染为 │，\hline 渲染为与行同宽的横线。
 func (p *Parser) renderArray(content string) string {
-	// array 第一个 {} 是列格式说明（如 {ccc}），跳过
+	// array 第一个 {} 是列格式说明（如 {|c|c|}）
+	var spec arraySpec
 	stripped := strings.TrimSpace(content)
 	if strings.HasPrefix(stripped, "{") {
 		close := strings.IndexByte(stripped, '}')
 		if close != -1 {
+			spec = parseArraySpec(stripped[1:close])
 			content = stripped[close+1:]
 		}
 	}
-	return p.renderMatrix(content, "", "", false)
+	
+	// rows 中 nil 表示 \hline
+	var rows [][]string
+	columns := 0
+	for _, row := range strings.Split(content, "\\\\") {
+		trimmed := strings.TrimSpace(row)
+		for strings.HasPrefix(trimmed, "\\hline") {
+			rows = append(rows, nil)
+			trimmed = strings.TrimSpace(trimmed[len("\\hline"):])
+		}
+		if trimmed == "" {
+			continue
+		}
+		var cells []string
+		for _, cell := range splitCells(trimmed) {
+			cells = append(cells, strings.TrimSpace(p.Parse(strings.TrimSpace(cell))))
+		}
+		rows = append(rows, cells)
+		if len(cells) > columns {
+			columns = len(cells)
+		}
+	}
+	
+	widths := make([]int, columns)
+	for _, cells := range rows {
+		for i, cell := range cells {
+			if w := displayWidth(cell); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+	// 先渲染数据行，横线的长度取决于最宽的一行
+	rendered := make([]string, len(rows))
+	rowWidth := 0
+	for i, cells := range rows {
+		if cells == nil {
+			continue
+		}
+		rendered[i] = renderArrayRow(cells, widths, spec)
+		if w := displayWidth(rendered[i]); w > rowWidth {
+			rowWidth = w
+		}
+	}
+	for i, cells := range rows {
+		if cells == nil {
+			rendered[i] = strings.Repeat("─", rowWidth)
+		}
+	}
+	return strings.Join(rendered, "\n")
+}
+
+// hasBar 报告第 i 个列边界是否有竖线
+func (s arraySpec) hasBar(i int) bool {
+	return i < len(s.bars) && s.bars[i]
+}
+
+// renderArrayRow 按列宽和对齐方式拼接一行单元格
+func renderArrayRow(cells []string, widths []int, spec arraySpec) string {
+	var sb strings.Builder
+	if spec.hasBar(0) {
+		sb.WriteString("│ ")
+	}
+	for i, width := range widths {
+		if i > 0 {
+			if spec.hasBar(i) {
+				sb.WriteString(" │ ")
+			} else {
+				sb.WriteString("  ")
+			}
+		}
+		cell := ""
+		if i < len(cells) {
+			cell = cells[i]
+		}
+		align := byte('l')
+		if i < len(spec.align) {
+			align = spec.align[i]
+		}
+		sb.WriteString(padCell(cell, width, align))
+	}
+	if spec.hasBar(len(widths)) {
+		sb.WriteString(" │")
+	}
+	return strings.TrimRight(sb.String(), " "+alignPad)
+}
+
+// padCell 按对齐方式用 alignPad 把单元格补齐到指定显示宽度
+func padCell(cell string, width int, align byte) string {
+	pad := width - displayWidth(cell)
+	if pad <= 0 {
+		return cell
+	}
+	switch align {
+	case 'r':
+		return strings.Repeat(alignPad, pad) + cell
+	case 'c':
+		left := pad / 2
+		return strings.Repeat(alignPad, left) + cell + strings.Repeat(alignPad, pad-left)
+	}
+	return cell + strings.Repeat(alignPad, pad)
 }
 
 // ──────────────────────────────────────────────
@@ -0,0 +1,394 @@
+package latex
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// TestParse_Multibyte 测试公式中的多字节字符原样保留
+func TestParse_Multibyte(t *testing.T) {
+	p := NewParser()
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"greek", `\alpha ≤ β`, "α ≤ β"},
+		{"greek only", "α+β=γ", "α+β=γ"},
+		{"cjk in text", `\text{中文说明} + x`, "中文说明 + x"},
+		{"accented in text", `\text{café}`, "café"},
+		{"emoji", `x^2 + 😀 = \pi`, "x² + 😀 = π"},
+		{"multibyte before braces", `é{\frac{1}{2}}`, "é½"},
+		{"multibyte subscript", `x_é`, "x_é"},
+		{"multibyte delimiter", `\left⟨ x \right⟩`, "⟨ x ⟩"},
+		{"unclosed brace", `{∑`, "∑"},
+		{"unclosed superscript", `x^{∑`, "x^∑"},
+		{"unclosed fraction", `\frac{∑`, "(∑)/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Convert(tt.input); got != tt.want {
+				t.Errorf("Convert(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParse_NonCommandRoundTrip 测试不含命令的多字节文本逐字节保持不变
+func TestParse_NonCommandRoundTrip(t *testing.T) {
+	p := NewParser()
+	for _, s := range []string{"中文", "Ελληνικά", "👍🏽 ok", "à la carte", "naïve ≠ wise"} {
+		got := p.Convert(s)
+		if got != s {
+			t.Errorf("Convert(%q) = %q, want it unchanged", s, got)
+		}
+	}
+}
+
+// TestParse_SymbolCommands 测试符号表中的命令以单个反斜杠匹配
+func TestParse_SymbolCommands(t *testing.T) {
+	p := NewParser()
+	tests := map[string]string{
+		`\alpha`:       "α",
+		`\mathbb{R}`:   "ℝ",
+		`\hat{x}`:      "x̂",
+		`\sum_{i=1}^n`: "∑ᵢ₌₁ⁿ",
+		`a \\ b`:       "a \n b",
+		`\{x\}`:        "{x}",
+	}
+	for input, want := range tests {
+		if got := p.Convert(input); got != want {
+			t.Errorf("Convert(%q) = %q, want %q", input, got, want)
+		}
+	}
+	for key := range LatexSymbols {
+		if strings.HasPrefix(key, `\\`) && key != `\\` {
+			t.Errorf("LatexSymbols key %q has a doubled backslash", key)
+		}
+	}
+}
+
+// TestParse_BigOperators 测试大型运算符的上下限
+func TestParse_BigOperators(t *testing.T) {
+	p := NewParser()
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"sum with unicode scripts", `\sum_{i=1}^{n} i`, "∑ᵢ₌₁ⁿ i"},
+		{"integral with bounds", `\int_0^\infty f(x)\,dx`, "∫[0..∞] f(x)\u2009dx"},
+		{"integral convertible", `\int_{a}^{b} f`, "∫ₐᵇ f"},
+		{"lim", `\lim_{x\to 0} f(x)`, "lim[x→0] f(x)"},
+		{"limits modifier", `\sum\limits_{k \in S} k`, "∑[k∈S] k"},
+		{"nolimits modifier", `\int\nolimits^{1} g`, "∫¹ g"},
+		{"upper only unconvertible", `\prod^{\infty} x`, "∏[..∞] x"},
+		{"no scripts", `\sum x`, "∑ x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Convert(tt.input); got != tt.want {
+				t.Errorf("Convert(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParse_AlphanumericStyles 测试花体、哥特体和粗斜体样式
+func TestParse_AlphanumericStyles(t *testing.T) {
+	p := NewParser()
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`\mathcal{L}`, "ℒ"},
+		{`\mathcal{ABC}123`, "𝒜ℬ𝒞123"},
+		{`\mathcal{HIMR}`, "ℋℐℳℛ"},
+		{`\mathcal{ego}`, "ℯℊℴ"},
+		{`\mathscr{F}`, "ℱ"},
+		{`\mathscr{EFx}`, "ℰℱ𝓍"},
+		{`\mathfrak{g}`, "𝔤"},
+		{`\mathfrak{CHIRZ}`, "ℭℌℑℜℨ"},
+		{`\mathfrak{a1}`, "𝔞1"},
+		{`\boldsymbol{\alpha}`, "𝜶"},
+		{`\boldsymbol{x + \Omega}`, "𝒙 + 𝜴"},
+		{`\bm{v}_2`, "𝒗₂"},
+		{`\boldsymbol{12}`, "𝟏𝟐"},
+	}
+	for _, tt := range tests {
+		if got := p.Convert(tt.input); got != tt.want {
+			t.Errorf("Convert(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+// TestParse_Fractions 测试分数变体和嵌套分数
+func TestParse_Fractions(t *testing.T) {
+	p := NewParser()
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"fracmap fast path", `\frac{1}{2}`, "½"},
+		{"dfrac alias", `\dfrac{a}{b}`, "a/b"},
+		{"tfrac fracmap", `\tfrac{3}{4}`, "¾"},
+		{"nested", `\frac{1}{1+\frac{1}{x}}`, "1/(1+1/x)"},
+		{"continued fraction", `\cfrac{1}{1+\cfrac{1}{1+\cfrac{1}{x}}}`, "1/(1+1/(1+1/x))"},
+		{"fraction as numerator", `\frac{\frac{a}{b}}{c}`, "(a/b)/c"},
+		{"already parenthesized", `\frac{(a+b)}{2}`, "(a+b)/2"},
+		{"superscripted operands", `\frac{{}^1}{{}^2}`, "½"},
+		{"mixed number", `3\dfrac{1}{2}`, "3 ½"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Convert(tt.input); got != tt.want {
+				t.Errorf("Convert(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParse_Chemistry 测试 \ce 化学式
+func TestParse_Chemistry(t *testing.T) {
+	p := NewParser()
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`\ce{H2O}`, "H₂O"},
+		{`\ce{SO4^2-}`, "SO₄²⁻"},
+		{`\ce{Fe^{3+}}`, "Fe³⁺"},
+		{`\ce{CO2 + H2O -> H2CO3}`, "CO₂ + H₂O → H₂CO₃"},
+		{`\ce{N2 + 3H2 <=> 2NH3}`, "N₂ + 3H₂ ⇌ 2NH₃"},
+		{`\ce{(NH4)2SO4}`, "(NH₄)₂SO₄"},
+		{`\ce{2H2 + O2 -> 2H2O}`, "2H₂ + O₂ → 2H₂O"},
+	}
+	for _, tt := range tests {
+		if got := p.Convert(tt.input); got != tt.want {
+			t.Errorf("Convert(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+// TestParse_Spacing 测试间距命令和 \\ 换行
+func TestParse_Spacing(t *testing.T) {
+	p := NewParser()
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"thin space", `a\,b`, "a\u2009b"},
+		{"medium space", `a\:b`, "a\u2005b"},
+		{"medium space alt", `a\>b`, "a\u2005b"},
+		{"thick space", `a\;b`, "a\u2003b"},
+		{"negative thin space", `a\!b`, "ab"},
+		{"quad", `a\quad{}b`, "a\u2003b"},
+		{"qquad", `a\qquad{}b`, "a\u2003\u2003b"},
+		{"tilde", `a~b`, "a\u00a0b"},
+		{"in formula", `f(x)\,dx = 1`, "f(x)\u2009dx = 1"},
+		{"line break", `a\\b`, "a\nb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Convert(tt.input); got != tt.want {
+				t.Errorf("Convert(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParse_Delimiters 测试 \left / \right / \middle 和尺寸修饰定界符
+func TestParse_Delimiters(t *testing.T) {
+	p := NewParser()
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"norm", `\left\| x \right\|`, "‖ x ‖"},
+		{"floor", `\left\lfloor \frac{n}{2} \right\rfloor`, "⌊ n/2 ⌋"},
+		{"ceil", `\lceil x \rceil`, "⌈ x ⌉"},
+		{"cases-like right dot", `\left\{ a \right.`, "{ a "},
+		{"angle", `\left\langle u, v \right\rangle`, "\u2329 u, v \u232a"},
+		{"abs", `\left\lvert x \right\rvert`, "| x |"},
+		{"middle", `\left( a \middle| b \right)`, "( a | b )"},
+		{"bigl bigr", `\bigl( x \bigr)`, "( x )"},
+		{"Bigg bracket", `\Bigg[ x \Bigg]`, "[ x ]"},
+		{"big with command", `\big\lbrace x \big\rbrace`, "{ x }"},
+		{"bigm", `a \bigm| b`, "a | b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Convert(tt.input); got != tt.want {
+				t.Errorf("Convert(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParse_EquationLabels 测试 \label、\tag、\nonumber 和 \ref
+func TestParse_EquationLabels(t *testing.T) {
+	p := NewParser()
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"label dropped", `E = mc^2 \label{eq:energy}`, "E = mc² "},
+		{"tag", `x = 1 \tag{3}`, "x = 1  (3)"},
+		{"tag star", `x = 1 \tag*{A}`, "x = 1  A"},
+		{"ref", `see \ref{sec:intro}`, "see sec:intro"},
+		{"eqref", `by \eqref{eq:energy}`, "by (eq:energy)"},
+		{
+			"align with labels",
+			`\begin{align} a &= b \label{eq:1} \\ c &= d \label{eq:2} \tag{2} \\ e &= f \nonumber \end{align}`,
+			"a = b\nc = d  (2)\ne = f",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Convert(tt.input); got != tt.want {
+				t.Errorf("Convert(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParse_AlignColumns 测试 align 环境按等号对齐
+func TestParse_AlignColumns(t *testing.T) {
+	p := NewParser()
+	got := p.Convert(`\begin{align} (a+b)^2 &= (a+b)(a+b) \\ &= a^2 + ab + ba + b^2 \\ &= a^2 + 2ab + b^2 \end{align}`)
+	want := "(a+b)² = (a+b)(a+b)\n\u00a0\u00a0\u00a0\u00a0\u00a0\u00a0 = a² + ab + ba + b²\n\u00a0\u00a0\u00a0\u00a0\u00a0\u00a0 = a² + 2ab + b²"
+	if got != want {
+		t.Fatalf("Convert() = %q, want %q", got, want)
+	}
+
+	lines := strings.Split(got, "\n")
+	prefix := strings.Index(lines[0], "=")
+	for _, line := range lines[1:] {
+		if i := strings.Index(line, "="); utf8.RuneCountInString(line[:i]) != utf8.RuneCountInString(lines[0][:prefix]) {
+			t.Errorf("line %q: '=' not aligned with first row", line)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"right aligned left column", `\begin{aligned} x &= 1 \\ xyz &= 2 \end{aligned}`, "\u00a0\u00a0x = 1\nxyz = 2"},
+		{"extra columns", `\begin{aligned} a &= 1 & b &= 2 \end{aligned}`, "a = 1  b  = 2"},
+		{"no ampersand", `\begin{gather} a = b \\ c = d \end{gather}`, "a = b\nc = d"},
+		{"escaped ampersand", `\begin{align} a \& b &= c \end{align}`, "a & b = c"},
+		{"starred align", `\begin{align*} a &= b \\ cc &= d \end{align*}`, "\u00a0a = b\ncc = d"},
+		{"starred gather", `\begin{gather*} a = b \\ c = d \end{gather*}`, "a = b\nc = d"},
+		{"alignat column count", `\begin{alignat}{2} x &= 1 \\ yy &= 2 \end{alignat}`, "\u00a0x = 1\nyy = 2"},
+		{"starred alignat", `\begin{alignat*}{1} x &= 1 \end{alignat*}`, "x = 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Convert(tt.input); got != tt.want {
+				t.Errorf("Convert(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParse_Array 测试 array 环境的列格式、竖线和 \hline
+func TestParse_Array(t *testing.T) {
+	p := NewParser()
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			"bars and hlines with fractions",
+			`\begin{array}{|c|c|} \hline x & \frac{1}{2} \\ \hline \alpha\beta & \frac{a}{b+c} \\ \hline \end{array}`,
+			"────────────────\n" +
+				"│ x\u00a0 │ \u00a0\u00a0\u00a0½\u00a0\u00a0\u00a0 │\n" +
+				"────────────────\n" +
+				"│ αβ │ a/(b+c) │\n" +
+				"────────────────",
+		},
+		{
+			"left and right alignment",
+			`\begin{array}{lr} a & 10 \\ bbb & 2 \end{array}`,
+			"a\u00a0\u00a0  10\nbbb  \u00a02",
+		},
+		{
+			"inner bar only",
+			`\begin{array}{r|l} 1 & x \\ 22 & y \end{array}`,
+			"\u00a01 │ x\n22 │ y",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Convert(tt.input); got != tt.want {
+				t.Errorf("Convert(%q) =\n%s\nwant\n%s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParse_CombiningFallback 测试多字符参数的重音命令改用可读形式
+func TestParse_CombiningFallback(t *testing.T) {
+	p := NewParser()
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"vec single", `\vec{v}`, "v⃗"},
+		{"vec multi", `\vec{AB}`, "vec(AB)"},
+		{"hat single", `\hat{x}`, "x̂"},
+		{"hat multi", `\hat{xy}`, "hat(xy)"},
+		{"dot single", `\dot{q}`, "q̇"},
+		{"dot multi", `\dot{qr}`, "dot(qr)"},
+		{"tilde single", `\tilde{n}`, "ñ"},
+		{"tilde multi", `\tilde{abc}`, "tilde(abc)"},
+		{"greek single", `\hat{\theta}`, "θ̂"},
+		{"subscripted multi", `\vec{x_1}`, "vec(x₁)"},
+		{"overline covers every character", `\overline{ab}`, "a̅b̅"},
+		{"overline skips spaces", `\overline{a b}`, "a\u0305 b\u0305"},
+		{"overline after existing accents", `\overline{\hat{x}y}`, "x\u0302\u0305y\u0305"},
+		{"sqrt radicand without overline", `\sqrt{a^2 + b^2}`, "√(a² + b²)"},
+		{"sqrt of a single atom", `\sqrt{x} + \sqrt{2} + \sqrt{12}`, "√x + √2 + √12"},
+		{"cube root", `\sqrt[3]{x}`, "∛x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Convert(tt.input); got != tt.want {
+				t.Errorf("Convert(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParse_UnknownCommands 测试未知命令的三种处理方式
+func TestParse_UnknownCommands(t *testing.T) {
+	input := `a \foo + \hspace{1em}b = {c}`
+	tests := []struct {
+		mode UnknownCommandMode
+		want string
+	}{
+		{UnknownKeep, `a \foo + \hspace1emb = c`},
+		{UnknownStrip, "a foo + hspace1emb = c"},
+		{UnknownDrop, "a  + b = c"},
+	}
+	for _, tt := range tests {
+		p := &Parser{UnknownCommands: tt.mode}
+		if got := p.Convert(input); got != tt.want {
+			t.Errorf("mode %d: Convert(%q) = %q, want %q", tt.mode, input, got, tt.want)
+		}
+	}
+
+	// 与命令隔着空格的花括号不属于它，不能被丢弃
+	p := &Parser{UnknownCommands: UnknownDrop}
+	if got, want := p.Convert(`\foo {x}^2`), " x²"; got != want {
+		t.Errorf("Convert() = %q, want %q", got, want)
+	}
+}
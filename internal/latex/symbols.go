@@ -2,468 +2,472 @@ package latex
 
 // LatexSymbols LaTeX 符号到 Unicode 的映射
 var LatexSymbols = map[string]string{
-	"\\\\&": "&",
-	"\\\\$": "$",
-	"\\\\{": "{",
-	"\\\\}": "}",
-	"\\\\%": "%",
-	"\\\\#": "#",
-	"\\\\_": "_",
+	"\\&": "&",
+	"\\$": "$",
+	"\\{": "{",
+	"\\}": "}",
+	"\\%": "%",
+	"\\#": "#",
+	"\\_": "_",
 	"$": "",
-	"~": " ",
-	"\\\\ ": " ",
-	"\\\\;": " ",
-	"\\\\:": " ",
-	"\\\\,": " ",
-	"\\\\quad": " ",
-	"\\\\qquad": " ",
+	"~": "\u00a0",
+	"\\ ": " ",
+	"\\,": "\u2009",
+	"\\:": "\u2005",
+	"\\>": "\u2005",
+	"\\;": "\u2003",
+	"\\!": "",
+	"\\thinspace": "\u2009",
+	"\\enspace": "\u2002",
+	"\\quad": "\u2003",
+	"\\qquad": "\u2003\u2003",
 	"\\\\": "\n",
 	"-": "-",
 	"--": "–",
 	"---": "—",
-	"\\\\colon": ":",
-	"\\\\lbrack": "[",
-	"\\\\rbrack": "]",
-	"\\\\textasciicircum": "^",
-	"\\\\textbackslash": "\\",
-	"\\\\textless": "<",
-	"\\\\textgreater": ">",
-	"\\\\textbar": "|",
-	"\\\\textasciitilde": "~",
-	"\\\\textunderscore": "_",
-	"\\\\textendash": "–",
-	"\\\\texttrademark": "™",
-	"\\\\textexclamdown": "¡",
-	"\\\\textemdash": "—",
-	"\\\\textregistered": "®",
-	"\\\\textquestiondown": "¿",
-	"\\\\textvisiblespace": "␣",
-	"\\\\textminus": "−",
-	"\\\\alpha": "α",
-	"\\\\beta": "β",
-	"\\\\Gamma": "Γ",
-	"\\\\gamma": "γ",
-	"\\\\Delta": "Δ",
-	"\\\\delta": "δ",
-	"\\\\zeta": "ζ",
-	"\\\\eta": "η",
-	"\\\\Theta": "Θ",
-	"\\\\theta": "θ",
-	"\\\\Iota": "Ι",
-	"\\\\iota": "ι",
-	"\\\\kappa": "κ",
-	"\\\\Lambda": "Λ",
-	"\\\\lambda": "λ",
-	"\\\\mu": "μ",
-	"\\\\Nu": "Ν",
-	"\\\\nu": "ν",
-	"\\\\Xi": "Ξ",
-	"\\\\xi": "ξ",
-	"\\\\Pi": "Π",
-	"\\\\pi": "π",
-	"\\\\rho": "ρ",
-	"\\\\Sigma": "Σ",
-	"\\\\sigma": "σ",
-	"\\\\tau": "τ",
-	"\\\\Upsilon": "Υ",
-	"\\\\upsilon": "υ",
-	"\\\\Phi": "Φ",
-	"\\\\phi": "φ",
-	"\\\\chi": "χ",
-	"\\\\Psi": "Ψ",
-	"\\\\psi": "ψ",
-	"\\\\Omega": "Ω",
-	"\\\\omega": "ω",
-	"\\\\P": "¶",
-	"\\\\S": "§",
-	"\\\\|": "‖",
-	"\\\\wr": "≀",
-	"\\\\wp": "℘",
-	"\\\\wedge": "∧",
-	"\\\\veebar": "⊻",
-	"\\\\vee": "∨",
-	"\\\\vdots": "⋮",
-	"\\\\vdash": "⊢",
-	"\\\\vartriangleright": "⊳",
-	"\\\\vartriangleleft": "⊲",
-	"\\\\vartriangle": "△",
-	"\\\\vartheta": "ϑ",
-	"\\\\varsigma": "ς",
-	"\\\\varrho": "ϱ",
-	"\\\\varpropto": "∝",
-	"\\\\varpi": "ϖ",
-	"\\\\varphi": "ϕ",
-	"\\\\varnothing": "∅",
-	"\\\\varkappa": "ϰ",
-	"\\\\varepsilon": "ε",
-	"\\\\vDash": "⊨",
-	"\\\\upuparrows": "⇈",
-	"\\\\uplus": "⊎",
-	"\\\\upharpoonright": "↾",
-	"\\\\upharpoonleft": "↿",
-	"\\\\updownarrow": "↕",
-	"\\\\uparrow": "↑",
-	"\\\\unrhd": "⊵",
-	"\\\\unlhd": "⊴",
-	"\\\\twoheadrightarrow": "↠",
-	"\\\\twoheadleftarrow": "↞",
-	"\\\\trianglerighteq": "⊵",
-	"\\\\triangleright": "▷",
-	"\\\\triangleq": "≜",
-	"\\\\trianglelefteq": "⊴",
-	"\\\\triangleleft": "◁",
-	"\\\\triangledown": "▽",
-	"\\\\triangle": "△",
-	"\\\\top": "⊤",
-	"\\\\times": "×",
-	"\\\\thicksim": "∼",
-	"\\\\thickapprox": "≈",
-	"\\\\therefore": "∴",
-	"\\\\swarrow": "↙",
-	"\\\\surd": "√",
-	"\\\\supseteq": "⊇",
-	"\\\\supsetneq": "⊋",
-	"\\\\supset": "⊃",
-	"\\\\sum": "∑",
-	"\\\\succsim": "≿",
-	"\\\\succeq": "≽",
-	"\\\\succcurlyeq": "≽",
-	"\\\\succ": "≻",
-	"\\\\subseteq": "⊆",
-	"\\\\subsetneq": "⊊",
-	"\\\\subset": "⊂",
-	"\\\\star": "⋆",
-	"\\\\square": "□",
-	"\\\\sqsupseteq": "⊒",
-	"\\\\sqsupset": "⊐",
-	"\\\\sqsubseteq": "⊑",
-	"\\\\sqsubset": "⊏",
-	"\\\\sqcup": "⊔",
-	"\\\\sqcap": "⊓",
-	"\\\\sphericalangle": "∢",
-	"\\\\spadesuit": "♠",
-	"\\\\smile": "⌣",
-	"\\\\smallsmile": "⌣",
-	"\\\\smallsetminus": "∖",
-	"\\\\smallfrown": "⌢",
-	"\\\\simeq": "≃",
-	"\\\\sim": "∼",
-	"\\\\shortparallel": "∥",
-	"\\\\sharp": "♯",
-	"\\\\setminus": "∖",
-	"\\\\searrow": "↘",
-	"\\\\rtimes": "⋈",
-	"\\\\risingdotseq": "≓",
-	"\\\\rightthreetimes": "⋌",
-	"\\\\rightsquigarrow": "⇝",
-	"\\\\rightrightarrows": "⇉",
-	"\\\\rightleftharpoons": "⇌",
-	"\\\\rightleftarrows": "⇄",
-	"\\\\rightharpoonup": "⇀",
-	"\\\\rightharpoondown": "⇁",
-	"\\\\rightarrowtail": "↣",
-	"\\\\to": "→",
-	"\\\\rightarrow": "→",
-	"\\\\rhd": "⊳",
-	"\\\\rfloor": "⌋",
-	"\\\\rceil": "⌉",
-	"\\\\rangle": "〉",
-	"\\\\propto": "∝",
-	"\\\\prod": "∏",
-	"\\\\prime": "′",
-	"\\\\precsim": "≾",
-	"\\\\preceq": "≼",
-	"\\\\preccurlyeq": "≼",
-	"\\\\prec": "≺",
-	"\\\\pm": "±",
-	"\\\\pitchfork": "⋔",
-	"\\\\perp": "⊥",
-	"\\\\partial": "∂",
-	"\\\\parallel": "∥",
-	"\\\\otimes": "⊗",
-	"\\\\oslash": "⊘",
-	"\\\\oplus": "⊕",
-	"\\\\ominus": "⊖",
-	"\\\\oint": "∮",
-	"\\\\odot": "⊙",
-	"\\\\nwarrow": "↖",
-	"\\\\notin": "∉",
-	"\\\\ni": "∋",
-	"\\\\nexists": "∄",
-	"\\\\neq": "≠",
-	"\\\\neg": "¬",
-	"\\\\lnot": "¬",
-	"\\\\nearrow": "↗",
-	"\\\\natural": "♮",
-	"\\\\nabla": "∇",
-	"\\\\multimap": "⊸",
-	"\\\\mp": "∓",
-	"\\\\models": "⊨",
-	"\\\\mid": "∣",
-	"\\\\mho": "℧",
-	"\\\\measuredangle": "∡",
-	"\\\\mapsto": "↦",
-	"\\\\ltimes": "⋉",
-	"\\\\lozenge": "◊",
-	"\\\\looparrowright": "↬",
-	"\\\\looparrowleft": "↫",
-	"\\\\longrightarrow": "→",
-	"\\\\longmapsto": "⇖",
-	"\\\\longleftrightarrow": "↔",
-	"\\\\longleftarrow": "←",
-	"\\\\lll": "⋘",
-	"\\\\ll": "≪",
-	"\\\\lhd": "⊲",
-	"\\\\lfloor": "⌊",
-	"\\\\lesssim": "≲",
-	"\\\\lessgtr": "≶",
-	"\\\\lesseqgtr": "⋚",
-	"\\\\lessdot": "⋖",
-	"\\\\leqslant": "≤",
-	"\\\\leqq": "≦",
-	"\\\\leq": "≤",
-	"\\\\leftthreetimes": "⋋",
-	"\\\\leftrightsquigarrow": "↭",
-	"\\\\leftrightharpoons": "⇋",
-	"\\\\leftrightarrows": "⇆",
-	"\\\\leftrightarrow": "↔",
-	"\\\\leftleftarrows": "⇇",
-	"\\\\leftharpoonup": "↼",
-	"\\\\leftharpoondown": "↽",
-	"\\\\leftarrowtail": "↢",
-	"\\\\gets": "←",
-	"\\\\leftarrow": "←",
-	"\\\\leadsto": "↝",
-	"\\\\le": "≤",
-	"\\\\lceil": "⌈",
-	"\\\\langle": "〈",
-	"\\\\intercal": "⊺",
-	"\\\\int": "∫",
-	"\\\\iint": "∬",
-	"\\\\iiint": "∭",
-	"\\\\iiiint": "⨌",
-	"\\\\infty": "∞",
-	"\\\\in": "∈",
-	"\\\\implies": "⇒",
-	"\\\\hslash": "ℏ",
-	"\\\\hookrightarrow": "↪",
-	"\\\\hookleftarrow": "↩",
-	"\\\\heartsuit": "♡",
-	"\\\\hbar": "ℏ",
-	"\\\\gtrsim": "≳",
-	"\\\\gtrless": "≷",
-	"\\\\gtreqless": "⋛",
-	"\\\\gtrdot": "⋗",
-	"\\\\gimel": "ג",
-	"\\\\ggg": "⋙",
-	"\\\\gg": "≫",
-	"\\\\geqq": "≧",
-	"\\\\geq": "≥",
-	"\\\\ge": "≥",
-	"\\\\frown": "⌢",
-	"\\\\forall": "∀",
-	"\\\\flat": "♭",
-	"\\\\fallingdotseq": "≒",
-	"\\\\exists": "∃",
-	"\\\\eth": "ð",
-	"\\\\equiv": "≡",
-	"\\\\eqcirc": "≖",
-	"\\\\epsilon": "∊",
-	"\\\\Epsilon": "Ε",
-	"\\\\emptyset": "∅",
-	"\\\\ell": "ℓ",
-	"\\\\downharpoonright": "⇂",
-	"\\\\downharpoonleft": "⇃",
-	"\\\\downdownarrows": "⇊",
-	"\\\\downarrow": "↓",
-	"\\\\dots": "…",
-	"\\\\ldots": "…",
-	"\\\\dotplus": "∔",
-	"\\\\doteqdot": "≑",
-	"\\\\doteq": "≐",
-	"\\\\divideontimes": "⋇",
-	"\\\\div": "÷",
-	"\\\\digamma": "Ϝ",
-	"\\\\diamondsuit": "♢",
-	"\\\\diamond": "⋄",
-	"\\\\ddots": "⋱",
-	"\\\\ddag": "‡",
-	"\\\\ddagger": "‡",
-	"\\\\dashv": "⊣",
-	"\\\\dashrightarrow": "⇢",
-	"\\\\dashleftarrow": "⇠",
-	"\\\\daleth": "ד",
-	"\\\\dag": "†",
-	"\\\\dagger": "†",
-	"\\\\textdagger": "†",
-	"\\\\curvearrowright": "↷",
-	"\\\\curvearrowleft": "↶",
-	"\\\\curlywedge": "⋏",
-	"\\\\curlyvee": "⋎",
-	"\\\\curlyeqsucc": "⋟",
-	"\\\\curlyeqprec": "⋞",
-	"\\\\cup": "∪",
-	"\\\\coprod": "∐",
-	"\\\\cong": "≅",
-	"\\\\complement": "∁",
-	"\\\\clubsuit": "♣",
-	"\\\\circleddash": "⊝",
-	"\\\\circledcirc": "⊚",
-	"\\\\circledast": "⊛",
-	"\\\\circledS": "Ⓢ",
-	"\\\\circlearrowright": "↻",
-	"\\\\circlearrowleft": "↺",
-	"\\\\circeq": "≗",
-	"\\\\circ": "∘",
-	"\\\\centerdot": "⋅",
-	"\\\\cdots": "⋯",
-	"\\\\cdot": "⋅",
-	"\\\\cap": "∩",
-	"\\\\bumpeq": "≏",
-	"\\\\bullet": "∙",
-	"\\\\boxtimes": "⊠",
-	"\\\\boxplus": "⊞",
-	"\\\\boxminus": "⊟",
-	"\\\\boxdot": "⊡",
-	"\\\\bowtie": "⋈",
-	"\\\\bot": "⊥",
-	"\\\\blacktriangleright": "▷",
-	"\\\\blacktriangleleft": "◀",
-	"\\\\blacktriangledown": "▼",
-	"\\\\blacktriangle": "▲",
-	"\\\\blacksquare": "■",
-	"\\\\blacklozenge": "◆",
-	"\\\\bigwedge": "⋀",
-	"\\\\bigvee": "⋁",
-	"\\\\biguplus": "⊎",
-	"\\\\bigtriangleup": "△",
-	"\\\\bigtriangledown": "▽",
-	"\\\\bigstar": "★",
-	"\\\\bigsqcup": "⊔",
-	"\\\\bigotimes": "⊗",
-	"\\\\bigoplus": "⊕",
-	"\\\\bigodot": "⊙",
-	"\\\\bigcup": "⋃",
-	"\\\\bigcirc": "○",
-	"\\\\bigcap": "⋂",
-	"\\\\between": "≬",
-	"\\\\beth": "ב",
-	"\\\\because": "∵",
-	"\\\\barwedge": "⊼",
-	"\\\\backsim": "∽",
-	"\\\\backprime": "‵",
-	"\\\\backepsilon": "∍",
-	"\\\\asymp": "≍",
-	"\\\\ast": "∗",
-	"\\\\approxeq": "≊",
-	"\\\\approx": "≈",
-	"\\\\angle": "∠",
-	"\\\\aleph": "ℵ",
-	"\\\\Vvdash": "⊪",
-	"\\\\Vdash": "⊩",
-	"\\\\Updownarrow": "⇕",
-	"\\\\Uparrow": "⇑",
-	"\\\\Supset": "⋑",
-	"\\\\Subset": "⋐",
-	"\\\\Rsh": "↱",
-	"\\\\Rrightarrow": "⇛",
-	"\\\\Rightarrow": "⇒",
-	"\\\\Re": "ℜ",
-	"\\\\Lsh": "↰",
-	"\\\\Longrightarrow": "⇒",
-	"\\\\iff": "⇔",
-	"\\\\Longleftrightarrow": "⇔",
-	"\\\\Longleftarrow": "⇐",
-	"\\\\Lleftarrow": "⇚",
-	"\\\\Leftrightarrow": "⇔",
-	"\\\\Leftarrow": "⇐",
-	"\\\\Join": "⋈",
-	"\\\\Im": "ℑ",
-	"\\\\Finv": "Ⅎ",
-	"\\\\Downarrow": "⇓",
-	"\\\\Diamond": "◇",
-	"\\\\Cup": "⋓",
-	"\\\\Cap": "⋒",
-	"\\\\Bumpeq": "≎",
-	"\\\\Box": "□",
-	"\\\\ae": "æ",
-	"\\\\AE": "Æ",
-	"\\\\oe": "œ",
-	"\\\\OE": "Œ",
-	"\\\\aa": "å",
-	"\\\\AA": "Å",
-	"\\\\dh": "ð",
-	"\\\\DH": "Ð",
-	"\\\\dj": "đ",
-	"\\\\DJ": "Ð",
-	"\\\\o": "ø",
-	"\\\\O": "Ø",
-	"\\\\i": "ı",
-	"\\\\imath": "ı",
-	"\\\\j": "ȷ",
-	"\\\\jmath": "ȷ",
-	"\\\\L": "Ł",
-	"\\\\l": "ł",
-	"\\\\ss": "ß",
-	"\\\\copyright": "©",
-	"\\\\pounds": "£",
-	"\\\\euro": "€",
-	"\\\\EUR": "€",
-	"\\\\texteuro": "€",
-	"\\\\lim": "lim",
-	"\\\\limsup": "lim sup",
-	"\\\\liminf": "lim inf",
-	"\\\\sin": "sin",
-	"\\\\cos": "cos",
-	"\\\\tan": "tan",
-	"\\\\sec": "sec",
-	"\\\\csc": "csc",
-	"\\\\cot": "cot",
-	"\\\\arcsin": "arcsin",
-	"\\\\arccos": "arccos",
-	"\\\\arctan": "arctan",
-	"\\\\sinh": "sinh",
-	"\\\\cosh": "cosh",
-	"\\\\tanh": "tanh",
-	"\\\\log": "log",
-	"\\\\ln": "ln",
-	"\\\\exp": "exp",
-	"\\\\lg": "lg",
-	"\\\\max": "max",
-	"\\\\min": "min",
-	"\\\\sup": "sup",
-	"\\\\inf": "inf",
-	"\\\\det": "det",
-	"\\\\gcd": "gcd",
-	"\\\\deg": "deg",
-	"\\\\dim": "dim",
-	"\\\\hom": "hom",
-	"\\\\ker": "ker",
-	"\\\\arg": "arg",
-	"\\\\Pr": "Pr",
-	"\\\\bmod": " mod ",
-	"\\\\mod": " mod ",
-	"\\\\!": "",
-	"\\\\limits": "",
-	"\\\\nolimits": "",
-	"\\\\displaystyle": "",
-	"\\\\textstyle": "",
-	"\\\\scriptstyle": "",
-	"\\\\scriptscriptstyle": "",
-	"\\\\nonumber": "",
-	"\\\\notag": "",
-	"\\\\vert": "|",
-	"\\\\Vert": "‖",
-	"\\\\lvert": "|",
-	"\\\\rvert": "|",
-	"\\\\lVert": "‖",
-	"\\\\rVert": "‖",
-	"\\\\lgroup": "(",
-	"\\\\rgroup": ")",
-	"\\\\land": "∧",
-	"\\\\lor": "∨",
-	"\\\\owns": "∋",
-	"\\\\\\\\": "\n",
+	"\\colon": ":",
+	"\\lbrack": "[",
+	"\\lbrace": "{",
+	"\\rbrace": "}",
+	"\\rbrack": "]",
+	"\\textasciicircum": "^",
+	"\\textbackslash": "\\",
+	"\\textless": "<",
+	"\\textgreater": ">",
+	"\\textbar": "|",
+	"\\textasciitilde": "~",
+	"\\textunderscore": "_",
+	"\\textendash": "–",
+	"\\texttrademark": "™",
+	"\\textexclamdown": "¡",
+	"\\textemdash": "—",
+	"\\textregistered": "®",
+	"\\textquestiondown": "¿",
+	"\\textvisiblespace": "␣",
+	"\\textminus": "−",
+	"\\alpha": "α",
+	"\\beta": "β",
+	"\\Gamma": "Γ",
+	"\\gamma": "γ",
+	"\\Delta": "Δ",
+	"\\delta": "δ",
+	"\\zeta": "ζ",
+	"\\eta": "η",
+	"\\Theta": "Θ",
+	"\\theta": "θ",
+	"\\Iota": "Ι",
+	"\\iota": "ι",
+	"\\kappa": "κ",
+	"\\Lambda": "Λ",
+	"\\lambda": "λ",
+	"\\mu": "μ",
+	"\\Nu": "Ν",
+	"\\nu": "ν",
+	"\\Xi": "Ξ",
+	"\\xi": "ξ",
+	"\\Pi": "Π",
+	"\\pi": "π",
+	"\\rho": "ρ",
+	"\\Sigma": "Σ",
+	"\\sigma": "σ",
+	"\\tau": "τ",
+	"\\Upsilon": "Υ",
+	"\\upsilon": "υ",
+	"\\Phi": "Φ",
+	"\\phi": "φ",
+	"\\chi": "χ",
+	"\\Psi": "Ψ",
+	"\\psi": "ψ",
+	"\\Omega": "Ω",
+	"\\omega": "ω",
+	"\\P": "¶",
+	"\\S": "§",
+	"\\|": "‖",
+	"\\wr": "≀",
+	"\\wp": "℘",
+	"\\wedge": "∧",
+	"\\veebar": "⊻",
+	"\\vee": "∨",
+	"\\vdots": "⋮",
+	"\\vdash": "⊢",
+	"\\vartriangleright": "⊳",
+	"\\vartriangleleft": "⊲",
+	"\\vartriangle": "△",
+	"\\vartheta": "ϑ",
+	"\\varsigma": "ς",
+	"\\varrho": "ϱ",
+	"\\varpropto": "∝",
+	"\\varpi": "ϖ",
+	"\\varphi": "ϕ",
+	"\\varnothing": "∅",
+	"\\varkappa": "ϰ",
+	"\\varepsilon": "ε",
+	"\\vDash": "⊨",
+	"\\upuparrows": "⇈",
+	"\\uplus": "⊎",
+	"\\upharpoonright": "↾",
+	"\\upharpoonleft": "↿",
+	"\\updownarrow": "↕",
+	"\\uparrow": "↑",
+	"\\unrhd": "⊵",
+	"\\unlhd": "⊴",
+	"\\twoheadrightarrow": "↠",
+	"\\twoheadleftarrow": "↞",
+	"\\trianglerighteq": "⊵",
+	"\\triangleright": "▷",
+	"\\triangleq": "≜",
+	"\\trianglelefteq": "⊴",
+	"\\triangleleft": "◁",
+	"\\triangledown": "▽",
+	"\\triangle": "△",
+	"\\top": "⊤",
+	"\\times": "×",
+	"\\thicksim": "∼",
+	"\\thickapprox": "≈",
+	"\\therefore": "∴",
+	"\\swarrow": "↙",
+	"\\surd": "√",
+	"\\supseteq": "⊇",
+	"\\supsetneq": "⊋",
+	"\\supset": "⊃",
+	"\\sum": "∑",
+	"\\succsim": "≿",
+	"\\succeq": "≽",
+	"\\succcurlyeq": "≽",
+	"\\succ": "≻",
+	"\\subseteq": "⊆",
+	"\\subsetneq": "⊊",
+	"\\subset": "⊂",
+	"\\star": "⋆",
+	"\\square": "□",
+	"\\sqsupseteq": "⊒",
+	"\\sqsupset": "⊐",
+	"\\sqsubseteq": "⊑",
+	"\\sqsubset": "⊏",
+	"\\sqcup": "⊔",
+	"\\sqcap": "⊓",
+	"\\sphericalangle": "∢",
+	"\\spadesuit": "♠",
+	"\\smile": "⌣",
+	"\\smallsmile": "⌣",
+	"\\smallsetminus": "∖",
+	"\\smallfrown": "⌢",
+	"\\simeq": "≃",
+	"\\sim": "∼",
+	"\\shortparallel": "∥",
+	"\\sharp": "♯",
+	"\\setminus": "∖",
+	"\\searrow": "↘",
+	"\\rtimes": "⋈",
+	"\\risingdotseq": "≓",
+	"\\rightthreetimes": "⋌",
+	"\\rightsquigarrow": "⇝",
+	"\\rightrightarrows": "⇉",
+	"\\rightleftharpoons": "⇌",
+	"\\rightleftarrows": "⇄",
+	"\\rightharpoonup": "⇀",
+	"\\rightharpoondown": "⇁",
+	"\\rightarrowtail": "↣",
+	"\\to": "→",
+	"\\rightarrow": "→",
+	"\\rhd": "⊳",
+	"\\rfloor": "⌋",
+	"\\rceil": "⌉",
+	"\\rangle": "〉",
+	"\\propto": "∝",
+	"\\prod": "∏",
+	"\\prime": "′",
+	"\\precsim": "≾",
+	"\\preceq": "≼",
+	"\\preccurlyeq": "≼",
+	"\\prec": "≺",
+	"\\pm": "±",
+	"\\pitchfork": "⋔",
+	"\\perp": "⊥",
+	"\\partial": "∂",
+	"\\parallel": "∥",
+	"\\otimes": "⊗",
+	"\\oslash": "⊘",
+	"\\oplus": "⊕",
+	"\\ominus": "⊖",
+	"\\oint": "∮",
+	"\\odot": "⊙",
+	"\\nwarrow": "↖",
+	"\\notin": "∉",
+	"\\ni": "∋",
+	"\\nexists": "∄",
+	"\\neq": "≠",
+	"\\neg": "¬",
+	"\\lnot": "¬",
+	"\\nearrow": "↗",
+	"\\natural": "♮",
+	"\\nabla": "∇",
+	"\\multimap": "⊸",
+	"\\mp": "∓",
+	"\\models": "⊨",
+	"\\mid": "∣",
+	"\\mho": "℧",
+	"\\measuredangle": "∡",
+	"\\mapsto": "↦",
+	"\\ltimes": "⋉",
+	"\\lozenge": "◊",
+	"\\looparrowright": "↬",
+	"\\looparrowleft": "↫",
+	"\\longrightarrow": "→",
+	"\\longmapsto": "⇖",
+	"\\longleftrightarrow": "↔",
+	"\\longleftarrow": "←",
+	"\\lll": "⋘",
+	"\\ll": "≪",
+	"\\lhd": "⊲",
+	"\\lfloor": "⌊",
+	"\\lesssim": "≲",
+	"\\lessgtr": "≶",
+	"\\lesseqgtr": "⋚",
+	"\\lessdot": "⋖",
+	"\\leqslant": "≤",
+	"\\leqq": "≦",
+	"\\leq": "≤",
+	"\\leftthreetimes": "⋋",
+	"\\leftrightsquigarrow": "↭",
+	"\\leftrightharpoons": "⇋",
+	"\\leftrightarrows": "⇆",
+	"\\leftrightarrow": "↔",
+	"\\leftleftarrows": "⇇",
+	"\\leftharpoonup": "↼",
+	"\\leftharpoondown": "↽",
+	"\\leftarrowtail": "↢",
+	"\\gets": "←",
+	"\\leftarrow": "←",
+	"\\leadsto": "↝",
+	"\\le": "≤",
+	"\\lceil": "⌈",
+	"\\langle": "〈",
+	"\\intercal": "⊺",
+	"\\int": "∫",
+	"\\iint": "∬",
+	"\\iiint": "∭",
+	"\\iiiint": "⨌",
+	"\\infty": "∞",
+	"\\in": "∈",
+	"\\implies": "⇒",
+	"\\hslash": "ℏ",
+	"\\hookrightarrow": "↪",
+	"\\hookleftarrow": "↩",
+	"\\heartsuit": "♡",
+	"\\hbar": "ℏ",
+	"\\gtrsim": "≳",
+	"\\gtrless": "≷",
+	"\\gtreqless": "⋛",
+	"\\gtrdot": "⋗",
+	"\\gimel": "ג",
+	"\\ggg": "⋙",
+	"\\gg": "≫",
+	"\\geqq": "≧",
+	"\\geq": "≥",
+	"\\ge": "≥",
+	"\\frown": "⌢",
+	"\\forall": "∀",
+	"\\flat": "♭",
+	"\\fallingdotseq": "≒",
+	"\\exists": "∃",
+	"\\eth": "ð",
+	"\\equiv": "≡",
+	"\\eqcirc": "≖",
+	"\\epsilon": "∊",
+	"\\Epsilon": "Ε",
+	"\\emptyset": "∅",
+	"\\ell": "ℓ",
+	"\\downharpoonright": "⇂",
+	"\\downharpoonleft": "⇃",
+	"\\downdownarrows": "⇊",
+	"\\downarrow": "↓",
+	"\\dots": "…",
+	"\\ldots": "…",
+	"\\dotplus": "∔",
+	"\\doteqdot": "≑",
+	"\\doteq": "≐",
+	"\\divideontimes": "⋇",
+	"\\div": "÷",
+	"\\digamma": "Ϝ",
+	"\\diamondsuit": "♢",
+	"\\diamond": "⋄",
+	"\\ddots": "⋱",
+	"\\ddag": "‡",
+	"\\ddagger": "‡",
+	"\\dashv": "⊣",
+	"\\dashrightarrow": "⇢",
+	"\\dashleftarrow": "⇠",
+	"\\daleth": "ד",
+	"\\dag": "†",
+	"\\dagger": "†",
+	"\\textdagger": "†",
+	"\\curvearrowright": "↷",
+	"\\curvearrowleft": "↶",
+	"\\curlywedge": "⋏",
+	"\\curlyvee": "⋎",
+	"\\curlyeqsucc": "⋟",
+	"\\curlyeqprec": "⋞",
+	"\\cup": "∪",
+	"\\coprod": "∐",
+	"\\cong": "≅",
+	"\\complement": "∁",
+	"\\clubsuit": "♣",
+	"\\circleddash": "⊝",
+	"\\circledcirc": "⊚",
+	"\\circledast": "⊛",
+	"\\circledS": "Ⓢ",
+	"\\circlearrowright": "↻",
+	"\\circlearrowleft": "↺",
+	"\\circeq": "≗",
+	"\\circ": "∘",
+	"\\centerdot": "⋅",
+	"\\cdots": "⋯",
+	"\\cdot": "⋅",
+	"\\cap": "∩",
+	"\\bumpeq": "≏",
+	"\\bullet": "∙",
+	"\\boxtimes": "⊠",
+	"\\boxplus": "⊞",
+	"\\boxminus": "⊟",
+	"\\boxdot": "⊡",
+	"\\bowtie": "⋈",
+	"\\bot": "⊥",
+	"\\blacktriangleright": "▷",
+	"\\blacktriangleleft": "◀",
+	"\\blacktriangledown": "▼",
+	"\\blacktriangle": "▲",
+	"\\blacksquare": "■",
+	"\\blacklozenge": "◆",
+	"\\bigwedge": "⋀",
+	"\\bigvee": "⋁",
+	"\\biguplus": "⊎",
+	"\\bigtriangleup": "△",
+	"\\bigtriangledown": "▽",
+	"\\bigstar": "★",
+	"\\bigsqcup": "⊔",
+	"\\bigotimes": "⊗",
+	"\\bigoplus": "⊕",
+	"\\bigodot": "⊙",
+	"\\bigcup": "⋃",
+	"\\bigcirc": "○",
+	"\\bigcap": "⋂",
+	"\\between": "≬",
+	"\\beth": "ב",
+	"\\because": "∵",
+	"\\barwedge": "⊼",
+	"\\backsim": "∽",
+	"\\backprime": "‵",
+	"\\backepsilon": "∍",
+	"\\asymp": "≍",
+	"\\ast": "∗",
+	"\\approxeq": "≊",
+	"\\approx": "≈",
+	"\\angle": "∠",
+	"\\aleph": "ℵ",
+	"\\Vvdash": "⊪",
+	"\\Vdash": "⊩",
+	"\\Updownarrow": "⇕",
+	"\\Uparrow": "⇑",
+	"\\Supset": "⋑",
+	"\\Subset": "⋐",
+	"\\Rsh": "↱",
+	"\\Rrightarrow": "⇛",
+	"\\Rightarrow": "⇒",
+	"\\Re": "ℜ",
+	"\\Lsh": "↰",
+	"\\Longrightarrow": "⇒",
+	"\\iff": "⇔",
+	"\\Longleftrightarrow": "⇔",
+	"\\Longleftarrow": "⇐",
+	"\\Lleftarrow": "⇚",
+	"\\Leftrightarrow": "⇔",
+	"\\Leftarrow": "⇐",
+	"\\Join": "⋈",
+	"\\Im": "ℑ",
+	"\\Finv": "Ⅎ",
+	"\\Downarrow": "⇓",
+	"\\Diamond": "◇",
+	"\\Cup": "⋓",
+	"\\Cap": "⋒",
+	"\\Bumpeq": "≎",
+	"\\Box": "□",
+	"\\ae": "æ",
+	"\\AE": "Æ",
+	"\\oe": "œ",
+	"\\OE": "Œ",
+	"\\aa": "å",
+	"\\AA": "Å",
+	"\\dh": "ð",
+	"\\DH": "Ð",
+	"\\dj": "đ",
+	"\\DJ": "Ð",
+	"\\o": "ø",
+	"\\O": "Ø",
+	"\\i": "ı",
+	"\\imath": "ı",
+	"\\j": "ȷ",
+	"\\jmath": "ȷ",
+	"\\L": "Ł",
+	"\\l": "ł",
+	"\\ss": "ß",
+	"\\copyright": "©",
+	"\\pounds": "£",
+	"\\euro": "€",
+	"\\EUR": "€",
+	"\\texteuro": "€",
+	"\\lim": "lim",
+	"\\limsup": "lim sup",
+	"\\liminf": "lim inf",
+	"\\sin": "sin",
+	"\\cos": "cos",
+	"\\tan": "tan",
+	"\\sec": "sec",
+	"\\csc": "csc",
+	"\\cot": "cot",
+	"\\arcsin": "arcsin",
+	"\\arccos": "arccos",
+	"\\arctan": "arctan",
+	"\\sinh": "sinh",
+	"\\cosh": "cosh",
+	"\\tanh": "tanh",
+	"\\log": "log",
+	"\\ln": "ln",
+	"\\exp": "exp",
+	"\\lg": "lg",
+	"\\max": "max",
+	"\\min": "min",
+	"\\sup": "sup",
+	"\\inf": "inf",
+	"\\det": "det",
+	"\\gcd": "gcd",
+	"\\deg": "deg",
+	"\\dim": "dim",
+	"\\hom": "hom",
+	"\\ker": "ker",
+	"\\arg": "arg",
+	"\\Pr": "Pr",
+	"\\bmod": " mod ",
+	"\\mod": " mod ",
+	"\\limits": "",
+	"\\nolimits": "",
+	"\\displaystyle": "",
+	"\\textstyle": "",
+	"\\scriptstyle": "",
+	"\\scriptscriptstyle": "",
+	"\\nonumber": "",
+	"\\notag": "",
+	"\\vert": "|",
+	"\\Vert": "‖",
+	"\\lvert": "|",
+	"\\rvert": "|",
+	"\\lVert": "‖",
+	"\\rVert": "‖",
+	"\\lgroup": "(",
+	"\\rgroup": ")",
+	"\\land": "∧",
+	"\\lor": "∨",
+	"\\owns": "∋",
 }
 
 // CombiningType 组合字符类型
@@ -476,44 +480,49 @@ const (
 )
 
 // CombiningChar 组合字符信息
+//
+// MaxLen 大于 0 时，参数超过 MaxLen 个字形就不再叠加组合字符，
+// 改用 Fallback 格式输出（%s 为参数），避免多字符参数在部分客户端上显示错乱。
 type CombiningChar struct {
-	Char rune
-	Type CombiningType
+	Char     rune
+	Type     CombiningType
+	MaxLen   int
+	Fallback string
 }
 
 // Combining 组合字符映射
 var Combining = map[string]CombiningChar{
-	"\\\\grave": {Char: '\u0300', Type: FirstChar},
-	"\\\\`": {Char: '\u0300', Type: FirstChar},
-	"\\\\acute": {Char: '\u0301', Type: FirstChar},
-	"\\\\'": {Char: '\u0301', Type: FirstChar},
-	"\\\\hat": {Char: '\u0302', Type: FirstChar},
-	"\\\\^": {Char: '\u0302', Type: FirstChar},
-	"\\\\tilde": {Char: '\u0303', Type: FirstChar},
-	"\\\\~": {Char: '\u0303', Type: FirstChar},
-	"\\\\bar": {Char: '\u0304', Type: FirstChar},
-	"\\\\=": {Char: '\u0304', Type: FirstChar},
-	"\\\\overline": {Char: '\u0305', Type: FirstChar},
-	"\\\\breve": {Char: '\u0306', Type: FirstChar},
-	"\\\\u": {Char: '\u0306', Type: FirstChar},
-	"\\\\dot": {Char: '\u0307', Type: FirstChar},
-	"\\\\.": {Char: '\u0307', Type: FirstChar},
-	"\\\\ddot": {Char: '\u0308', Type: FirstChar},
-	"\\\\\"": {Char: '\u0308', Type: FirstChar},
-	"\\\\mathring": {Char: '\u030a', Type: FirstChar},
-	"\\\\r": {Char: '\u030a', Type: FirstChar},
-	"\\\\H": {Char: '\u030b', Type: FirstChar},
-	"\\\\check": {Char: '\u030c', Type: FirstChar},
-	"\\\\v": {Char: '\u030c', Type: FirstChar},
-	"\\\\d": {Char: '\u0323', Type: FirstChar},
-	"\\\\c": {Char: '\u0327', Type: FirstChar},
-	"\\\\k": {Char: '\u0328', Type: FirstChar},
-	"\\\\b": {Char: '\u0332', Type: FirstChar},
-	"\\\\underline": {Char: '\u0332', Type: FirstChar},
-	"\\\\underbar": {Char: '\u0332', Type: FirstChar},
-	"\\\\t": {Char: '\u0361', Type: FirstChar},
-	"\\\\vec": {Char: '\u20d7', Type: FirstChar},
-	"\\\\textcircled": {Char: '\u20dd', Type: FirstChar},
+	"\\grave": {Char: '\u0300', Type: FirstChar, MaxLen: 1, Fallback: "grave(%s)"},
+	"\\`": {Char: '\u0300', Type: FirstChar},
+	"\\acute": {Char: '\u0301', Type: FirstChar, MaxLen: 1, Fallback: "acute(%s)"},
+	"\\'": {Char: '\u0301', Type: FirstChar},
+	"\\hat": {Char: '\u0302', Type: FirstChar, MaxLen: 1, Fallback: "hat(%s)"},
+	"\\^": {Char: '\u0302', Type: FirstChar},
+	"\\tilde": {Char: '\u0303', Type: FirstChar, MaxLen: 1, Fallback: "tilde(%s)"},
+	"\\~": {Char: '\u0303', Type: FirstChar},
+	"\\bar": {Char: '\u0304', Type: FirstChar, MaxLen: 1, Fallback: "bar(%s)"},
+	"\\=": {Char: '\u0304', Type: FirstChar},
+	"\\overline": {Char: '\u0305', Type: AllChars},
+	"\\breve": {Char: '\u0306', Type: FirstChar, MaxLen: 1, Fallback: "breve(%s)"},
+	"\\u": {Char: '\u0306', Type: FirstChar},
+	"\\dot": {Char: '\u0307', Type: FirstChar, MaxLen: 1, Fallback: "dot(%s)"},
+	"\\.": {Char: '\u0307', Type: FirstChar},
+	"\\ddot": {Char: '\u0308', Type: FirstChar, MaxLen: 1, Fallback: "ddot(%s)"},
+	"\\\"": {Char: '\u0308', Type: FirstChar},
+	"\\mathring": {Char: '\u030a', Type: FirstChar, MaxLen: 1, Fallback: "ring(%s)"},
+	"\\r": {Char: '\u030a', Type: FirstChar},
+	"\\H": {Char: '\u030b', Type: FirstChar},
+	"\\check": {Char: '\u030c', Type: FirstChar, MaxLen: 1, Fallback: "check(%s)"},
+	"\\v": {Char: '\u030c', Type: FirstChar},
+	"\\d": {Char: '\u0323', Type: FirstChar},
+	"\\c": {Char: '\u0327', Type: FirstChar},
+	"\\k": {Char: '\u0328', Type: FirstChar},
+	"\\b": {Char: '\u0332', Type: FirstChar},
+	"\\underline": {Char: '\u0332', Type: FirstChar},
+	"\\underbar": {Char: '\u0332', Type: FirstChar},
+	"\\t": {Char: '\u0361', Type: FirstChar},
+	"\\vec": {Char: '\u20d7', Type: FirstChar, MaxLen: 1, Fallback: "vec(%s)"},
+	"\\textcircled": {Char: '\u20dd', Type: FirstChar},
 }
 
 // NotMap 否定符号映射
@@ -664,7 +673,7 @@ var Superscripts = map[rune]rune{
 
 // LatexStyles LaTeX 样式映射
 var LatexStyles = map[string]map[rune]rune{
-	"\\\\mathbb": {
+	"\\mathbb": {
 		'\u007a': 0x1d56b,
 		'\u0079': 0x1d56a,
 		'\u0078': 0x1d569,
@@ -728,7 +737,7 @@ var LatexStyles = map[string]map[rune]rune{
 		'\u0031': 0x1d7d9,
 		'\u0030': 0x1d7d8,
 	},
-	"\\\\textbb": {
+	"\\textbb": {
 		'\u007a': 0x1d56b,
 		'\u0079': 0x1d56a,
 		'\u0078': 0x1d569,
@@ -792,7 +801,7 @@ var LatexStyles = map[string]map[rune]rune{
 		'\u0031': 0x1d7d9,
 		'\u0030': 0x1d7d8,
 	},
-	"\\\\mathbf": {
+	"\\mathbf": {
 		'\u2207': 0x1d6c1,
 		'\u2202': 0x1d6db,
 		'\u03f5': 0x1d6dc,
@@ -914,7 +923,7 @@ var LatexStyles = map[string]map[rune]rune{
 		'\u0031': 0x1d7cf,
 		'\u0030': 0x1d7ce,
 	},
-	"\\\\textbf": {
+	"\\textbf": {
 		'\u2207': 0x1d6c1,
 		'\u2202': 0x1d6db,
 		'\u03f5': 0x1d6dc,
@@ -1036,115 +1045,115 @@ var LatexStyles = map[string]map[rune]rune{
 		'\u0031': 0x1d7cf,
 		'\u0030': 0x1d7ce,
 	},
-	"\\\\mathcal": {
-		'\u007a': 0x1d503,
-		'\u0079': 0x1d502,
-		'\u0078': 0x1d501,
-		'\u0077': 0x1d500,
-		'\u0076': 0x1d4ff,
-		'\u0075': 0x1d4fe,
-		'\u0074': 0x1d4fd,
-		'\u0073': 0x1d4fc,
-		'\u0072': 0x1d4fb,
-		'\u0071': 0x1d4fa,
-		'\u0070': 0x1d4f9,
-		'\u006f': 0x1d4f8,
-		'\u006e': 0x1d4f7,
-		'\u006d': 0x1d4f6,
-		'\u006c': 0x1d4f5,
-		'\u006b': 0x1d4f4,
-		'\u006a': 0x1d4f3,
-		'\u0069': 0x1d4f2,
-		'\u0068': 0x1d4f1,
-		'\u0067': 0x1d4f0,
-		'\u0066': 0x1d4ef,
-		'\u0065': 0x1d4ee,
-		'\u0064': 0x1d4ed,
-		'\u0063': 0x1d4ec,
-		'\u0062': 0x1d4eb,
-		'\u0061': 0x1d4ea,
-		'\u005a': 0x1d4e9,
-		'\u0059': 0x1d4e8,
-		'\u0058': 0x1d4e7,
-		'\u0057': 0x1d4e6,
-		'\u0056': 0x1d4e5,
-		'\u0055': 0x1d4e4,
-		'\u0054': 0x1d4e3,
-		'\u0053': 0x1d4e2,
-		'\u0052': 0x1d4e1,
-		'\u0051': 0x1d4e0,
-		'\u0050': 0x1d4df,
-		'\u004f': 0x1d4de,
-		'\u004e': 0x1d4dd,
-		'\u004d': 0x1d4dc,
-		'\u004c': 0x1d4db,
-		'\u004b': 0x1d4da,
-		'\u004a': 0x1d4d9,
-		'\u0049': 0x1d4d8,
-		'\u0048': 0x1d4d7,
-		'\u0047': 0x1d4d6,
-		'\u0046': 0x1d4d5,
-		'\u0045': 0x1d4d4,
-		'\u0044': 0x1d4d3,
-		'\u0043': 0x1d4d2,
-		'\u0042': 0x1d4d1,
-		'\u0041': 0x1d4d0,
+	"\\mathcal": {
+		'\u007a': 0x1d4cf,
+		'\u0079': 0x1d4ce,
+		'\u0078': 0x1d4cd,
+		'\u0077': 0x1d4cc,
+		'\u0076': 0x1d4cb,
+		'\u0075': 0x1d4ca,
+		'\u0074': 0x1d4c9,
+		'\u0073': 0x1d4c8,
+		'\u0072': 0x1d4c7,
+		'\u0071': 0x1d4c6,
+		'\u0070': 0x1d4c5,
+		'\u006f': '\u2134',
+		'\u006e': 0x1d4c3,
+		'\u006d': 0x1d4c2,
+		'\u006c': 0x1d4c1,
+		'\u006b': 0x1d4c0,
+		'\u006a': 0x1d4bf,
+		'\u0069': 0x1d4be,
+		'\u0068': 0x1d4bd,
+		'\u0067': '\u210a',
+		'\u0066': 0x1d4bb,
+		'\u0065': '\u212f',
+		'\u0064': 0x1d4b9,
+		'\u0063': 0x1d4b8,
+		'\u0062': 0x1d4b7,
+		'\u0061': 0x1d4b6,
+		'\u005a': 0x1d4b5,
+		'\u0059': 0x1d4b4,
+		'\u0058': 0x1d4b3,
+		'\u0057': 0x1d4b2,
+		'\u0056': 0x1d4b1,
+		'\u0055': 0x1d4b0,
+		'\u0054': 0x1d4af,
+		'\u0053': 0x1d4ae,
+		'\u0052': '\u211b',
+		'\u0051': 0x1d4ac,
+		'\u0050': 0x1d4ab,
+		'\u004f': 0x1d4aa,
+		'\u004e': 0x1d4a9,
+		'\u004d': '\u2133',
+		'\u004c': '\u2112',
+		'\u004b': 0x1d4a6,
+		'\u004a': 0x1d4a5,
+		'\u0049': '\u2110',
+		'\u0048': '\u210b',
+		'\u0047': 0x1d4a2,
+		'\u0046': '\u2131',
+		'\u0045': '\u2130',
+		'\u0044': 0x1d49f,
+		'\u0043': 0x1d49e,
+		'\u0042': '\u212c',
+		'\u0041': 0x1d49c,
 	},
-	"\\\\textcal": {
-		'\u007a': 0x1d503,
-		'\u0079': 0x1d502,
-		'\u0078': 0x1d501,
-		'\u0077': 0x1d500,
-		'\u0076': 0x1d4ff,
-		'\u0075': 0x1d4fe,
-		'\u0074': 0x1d4fd,
-		'\u0073': 0x1d4fc,
-		'\u0072': 0x1d4fb,
-		'\u0071': 0x1d4fa,
-		'\u0070': 0x1d4f9,
-		'\u006f': 0x1d4f8,
-		'\u006e': 0x1d4f7,
-		'\u006d': 0x1d4f6,
-		'\u006c': 0x1d4f5,
-		'\u006b': 0x1d4f4,
-		'\u006a': 0x1d4f3,
-		'\u0069': 0x1d4f2,
-		'\u0068': 0x1d4f1,
-		'\u0067': 0x1d4f0,
-		'\u0066': 0x1d4ef,
-		'\u0065': 0x1d4ee,
-		'\u0064': 0x1d4ed,
-		'\u0063': 0x1d4ec,
-		'\u0062': 0x1d4eb,
-		'\u0061': 0x1d4ea,
-		'\u005a': 0x1d4e9,
-		'\u0059': 0x1d4e8,
-		'\u0058': 0x1d4e7,
-		'\u0057': 0x1d4e6,
-		'\u0056': 0x1d4e5,
-		'\u0055': 0x1d4e4,
-		'\u0054': 0x1d4e3,
-		'\u0053': 0x1d4e2,
-		'\u0052': 0x1d4e1,
-		'\u0051': 0x1d4e0,
-		'\u0050': 0x1d4df,
-		'\u004f': 0x1d4de,
-		'\u004e': 0x1d4dd,
-		'\u004d': 0x1d4dc,
-		'\u004c': 0x1d4db,
-		'\u004b': 0x1d4da,
-		'\u004a': 0x1d4d9,
-		'\u0049': 0x1d4d8,
-		'\u0048': 0x1d4d7,
-		'\u0047': 0x1d4d6,
-		'\u0046': 0x1d4d5,
-		'\u0045': 0x1d4d4,
-		'\u0044': 0x1d4d3,
-		'\u0043': 0x1d4d2,
-		'\u0042': 0x1d4d1,
-		'\u0041': 0x1d4d0,
+	"\\textcal": {
+		'\u007a': 0x1d4cf,
+		'\u0079': 0x1d4ce,
+		'\u0078': 0x1d4cd,
+		'\u0077': 0x1d4cc,
+		'\u0076': 0x1d4cb,
+		'\u0075': 0x1d4ca,
+		'\u0074': 0x1d4c9,
+		'\u0073': 0x1d4c8,
+		'\u0072': 0x1d4c7,
+		'\u0071': 0x1d4c6,
+		'\u0070': 0x1d4c5,
+		'\u006f': '\u2134',
+		'\u006e': 0x1d4c3,
+		'\u006d': 0x1d4c2,
+		'\u006c': 0x1d4c1,
+		'\u006b': 0x1d4c0,
+		'\u006a': 0x1d4bf,
+		'\u0069': 0x1d4be,
+		'\u0068': 0x1d4bd,
+		'\u0067': '\u210a',
+		'\u0066': 0x1d4bb,
+		'\u0065': '\u212f',
+		'\u0064': 0x1d4b9,
+		'\u0063': 0x1d4b8,
+		'\u0062': 0x1d4b7,
+		'\u0061': 0x1d4b6,
+		'\u005a': 0x1d4b5,
+		'\u0059': 0x1d4b4,
+		'\u0058': 0x1d4b3,
+		'\u0057': 0x1d4b2,
+		'\u0056': 0x1d4b1,
+		'\u0055': 0x1d4b0,
+		'\u0054': 0x1d4af,
+		'\u0053': 0x1d4ae,
+		'\u0052': '\u211b',
+		'\u0051': 0x1d4ac,
+		'\u0050': 0x1d4ab,
+		'\u004f': 0x1d4aa,
+		'\u004e': 0x1d4a9,
+		'\u004d': '\u2133',
+		'\u004c': '\u2112',
+		'\u004b': 0x1d4a6,
+		'\u004a': 0x1d4a5,
+		'\u0049': '\u2110',
+		'\u0048': '\u210b',
+		'\u0047': 0x1d4a2,
+		'\u0046': '\u2131',
+		'\u0045': '\u2130',
+		'\u0044': 0x1d49f,
+		'\u0043': 0x1d49e,
+		'\u0042': '\u212c',
+		'\u0041': 0x1d49c,
 	},
-	"\\\\mathfrak": {
+	"\\mathfrak": {
 		'\u007a': 0x1d537,
 		'\u0079': 0x1d536,
 		'\u0078': 0x1d535,
@@ -1198,7 +1207,7 @@ var LatexStyles = map[string]map[rune]rune{
 		'\u0042': 0x1d505,
 		'\u0041': 0x1d504,
 	},
-	"\\\\textfrak": {
+	"\\textfrak": {
 		'\u007a': 0x1d537,
 		'\u0079': 0x1d536,
 		'\u0078': 0x1d535,
@@ -1252,7 +1261,7 @@ var LatexStyles = map[string]map[rune]rune{
 		'\u0042': 0x1d505,
 		'\u0041': 0x1d504,
 	},
-	"\\\\mathit": {
+	"\\mathit": {
 		'\u2207': 0x1d6fb,
 		'\u2202': 0x1d715,
 		'\u03f5': 0x1d716,
@@ -1364,7 +1373,7 @@ var LatexStyles = map[string]map[rune]rune{
 		'\u0042': 0x1d435,
 		'\u0041': 0x1d434,
 	},
-	"\\\\textit": {
+	"\\textit": {
 		'\u2207': 0x1d6fb,
 		'\u2202': 0x1d715,
 		'\u03f5': 0x1d716,
@@ -1476,7 +1485,7 @@ var LatexStyles = map[string]map[rune]rune{
 		'\u0042': 0x1d435,
 		'\u0041': 0x1d434,
 	},
-	"\\\\mathtt": {
+	"\\mathtt": {
 		'\u007a': 0x1d6a3,
 		'\u0079': 0x1d6a2,
 		'\u0078': 0x1d6a1,
@@ -1540,7 +1549,7 @@ var LatexStyles = map[string]map[rune]rune{
 		'\u0031': 0x1d7f7,
 		'\u0030': 0x1d7f6,
 	},
-	"\\\\texttt": {
+	"\\texttt": {
 		'\u007a': 0x1d6a3,
 		'\u0079': 0x1d6a2,
 		'\u0078': 0x1d6a1,
@@ -1604,9 +1613,291 @@ var LatexStyles = map[string]map[rune]rune{
 		'\u0031': 0x1d7f7,
 		'\u0030': 0x1d7f6,
 	},
-	"\\\\mathrm": {
+	// \mathscr 在 Unicode 中与 \mathcal 共用同一组花体字母
+	"\\mathscr": {
+		'\u007a': 0x1d4cf,
+		'\u0079': 0x1d4ce,
+		'\u0078': 0x1d4cd,
+		'\u0077': 0x1d4cc,
+		'\u0076': 0x1d4cb,
+		'\u0075': 0x1d4ca,
+		'\u0074': 0x1d4c9,
+		'\u0073': 0x1d4c8,
+		'\u0072': 0x1d4c7,
+		'\u0071': 0x1d4c6,
+		'\u0070': 0x1d4c5,
+		'\u006f': '\u2134',
+		'\u006e': 0x1d4c3,
+		'\u006d': 0x1d4c2,
+		'\u006c': 0x1d4c1,
+		'\u006b': 0x1d4c0,
+		'\u006a': 0x1d4bf,
+		'\u0069': 0x1d4be,
+		'\u0068': 0x1d4bd,
+		'\u0067': '\u210a',
+		'\u0066': 0x1d4bb,
+		'\u0065': '\u212f',
+		'\u0064': 0x1d4b9,
+		'\u0063': 0x1d4b8,
+		'\u0062': 0x1d4b7,
+		'\u0061': 0x1d4b6,
+		'\u005a': 0x1d4b5,
+		'\u0059': 0x1d4b4,
+		'\u0058': 0x1d4b3,
+		'\u0057': 0x1d4b2,
+		'\u0056': 0x1d4b1,
+		'\u0055': 0x1d4b0,
+		'\u0054': 0x1d4af,
+		'\u0053': 0x1d4ae,
+		'\u0052': '\u211b',
+		'\u0051': 0x1d4ac,
+		'\u0050': 0x1d4ab,
+		'\u004f': 0x1d4aa,
+		'\u004e': 0x1d4a9,
+		'\u004d': '\u2133',
+		'\u004c': '\u2112',
+		'\u004b': 0x1d4a6,
+		'\u004a': 0x1d4a5,
+		'\u0049': '\u2110',
+		'\u0048': '\u210b',
+		'\u0047': 0x1d4a2,
+		'\u0046': '\u2131',
+		'\u0045': '\u2130',
+		'\u0044': 0x1d49f,
+		'\u0043': 0x1d49e,
+		'\u0042': '\u212c',
+		'\u0041': 0x1d49c,
 	},
-	"\\\\mathsf": {
+	// \boldsymbol / \bm：拉丁字母和希腊字母为粗斜体，数字为粗体
+	"\\boldsymbol": {
+		'\u03c9': 0x1d74e,
+		'\u03c8': 0x1d74d,
+		'\u03c7': 0x1d74c,
+		'\u03c6': 0x1d74b,
+		'\u03c5': 0x1d74a,
+		'\u03c4': 0x1d749,
+		'\u03c3': 0x1d748,
+		'\u03c2': 0x1d747,
+		'\u03c1': 0x1d746,
+		'\u03c0': 0x1d745,
+		'\u03bf': 0x1d744,
+		'\u03be': 0x1d743,
+		'\u03bd': 0x1d742,
+		'\u03bc': 0x1d741,
+		'\u03bb': 0x1d740,
+		'\u03ba': 0x1d73f,
+		'\u03b9': 0x1d73e,
+		'\u03b8': 0x1d73d,
+		'\u03b7': 0x1d73c,
+		'\u03b6': 0x1d73b,
+		'\u03b5': 0x1d73a,
+		'\u03b4': 0x1d739,
+		'\u03b3': 0x1d738,
+		'\u03b2': 0x1d737,
+		'\u03b1': 0x1d736,
+		'\u03a9': 0x1d734,
+		'\u03a8': 0x1d733,
+		'\u03a7': 0x1d732,
+		'\u03a6': 0x1d731,
+		'\u03a5': 0x1d730,
+		'\u03a4': 0x1d72f,
+		'\u03a3': 0x1d72e,
+		'\u03a1': 0x1d72c,
+		'\u03a0': 0x1d72b,
+		'\u039f': 0x1d72a,
+		'\u039e': 0x1d729,
+		'\u039d': 0x1d728,
+		'\u039c': 0x1d727,
+		'\u039b': 0x1d726,
+		'\u039a': 0x1d725,
+		'\u0399': 0x1d724,
+		'\u0398': 0x1d723,
+		'\u0397': 0x1d722,
+		'\u0396': 0x1d721,
+		'\u0395': 0x1d720,
+		'\u0394': 0x1d71f,
+		'\u0393': 0x1d71e,
+		'\u0392': 0x1d71d,
+		'\u0391': 0x1d71c,
+		'\u007a': 0x1d49b,
+		'\u0079': 0x1d49a,
+		'\u0078': 0x1d499,
+		'\u0077': 0x1d498,
+		'\u0076': 0x1d497,
+		'\u0075': 0x1d496,
+		'\u0074': 0x1d495,
+		'\u0073': 0x1d494,
+		'\u0072': 0x1d493,
+		'\u0071': 0x1d492,
+		'\u0070': 0x1d491,
+		'\u006f': 0x1d490,
+		'\u006e': 0x1d48f,
+		'\u006d': 0x1d48e,
+		'\u006c': 0x1d48d,
+		'\u006b': 0x1d48c,
+		'\u006a': 0x1d48b,
+		'\u0069': 0x1d48a,
+		'\u0068': 0x1d489,
+		'\u0067': 0x1d488,
+		'\u0066': 0x1d487,
+		'\u0065': 0x1d486,
+		'\u0064': 0x1d485,
+		'\u0063': 0x1d484,
+		'\u0062': 0x1d483,
+		'\u0061': 0x1d482,
+		'\u005a': 0x1d481,
+		'\u0059': 0x1d480,
+		'\u0058': 0x1d47f,
+		'\u0057': 0x1d47e,
+		'\u0056': 0x1d47d,
+		'\u0055': 0x1d47c,
+		'\u0054': 0x1d47b,
+		'\u0053': 0x1d47a,
+		'\u0052': 0x1d479,
+		'\u0051': 0x1d478,
+		'\u0050': 0x1d477,
+		'\u004f': 0x1d476,
+		'\u004e': 0x1d475,
+		'\u004d': 0x1d474,
+		'\u004c': 0x1d473,
+		'\u004b': 0x1d472,
+		'\u004a': 0x1d471,
+		'\u0049': 0x1d470,
+		'\u0048': 0x1d46f,
+		'\u0047': 0x1d46e,
+		'\u0046': 0x1d46d,
+		'\u0045': 0x1d46c,
+		'\u0044': 0x1d46b,
+		'\u0043': 0x1d46a,
+		'\u0042': 0x1d469,
+		'\u0041': 0x1d468,
+		'\u0039': 0x1d7d7,
+		'\u0038': 0x1d7d6,
+		'\u0037': 0x1d7d5,
+		'\u0036': 0x1d7d4,
+		'\u0035': 0x1d7d3,
+		'\u0034': 0x1d7d2,
+		'\u0033': 0x1d7d1,
+		'\u0032': 0x1d7d0,
+		'\u0031': 0x1d7cf,
+		'\u0030': 0x1d7ce,
+	},
+	"\\bm": {
+		'\u03c9': 0x1d74e,
+		'\u03c8': 0x1d74d,
+		'\u03c7': 0x1d74c,
+		'\u03c6': 0x1d74b,
+		'\u03c5': 0x1d74a,
+		'\u03c4': 0x1d749,
+		'\u03c3': 0x1d748,
+		'\u03c2': 0x1d747,
+		'\u03c1': 0x1d746,
+		'\u03c0': 0x1d745,
+		'\u03bf': 0x1d744,
+		'\u03be': 0x1d743,
+		'\u03bd': 0x1d742,
+		'\u03bc': 0x1d741,
+		'\u03bb': 0x1d740,
+		'\u03ba': 0x1d73f,
+		'\u03b9': 0x1d73e,
+		'\u03b8': 0x1d73d,
+		'\u03b7': 0x1d73c,
+		'\u03b6': 0x1d73b,
+		'\u03b5': 0x1d73a,
+		'\u03b4': 0x1d739,
+		'\u03b3': 0x1d738,
+		'\u03b2': 0x1d737,
+		'\u03b1': 0x1d736,
+		'\u03a9': 0x1d734,
+		'\u03a8': 0x1d733,
+		'\u03a7': 0x1d732,
+		'\u03a6': 0x1d731,
+		'\u03a5': 0x1d730,
+		'\u03a4': 0x1d72f,
+		'\u03a3': 0x1d72e,
+		'\u03a1': 0x1d72c,
+		'\u03a0': 0x1d72b,
+		'\u039f': 0x1d72a,
+		'\u039e': 0x1d729,
+		'\u039d': 0x1d728,
+		'\u039c': 0x1d727,
+		'\u039b': 0x1d726,
+		'\u039a': 0x1d725,
+		'\u0399': 0x1d724,
+		'\u0398': 0x1d723,
+		'\u0397': 0x1d722,
+		'\u0396': 0x1d721,
+		'\u0395': 0x1d720,
+		'\u0394': 0x1d71f,
+		'\u0393': 0x1d71e,
+		'\u0392': 0x1d71d,
+		'\u0391': 0x1d71c,
+		'\u007a': 0x1d49b,
+		'\u0079': 0x1d49a,
+		'\u0078': 0x1d499,
+		'\u0077': 0x1d498,
+		'\u0076': 0x1d497,
+		'\u0075': 0x1d496,
+		'\u0074': 0x1d495,
+		'\u0073': 0x1d494,
+		'\u0072': 0x1d493,
+		'\u0071': 0x1d492,
+		'\u0070': 0x1d491,
+		'\u006f': 0x1d490,
+		'\u006e': 0x1d48f,
+		'\u006d': 0x1d48e,
+		'\u006c': 0x1d48d,
+		'\u006b': 0x1d48c,
+		'\u006a': 0x1d48b,
+		'\u0069': 0x1d48a,
+		'\u0068': 0x1d489,
+		'\u0067': 0x1d488,
+		'\u0066': 0x1d487,
+		'\u0065': 0x1d486,
+		'\u0064': 0x1d485,
+		'\u0063': 0x1d484,
+		'\u0062': 0x1d483,
+		'\u0061': 0x1d482,
+		'\u005a': 0x1d481,
+		'\u0059': 0x1d480,
+		'\u0058': 0x1d47f,
+		'\u0057': 0x1d47e,
+		'\u0056': 0x1d47d,
+		'\u0055': 0x1d47c,
+		'\u0054': 0x1d47b,
+		'\u0053': 0x1d47a,
+		'\u0052': 0x1d479,
+		'\u0051': 0x1d478,
+		'\u0050': 0x1d477,
+		'\u004f': 0x1d476,
+		'\u004e': 0x1d475,
+		'\u004d': 0x1d474,
+		'\u004c': 0x1d473,
+		'\u004b': 0x1d472,
+		'\u004a': 0x1d471,
+		'\u0049': 0x1d470,
+		'\u0048': 0x1d46f,
+		'\u0047': 0x1d46e,
+		'\u0046': 0x1d46d,
+		'\u0045': 0x1d46c,
+		'\u0044': 0x1d46b,
+		'\u0043': 0x1d46a,
+		'\u0042': 0x1d469,
+		'\u0041': 0x1d468,
+		'\u0039': 0x1d7d7,
+		'\u0038': 0x1d7d6,
+		'\u0037': 0x1d7d5,
+		'\u0036': 0x1d7d4,
+		'\u0035': 0x1d7d3,
+		'\u0034': 0x1d7d2,
+		'\u0033': 0x1d7d1,
+		'\u0032': 0x1d7d0,
+		'\u0031': 0x1d7cf,
+		'\u0030': 0x1d7ce,
+	},
+	"\\mathrm": {
+	},
+	"\\mathsf": {
 	},
 }
 
@@ -13,6 +13,8 @@ import (
 	_ "image/png"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
 	_ "golang.org/x/image/webp"
@@ -30,6 +32,24 @@ func DefaultConfig() *Config {
 	}
 }
 
+// URLOptions 图片和编辑器 URL 的参数
+type URLOptions struct {
+	Theme string // 主题：default、neutral、dark、forest
+	Type  string // 图片格式：webp、png、jpeg
+	Width int    // 图片宽度（像素），0 表示由服务端决定
+	Scale int    // 缩放倍数，需要同时设置 Width，0 表示不缩放
+}
+
+// DefaultURLOptions 返回管道使用的默认参数
+func DefaultURLOptions() URLOptions {
+	return URLOptions{
+		Theme: "default",
+		Type:  "webp",
+		Width: 500,
+		Scale: 2,
+	}
+}
+
 // compressToDeflate 使用 DEFLATE 算法压缩数据
 func compressToDeflate(data []byte) ([]byte, error) {
 	var buf bytes.Buffer
@@ -82,21 +102,52 @@ func GeneratePako(graphMarkdown string, config *Config) (string, error) {
 // GetMermaidLiveURL 获取 Mermaid Live 编辑器 URL
 // 可用于在浏览器中编辑图表
 func GetMermaidLiveURL(graphMarkdown string) (string, error) {
-	pako, err := GeneratePako(graphMarkdown, nil)
+	return LiveURL(graphMarkdown, DefaultURLOptions())
+}
+
+// GetMermaidInkURL 获取 Mermaid Ink 图片 URL
+// 可用于下载图片
+func GetMermaidInkURL(graphMarkdown string) (string, error) {
+	return InkURL(graphMarkdown, DefaultURLOptions())
+}
+
+// LiveURL 按 opts 生成 Mermaid Live 编辑器 URL，只使用其中的主题
+func LiveURL(graphMarkdown string, opts URLOptions) (string, error) {
+	pako, err := GeneratePako(graphMarkdown, &Config{Theme: opts.Theme})
 	if err != nil {
 		return "", err
 	}
 	return fmt.Sprintf("https://mermaid.live/edit/#%s", pako), nil
 }
 
-// GetMermaidInkURL 获取 Mermaid Ink 图片 URL
-// 可用于下载图片
-func GetMermaidInkURL(graphMarkdown string) (string, error) {
+// InkURL 按 opts 生成 Mermaid Ink 图片 URL，空值和 0 的参数不出现在查询串中
+func InkURL(graphMarkdown string, opts URLOptions) (string, error) {
 	pako, err := GeneratePako(graphMarkdown, nil)
 	if err != nil {
 		return "", err
 	}
-	return fmt.Sprintf("https://mermaid.ink/img/%s?theme=default&width=500&scale=2&type=webp", pako), nil
+	// 按固定顺序拼接，同样的参数总是得到同样的 URL
+	var query []string
+	add := func(key, value string) {
+		if value != "" && value != "0" {
+			query = append(query, key+"="+url.QueryEscape(value))
+		}
+	}
+	add("theme", opts.Theme)
+	add("width", strconv.Itoa(opts.Width))
+	if opts.Width > 0 {
+		add("scale", strconv.Itoa(opts.Scale))
+	}
+	add("type", opts.Type)
+	u := "https://mermaid.ink/img/" + pako
+	for i, q := range query {
+		if i == 0 {
+			u += "?" + q
+		} else {
+			u += "&" + q
+		}
+	}
+	return u, nil
 }
 
 // DownloadImage 异步下载图片
@@ -160,18 +211,26 @@ func RenderMermaid(ctx context.Context, diagram string, client *http.Client) (*b
 		return nil, "", err
 	}
 	
-	// 下载图片
-	imgData, err := DownloadImage(ctx, imgURL, client)
+	imgData, err := Download(ctx, imgURL, client)
 	if err != nil {
 		return nil, "", err
 	}
+	return imgData, caption, nil
+}
+
+// Download 下载 imgURL 处的图片并验证是有效图片
+func Download(ctx context.Context, imgURL string, client *http.Client) (*bytes.Buffer, error) {
+	imgData, err := DownloadImage(ctx, imgURL, client)
+	if err != nil {
+		return nil, err
+	}
 	
 	// 验证图片
 	if !IsImage(imgData) {
-		return nil, "", fmt.Errorf("downloaded data is not a valid image")
+		return nil, fmt.Errorf("downloaded data is not a valid image")
 	}
 	
-	return imgData, caption, nil
+	return imgData, nil
 }
 
 // SupportMermaid 检查是否支持 Mermaid 渲染
@@ -12,6 +12,10 @@ import (
 )
 
 // StandardOptions goldmark 扩展配置，对应 pyromark 的 STANDARD_OPTIONS
+//
+// EventWalker 识别 CommonMark 的全部节点和 GFM 的表格、删除线、任务列表；
+// 定义列表和脚注节点按普通容器只转换其子节点。其他扩展产生的节点同样只转换子节点，
+// 没有子节点的未知节点不产生输出。
 var StandardOptions = []goldmark.Option{
 	goldmark.WithExtensions(
 		extension.GFM,            // GitHub Flavored Markdown (tables, strikethrough, tasklists)
@@ -23,28 +27,122 @@ var StandardOptions = []goldmark.Option{
 	),
 }
 
+// Typographer 将直引号、-- / --- 和 ... 替换为弯引号、短划线 / 长划线和省略号的 goldmark 扩展
+//
+// 替换为 Unicode 字符而不是 goldmark 默认的 HTML 实体；代码、链接地址和 HTML 不受影响。
+// << 和 >> 保持原样，它们在普通文字中也常见（如位移运算）。
+var Typographer = extension.NewTypographer(extension.WithTypographicSubstitutions(map[extension.TypographicPunctuation][]byte{
+	extension.LeftSingleQuote:  []byte("‘"),
+	extension.RightSingleQuote: []byte("’"),
+	extension.LeftDoubleQuote:  []byte("“"),
+	extension.RightDoubleQuote: []byte("”"),
+	extension.EnDash:           []byte("–"),
+	extension.EmDash:           []byte("—"),
+	extension.Ellipsis:         []byte("…"),
+	extension.LeftAngleQuote:   nil,
+	extension.RightAngleQuote:  nil,
+	extension.Apostrophe:       []byte("’"),
+}))
+
 // Parse 解析 Markdown 并遍历 AST 生成 (text, entities, segments)
 func Parse(markdown string, config *converter.RenderConfig) (string, []converter.MessageEntity, []converter.Segment) {
-	if config == nil {
-		config = types.DefaultRenderConfig()
+	return ParseBytes([]byte(markdown), config)
+}
+
+// ParseBytes 与 Parse 相同，但直接使用 source，不做额外复制
+//
+// 返回值不引用 source，调用方可以在返回后复用 source 的底层数组。
+func ParseBytes(source []byte, config *converter.RenderConfig) (string, []converter.MessageEntity, []converter.Segment) {
+	return New().Parse(source, config)
+}
+
+// Parser 可复用的解析器，持有 goldmark 实例和 EventWalker
+//
+// goldmark.New 会构建整条扩展管道，开销较大；高频场景应复用 Parser。
+// Parser 不是并发安全的，并发使用时每个 goroutine 需要各自的实例（例如放入 sync.Pool）。
+type Parser struct {
+	md       goldmark.Markdown
+	walker   *converter.EventWalker
+	headings []converter.Heading
+	dropped  []converter.DroppedLink
+	html     []string
+	images   int
+	limit    *types.LimitError
+}
+
+// New 使用 StandardOptions 创建新的 Parser
+func New() *Parser {
+	return NewWithOptions(StandardOptions...)
+}
+
+// NewWithOptions 使用给定的 goldmark 选项创建 Parser，opts 替代 StandardOptions
+func NewWithOptions(opts ...goldmark.Option) *Parser {
+	return &Parser{
+		md:     goldmark.New(opts...),
+		walker: converter.NewEventWalker(nil, nil),
 	}
-	// 创建 goldmark 解析器
-	md := goldmark.New(StandardOptions...)
-	
+}
+
+// Parse 解析 source 并返回 (text, entities, segments)，返回值不引用 source
+func (p *Parser) Parse(source []byte, config *converter.RenderConfig) (string, []converter.MessageEntity, []converter.Segment) {
 	// 解析为 AST
-	source := []byte(markdown)
 	reader := text.NewReader(source)
-	node := md.Parser().Parse(reader)
-	
-	// 创建 Walker
-	walker := converter.NewEventWalker(source, config)
+	node := p.md.Parser().Parse(reader)
+	return p.Walk(node, source, config)
+}
+
+// Walk 遍历已解析的 AST 并返回 (text, entities, segments)，返回值不引用 source
+//
+// node 必须由 source 解析得到。未识别的节点类型只遍历其子节点，
+// 因此启用了额外扩展或缺少 StandardOptions 中扩展的 AST 也能转换。
+func (p *Parser) Walk(node ast.Node, source []byte, config *converter.RenderConfig) (string, []converter.MessageEntity, []converter.Segment) {
+	if config == nil {
+		config = types.DefaultRenderConfig()
+	}
+	// 复用 Walker
+	walker := p.walker
+	walker.Reset(source, config)
 	
 	// 遍历 AST
 	_ = ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
 		return walker.Walk(n, entering)
 	})
 	
-	return walker.Result()
+	plain, entities, segments := walker.Result()
+	p.headings = walker.Headings()
+	p.dropped = walker.DroppedLinks()
+	p.html = walker.DroppedHTML()
+	p.images = walker.Images()
+	p.limit = walker.Limit()
+	// 复用的 walker 不应继续持有 source
+	walker.Reset(nil, nil)
+	return plain, entities, segments
+}
+
+// Headings 返回最近一次 Parse 或 Walk 记录的文档顶层标题
+func (p *Parser) Headings() []converter.Heading {
+	return p.headings
+}
+
+// DroppedLinks 返回最近一次 Parse 或 Walk 中只渲染为文字的链接
+func (p *Parser) DroppedLinks() []converter.DroppedLink {
+	return p.dropped
+}
+
+// DroppedHTML 返回最近一次 Parse 或 Walk 中被丢弃的 HTML 元素的标签名
+func (p *Parser) DroppedHTML() []string {
+	return p.html
+}
+
+// Images 返回最近一次 Parse 或 Walk 中的图片数量
+func (p *Parser) Images() int {
+	return p.images
+}
+
+// Limit 返回最近一次 Parse 或 Walk 超出的安全上限，未超出时为 nil；
+// 超出时返回的结果只包含停止遍历前生成的部分
+func (p *Parser) Limit() *types.LimitError {
+	return p.limit
 }
 
 // ParseWithCustomRenderer 使用自定义渲染器（预留）
@@ -1,13 +1,62 @@
 package types
 
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// Bot API 的 entity 类型
+const (
+	EntityMention              = "mention"
+	EntityHashtag              = "hashtag"
+	EntityCashtag              = "cashtag"
+	EntityBotCommand           = "bot_command"
+	EntityURL                  = "url"
+	EntityEmail                = "email"
+	EntityPhoneNumber          = "phone_number"
+	EntityBold                 = "bold"
+	EntityItalic               = "italic"
+	EntityUnderline            = "underline"
+	EntityStrikethrough        = "strikethrough"
+	EntitySpoiler              = "spoiler"
+	EntityBlockquote           = "blockquote"
+	EntityExpandableBlockquote = "expandable_blockquote"
+	EntityCode                 = "code"
+	EntityPre                  = "pre"
+	EntityTextLink             = "text_link"
+	EntityTextMention          = "text_mention"
+	EntityCustomEmoji          = "custom_emoji"
+)
+
+// StandardEntityTypes 返回可以由 <tg-entity> 标签生成的标准实体类型，即 Bot API 的
+// 全部类型，text_mention 除外：标签无法携带它需要的用户
+func StandardEntityTypes() []string {
+	return []string{
+		EntityMention, EntityHashtag, EntityCashtag, EntityBotCommand, EntityURL,
+		EntityEmail, EntityPhoneNumber, EntityBold, EntityItalic, EntityUnderline,
+		EntityStrikethrough, EntitySpoiler, EntityBlockquote, EntityExpandableBlockquote,
+		EntityCode, EntityPre, EntityTextLink, EntityCustomEmoji,
+	}
+}
+
+// EntityUser 是 text_mention 实体提及的用户
+type EntityUser struct {
+	ID        int64  `json:"id"`
+	FirstName string `json:"first_name"`
+	Username  string `json:"username,omitempty"`
+}
+
 // MessageEntity 表示 Telegram 消息实体
 type MessageEntity struct {
-	Type          string `json:"type"`
-	Offset        int    `json:"offset"`
-	Length        int    `json:"length"`
-	URL           string `json:"url,omitempty"`
-	Language      string `json:"language,omitempty"`
-	CustomEmojiID string `json:"custom_emoji_id,omitempty"`
+	Type          string      `json:"type"`
+	Offset        int         `json:"offset"`
+	Length        int         `json:"length"`
+	URL           string      `json:"url,omitempty"`
+	User          *EntityUser `json:"user,omitempty"`
+	Language      string      `json:"language,omitempty"`
+	CustomEmojiID string      `json:"custom_emoji_id,omitempty"`
 }
 
 // ToDict 将 MessageEntity 转换为 map
@@ -20,6 +69,16 @@ func (e MessageEntity) ToDict() map[string]interface{} {
 	if e.URL != "" {
 		result["url"] = e.URL
 	}
+	if e.User != nil {
+		user := map[string]interface{}{
+			"id":         e.User.ID,
+			"first_name": e.User.FirstName,
+		}
+		if e.User.Username != "" {
+			user["username"] = e.User.Username
+		}
+		result["user"] = user
+	}
 	if e.Language != "" {
 		result["language"] = e.Language
 	}
@@ -41,6 +100,8 @@ type Symbol struct {
 	Image           string
 	TaskCompleted   string
 	TaskUncompleted string
+	// Rule 是分隔线的文字，为空时不显示分隔线，但前后的段落仍以空行分隔
+	Rule string
 }
 
 // DefaultSymbol 返回默认符号配置
@@ -56,16 +117,268 @@ func DefaultSymbol() *Symbol {
 		Image:           "🖼",
 		TaskCompleted:   "✅",
 		TaskUncompleted: "☑️",
+		Rule:            "————————",
 	}
 }
 
+// Validate 检查符号中没有换行符：符号与后面的文本写在同一行，换行会破坏
+// 标题、引用和列表的排版以及按行计算的实体
+func (s *Symbol) Validate() error {
+	if s == nil {
+		return nil
+	}
+	fields := []struct {
+		name, value string
+	}{
+		{"HeadingLevel1", s.HeadingLevel1},
+		{"HeadingLevel2", s.HeadingLevel2},
+		{"HeadingLevel3", s.HeadingLevel3},
+		{"HeadingLevel4", s.HeadingLevel4},
+		{"HeadingLevel5", s.HeadingLevel5},
+		{"HeadingLevel6", s.HeadingLevel6},
+		{"Quote", s.Quote},
+		{"Image", s.Image},
+		{"TaskCompleted", s.TaskCompleted},
+		{"TaskUncompleted", s.TaskUncompleted},
+		{"Rule", s.Rule},
+	}
+	for _, f := range fields {
+		if strings.ContainsAny(f.value, "\r\n") {
+			return fmt.Errorf("telegramify: symbol %s %q contains a line break", f.name, f.value)
+		}
+	}
+	return nil
+}
+
+// Clone 返回 s 的副本，nil 时返回 nil
+func (s *Symbol) Clone() *Symbol {
+	if s == nil {
+		return nil
+	}
+	c := *s
+	return &c
+}
+
+// MathDelimiters 控制 LaTeX 公式转换为 Unicode 后如何呈现
+type MathDelimiters string
+
+const (
+	// MathDelimitersKeep 保留 $...$ / $$...$$ 包裹（默认）
+	MathDelimitersKeep MathDelimiters = "keep"
+	// MathDelimitersStrip 去掉包裹，只留下转换结果
+	MathDelimitersStrip MathDelimiters = "strip"
+	// MathDelimitersCode 行内公式渲染为 code，块级公式渲染为单独成行的 pre
+	MathDelimitersCode MathDelimiters = "code"
+)
+
+// UnknownLatexCommands 控制公式中无法识别的 LaTeX 命令如何输出
+type UnknownLatexCommands string
+
+const (
+	// UnknownLatexCommandsKeep 原样保留命令文本，如 \foobar（默认）
+	UnknownLatexCommandsKeep UnknownLatexCommands = "keep"
+	// UnknownLatexCommandsStrip 去掉反斜杠，输出 foobar
+	UnknownLatexCommandsStrip UnknownLatexCommands = "strip"
+	// UnknownLatexCommandsDrop 丢弃命令及紧跟的 {...} 参数
+	UnknownLatexCommandsDrop UnknownLatexCommands = "drop"
+)
+
+// LinkStyle 控制链接如何呈现
+type LinkStyle string
+
+const (
+	// LinkStyleEntity 链接文字带 text_link 实体（默认）
+	LinkStyleEntity LinkStyle = "entity"
+	// LinkStyleFootnote 链接渲染为 "文字 [1]"，文末附上 "[1] 地址" 列表，同一地址共用编号
+	LinkStyleFootnote LinkStyle = "footnote"
+	// LinkStyleInlineURL 链接渲染为 "文字 (地址)"
+	LinkStyleInlineURL LinkStyle = "inline-url"
+)
+
+// Spacing 控制块与块之间的空白
+type Spacing string
+
+const (
+	// SpacingNormal 块之间以空行分隔（默认）
+	SpacingNormal Spacing = "normal"
+	// SpacingCompact 块之间只换行，不留空行；代码块前后仍保留一个空行
+	SpacingCompact Spacing = "compact"
+)
+
+// CustomEmojiMode 控制 tg://emoji 链接和图片是否生成 custom_emoji 实体
+type CustomEmojiMode string
+
+const (
+	// CustomEmojiOn 生成 custom_emoji 实体（默认）
+	CustomEmojiOn CustomEmojiMode = "on"
+	// CustomEmojiOff 不生成实体，只保留作为后备的表情文字。非 Premium 的机器人
+	// 发送 custom_emoji 实体会被 sendMessage 拒绝
+	CustomEmojiOff CustomEmojiMode = "off"
+)
+
 // RenderConfig 渲染配置
 type RenderConfig struct {
 	MarkdownSymbol *Symbol
 	CiteExpandable bool
+	// Debug 为 true 时管道会用 ValidateEntities 校验每个 Text，
+	// 校验失败写入 ContentTrace.Extra["diagnostics"]
+	Debug bool
+	// MathDelimiters 为空时等同于 MathDelimitersKeep
+	MathDelimiters MathDelimiters
+	// MathEntity 不为空时，转换为 Unicode 的行内公式带上该类型的实体，如 EntityItalic
+	// 或 EntityCode，与正文区分开；MathBlockEntity 对块级公式同样处理，如 EntityBlockquote
+	// 或 EntityPre，块级公式随之单独成段（列表项中单独成行，不生成引用）。行内公式的实体
+	// 只覆盖公式本身，不含 $ 分隔符；块级公式的实体包含 $$，引用从行首开始。
+	// MathDelimiters 为 MathDelimitersCode 时不生效
+	MathEntity      string
+	MathBlockEntity string
+	// UnknownLatexCommands 为空时等同于 UnknownLatexCommandsKeep
+	UnknownLatexCommands UnknownLatexCommands
+	// TrimTrailingSpaces 为 true 时删除渲染结果每行末尾的空格和制表符，
+	// 代码块内容不受影响
+	TrimTrailingSpaces bool
+	// NormalizeNFC 为 true 时解析前将 Markdown 转为 Unicode NFC 形式，
+	// NormalizeNFCSkipCode 再为 true 时代码块和行内代码保持原始字节
+	NormalizeNFC         bool
+	NormalizeNFCSkipCode bool
+	// FrontMatterHeading 列出要渲染的 front matter 键，如 {"title", "date"}：
+	// 第一个存在的键渲染为一级标题，其余为斜体行。为空时 front matter 只被删除
+	FrontMatterHeading []string
+	// MergeEntities 为 true 时合并相邻或重叠的同类实体并去除重复，
+	// 减少实体数量（Telegram 每条消息最多 100 个）
+	MergeEntities bool
+	// BaseURL 用于解析没有协议的相对链接，如转发 GitHub README 时设为仓库地址；
+	// 为空时相对链接只渲染为文字
+	BaseURL string
+	// ShowDroppedLinkURL 为 true 时，因协议不安全或无法解析而没有生成实体的链接
+	// 在文字后以括号附上原地址
+	ShowDroppedLinkURL bool
+	// LinkStyle 为空时等同于 LinkStyleEntity；另外两种样式不生成 text_link 实体，
+	// 适合不支持实体的纯文本转发目标
+	LinkStyle LinkStyle
+	// Spacing 为空时等同于 SpacingNormal；SpacingCompact 适合频繁发送的短消息，
+	// 标题、段落、列表和引用之间不再留空行
+	Spacing Spacing
+	// CustomEmoji 为空时等同于 CustomEmojiOn；为 CustomEmojiOff 时 [😀](tg://emoji?id=...)
+	// 只输出 😀，<tg-entity type="custom_emoji"> 同样不生成实体
+	CustomEmoji CustomEmojiMode
+	// MarkEntity 是 <mark> 标签对应的实体类型，如 EntityBold；为空时为 underline
+	MarkEntity string
+	// DisableLanguageDetection 为 true 时不再根据内容（shebang、JSON、SQL 等特征）
+	// 猜测没有标注语言的代码块的语言
+	DisableLanguageDetection bool
+	// DisableQuoteAttribution 为 true 时不再识别引用最后一行 "— 作者" 形式的署名；
+	// 识别出的署名渲染为斜体，且不计入自动折叠引用的长度
+	DisableQuoteAttribution bool
+	// DisabledEntities 列出不生成的实体类型，如 {EntityUnderline, EntitySpoiler}，
+	// 对应的文字照常输出。禁用 EntityBlockquote 同时禁用 EntityExpandableBlockquote；
+	// 禁用 EntityPre 时代码块作为普通文字留在正文中，不再提取为文件
+	DisabledEntities []string
+	// EntityTagTypes 列出 <tg-entity type="..."> 标签可以生成的实体类型，为空时为
+	// StandardEntityTypes；自建 Bot API 服务或 TDLib 支持的实验类型需要在这里列出。
+	// 类型不在其中的标签只保留文字
+	EntityTagTypes []string
+	// RuleWidth 大于 0 且 MarkdownSymbol.Rule 是单个字符时，分隔线由该字符重复
+	// RuleWidth 次组成，如 Rule 为 "─"、RuleWidth 为 24
+	RuleWidth int
+	// CodeSanitizer 不为 nil 时在代码块和行内代码写入前调用，返回值代替原代码，
+	// 用于遮盖令牌等敏感信息。lang 是代码块的语言（行内代码为空），
+	// 处理后的代码同样用于提取的文件和 Mermaid 渲染
+	CodeSanitizer func(lang, code string) string
+	// InlineCodeBlockMax 大于 0 时，只有一行且不超过该 UTF-16 长度的代码块
+	// （Mermaid 除外）生成 code 实体而不是 pre，不带复制按钮、更节省空间；
+	// 这样的代码块不产生 Segment，也不会被提取为文件
+	InlineCodeBlockMax int
+	// MergeCodeBlocks 为 true 时，相邻且语言相同、之间只有空行的代码块合并为一个
+	// pre 实体，原来的代码块之间以空行分隔；合并后的 Segment 按总大小决定是否提取。
+	// 已按 InlineCodeBlockMax 降级为 code 实体的代码块和 Mermaid 图表不参与合并
+	MergeCodeBlocks bool
+	// OnUnknownNode 在遇到转换器不认识的节点（其他 goldmark 扩展产生）时调用，
+	// source 是解析所用的原文。handled 为 true 时用 text 代替该节点及其子节点，
+	// 块级节点与前后的块之间保留空行；为 false 时按默认方式只转换子节点
+	OnUnknownNode func(node ast.Node, source []byte) (text string, handled bool)
+	// MaxEntities、MaxNestingDepth 和 MaxOutputBytes 是防御异常输入的安全上限：
+	// 实体数量、AST 嵌套深度和输出文本的字节数。为 0 时使用 DefaultMaxEntities 等默认值，
+	// 足够宽松，不影响正常文档；为负数时不限制。遍历中超出任一上限即停止，
+	// ConvertE、Process 等返回 *LimitError
+	MaxEntities     int
+	MaxNestingDepth int
+	MaxOutputBytes  int
+	// TruncateOnLimit 为 true 时超出安全上限不返回错误，而是保留停止前已生成的
+	// 文本和实体，并记录一条 Warn 日志
+	TruncateOnLimit bool
+}
+
+// 安全上限的默认值
+const (
+	DefaultMaxEntities     = 100000
+	DefaultMaxNestingDepth = 128
+	DefaultMaxOutputBytes  = 64 << 20
+)
+
+// Limit 返回 value 对应的实际上限：0 时为 def，负数时为 0（不限制）
+func Limit(value, def int) int {
+	if value == 0 {
+		return def
+	}
+	return max(value, 0)
+}
+
+// LimitError 表示文档超出了 RenderConfig 的安全上限
+type LimitError struct {
+	// Limit 是超出的上限名称："MaxEntities"、"MaxNestingDepth" 或 "MaxOutputBytes"
+	Limit string
+	// Max 是该上限的值
+	Max int
+}
+
+// Error 实现 error 接口
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("telegramify: document exceeds %s (%d)", e.Limit, e.Max)
+}
+
+// Clone 返回 c 的深拷贝，修改副本（包括 MarkdownSymbol）不影响 c，nil 时返回 nil
+func (c *RenderConfig) Clone() *RenderConfig {
+	if c == nil {
+		return nil
+	}
+	clone := *c
+	clone.MarkdownSymbol = c.MarkdownSymbol.Clone()
+	clone.FrontMatterHeading = append([]string(nil), c.FrontMatterHeading...)
+	clone.DisabledEntities = append([]string(nil), c.DisabledEntities...)
+	clone.EntityTagTypes = append([]string(nil), c.EntityTagTypes...)
+	return &clone
+}
+
+// EntityDisabled 报告 entityType 类型的实体是否被 DisabledEntities 禁用；
+// CustomEmoji 为 CustomEmojiOff 时 custom_emoji 同样视为禁用
+func (c *RenderConfig) EntityDisabled(entityType string) bool {
+	if entityType == EntityCustomEmoji && c.CustomEmoji == CustomEmojiOff {
+		return true
+	}
+	for _, t := range c.DisabledEntities {
+		if t == entityType || (t == EntityBlockquote && entityType == EntityExpandableBlockquote) {
+			return true
+		}
+	}
+	return false
+}
+
+// EntityTagAllowed 报告 <tg-entity> 标签能否生成 entityType 类型的实体
+func (c *RenderConfig) EntityTagAllowed(entityType string) bool {
+	allowed := c.EntityTagTypes
+	if len(allowed) == 0 {
+		allowed = StandardEntityTypes()
+	}
+	for _, t := range allowed {
+		if t == entityType {
+			return true
+		}
+	}
+	return false
 }
 
-// DefaultRenderConfig 返回默认渲染配置
+// DefaultRenderConfig 返回默认渲染配置，每次调用都是新的实例
 func DefaultRenderConfig() *RenderConfig {
 	return &RenderConfig{
 		MarkdownSymbol: DefaultSymbol(),
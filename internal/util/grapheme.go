@@ -0,0 +1,75 @@
+package util
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+const zeroWidthJoiner = '\u200d'
+
+// ContinuesCluster reports whether r belongs to the same user-perceived
+// character as the rune prev before it. Combining marks, variation selectors,
+// emoji skin-tone modifiers and tag characters attach to the preceding
+// character, and any character following a zero-width joiner joins it.
+//
+// This is a small subset of the Unicode grapheme cluster rules, enough to keep
+// emoji sequences and accented letters in one piece.
+func ContinuesCluster(prev, r rune) bool {
+	if prev == zeroWidthJoiner {
+		return true
+	}
+	switch {
+	case r == zeroWidthJoiner:
+		return true
+	case r >= 0xFE00 && r <= 0xFE0F, r >= 0xE0100 && r <= 0xE01EF: // variation selectors
+		return true
+	case r >= 0x1F3FB && r <= 0x1F3FF: // emoji modifiers
+		return true
+	case r >= 0xE0020 && r <= 0xE007F: // tags
+		return true
+	}
+	return unicode.In(r, unicode.Mn, unicode.Me)
+}
+
+// IsClusterBoundary reports whether the byte offset i in text falls between
+// two user-perceived characters. Offsets inside a multi-byte rune are not
+// boundaries; the start and end of text always are.
+func IsClusterBoundary(text string, i int) bool {
+	if i <= 0 || i >= len(text) {
+		return true
+	}
+	if !utf8.RuneStart(text[i]) {
+		return false
+	}
+	prev, _ := utf8.DecodeLastRuneInString(text[:i])
+	r, _ := utf8.DecodeRuneInString(text[i:])
+	return !ContinuesCluster(prev, r)
+}
+
+// UTF16ClusterBoundaries returns, for every UTF-16 offset from 0 to the
+// UTF-16 length of text inclusive, whether it is a cluster boundary.
+func UTF16ClusterBoundaries(text string) []bool {
+	boundaries := make([]bool, 0, len(text)+1)
+	prev := rune(-1)
+	for _, r := range text {
+		boundaries = append(boundaries, prev < 0 || !ContinuesCluster(prev, r))
+		if r > 0xFFFF {
+			// the offset between the two surrogate halves
+			boundaries = append(boundaries, false)
+		}
+		prev = r
+	}
+	return append(boundaries, true)
+}
+
+// SnapToClusters widens the UTF-16 range [start, end) until both edges are
+// cluster boundaries, so that it never covers only part of a character.
+func SnapToClusters(boundaries []bool, start, end int) (int, int) {
+	for start > 0 && start < len(boundaries) && !boundaries[start] {
+		start--
+	}
+	for end < len(boundaries)-1 && end >= 0 && !boundaries[end] {
+		end++
+	}
+	return start, end
+}
@@ -56,9 +56,14 @@ func ExtractValidFilename(line string) string {
 	return ""
 }
 
-// GetExt returns the file extension for a given language.
-func GetExt(language string) string {
-	ext, ok := DefaultLanguageToExt[strings.ToLower(language)]
+// GetExt returns the file extension for a given language. Entries of extra,
+// whose keys must be lowercase, take precedence over DefaultLanguageToExt.
+func GetExt(language string, extra map[string]string) string {
+	language = strings.ToLower(language)
+	if ext, ok := extra[language]; ok {
+		return ext
+	}
+	ext, ok := DefaultLanguageToExt[language]
 	if !ok {
 		return "txt"
 	}
@@ -68,8 +73,8 @@ func GetExt(language string) string {
 // GetFilename generates a filename for a code block.
 //
 // Tries to extract a filename from the first line of the code.
-// Falls back to 'readable.<ext>' based on the language.
-func GetFilename(code string, language string) string {
+// Falls back to 'readable.<ext>' based on the language, looked up as by GetExt.
+func GetFilename(code string, language string, extra map[string]string) string {
 	// Take the first two lines
 	lines := strings.Split(strings.TrimSpace(code), "\n")
 	sample := ""
@@ -82,7 +87,7 @@ func GetFilename(code string, language string) string {
 	sample = strings.ReplaceAll(sample, "\\", "")
 
 	extractedFilename := ExtractValidFilename(sample)
-	ext := GetExt(language)
+	ext := GetExt(language, extra)
 
 	if extractedFilename != "" {
 		// Check if it already has the correct extension and is reasonably short
@@ -1,15 +1,64 @@
 package telegramify
 
 import (
+	"context"
+	"io"
 	"log"
-	"os"
+	"log/slog"
+	"strings"
 )
 
-// Logger 全局日志记录器
-var Logger = log.New(os.Stderr, "[telegramify] ", log.LstdFlags)
+// Logger 旧版全局日志记录器，默认输出到 io.Discard（不输出）
+//
+// Deprecated: 使用 WithLogger 按 Converter 或按调用设置 *slog.Logger。
+// 未设置 WithLogger 时，Logger 的输出不是 io.Discard 则日志经由它输出，
+// 因此 SetLogger 和 Logger.SetOutput 都能启用它。
+var Logger = log.New(io.Discard, "[telegramify] ", log.LstdFlags)
 
-// SetLogger 设置自定义日志记录器
+// SetLogger 设置旧版日志记录器，保留用于兼容
+//
+// Deprecated: 使用 WithLogger。
 func SetLogger(logger *log.Logger) {
 	Logger = logger
 }
 
+// discardLogger 未配置日志时使用，丢弃所有记录
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// resolveLogger 返回本次调用使用的 *slog.Logger：优先 WithLogger，其次旧版 Logger
+func resolveLogger(logger *slog.Logger) *slog.Logger {
+	if logger != nil {
+		return logger
+	}
+	if l := Logger; l != nil && l.Writer() != io.Discard {
+		return slog.New(legacyHandler{slog.NewTextHandler(legacyWriter{l}, nil)})
+	}
+	return discardLogger
+}
+
+// legacyHandler 把 slog 记录转发给旧版 *log.Logger，只输出 Info 及以上级别
+type legacyHandler struct {
+	slog.Handler
+}
+
+func (h legacyHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelInfo
+}
+
+func (h legacyHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return legacyHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h legacyHandler) WithGroup(name string) slog.Handler {
+	return legacyHandler{h.Handler.WithGroup(name)}
+}
+
+// legacyWriter 将 TextHandler 输出的每一行交给 *log.Logger，由它加上前缀和时间
+type legacyWriter struct {
+	logger *log.Logger
+}
+
+func (w legacyWriter) Write(p []byte) (int, error) {
+	w.logger.Print(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
@@ -0,0 +1,55 @@
+package telegramify
+
+import "github.com/riverfjs/telegramify-go/internal/mermaid"
+
+// MermaidOption adjusts the URLs built by MermaidImageURL and
+// MermaidLiveURL.
+type MermaidOption func(*mermaid.URLOptions)
+
+// WithMermaidTheme sets the diagram theme, such as "default", "neutral",
+// "dark" or "forest". It applies to both the image and the editor URL.
+func WithMermaidTheme(theme string) MermaidOption {
+	return func(o *mermaid.URLOptions) {
+		o.Theme = theme
+	}
+}
+
+// WithMermaidImageType sets the image format: "webp" (the default), "png"
+// or "jpeg".
+func WithMermaidImageType(imageType string) MermaidOption {
+	return func(o *mermaid.URLOptions) {
+		o.Type = imageType
+	}
+}
+
+// WithMermaidWidth sets the image width in pixels and its scale factor.
+// Zero leaves the width to the server, in which case the scale is ignored.
+func WithMermaidWidth(width, scale int) MermaidOption {
+	return func(o *mermaid.URLOptions) {
+		o.Width, o.Scale = width, scale
+	}
+}
+
+// mermaidURLOptions returns the options used by the pipeline, adjusted by
+// opts.
+func mermaidURLOptions(opts []MermaidOption) mermaid.URLOptions {
+	o := mermaid.DefaultURLOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// MermaidImageURL returns the mermaid.ink address of the rendered diagram.
+// Without options it is the address the pipeline downloads a Photo from: a
+// 500 pixel wide WebP image at scale 2 in the default theme.
+func MermaidImageURL(code string, opts ...MermaidOption) (string, error) {
+	return mermaid.InkURL(code, mermaidURLOptions(opts))
+}
+
+// MermaidLiveURL returns the mermaid.live editor address for the diagram,
+// which the pipeline uses as the caption of a rendered Photo. Only
+// WithMermaidTheme affects it.
+func MermaidLiveURL(code string, opts ...MermaidOption) (string, error) {
+	return mermaid.LiveURL(code, mermaidURLOptions(opts))
+}
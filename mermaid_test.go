@@ -0,0 +1,67 @@
+package telegramify
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/riverfjs/telegramify-go/internal/mermaid"
+)
+
+// TestMermaidURLs 测试导出的 URL 函数默认与管道使用的内部实现一致，选项改变查询参数
+func TestMermaidURLs(t *testing.T) {
+	code := "graph TD\n  A-->B"
+
+	image, err := MermaidImageURL(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := mermaid.GetMermaidInkURL(code); image != want {
+		t.Errorf("MermaidImageURL() = %q, want %q", image, want)
+	}
+	live, err := MermaidLiveURL(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := mermaid.GetMermaidLiveURL(code); live != want {
+		t.Errorf("MermaidLiveURL() = %q, want %q", live, want)
+	}
+
+	// Plan 报告的地址和标题来自同样的函数
+	plan, err := Plan(context.Background(), "```mermaid\n"+code+"\n```")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.URLs) != 1 || plan.URLs[0] != image {
+		t.Errorf("Plan().URLs = %q, want [%q]", plan.URLs, image)
+	}
+
+	custom, err := MermaidImageURL(code, WithMermaidTheme("dark"), WithMermaidImageType("png"), WithMermaidWidth(800, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(custom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Query(); got.Get("theme") != "dark" || got.Get("type") != "png" || got.Get("width") != "800" || got.Get("scale") != "1" {
+		t.Errorf("MermaidImageURL() query = %v", got)
+	}
+	if !strings.HasPrefix(custom, strings.SplitN(image, "?", 2)[0]+"?") {
+		t.Errorf("MermaidImageURL() = %q, want the same diagram path as %q", custom, image)
+	}
+
+	noWidth, _ := MermaidImageURL(code, WithMermaidWidth(0, 2))
+	if q := noWidth[strings.Index(noWidth, "?")+1:]; q != "theme=default&type=webp" {
+		t.Errorf("MermaidImageURL() without width query = %q", q)
+	}
+
+	dark, _ := MermaidLiveURL(code, WithMermaidTheme("dark"), WithMermaidWidth(800, 1))
+	if dark == live || !strings.HasPrefix(dark, "https://mermaid.live/edit/#pako:") {
+		t.Errorf("MermaidLiveURL() with a theme = %q, want a different editor state", dark)
+	}
+	if same, _ := MermaidLiveURL(code, WithMermaidImageType("png")); same != live {
+		t.Errorf("MermaidLiveURL() changed by the image type: %q", same)
+	}
+}
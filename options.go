@@ -1,11 +1,162 @@
 package telegramify
 
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/yuin/goldmark"
+
+	"github.com/riverfjs/telegramify-go/internal/parser"
+	"github.com/riverfjs/telegramify-go/internal/util"
+)
+
 // ConvertOptions holds options for markdown conversion.
 type ConvertOptions struct {
 	LatexEscape bool
 	Config      *RenderConfig
+
+	// MaxMessageLength is the UTF-16 budget per Text produced by Process.
+	MaxMessageLength int
+	// RenderMermaid controls whether mermaid blocks are rendered to photos.
+	// When false they are treated like ordinary code blocks.
+	RenderMermaid bool
+	// Logger receives the pipeline's logs: Debug records for segment and
+	// split decisions and Warn records for fallbacks such as failed mermaid
+	// renders. Nil discards them (or uses the deprecated package Logger).
+	Logger *slog.Logger
+
+	// GenerateTOC makes Process start with a Text listing the document's
+	// headings, when it has at least TOCMinHeadings of them.
+	GenerateTOC bool
+	// TOCMinHeadings is the number of headings below which no table of
+	// contents is generated. Zero means 3.
+	TOCMinHeadings int
+
+	// SplitStrategy selects how text is divided into messages. Empty means
+	// SplitGreedy.
+	SplitStrategy SplitStrategy
+	// MinSectionLength is the UTF-16 length below which a section is merged
+	// with the one after it in SplitPerHeading mode. Zero keeps every section.
+	MinSectionLength int
+
+	// MinTailSize is the UTF-16 length below which the last chunk of a split
+	// text is rebalanced with the one before it (see SplitOptions). Zero
+	// means DefaultMinTailSize and a negative value disables rebalancing.
+	MinTailSize int
+
+	// Header and Footer are added to the Text messages produced by Process.
+	// Their length, plus the newline separating them from the text, is taken
+	// from every chunk's budget before splitting, so decorated messages never
+	// exceed MaxMessageLength.
+	Header Decoration
+	Footer Decoration
+
+	// Overflow selects what Process does with a document whose text would
+	// need more than OverflowMaxMessages Text messages. Empty means
+	// OverflowSplit.
+	Overflow OverflowMode
+	// OverflowMaxMessages is the number of Text messages above which
+	// Overflow applies. Zero means 3.
+	OverflowMaxMessages int
+	// OverflowPlainText makes the overflow file contain the rendered plain
+	// text (message.txt) instead of the original Markdown (message.md).
+	OverflowPlainText bool
+
+	// LanguageExtensions maps additional code block languages (lowercase)
+	// to the file extension used when such a block is extracted as a file.
+	// It takes precedence over the built-in table; see LanguageExtensions.
+	LanguageExtensions map[string]string
+
+	// AttachmentPlaceholders leaves an italic line such as "📎 attached:
+	// main.go (142 lines)" in the text where a code block or diagram was
+	// extracted, and captions each extracted File with the section it came
+	// from. The line counts against MaxMessageLength.
+	AttachmentPlaceholders bool
+
+	// Dedupe controls what happens to a File or Photo whose content repeats
+	// an earlier attachment of the same document. Empty means DedupeOff.
+	Dedupe DedupeMode
+
+	// Typographer replaces straight quotes, "--", "---" and "..." with
+	// their typographic forms outside code.
+	Typographer bool
+
+	// GoldmarkOptions are passed to goldmark after StandardOptions, or
+	// instead of them when ReplaceStandardOptions is true. See
+	// WithGoldmarkOptions for the nodes the converter understands.
+	GoldmarkOptions        []goldmark.Option
+	ReplaceStandardOptions bool
+
+	// symbolOverrides are applied to a copy of Config once all options have
+	// been applied, so they combine with WithConfig in any order.
+	symbolOverrides []func(*Symbol)
+
+	// dryRun makes the pipeline skip network handlers and record what they
+	// would fetch instead (see Plan).
+	dryRun bool
 }
 
+// SplitStrategy selects how Process divides long text into messages.
+type SplitStrategy string
+
+const (
+	// SplitGreedy packs as much text as fits into each message (the default).
+	SplitGreedy SplitStrategy = "greedy"
+	// SplitPerHeading starts a new message at every top-level H1 or H2
+	// heading and splits a section further only when it exceeds the limit.
+	SplitPerHeading SplitStrategy = "per-heading"
+)
+
+// Decoration is text that Process adds to its Text messages, such as a
+// sender line or a footer. Entity offsets are relative to Text.
+type Decoration struct {
+	Text     string
+	Entities []MessageEntity
+	// Placement selects the messages that receive the decoration. Empty
+	// means PlaceFirst for a header and PlaceLast for a footer.
+	Placement Placement
+}
+
+// Placement selects which Text messages receive a header or footer.
+type Placement string
+
+const (
+	// PlaceFirst adds the decoration to the first Text only.
+	PlaceFirst Placement = "first"
+	// PlaceEvery adds the decoration to every Text.
+	PlaceEvery Placement = "every"
+	// PlaceLast adds the decoration to the last Text only.
+	PlaceLast Placement = "last"
+)
+
+// OverflowMode selects how Process handles a document that would be split
+// into too many messages.
+type OverflowMode string
+
+const (
+	// OverflowSplit splits the text into as many messages as needed (the
+	// default).
+	OverflowSplit OverflowMode = "split"
+	// OverflowFile sends the whole document as a single file.
+	OverflowFile OverflowMode = "file"
+	// OverflowSummaryFile sends the first paragraph as a Text, keeping its
+	// entities, followed by the whole document as a file.
+	OverflowSummaryFile OverflowMode = "summary+file"
+)
+
+// DedupeMode selects how Process handles repeated attachments.
+type DedupeMode string
+
+const (
+	// DedupeOff sends every attachment, even identical ones (the default).
+	DedupeOff DedupeMode = "off"
+	// DedupeReference replaces a repeated attachment with a short Text
+	// naming the earlier one.
+	DedupeReference DedupeMode = "reference"
+	// DedupeDrop removes repeated attachments.
+	DedupeDrop DedupeMode = "drop"
+)
+
 // Option is a function that configures ConvertOptions.
 type Option func(*ConvertOptions)
 
@@ -23,11 +174,279 @@ func WithConfig(config *RenderConfig) Option {
 	}
 }
 
+// WithMaxMessageLength sets the maximum UTF-16 length of each Text produced by Process.
+func WithMaxMessageLength(n int) Option {
+	return func(opts *ConvertOptions) {
+		opts.MaxMessageLength = n
+	}
+}
+
+// WithMermaid sets whether mermaid code blocks are rendered (which needs network access).
+func WithMermaid(enable bool) Option {
+	return func(opts *ConvertOptions) {
+		opts.RenderMermaid = enable
+	}
+}
+
+// WithLogger sets the structured logger used by the pipeline. Pass a logger
+// created with With to attach request-scoped attributes to every record.
+func WithLogger(logger *slog.Logger) Option {
+	return func(opts *ConvertOptions) {
+		opts.Logger = logger
+	}
+}
+
+// WithTOC sets whether Process prepends a table of contents built from the
+// document's top-level headings.
+func WithTOC(enable bool) Option {
+	return func(opts *ConvertOptions) {
+		opts.GenerateTOC = enable
+	}
+}
+
+// WithTOCMinHeadings sets how many headings a document needs before WithTOC
+// generates a table of contents.
+func WithTOCMinHeadings(n int) Option {
+	return func(opts *ConvertOptions) {
+		opts.TOCMinHeadings = n
+	}
+}
+
+// WithSplitStrategy sets how Process divides long text into messages.
+func WithSplitStrategy(strategy SplitStrategy) Option {
+	return func(opts *ConvertOptions) {
+		opts.SplitStrategy = strategy
+	}
+}
+
+// WithMinSectionLength sets the UTF-16 length below which SplitPerHeading
+// merges a section with the next one.
+func WithMinSectionLength(n int) Option {
+	return func(opts *ConvertOptions) {
+		opts.MinSectionLength = n
+	}
+}
+
+// WithMinTailSize sets the length below which the last message of a split
+// text takes over part of the previous message instead of being sent on its
+// own. Zero means DefaultMinTailSize (200) and a negative value keeps the
+// greedy split.
+func WithMinTailSize(n int) Option {
+	return func(opts *ConvertOptions) {
+		opts.MinTailSize = n
+	}
+}
+
+// WithHeader sets text placed on its own line before the first Text message
+// (see WithHeaderPlacement). entities are relative to text.
+func WithHeader(text string, entities []MessageEntity) Option {
+	return func(opts *ConvertOptions) {
+		opts.Header.Text = text
+		opts.Header.Entities = entities
+	}
+}
+
+// WithFooter sets text placed on its own line after the last Text message
+// (see WithFooterPlacement). entities are relative to text.
+func WithFooter(text string, entities []MessageEntity) Option {
+	return func(opts *ConvertOptions) {
+		opts.Footer.Text = text
+		opts.Footer.Entities = entities
+	}
+}
+
+// WithHeaderPlacement sets which Text messages receive the header.
+func WithHeaderPlacement(placement Placement) Option {
+	return func(opts *ConvertOptions) {
+		opts.Header.Placement = placement
+	}
+}
+
+// WithFooterPlacement sets which Text messages receive the footer.
+func WithFooterPlacement(placement Placement) Option {
+	return func(opts *ConvertOptions) {
+		opts.Footer.Placement = placement
+	}
+}
+
+// WithOverflow sets what Process does when the text would need more than
+// maxMessages Text messages; zero maxMessages means 3. In OverflowFile and
+// OverflowSummaryFile mode no code block or diagram is extracted, since the
+// file already contains the whole document.
+func WithOverflow(mode OverflowMode, maxMessages int) Option {
+	return func(opts *ConvertOptions) {
+		opts.Overflow = mode
+		opts.OverflowMaxMessages = maxMessages
+	}
+}
+
+// WithOverflowPlainText sets whether the overflow file holds the rendered
+// plain text (message.txt) rather than the original Markdown (message.md).
+// The plain text is always used when RenderConfig.CodeSanitizer is set, as
+// the original Markdown still contains the unsanitized code.
+func WithOverflowPlainText(enable bool) Option {
+	return func(opts *ConvertOptions) {
+		opts.OverflowPlainText = enable
+	}
+}
+
+// WithLanguageExtensions registers file extensions for code block languages,
+// such as {"terraform": "tf", "proto": "proto"}, overriding the built-in
+// entries for the same languages. Languages are matched case-insensitively
+// and a leading dot in an extension is ignored. The map is copied, and
+// repeated calls add to the mappings registered before.
+func WithLanguageExtensions(extensions map[string]string) Option {
+	return func(opts *ConvertOptions) {
+		merged := make(map[string]string, len(opts.LanguageExtensions)+len(extensions))
+		for lang, ext := range opts.LanguageExtensions {
+			merged[lang] = ext
+		}
+		for lang, ext := range extensions {
+			merged[strings.ToLower(lang)] = strings.TrimPrefix(ext, ".")
+		}
+		opts.LanguageExtensions = merged
+	}
+}
+
+// LanguageExtensions returns the effective language to file extension
+// mapping for the given options: the built-in table merged with the entries
+// of WithLanguageExtensions. Languages without an entry are extracted as
+// ".txt" files. The returned map is a copy.
+func LanguageExtensions(opts ...Option) map[string]string {
+	return mergeLanguageExtensions(applyOptions(opts...).LanguageExtensions)
+}
+
+// mergeLanguageExtensions returns a copy of the built-in table with extra
+// applied on top.
+func mergeLanguageExtensions(extra map[string]string) map[string]string {
+	merged := make(map[string]string, len(util.DefaultLanguageToExt)+len(extra))
+	for lang, ext := range util.DefaultLanguageToExt {
+		merged[lang] = ext
+	}
+	for lang, ext := range extra {
+		merged[lang] = ext
+	}
+	return merged
+}
+
+// WithAttachmentPlaceholders sets whether Process marks the place of each
+// extracted code block or diagram in the text and captions extracted files
+// with their section. See ConvertOptions.AttachmentPlaceholders.
+func WithAttachmentPlaceholders(enable bool) Option {
+	return func(opts *ConvertOptions) {
+		opts.AttachmentPlaceholders = enable
+	}
+}
+
+// WithDedupe sets how Process handles a File or Photo identical to an
+// earlier one in the same document.
+func WithDedupe(mode DedupeMode) Option {
+	return func(opts *ConvertOptions) {
+		opts.Dedupe = mode
+	}
+}
+
+// WithGoldmarkOptions adds options, such as extensions, to the goldmark
+// parser used for conversion; repeated calls add to the options given
+// before. They apply on top of StandardOptions unless
+// WithStandardOptions(false) is also given, in which case they replace it:
+//
+//	// GFM and definition lists, but no footnotes
+//	telegramify.NewConverter(
+//	    telegramify.WithStandardOptions(false),
+//	    telegramify.WithGoldmarkOptions(goldmark.WithExtensions(extension.GFM, extension.DefinitionList)),
+//	)
+//
+// The converter renders every CommonMark node as well as GFM tables,
+// strikethrough and task lists. Nodes of other extensions, including
+// footnotes and definition lists, are replaced by their children: terms and
+// descriptions become paragraphs and footnote references are dropped. A
+// block without children, such as a math block, is rendered as its source
+// lines. RenderConfig.OnUnknownNode can render such nodes instead. Unknown
+// nodes never make the conversion fail.
+func WithGoldmarkOptions(goldmarkOpts ...goldmark.Option) Option {
+	return func(opts *ConvertOptions) {
+		opts.GoldmarkOptions = append(opts.GoldmarkOptions, goldmarkOpts...)
+	}
+}
+
+// WithStandardOptions sets whether StandardOptions are passed to goldmark
+// before the options of WithGoldmarkOptions. It is true by default.
+func WithStandardOptions(enable bool) Option {
+	return func(opts *ConvertOptions) {
+		opts.ReplaceStandardOptions = !enable
+	}
+}
+
+// WithTypographer sets whether straight quotes become curly quotes, "--"
+// and "---" become en and em dashes, and "..." becomes an ellipsis. Code
+// spans, code blocks, link targets and HTML are left alone. The replacement
+// happens while parsing, so entity offsets refer to the typographic text.
+func WithTypographer(enable bool) Option {
+	return func(opts *ConvertOptions) {
+		opts.Typographer = enable
+	}
+}
+
+// goldmarkOptions returns the goldmark options the parser is built with.
+func (o *ConvertOptions) goldmarkOptions() []goldmark.Option {
+	var goldmarkOpts []goldmark.Option
+	if !o.ReplaceStandardOptions {
+		goldmarkOpts = append(goldmarkOpts, parser.StandardOptions...)
+	}
+	if o.Typographer {
+		goldmarkOpts = append(goldmarkOpts, goldmark.WithExtensions(parser.Typographer))
+	}
+	return append(goldmarkOpts, o.GoldmarkOptions...)
+}
+
+// customParser reports whether the options change the goldmark parser.
+func (o *ConvertOptions) customParser() bool {
+	return o.ReplaceStandardOptions || o.Typographer || len(o.GoldmarkOptions) > 0
+}
+
+// WithSymbolOverride changes individual symbols of the render configuration.
+// The function receives a copy of the configured symbols (the defaults unless
+// WithConfig says otherwise); neither the config passed to WithConfig nor the
+// defaults are modified.
+func WithSymbolOverride(override func(*Symbol)) Option {
+	return func(opts *ConvertOptions) {
+		opts.symbolOverrides = append(opts.symbolOverrides, override)
+	}
+}
+
+// WithHeadingSymbols replaces the heading prefixes starting at level 1, so
+// WithHeadingSymbols("#", "##") changes levels 1 and 2 only. Extra symbols
+// beyond level 6 are ignored.
+func WithHeadingSymbols(symbols ...string) Option {
+	return WithSymbolOverride(func(s *Symbol) {
+		levels := []*string{
+			&s.HeadingLevel1, &s.HeadingLevel2, &s.HeadingLevel3,
+			&s.HeadingLevel4, &s.HeadingLevel5, &s.HeadingLevel6,
+		}
+		for i, symbol := range symbols {
+			if i < len(levels) {
+				*levels[i] = symbol
+			}
+		}
+	})
+}
+
+// WithTaskSymbols replaces the markers of completed and uncompleted task list items.
+func WithTaskSymbols(done, todo string) Option {
+	return WithSymbolOverride(func(s *Symbol) {
+		s.TaskCompleted = done
+		s.TaskUncompleted = todo
+	})
+}
+
 // defaultConvertOptions returns the default conversion options.
 func defaultConvertOptions() *ConvertOptions {
 	return &ConvertOptions{
-		LatexEscape: true,
-		Config:      DefaultConfig(),
+		LatexEscape:      true,
+		Config:           DefaultConfig(),
+		MaxMessageLength: 4096,
+		RenderMermaid:    true,
 	}
 }
 
@@ -37,6 +456,19 @@ func applyOptions(opts ...Option) *ConvertOptions {
 	for _, opt := range opts {
 		opt(options)
 	}
+	if len(options.symbolOverrides) > 0 {
+		config := options.Config.Clone()
+		if config == nil {
+			config = DefaultConfig()
+		}
+		if config.MarkdownSymbol == nil {
+			config.MarkdownSymbol = DefaultConfig().MarkdownSymbol
+		}
+		for _, override := range options.symbolOverrides {
+			override(config.MarkdownSymbol)
+		}
+		options.Config = config
+	}
 	return options
 }
 
@@ -0,0 +1,47 @@
+package telegramify
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+)
+
+// PanicError is returned when conversion or the pipeline panics.
+//
+// A panic indicates a bug or an input combination the converter does not
+// handle (for example a RenderConfig without MarkdownSymbol). It is reported
+// as an error so that one bad message cannot take down a bot's update loop.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value interface{}
+	// Stack is the goroutine stack at the time of the panic.
+	Stack []byte
+}
+
+// Error implements the error interface.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("telegramify: panic: %v", e.Value)
+}
+
+// Unwrap returns the panic value when it is an error, such as a runtime.Error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// recoverPanic turns a panic in the calling function into a *PanicError
+// stored in *err. It must be called directly by defer.
+func recoverPanic(err *error) {
+	if r := recover(); r != nil {
+		*err = &PanicError{Value: r, Stack: debug.Stack()}
+	}
+}
+
+// logPanic logs a panic in the calling function and re-panics, for entry
+// points whose signature has no error. It must be called directly by defer.
+func logPanic(logger *slog.Logger) {
+	if r := recover(); r != nil {
+		logger.Error("conversion panicked", "panic", r, "stack", string(debug.Stack()))
+		panic(r)
+	}
+}
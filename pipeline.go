@@ -3,6 +3,11 @@ package telegramify
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
 	"strings"
 
 	"github.com/riverfjs/telegramify-go/internal/converter"
@@ -10,89 +15,6 @@ import (
 	"github.com/riverfjs/telegramify-go/internal/util"
 )
 
-// stripNewlinesAdjust 去除首尾换行符并调整 entity 偏移量
-func stripNewlinesAdjustInternal(text string, entities []MessageEntity) (string, []MessageEntity) {
-	// Count leading newlines
-	leading := 0
-	for _, ch := range text {
-		if ch == '\n' {
-			leading++
-		} else {
-			break
-		}
-	}
-	
-	// Count trailing newlines
-	trailing := 0
-	runes := []rune(text)
-	for i := len(runes) - 1; i >= 0; i-- {
-		if runes[i] == '\n' {
-			trailing++
-		} else {
-			break
-		}
-	}
-	
-	if leading == 0 && trailing == 0 {
-		return text, entities
-	}
-	
-	end := len(text) - trailing
-	if trailing > 0 {
-		end = len(text) - trailing
-	} else {
-		end = len(text)
-	}
-	
-	// Check bounds before slicing to avoid panic
-	if leading >= end {
-		return "", []MessageEntity{}
-	}
-	
-	stripped := text[leading:end]
-	if stripped == "" {
-		return stripped, []MessageEntity{}
-	}
-	
-	// Newlines are each 1 UTF-16 code unit
-	leadingUTF16 := leading
-	newUTF16Len := UTF16Len(stripped)
-	
-	adjusted := make([]MessageEntity, 0)
-	for _, ent := range entities {
-		newOffset := ent.Offset - leadingUTF16
-		newEnd := newOffset + ent.Length
-		
-		// Skip entities entirely outside the stripped range
-		if newEnd <= 0 || newOffset >= newUTF16Len {
-			continue
-		}
-		
-		// Clip to boundaries
-		if newOffset < 0 {
-			newOffset = 0
-		}
-		if newEnd > newUTF16Len {
-			newEnd = newUTF16Len
-		}
-		newLength := newEnd - newOffset
-		if newLength <= 0 {
-			continue
-		}
-		
-		adjusted = append(adjusted, MessageEntity{
-			Type:          ent.Type,
-			Offset:        newOffset,
-			Length:        newLength,
-			URL:           ent.URL,
-			Language:      ent.Language,
-			CustomEmojiID: ent.CustomEmojiID,
-		})
-	}
-	
-	return stripped, adjusted
-}
-
 // sliceTextEntities 提取子串及其重叠的实体，调整偏移量
 func sliceTextEntities(
 	fullText string,
@@ -129,19 +51,19 @@ func sliceTextEntities(
 			continue
 		}
 		
-		chunkEntities = append(chunkEntities, MessageEntity{
-			Type:          ent.Type,
-			Offset:        clippedStart - utf16Start,
-			Length:        clippedLength,
-			URL:           ent.URL,
-			Language:      ent.Language,
-			CustomEmojiID: ent.CustomEmojiID,
-		})
+		ent.Offset = clippedStart - utf16Start
+		ent.Length = clippedLength
+		chunkEntities = append(chunkEntities, ent)
 	}
 	
 	return chunkText, chunkEntities
 }
 
+// ErrEmptyContent 表示 Markdown 没有任何可发送的内容。空白输入、只有空代码块
+// （包括空的 Mermaid 图表）或只有 HTML 注释的输入都返回该错误和 nil 内容，
+// 调用方可用 errors.Is 区分"无需发送"和转换失败
+var ErrEmptyContent = errors.New("telegramify: markdown has no content to send")
+
 // ProcessMarkdown 完整异步管道：markdown → 可发送的内容列表
 //
 // 步骤：
@@ -151,6 +73,8 @@ func sliceTextEntities(
 //    - code_block → 提取为 File
 //    - text regions → 收集并按 max_message_length 拆分
 // 3. 返回 Text | File | Photo 的有序列表
+//
+// 没有可发送的内容时返回 ErrEmptyContent。
 func ProcessMarkdown(
 	ctx context.Context,
 	content string,
@@ -158,57 +82,106 @@ func ProcessMarkdown(
 	latexEscape bool,
 	config *RenderConfig,
 ) ([]Content, error) {
-	if maxMessageLength <= 0 {
-		maxMessageLength = 4096
+	options := defaultConvertOptions()
+	options.MaxMessageLength = maxMessageLength
+	options.LatexEscape = latexEscape
+	options.Config = config
+	return processMarkdown(ctx, []byte(content), options)
+}
+
+// processMarkdown 使用默认 Converter 运行管道，options 设置了 goldmark 选项时使用相应的解析器
+func processMarkdown(ctx context.Context, source []byte, options *ConvertOptions) ([]Content, error) {
+	return converterFor(options).processMarkdown(ctx, source, options)
+}
+
+// processMarkdown 是 ProcessMarkdown、Process 和 TelegramifyReader 共用的管道实现
+//
+// 返回的内容不引用 source。管道中发生的 panic 以 *PanicError 返回。
+// ctx 为 nil 时视为 context.Background()。
+func (c *Converter) processMarkdown(ctx context.Context, source []byte, options *ConvertOptions) (contents []Content, err error) {
+	defer recoverPanic(&err)
+	if ctx == nil {
+		ctx = context.Background()
 	}
+	
+	maxMessageLength, err := messageBudget(options)
+	if err != nil {
+		return nil, err
+	}
+	config := options.Config
 	if config == nil {
 		config = DefaultConfig()
 	}
+	if err := config.MarkdownSymbol.Validate(); err != nil {
+		return nil, err
+	}
 	
-	fullText, fullEntities, segments := ConvertWithSegments(content, latexEscape, config)
+	logger := resolveLogger(options.Logger)
+	
+	doc := c.convertDocument(source, options.LatexEscape, config)
+	if err := doc.limitError(config); err != nil {
+		return nil, err
+	}
+	doc.logLimit(ctx, logger)
+	fullText, fullEntities, segments := doc.text, doc.entities, doc.segments
+	for _, d := range doc.dropped {
+		logger.WarnContext(ctx, "link rendered as plain text", "reason", d.Reason, "url_bytes", len(d.URL))
+	}
+	for _, tag := range doc.droppedHTML {
+		logger.WarnContext(ctx, "unsupported html element dropped", "tag", tag)
+	}
 	
 	result := make([]Content, 0)
 	
 	// First pass: identify which code blocks should be extracted as files
 	// Only segments that are extracted as files/photos will split the text
-	extractableSegments := make([]converter.Segment, 0)
-	for _, s := range segments {
-		if s.Kind == "mermaid" {
-			// Mermaid always extracted as photo/file
-			extractableSegments = append(extractableSegments, s)
-		} else if s.Kind == "code_block" {
-			// Only extract code blocks > 50 lines
-			lineCount := strings.Count(s.RawCode, "\n") + 1
-			if lineCount > 50 {
-				extractableSegments = append(extractableSegments, s)
+	extractableSegments := selectExtractable(ctx, logger, segments, options)
+	
+	if overflows(doc, options, extractableSegments, maxMessageLength) {
+		logger.DebugContext(ctx, "text sent as file", "mode", string(options.Overflow), "max_messages", overflowLimit(options))
+		result = overflowContents(source, doc, options, maxMessageLength)
+		if doc.frontMatter != nil {
+			attachFrontMatter(result, doc.frontMatter)
+		}
+		return decorate(result, options), nil
+	}
+	
+	// Extract the segments as files/photos before emitting text: with
+	// DedupeDrop the placeholder of a dropped attachment is left out
+	attachments := make([][]Content, len(extractableSegments))
+	for i, seg := range extractableSegments {
+		if seg.Kind == SegmentMermaid {
+			if options.dryRun {
+				planMermaid(&attachments[i], seg)
+			} else {
+				handleMermaid(ctx, logger, &attachments[i], seg)
 			}
+		} else if seg.Kind == SegmentCodeBlock {
+			handleCodeBlockAsFile(&attachments[i], seg, options.LanguageExtensions)
+		}
+		if options.AttachmentPlaceholders {
+			captionSection(attachments[i], doc.headings, seg.TextStart)
 		}
 	}
+	var dropped []bool
+	if options.Dedupe == DedupeDrop {
+		dropped = droppedAttachments(attachments)
+	}
 	
 	// Walk through the text, splitting only at extractable segments
 	cursorPy := 0
 	cursorUTF16 := 0
+	prefixes, suffixes := attachmentNotes(fullText, extractableSegments, dropped, options)
 	
-	for _, seg := range extractableSegments {
+	for i, seg := range extractableSegments {
 		// Emit text before this segment
-		if seg.TextStart > cursorPy {
-			textChunk, textEntities := sliceTextEntities(
-				fullText, fullEntities,
-				cursorPy, seg.TextStart,
-				cursorUTF16, seg.UTF16Start,
-			)
-			textChunk, textEntities = stripNewlinesAdjustInternal(textChunk, textEntities)
-			if textChunk != "" {
-				appendTextChunks(&result, textChunk, textEntities, maxMessageLength)
+		cutStart, cutUTF16Start := segmentCut(seg)
+		if cutStart > cursorPy {
+			for _, t := range rangeTexts(doc, options, textRange{cursorPy, cutStart, cursorUTF16, cutUTF16Start}, prefixes[i], suffixes[i]) {
+				appendTextChunks(ctx, logger, &result, t.text, t.entities, maxMessageLength, splitOptions(options), config, doc.headings, t.start)
 			}
 		}
-		
-		// Extract the segment as file/photo
-		if seg.Kind == "mermaid" {
-			handleMermaid(ctx, &result, seg)
-		} else if seg.Kind == "code_block" {
-			handleCodeBlockAsFile(&result, seg)
-		}
+		result = append(result, attachments[i]...)
 		
 		// Move cursor past the segment
 		cursorPy = seg.TextEnd
@@ -217,58 +190,629 @@ func ProcessMarkdown(
 	
 	// Emit remaining text after last special segment
 	if cursorPy < len(fullText) {
-		textChunk, textEntities := sliceTextEntities(
-			fullText, fullEntities,
-			cursorPy, len(fullText),
-			cursorUTF16, UTF16Len(fullText),
-		)
-		textChunk, textEntities = stripNewlinesAdjust(textChunk, textEntities)
-		if textChunk != "" {
-			appendTextChunks(&result, textChunk, textEntities, maxMessageLength)
+		last := len(extractableSegments)
+		for _, t := range rangeTexts(doc, options, textRange{cursorPy, len(fullText), cursorUTF16, UTF16Len(fullText)}, prefixes[last], suffixes[last]) {
+			appendTextChunks(ctx, logger, &result, t.text, t.entities, maxMessageLength, splitOptions(options), config, doc.headings, t.start)
 		}
 	}
 	
 	// If no output was generated, emit empty text
 	if len(result) == 0 && strings.TrimSpace(fullText) != "" {
-		appendTextChunks(&result, strings.TrimSpace(fullText), fullEntities, maxMessageLength)
+		trimmed := strings.TrimSpace(fullText)
+		appendTextChunks(ctx, logger, &result, trimmed, fullEntities, maxMessageLength, splitOptions(options), config, doc.headings, strings.Index(fullText, trimmed))
+	}
+	
+	if len(result) == 0 {
+		return nil, ErrEmptyContent
 	}
 	
-	return result, nil
+	if options.Dedupe == DedupeReference || options.Dedupe == DedupeDrop {
+		result = dedupeAttachments(ctx, logger, result, options.Dedupe)
+	}
+	if doc.frontMatter != nil {
+		attachFrontMatter(result, doc.frontMatter)
+	}
+	numberChunks(result)
+	if options.GenerateTOC {
+		if toc := buildTOC(doc.headings, options.TOCMinHeadings, maxMessageLength, config); toc != nil {
+			logger.DebugContext(ctx, "table of contents generated", "headings", len(doc.headings))
+			result = append([]Content{toc}, result...)
+		}
+	}
+	return decorate(result, options), nil
+}
+
+// sectionText 是正文区间中的一节：去掉首尾换行、加上占位行后的文字和实体，
+// start 是文字在 fullText 中的起始字节
+type sectionText struct {
+	text     string
+	entities []MessageEntity
+	start    int
+}
+
+// rangeTexts 返回正文区间 rg 按章节切分、去掉首尾换行后非空的各节。
+// prefix 和 suffix 是附在该区间上的占位行，分别加在第一节之前和最后一节之后
+func rangeTexts(doc document, options *ConvertOptions, rg textRange, prefix, suffix []string) []sectionText {
+	var texts []sectionText
+	for _, sec := range sections(doc.headings, options, rg.byteStart, rg.byteEnd, rg.utf16Start, rg.utf16End) {
+		text, entities := sliceTextEntities(doc.text, doc.entities, sec.byteStart, sec.byteEnd, sec.utf16Start, sec.utf16End)
+		start := sec.byteStart + leadingNewlines(text)
+		text, entities = stripNewlinesAdjust(text, entities)
+		if text != "" {
+			texts = append(texts, sectionText{text, entities, start})
+		}
+	}
+	if len(texts) == 0 {
+		return nil
+	}
+	sep := "\n\n"
+	if options.Config != nil && options.Config.Spacing == SpacingCompact {
+		sep = "\n"
+	}
+	italic := options.Config == nil || !options.Config.EntityDisabled(EntityItalic)
+	if len(prefix) > 0 {
+		first := &texts[0]
+		notes, entities := noteLines(prefix, 0, italic)
+		notes += sep
+		shift := UTF16Len(notes)
+		for _, e := range first.entities {
+			e.Offset += shift
+			entities = append(entities, e)
+		}
+		first.text, first.entities, first.start = notes+first.text, entities, first.start-len(notes)
+	}
+	if len(suffix) > 0 {
+		last := &texts[len(texts)-1]
+		notes, entities := noteLines(suffix, UTF16Len(last.text)+UTF16Len(sep), italic)
+		last.text += sep + notes
+		last.entities = append(append([]MessageEntity(nil), last.entities...), entities...)
+	}
+	return texts
+}
+
+// noteLines 将占位行逐行拼接，italic 为 true 时每行带一个斜体实体，
+// offset 是第一行在所在文字中的 UTF-16 偏移
+func noteLines(notes []string, offset int, italic bool) (string, []MessageEntity) {
+	var entities []MessageEntity
+	for _, note := range notes {
+		n := UTF16Len(note)
+		if italic {
+			entities = append(entities, MessageEntity{Type: EntityItalic, Offset: offset, Length: n})
+		}
+		offset += n + 1
+	}
+	return strings.Join(notes, "\n"), entities
+}
+
+// attachmentNotes 在启用 AttachmentPlaceholders 时为每个提取的片段生成占位行，
+// 并决定附在哪段正文上：区间 k 是第 k 个片段之前的正文，len(extractable) 是最后一个片段之后。
+// 占位行加在片段之前最近的非空区间末尾，片段之前没有正文时加在之后第一个非空区间的开头。
+// dropped[i] 为 true 的片段的附件会被去重删除，不生成占位行
+func attachmentNotes(text string, extractable []Segment, dropped []bool, options *ConvertOptions) (prefixes, suffixes [][]string) {
+	prefixes = make([][]string, len(extractable)+1)
+	suffixes = make([][]string, len(extractable)+1)
+	if !options.AttachmentPlaceholders {
+		return prefixes, suffixes
+	}
+	empty := func(k int) bool {
+		start, end := 0, len(text)
+		if k > 0 {
+			start = extractable[k-1].TextEnd
+		}
+		if k < len(extractable) {
+			end, _ = segmentCut(extractable[k])
+		}
+		return start >= end || strings.TrimSpace(text[start:end]) == ""
+	}
+	for i, seg := range extractable {
+		if i < len(dropped) && dropped[i] {
+			continue
+		}
+		note := attachmentNote(seg, options.LanguageExtensions)
+		k := i
+		for k >= 0 && empty(k) {
+			k--
+		}
+		if k >= 0 {
+			suffixes[k] = append(suffixes[k], note)
+			continue
+		}
+		for k = i + 1; k <= len(extractable); k++ {
+			if !empty(k) {
+				prefixes[k] = append(prefixes[k], note)
+				break
+			}
+		}
+	}
+	return prefixes, suffixes
+}
+
+// attachmentNote 返回提取 seg 后留在正文中的占位行，如 "📎 attached: main.go (142 lines)"
+func attachmentNote(seg Segment, extensions map[string]string) string {
+	if seg.Kind == SegmentMermaid {
+		return "📎 attached: Mermaid diagram"
+	}
+	lines := strings.Count(seg.RawCode, "\n") + 1
+	return fmt.Sprintf("📎 attached: %s (%d lines)", codeFileName(seg, extensions), lines)
+}
+
+// captionSection 为提取出的 File 加上 "from section: 标题" 说明，标题是 pos 所在的最近一级章节；
+// 第一个标题之前的片段不加
+func captionSection(contents []Content, headings []converter.Heading, pos int) {
+	path := sectionPath(headings, pos)
+	if len(path) == 0 {
+		return
+	}
+	caption := "from section: " + path[len(path)-1]
+	for _, c := range contents {
+		if f, ok := c.(*File); ok {
+			if f.CaptionText != "" {
+				f.CaptionText += "\n"
+			}
+			f.CaptionText += caption
+		}
+	}
+}
+
+// segmentCut 返回提取 seg 时从正文中去掉的范围的起点（字节和 UTF-16）：
+// 代码之前同一行的列表符号一并去掉，跨越该范围的实体由 sliceTextEntities 截断
+func segmentCut(seg Segment) (int, int) {
+	return seg.TextStart - seg.PrefixLen, seg.UTF16Start - seg.PrefixUTF16Len
+}
+
+// overflowLimit 返回 OverflowMaxMessages，未设置时为 3
+func overflowLimit(options *ConvertOptions) int {
+	if options.OverflowMaxMessages > 0 {
+		return options.OverflowMaxMessages
+	}
+	return 3
+}
+
+// overflows 报告文档是否应按 Overflow 模式作为文件发送：按正常拆分会生成超过上限的 Text
+func overflows(doc document, options *ConvertOptions, extractable []Segment, budget int) bool {
+	if options.Overflow != OverflowFile && options.Overflow != OverflowSummaryFile {
+		return false
+	}
+	return countTexts(doc, options, extractable, nil, budget) > overflowLimit(options)
+}
+
+// overflowContents 生成代替长文本发送的内容：OverflowSummaryFile 时先是第一段的 Text，
+// 然后是包含原始 Markdown（或渲染后纯文本）的文件
+func overflowContents(source []byte, doc document, options *ConvertOptions, budget int) []Content {
+	var result []Content
+	if options.Overflow == OverflowSummaryFile {
+		if summary := overflowSummary(doc, budget); summary != nil {
+			result = append(result, summary)
+		}
+	}
+	file := &File{
+		FileName: "message.md",
+		FileData: append([]byte(nil), source...),
+		ContentTrace: ContentTrace{
+			SourceType: ContentTypeOverflow,
+		},
+	}
+	// 原文中的代码没有经过 CodeSanitizer，设置了它时只能发送渲染后的文本
+	if options.OverflowPlainText || (options.Config != nil && options.Config.CodeSanitizer != nil) {
+		file.FileName, file.FileData = "message.txt", []byte(doc.text)
+	}
+	return append(result, file)
+}
+
+// overflowSummary 返回文档第一段（到第一个空行为止）及其实体组成的 Text，超出预算时只保留第一块
+func overflowSummary(doc document, budget int) *Text {
+	text := doc.text
+	start := len(text) - len(strings.TrimLeft(text, "\n"))
+	end := len(text)
+	if i := strings.Index(text[start:], "\n\n"); i >= 0 {
+		end = start + i
+	}
+	chunk, entities := sliceTextEntities(text, doc.entities, start, end, UTF16Len(text[:start]), UTF16Len(text[:end]))
+	chunk, entities = stripNewlinesAdjust(chunk, entities)
+	if chunk == "" {
+		return nil
+	}
+	if UTF16Len(chunk) > budget {
+		first := SplitEntities(chunk, entities, budget)[0]
+		chunk, entities = stripNewlinesAdjust(first.Text, first.Entities)
+	}
+	return &Text{
+		Text:     chunk,
+		Entities: entities,
+		ContentTrace: ContentTrace{
+			SourceType: ContentTypeOverflow,
+		},
+	}
+}
+
+// dedupeAttachments 按内容的 SHA-256 找出重复的 File 和 Photo，替换为引用前者的 Text 或直接删除
+//
+// 在所有片段处理完之后运行；dry-run 中没有数据的 Photo 以将要请求的 URL 作为内容。
+// 第一次出现的附件在 ContentTrace 中记录被去重的次数。
+func dedupeAttachments(ctx context.Context, logger *slog.Logger, result []Content, mode DedupeMode) []Content {
+	seen := make(map[[sha256.Size]byte]Content)
+	out := result[:0]
+	for _, content := range result {
+		key, name, ok := attachmentKey(content)
+		if !ok {
+			out = append(out, content)
+			continue
+		}
+		first, dup := seen[key]
+		if !dup {
+			seen[key] = content
+			out = append(out, content)
+			continue
+		}
+		trace := contentTrace(first)
+		if trace.Extra == nil {
+			trace.Extra = make(map[string]interface{})
+		}
+		count, _ := trace.Extra[TraceKeyDuplicates].(int)
+		trace.Extra[TraceKeyDuplicates] = count + 1
+		logger.DebugContext(ctx, "duplicate attachment", "file_name", name, "mode", string(mode))
+		if mode == DedupeReference {
+			out = append(out, &Text{
+				Text: "📎 (same as attachment " + name + " above)",
+				ContentTrace: ContentTrace{
+					SourceType: ContentTypeDuplicate,
+					Extra: map[string]interface{}{
+						TraceKeyDuplicateOf: name,
+					},
+				},
+			})
+		}
+	}
+	return out
+}
+
+// droppedAttachments 报告 DedupeDrop 会删除哪些片段的全部附件，attachments[i] 是第 i 个片段的附件
+func droppedAttachments(attachments [][]Content) []bool {
+	seen := make(map[[sha256.Size]byte]bool)
+	dropped := make([]bool, len(attachments))
+	for i, contents := range attachments {
+		dup := len(contents) > 0
+		for _, content := range contents {
+			key, _, ok := attachmentKey(content)
+			if !ok || !seen[key] {
+				dup = false
+			}
+			if ok {
+				seen[key] = true
+			}
+		}
+		dropped[i] = dup
+	}
+	return dropped
+}
+
+// attachmentKey 返回附件内容的摘要和文件名；没有可比较内容的附件（如 FileReader）返回 ok=false
+func attachmentKey(content Content) (key [sha256.Size]byte, name string, ok bool) {
+	var data []byte
+	switch c := content.(type) {
+	case *File:
+		if c.FileReader != nil {
+			return key, "", false
+		}
+		data, name = c.FileData, c.FileName
+	case *Photo:
+		data, name = c.FileData, c.FileName
+		if len(data) == 0 {
+			url, _ := c.ContentTrace.Extra[traceKeyURL].(string)
+			data = []byte(url)
+		}
+	default:
+		return key, "", false
+	}
+	if len(data) == 0 {
+		return key, "", false
+	}
+	h := sha256.New()
+	h.Write([]byte(content.GetContentType().String()))
+	h.Write([]byte{0})
+	h.Write(data)
+	h.Sum(key[:0])
+	return key, name, true
+}
+
+// contentTrace 返回内容中 ContentTrace 字段的指针
+func contentTrace(content Content) *ContentTrace {
+	switch c := content.(type) {
+	case *Text:
+		return &c.ContentTrace
+	case *File:
+		return &c.ContentTrace
+	case *Photo:
+		return &c.ContentTrace
+	}
+	return &ContentTrace{}
+}
+
+// messageBudget 返回每条 Text 中正文可用的 UTF-16 长度：MaxMessageLength（默认 4096）
+// 减去 header 和 footer 预留的空间
+func messageBudget(options *ConvertOptions) (int, error) {
+	maxMessageLength := options.MaxMessageLength
+	if maxMessageLength <= 0 {
+		maxMessageLength = 4096
+	}
+	if reserved := options.Header.reserved() + options.Footer.reserved(); reserved > 0 {
+		if reserved >= maxMessageLength {
+			return 0, fmt.Errorf("telegramify: header and footer need %d UTF-16 units, leaving no room in a %d-unit message", reserved, maxMessageLength)
+		}
+		maxMessageLength -= reserved
+	}
+	return maxMessageLength, nil
+}
+
+// reserved 返回装饰在每条消息中占用的 UTF-16 长度，包括分隔的换行
+func (d Decoration) reserved() int {
+	if d.Text == "" {
+		return 0
+	}
+	return UTF16Len(d.Text) + 1
+}
+
+// appliesTo 报告装饰是否加到第 first/last 条 Text 上，Placement 为空时使用 fallback
+func (d Decoration) appliesTo(first, last bool, fallback Placement) bool {
+	placement := d.Placement
+	if placement == "" {
+		placement = fallback
+	}
+	switch placement {
+	case PlaceEvery:
+		return true
+	case PlaceLast:
+		return last
+	}
+	return first
+}
+
+// decorate 将 header 和 footer 加到 Text 上；没有 Text 时单独生成一条放在最前面
+func decorate(result []Content, options *ConvertOptions) []Content {
+	header, footer := options.Header, options.Footer
+	if header.Text == "" && footer.Text == "" {
+		return result
+	}
+	var texts []*Text
+	for _, content := range result {
+		if text, ok := content.(*Text); ok {
+			texts = append(texts, text)
+		}
+	}
+	if len(texts) == 0 {
+		text := &Text{ContentTrace: ContentTrace{SourceType: "text"}}
+		result = append([]Content{text}, result...)
+		texts = []*Text{text}
+	}
+	for i, text := range texts {
+		first, last := i == 0, i == len(texts)-1
+		if footer.Text != "" && footer.appliesTo(first, last, PlaceLast) {
+			text.Text, text.Entities = joinLines(text.Text, text.Entities, footer.Text, footer.Entities)
+		}
+		if header.Text != "" && header.appliesTo(first, last, PlaceFirst) {
+			text.Text, text.Entities = joinLines(header.Text, header.Entities, text.Text, text.Entities)
+		}
+	}
+	return result
+}
+
+// joinLines 用换行连接两段文本，b 的实体按 a 的长度后移；任一段为空时不加换行
+func joinLines(a string, aEntities []MessageEntity, b string, bEntities []MessageEntity) (string, []MessageEntity) {
+	if a == "" {
+		return b, append([]MessageEntity(nil), bEntities...)
+	}
+	if b == "" {
+		return a, append([]MessageEntity(nil), aEntities...)
+	}
+	shift := UTF16Len(a) + 1
+	entities := make([]MessageEntity, 0, len(aEntities)+len(bEntities))
+	entities = append(entities, aEntities...)
+	for _, e := range bEntities {
+		e.Offset += shift
+		entities = append(entities, e)
+	}
+	return a + "\n" + b, entities
+}
+
+// selectExtractable 返回需要提取为文件或图片的片段：所有 Mermaid 图（未启用渲染时按代码处理）
+// 和超过 50 行的代码块
+func selectExtractable(ctx context.Context, logger *slog.Logger, segments []Segment, options *ConvertOptions) []Segment {
+	extractableSegments := make([]Segment, 0)
+	for _, s := range segments {
+		if strings.TrimSpace(s.RawCode) == "" {
+			// 空代码块没有可发送的内容，留在正文中（即什么也不输出）
+			continue
+		}
+		if s.Kind == SegmentMermaid && !options.RenderMermaid {
+			logger.DebugContext(ctx, "mermaid rendering disabled, treating diagram as code", "source_start", s.SourceStart)
+			s.Kind = SegmentCodeBlock
+		}
+		if s.Kind == SegmentMermaid {
+			// Mermaid always extracted as photo/file
+			extractableSegments = append(extractableSegments, s)
+			logger.DebugContext(ctx, "segment extracted", "kind", s.Kind, "source_start", s.SourceStart)
+		} else if s.Kind == SegmentCodeBlock && s.Inline {
+			logger.DebugContext(ctx, "code block kept inline", "reason", "pre entity disabled", "source_start", s.SourceStart)
+		} else if s.Kind == SegmentCodeBlock {
+			// Only extract code blocks > 50 lines
+			lineCount := strings.Count(s.RawCode, "\n") + 1
+			if lineCount > 50 {
+				extractableSegments = append(extractableSegments, s)
+				logger.DebugContext(ctx, "segment extracted", "kind", s.Kind, "language", s.Language, "lines", lineCount, "source_start", s.SourceStart)
+			} else {
+				logger.DebugContext(ctx, "code block kept inline", "language", s.Language, "lines", lineCount, "source_start", s.SourceStart)
+			}
+		}
+	}
+	return extractableSegments
+}
+
+// textRange 是 fullText 中的一段，同时记录字节和 UTF-16 偏移
+type textRange struct {
+	byteStart, byteEnd   int
+	utf16Start, utf16End int
+}
+
+// sections 将 [byteStart, byteEnd) 这段文本划分为分别拆分的部分
+//
+// SplitPerHeading 模式下在范围内每个顶层 H1/H2 标题处断开，短于 MinSectionLength 的部分
+// 并入下一部分；其他模式返回整段。
+func sections(headings []converter.Heading, options *ConvertOptions, byteStart, byteEnd, utf16Start, utf16End int) []textRange {
+	if options.SplitStrategy != SplitPerHeading {
+		return []textRange{{byteStart, byteEnd, utf16Start, utf16End}}
+	}
+	var result []textRange
+	current := textRange{byteStart: byteStart, utf16Start: utf16Start}
+	for _, h := range headings {
+		if h.Level > 2 || h.TextStart <= byteStart || h.TextStart >= byteEnd {
+			continue
+		}
+		if h.UTF16Start-current.utf16Start < options.MinSectionLength {
+			continue
+		}
+		current.byteEnd, current.utf16End = h.TextStart, h.UTF16Start
+		result = append(result, current)
+		current = textRange{byteStart: h.TextStart, utf16Start: h.UTF16Start}
+	}
+	current.byteEnd, current.utf16End = byteEnd, utf16End
+	return append(result, current)
+}
+
+// attachFrontMatter 将 front matter 键值记录到第一个 Text 的 ContentTrace
+func attachFrontMatter(result []Content, frontMatter map[string]string) {
+	for _, content := range result {
+		if text, ok := content.(*Text); ok {
+			if text.ContentTrace.Extra == nil {
+				text.ContentTrace.Extra = make(map[string]interface{})
+			}
+			text.ContentTrace.Extra[TraceKeyFrontMatter] = frontMatter
+			return
+		}
+	}
+}
+
+// leadingNewlines 返回 s 开头换行符的字节数
+func leadingNewlines(s string) int {
+	return len(s) - len(strings.TrimLeft(s, lineBreaks))
+}
+
+// sectionPath 返回位置 pos 所在章节的标题路径，如 ["Guide", "Install"]；
+// 第一个标题之前返回 nil
+func sectionPath(headings []converter.Heading, pos int) []string {
+	var stack []converter.Heading
+	for _, h := range headings {
+		if h.TextStart > pos {
+			break
+		}
+		for len(stack) > 0 && stack[len(stack)-1].Level >= h.Level {
+			stack = stack[:len(stack)-1]
+		}
+		stack = append(stack, h)
+	}
+	if len(stack) == 0 {
+		return nil
+	}
+	path := make([]string, len(stack))
+	for i, h := range stack {
+		path[i] = h.Text
+	}
+	return path
+}
+
+// numberChunks 为带有 ChunkInfo 的 Text 填写 Index、Total 和 SectionIndex
+func numberChunks(result []Content) {
+	var texts []*Text
+	for _, content := range result {
+		if text, ok := content.(*Text); ok {
+			if _, ok := text.ContentTrace.Chunk(); ok {
+				texts = append(texts, text)
+			}
+		}
+	}
+	perSection := make(map[string]int)
+	for i, text := range texts {
+		info, _ := text.ContentTrace.Chunk()
+		key := sectionKey(info.Section)
+		info.Index, info.Total, info.SectionIndex = i, len(texts), perSection[key]
+		perSection[key]++
+		text.ContentTrace.Extra[TraceKeyChunk] = info
+	}
+}
+
+// splitOptions 返回管道拆分文本时使用的 SplitOptions
+func splitOptions(options *ConvertOptions) SplitOptions {
+	config := options.Config
+	if config == nil {
+		config = DefaultConfig()
+	}
+	return SplitOptions{MinTailSize: options.MinTailSize, Rule: converter.RuleText(config)}
 }
 
 // appendTextChunks 按 max_message_length 拆分文本并发送 Text 对象
+//
+// textStart 是 text 在文档中的字节位置，用于确定每块所在的章节（见 ChunkInfo）。
 func appendTextChunks(
+	ctx context.Context,
+	logger *slog.Logger,
 	result *[]Content,
 	text string,
 	entities []MessageEntity,
 	maxMessageLength int,
+	split SplitOptions,
+	config *RenderConfig,
+	headings []converter.Heading,
+	textStart int,
 ) {
-	chunks := SplitEntities(text, entities, maxMessageLength)
-	for _, chunk := range chunks {
+	chunks := SplitEntitiesWith(text, entities, maxMessageLength, split)
+	if len(chunks) > 1 {
+		logger.DebugContext(ctx, "text split", "utf16_length", UTF16Len(text), "max_length", maxMessageLength, "chunks", len(chunks))
+	}
+	chunkStart := textStart
+	for i, chunk := range chunks {
+		if len(chunks) > 1 {
+			logger.DebugContext(ctx, "text chunk", "index", i, "utf16_length", UTF16Len(chunk.Text))
+		}
+		for _, e := range chunk.Dropped {
+			logger.WarnContext(ctx, "entity longer than a message dropped", "type", e.Type, "utf16_length", e.Length, "max_length", maxMessageLength)
+		}
+		section := sectionPath(headings, chunkStart+leadingNewlines(chunk.Text))
+		chunkStart += len(chunk.Text)
 		chunkText, chunkEntities := stripNewlinesAdjust(chunk.Text, chunk.Entities)
 		if chunkText != "" {
-			*result = append(*result, &Text{
-				Text:     chunkText,
-				Entities: chunkEntities,
-				ContentTrace: ContentTrace{
-					SourceType: "text",
+			sum := sha256.Sum256([]byte(chunkText))
+			trace := ContentTrace{
+				SourceType: "text",
+				Extra: map[string]interface{}{
+					TraceKeyChunk: ChunkInfo{Section: section, Hash: hex.EncodeToString(sum[:8])},
 				},
+			}
+			// Debug 模式：校验 entity 并附加诊断信息
+			if config.Debug {
+				if errs := ValidateEntities(chunkText, chunkEntities); len(errs) > 0 {
+					trace.Extra[TraceKeyDiagnostics] = errs
+				}
+			}
+			*result = append(*result, &Text{
+				Text:         chunkText,
+				Entities:     chunkEntities,
+				ContentTrace: trace,
 			})
 		}
 	}
 }
 
 // handleCodeBlockAsFile 将大代码块提取为 File（仅当代码超过 50 行时调用）
-func handleCodeBlockAsFile(result *[]Content, seg converter.Segment) {
+//
+// extensions 是 WithLanguageExtensions 注册的语言到扩展名映射，优先于内置映射。
+func handleCodeBlockAsFile(result *[]Content, seg Segment, extensions map[string]string) {
 	rawCode := seg.RawCode
 	lang := seg.Language
 	if lang == "" {
 		lang = "txt"
 	}
-	fileName := util.GetFilename(rawCode, lang)
 	
 	*result = append(*result, &File{
-		FileName: fileName,
+		FileName: codeFileName(seg, extensions),
 		FileData: []byte(rawCode),
 		ContentTrace: ContentTrace{
 			SourceType: "file",
@@ -279,15 +823,24 @@ func handleCodeBlockAsFile(result *[]Content, seg converter.Segment) {
 	})
 }
 
+// codeFileName 返回代码块提取为文件时的文件名
+func codeFileName(seg Segment, extensions map[string]string) string {
+	lang := seg.Language
+	if lang == "" {
+		lang = "txt"
+	}
+	return util.GetFilename(seg.RawCode, lang, extensions)
+}
+
 // handleMermaid 渲染 mermaid 图表为 Photo，或回退到 File
-func handleMermaid(ctx context.Context, result *[]Content, seg converter.Segment) {
+func handleMermaid(ctx context.Context, logger *slog.Logger, result *[]Content, seg Segment) {
 	rawCode := seg.RawCode
 	
 	// 尝试渲染 Mermaid
 	imgData, caption, err := renderMermaid(ctx, rawCode)
 	if err != nil {
 		// 渲染失败，作为文件发送
-		Logger.Printf("Mermaid rendering failed: %v", err)
+		logger.WarnContext(ctx, "mermaid rendering failed, sending diagram as file", "error", err, "source_start", seg.SourceStart)
 		*result = append(*result, &File{
 			FileName: "invalid_mermaid.txt",
 			FileData: []byte(rawCode),
@@ -299,18 +852,61 @@ func handleMermaid(ctx context.Context, result *[]Content, seg converter.Segment
 	}
 	
 	// 渲染成功，作为图片发送
-	*result = append(*result, &Photo{
+	photo := &Photo{
 		FileName: "mermaid.webp",
 		FileData: imgData.Bytes(),
-		Caption:  caption,
 		ContentTrace: ContentTrace{
 			SourceType: ContentTypeMermaid,
 		},
-	})
+	}
+	photo.SetCaption(caption, nil)
+	photo.decodeDimensions()
+	*result = append(*result, photo)
 }
 
-// renderMermaid 内部渲染函数
-func renderMermaid(ctx context.Context, code string) (*bytes.Buffer, string, error) {
-	return mermaid.RenderMermaid(ctx, code, nil)
+// planMermaid 是 dry-run 模式下的 handleMermaid：只记录将要请求的 URL，不下载
+func planMermaid(result *[]Content, seg Segment) {
+	imgURL, err := MermaidImageURL(seg.RawCode)
+	if err != nil {
+		// 真实运行时同样会回退为文件
+		*result = append(*result, &File{
+			FileName: "invalid_mermaid.txt",
+			FileData: []byte(seg.RawCode),
+			ContentTrace: ContentTrace{
+				SourceType: ContentTypeMermaid,
+			},
+		})
+		return
+	}
+	caption, _ := MermaidLiveURL(seg.RawCode)
+	photo := &Photo{
+		FileName: "mermaid.webp",
+		ContentTrace: ContentTrace{
+			SourceType: ContentTypeMermaid,
+			Extra: map[string]interface{}{
+				traceKeyURL: imgURL,
+			},
+		},
+	}
+	photo.SetCaption(caption, nil)
+	*result = append(*result, photo)
+}
+
+// renderMermaid 内部渲染函数（测试中可替换以避免网络请求）
+// 与 planMermaid 一样通过 MermaidImageURL 和 MermaidLiveURL 生成地址
+var renderMermaid = func(ctx context.Context, code string) (*bytes.Buffer, string, error) {
+	imgURL, err := MermaidImageURL(code)
+	if err != nil {
+		return nil, "", err
+	}
+	caption, err := MermaidLiveURL(code)
+	if err != nil {
+		return nil, "", err
+	}
+	imgData, err := mermaid.Download(ctx, imgURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return imgData, caption, nil
 }
 
@@ -1,13 +1,24 @@
 package telegramify
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"runtime"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
-// TestStripNewlinesAdjustInternal_OnlyNewlines 测试只包含换行符的情况
+// TestStripNewlinesAdjust_OnlyNewlines 测试只包含换行符的情况
 // 这是导致 panic: slice bounds out of range [2:0] 的边界情况
-func TestStripNewlinesAdjustInternal_OnlyNewlines(t *testing.T) {
+func TestStripNewlinesAdjust_OnlyNewlines(t *testing.T) {
 	tests := []struct {
 		name     string
 		text     string
@@ -68,19 +79,19 @@ func TestStripNewlinesAdjustInternal_OnlyNewlines(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotText, gotEntities := stripNewlinesAdjustInternal(tt.text, tt.entities)
+			gotText, gotEntities := stripNewlinesAdjust(tt.text, tt.entities)
 			if gotText != tt.wantText {
-				t.Errorf("stripNewlinesAdjustInternal() text = %q, want %q", gotText, tt.wantText)
+				t.Errorf("stripNewlinesAdjust() text = %q, want %q", gotText, tt.wantText)
 			}
 			if len(gotEntities) != tt.wantLen {
-				t.Errorf("stripNewlinesAdjustInternal() entities len = %d, want %d", len(gotEntities), tt.wantLen)
+				t.Errorf("stripNewlinesAdjust() entities len = %d, want %d", len(gotEntities), tt.wantLen)
 			}
 		})
 	}
 }
 
-// TestStripNewlinesAdjustInternal_WithEntities 测试带实体的情况
-func TestStripNewlinesAdjustInternal_WithEntities(t *testing.T) {
+// TestStripNewlinesAdjust_WithEntities 测试带实体的情况
+func TestStripNewlinesAdjust_WithEntities(t *testing.T) {
 	tests := []struct {
 		name         string
 		text         string
@@ -92,50 +103,63 @@ func TestStripNewlinesAdjustInternal_WithEntities(t *testing.T) {
 			name: "entity in middle",
 			text: "\n\nhello world\n\n",
 			entities: []MessageEntity{
-				{Type: "bold", Offset: 2, Length: 5}, // "hello" after leading newlines
+				{Type: EntityBold, Offset: 2, Length: 5}, // "hello" after leading newlines
 			},
 			wantText: "hello world",
 			wantEntities: []MessageEntity{
-				{Type: "bold", Offset: 0, Length: 5}, // adjusted to start
+				{Type: EntityBold, Offset: 0, Length: 5}, // adjusted to start
 			},
 		},
 		{
 			name: "entity clipped by leading newlines",
 			text: "\n\nhello\n\n",
 			entities: []MessageEntity{
-				{Type: "bold", Offset: 0, Length: 7}, // starts before text
+				{Type: EntityBold, Offset: 0, Length: 7}, // starts before text
 			},
 			wantText: "hello",
 			wantEntities: []MessageEntity{
-				{Type: "bold", Offset: 0, Length: 5}, // clipped
+				{Type: EntityBold, Offset: 0, Length: 5}, // clipped
 			},
 		},
 		{
 			name: "entity entirely in stripped area",
 			text: "\n\nhello\n\n",
 			entities: []MessageEntity{
-				{Type: "bold", Offset: 0, Length: 1}, // in leading newlines
+				{Type: EntityBold, Offset: 0, Length: 1}, // in leading newlines
 			},
 			wantText:     "hello",
 			wantEntities: []MessageEntity{}, // entity removed
 		},
+		{
+			name: "crlf runs",
+			text: "\r\n\r\nhello\r\nworld\r\n",
+			entities: []MessageEntity{
+				{Type: EntityBold, Offset: 2, Length: 7},  // "\r\nhello"
+				{Type: EntityItalic, Offset: 9, Length: 9}, // "\r\nworld\r\n"
+			},
+			wantText: "hello\r\nworld",
+			wantEntities: []MessageEntity{
+				{Type: EntityBold, Offset: 0, Length: 5},
+				{Type: EntityItalic, Offset: 5, Length: 7},
+			},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotText, gotEntities := stripNewlinesAdjustInternal(tt.text, tt.entities)
+			gotText, gotEntities := stripNewlinesAdjust(tt.text, tt.entities)
 			if gotText != tt.wantText {
-				t.Errorf("stripNewlinesAdjustInternal() text = %q, want %q", gotText, tt.wantText)
+				t.Errorf("stripNewlinesAdjust() text = %q, want %q", gotText, tt.wantText)
 			}
 			if len(gotEntities) != len(tt.wantEntities) {
-				t.Errorf("stripNewlinesAdjustInternal() entities len = %d, want %d", len(gotEntities), len(tt.wantEntities))
+				t.Errorf("stripNewlinesAdjust() entities len = %d, want %d", len(gotEntities), len(tt.wantEntities))
 				return
 			}
 			for i := range gotEntities {
 				if gotEntities[i].Type != tt.wantEntities[i].Type ||
 					gotEntities[i].Offset != tt.wantEntities[i].Offset ||
 					gotEntities[i].Length != tt.wantEntities[i].Length {
-					t.Errorf("stripNewlinesAdjustInternal() entity[%d] = %+v, want %+v",
+					t.Errorf("stripNewlinesAdjust() entity[%d] = %+v, want %+v",
 						i, gotEntities[i], tt.wantEntities[i])
 				}
 			}
@@ -194,3 +218,876 @@ func TestPathWithTilde(t *testing.T) {
 		})
 	}
 }
+
+// TestLineEndings tests that CRLF and bare CR input converts and splits exactly like LF input
+func TestLineEndings(t *testing.T) {
+	lf := "# Title\n\nSome **bold** text\nnext line\n\n> quote\n\n```go\nx := 1\ny := 2\n```\n\n- a\n- b"
+	for _, eol := range []string{"\r\n", "\r"} {
+		text, entities := Convert(strings.ReplaceAll(lf, "\n", eol), false, nil)
+		wantText, wantEntities := Convert(lf, false, nil)
+		if text != wantText {
+			t.Errorf("%q: text = %q, want %q", eol, text, wantText)
+		}
+		if !reflect.DeepEqual(entities, wantEntities) {
+			t.Errorf("%q: entities = %+v, want %+v", eol, entities, wantEntities)
+		}
+	}
+
+	var long strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&long, "Paragraph %d with **some bold** and `code`.\n\n", i)
+	}
+	want, err := ProcessMarkdown(context.Background(), long.String(), 1000, false, nil)
+	if err != nil {
+		t.Fatalf("ProcessMarkdown() error = %v", err)
+	}
+	got, err := ProcessMarkdown(context.Background(), strings.ReplaceAll(long.String(), "\n", "\r\n"), 1000, false, nil)
+	if err != nil {
+		t.Fatalf("ProcessMarkdown() error = %v", err)
+	}
+	if len(got) != len(want) || len(want) < 2 {
+		t.Fatalf("got %d chunks, want %d (more than one)", len(got), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("chunk %d differs:\ngot:  %+v\nwant: %+v", i, got[i], want[i])
+		}
+	}
+}
+
+// TestFrontMatter tests that leading YAML front matter is stripped and exposed on the first Text
+func TestFrontMatter(t *testing.T) {
+	md := "---\ntitle: \"Hello: World\"\ndate: 2024-01-02\ntags:\n  - go\n# comment\n---\n\nBody **text**"
+
+	text, entities := Convert(md, false, nil)
+	if text != "Body text" {
+		t.Errorf("Convert() text = %q, want %q", text, "Body text")
+	}
+	if bold := findEntity(entities, EntityBold); bold == nil || extractEntityText(text, bold) != "text" {
+		t.Errorf("bold entity = %+v", bold)
+	}
+
+	contents, err := ProcessMarkdown(context.Background(), md, 4096, false, nil)
+	if err != nil {
+		t.Fatalf("ProcessMarkdown() error = %v", err)
+	}
+	first, ok := contents[0].(*Text)
+	if !ok {
+		t.Fatalf("first content is %T, want *Text", contents[0])
+	}
+	want := map[string]string{"title": "Hello: World", "date": "2024-01-02"}
+	if got := first.ContentTrace.Extra[TraceKeyFrontMatter]; !reflect.DeepEqual(got, want) {
+		t.Errorf("front matter = %#v, want %#v", got, want)
+	}
+
+	config := &RenderConfig{MarkdownSymbol: DefaultConfig().MarkdownSymbol, CiteExpandable: true, FrontMatterHeading: []string{"title", "date"}}
+	text, _ = Convert(md, false, config)
+	if want := "📌 Hello: World\n\n2024-01-02\n\nBody text"; text != want {
+		t.Errorf("Convert() with FrontMatterHeading = %q, want %q", text, want)
+	}
+}
+
+// TestFrontMatter_LeftAlone tests documents without valid front matter are converted unchanged
+func TestFrontMatter_LeftAlone(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		want     string // 必须保留在输出中的文本
+	}{
+		{"absent", "# Title\n\ntitle: not front matter", "title: not front matter"},
+		{"unclosed", "---\ntitle: Hello\n\nBody", "————————\n\ntitle: Hello"},
+		{"not yaml", "---\nJust a paragraph\n---\n\nBody", "Just a paragraph"},
+		{"not at start", "Intro\n\n---\ntitle: Hello\n---", "title: Hello"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contents, err := ProcessMarkdown(context.Background(), tt.markdown, 4096, false, nil)
+			if err != nil {
+				t.Fatalf("ProcessMarkdown() error = %v", err)
+			}
+			for _, c := range contents {
+				if text, ok := c.(*Text); ok && text.ContentTrace.Extra[TraceKeyFrontMatter] != nil {
+					t.Errorf("unexpected front matter in %q", tt.markdown)
+				}
+			}
+			text, _ := Convert(tt.markdown, false, nil)
+			if !strings.Contains(text, tt.want) {
+				t.Errorf("Convert(%q) = %q, want it to contain %q", tt.markdown, text, tt.want)
+			}
+		})
+	}
+}
+
+// TestBlankLineNormalization 在一组拼接出来的文档上检查：Convert 的输出没有连续三个换行、
+// 不以换行开头，管道输出的 Text 首尾都没有换行
+func TestBlankLineNormalization(t *testing.T) {
+	blocks := []string{
+		"# Heading", "---", "- a\n- b\n  - c", "1. one\n2. two", "> quote\n> more",
+		"```go\nx := 1\n\n\n\ny := 2\n```", "| a | b |\n|---|---|\n| 1 | 2 |", "Plain **bold** text.",
+		"- [x] done\n- [ ] todo", "```\nplain code\n```", "<div>html</div>", "$$x^2$$",
+	}
+	separators := []string{"\n", "\n\n", "\n\n\n\n", "\n\n \n\n"}
+	for i := 0; i < 50; i++ {
+		var doc strings.Builder
+		doc.WriteString(separators[i%len(separators)])
+		for j := 0; j < 4; j++ {
+			doc.WriteString(blocks[(i*7+j*5)%len(blocks)])
+			doc.WriteString(separators[(i+j)%len(separators)])
+		}
+		md := doc.String()
+
+		text, entities := Convert(md, true, nil)
+		if strings.HasPrefix(text, "\n") {
+			t.Errorf("doc %d: Convert(%q) starts with a newline: %q", i, md, text)
+		}
+		// 代码块内容中的空行保持原样
+		for at := strings.Index(text, "\n\n\n"); at >= 0; at = nextIndex(text, "\n\n\n", at) {
+			offset := UTF16Len(text[:at])
+			inPre := false
+			for _, e := range findEntities(entities, EntityPre) {
+				inPre = inPre || (e.Offset <= offset && offset < e.Offset+e.Length)
+			}
+			if !inPre {
+				t.Errorf("doc %d: Convert(%q) = %q has three newlines outside code", i, md, text)
+				break
+			}
+		}
+
+		contents, err := ProcessMarkdown(context.Background(), md, 120, true, nil)
+		if err != nil {
+			t.Fatalf("doc %d: ProcessMarkdown() error = %v", i, err)
+		}
+		for _, c := range contents {
+			if text, ok := c.(*Text); ok && (strings.HasPrefix(text.Text, "\n") || strings.HasSuffix(text.Text, "\n")) {
+				t.Errorf("doc %d: chunk %q starts or ends with a newline", i, text.Text)
+			}
+		}
+	}
+}
+
+// nextIndex 返回 s 中 at 之后下一次出现 sep 的位置，没有时返回 -1
+func nextIndex(s, sep string, at int) int {
+	if i := strings.Index(s[at+1:], sep); i >= 0 {
+		return at + 1 + i
+	}
+	return -1
+}
+
+// recordHandler 记录收到的 slog 记录，供测试检查
+type recordHandler struct {
+	mu      *sync.Mutex
+	records *[]slog.Record
+	attrs   []slog.Attr
+}
+
+func newRecordHandler() recordHandler {
+	return recordHandler{mu: new(sync.Mutex), records: new([]slog.Record)}
+}
+
+func (h recordHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h recordHandler) Handle(_ context.Context, r slog.Record) error {
+	r = r.Clone()
+	r.AddAttrs(h.attrs...)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	*h.records = append(*h.records, r)
+	return nil
+}
+
+func (h recordHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h.attrs = append(append([]slog.Attr(nil), h.attrs...), attrs...)
+	return h
+}
+
+func (h recordHandler) WithGroup(string) slog.Handler { return h }
+
+// find 返回第一条消息以 prefix 开头的记录的属性
+func (h recordHandler) find(prefix string) (slog.Level, map[string]string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, r := range *h.records {
+		if strings.HasPrefix(r.Message, prefix) {
+			attrs := make(map[string]string)
+			r.Attrs(func(a slog.Attr) bool {
+				attrs[a.Key] = a.Value.String()
+				return true
+			})
+			return r.Level, attrs, true
+		}
+	}
+	return 0, nil, false
+}
+
+// TestLogger 测试管道通过 WithLogger 记录 mermaid 失败和切分决策
+func TestLogger(t *testing.T) {
+	saved := renderMermaid
+	renderMermaid = func(ctx context.Context, code string) (*bytes.Buffer, string, error) {
+		return nil, "", errors.New("render service unavailable")
+	}
+	defer func() { renderMermaid = saved }()
+
+	md := "intro\n\n```mermaid\ngraph TD\n  A-->B\n```\n\n```go\nfmt.Println(1)\n```\n\n" + strings.Repeat("word ", 40)
+	h := newRecordHandler()
+	logger := slog.New(h).With("request_id", "r-42")
+	contents, err := Process(context.Background(), md, WithLogger(logger), WithMaxMessageLength(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f, ok := contents[1].(*File); !ok || f.FileName != "invalid_mermaid.txt" {
+		t.Fatalf("contents[1] = %#v, want the mermaid fallback file", contents[1])
+	}
+
+	level, attrs, ok := h.find("mermaid rendering failed")
+	if !ok {
+		t.Fatal("no record for the mermaid failure")
+	}
+	if level != slog.LevelWarn || attrs["error"] != "render service unavailable" || attrs["request_id"] != "r-42" {
+		t.Errorf("mermaid failure record = %v %v", level, attrs)
+	}
+	if level, attrs, ok := h.find("segment extracted"); !ok || level != slog.LevelDebug || attrs["kind"] != SegmentMermaid {
+		t.Errorf("segment extracted record = %v %v %v", level, attrs, ok)
+	}
+	if _, attrs, ok := h.find("code block kept inline"); !ok || attrs["language"] != "go" {
+		t.Errorf("code block kept inline record = %v %v", attrs, ok)
+	}
+	if _, attrs, ok := h.find("text split"); !ok || attrs["max_length"] != "100" {
+		t.Errorf("text split record = %v %v", attrs, ok)
+	}
+}
+
+// TestLogger_Legacy 测试默认不输出日志，以及 SetLogger 设置或 SetOutput 修改的旧版记录器仍然收到警告
+func TestLogger_Legacy(t *testing.T) {
+	saved := renderMermaid
+	renderMermaid = func(ctx context.Context, code string) (*bytes.Buffer, string, error) {
+		return nil, "", errors.New("boom")
+	}
+	defer func() { renderMermaid = saved }()
+	md := "```mermaid\ngraph TD\n  A-->B\n```"
+
+	if _, err := Process(context.Background(), md); err != nil {
+		t.Fatal(err)
+	}
+
+	if Logger == nil {
+		t.Fatal("default Logger is nil")
+	}
+	defaultLogger := Logger
+	defer SetLogger(defaultLogger)
+
+	var buf bytes.Buffer
+	SetLogger(log.New(&buf, "[telegramify] ", 0))
+	if _, err := Process(context.Background(), md); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "[telegramify] ") || !strings.Contains(out, "level=WARN") || !strings.Contains(out, "error=boom") {
+		t.Errorf("legacy logger output = %q", out)
+	}
+	if strings.Contains(out, "level=DEBUG") {
+		t.Errorf("legacy logger received debug records: %q", out)
+	}
+
+	// 旧代码直接修改默认记录器的输出
+	SetLogger(defaultLogger)
+	buf.Reset()
+	Logger.SetOutput(&buf)
+	defer Logger.SetOutput(io.Discard)
+	if _, err := Process(context.Background(), md); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, "[telegramify] ") || !strings.Contains(out, "error=boom") {
+		t.Errorf("default logger output after SetOutput = %q", out)
+	}
+}
+
+// TestNilContext 测试 ctx 为 nil 时包含 Mermaid 图的文档不会 panic，渲染收到 context.Background()
+func TestNilContext(t *testing.T) {
+	saved := renderMermaid
+	renderMermaid = func(ctx context.Context, code string) (*bytes.Buffer, string, error) {
+		if ctx == nil {
+			t.Error("renderMermaid received a nil context")
+		}
+		return nil, "", errors.New("offline")
+	}
+	defer func() { renderMermaid = saved }()
+	md := "text\n\n```mermaid\ngraph TD; A-->B\n```"
+
+	contents, err := Telegramify(nil, md, 4096, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f, ok := contents[len(contents)-1].(*File); !ok || f.FileName != "invalid_mermaid.txt" {
+		t.Errorf("last content = %#v, want the mermaid fallback file", contents[len(contents)-1])
+	}
+	if _, err := Plan(nil, md); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestContextDeadline 测试 ctx 的截止时间早于渲染完成时中止渲染，并退回为文件
+func TestContextDeadline(t *testing.T) {
+	saved := renderMermaid
+	renderMermaid = func(ctx context.Context, code string) (*bytes.Buffer, string, error) {
+		select {
+		case <-ctx.Done():
+			return nil, "", ctx.Err()
+		case <-time.After(5 * time.Second):
+			return bytes.NewBufferString("image"), "caption", nil
+		}
+	}
+	defer func() { renderMermaid = saved }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	contents, err := Process(ctx, "```mermaid\ngraph TD; A-->B\n```")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Process took %v, the deadline did not abort the render", elapsed)
+	}
+	if len(contents) != 1 {
+		t.Fatalf("got %d contents, want 1: %#v", len(contents), contents)
+	}
+	f, ok := contents[0].(*File)
+	if !ok || f.FileName != "invalid_mermaid.txt" || f.ContentTrace.SourceType != ContentTypeMermaid {
+		t.Fatalf("contents[0] = %#v, want the mermaid fallback file", contents[0])
+	}
+	if string(f.FileData) != "graph TD; A-->B" {
+		t.Errorf("fallback file data = %q", f.FileData)
+	}
+}
+
+// TestTOC 测试目录的内容、缩进、标题数量阈值和长度上限
+func TestTOC(t *testing.T) {
+	md := "# Intro\n\ntext\n\n## Setup\n\nsteps\n\n### Linux\n\n> # quoted heading\n\n- ## heading in list\n\n## FAQ\n\nanswers"
+
+	contents, err := Process(context.Background(), md, WithTOC(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	toc, ok := contents[0].(*Text)
+	if !ok || toc.ContentTrace.SourceType != ContentTypeTOC {
+		t.Fatalf("contents[0] = %#v, want the table of contents", contents[0])
+	}
+	want := "📌 Intro\n  📝 Setup\n    📋 Linux\n  📝 FAQ"
+	if toc.Text != want {
+		t.Errorf("TOC text = %q, want %q", toc.Text, want)
+	}
+	var bold []string
+	for _, e := range findEntities(toc.Entities, EntityBold) {
+		bold = append(bold, extractEntityText(toc.Text, &e))
+	}
+	if !reflect.DeepEqual(bold, []string{"Intro", "Setup", "Linux", "FAQ"}) {
+		t.Errorf("TOC bold entities cover %q", bold)
+	}
+	if body, ok := contents[1].(*Text); !ok || !strings.HasPrefix(body.Text, "📌 Intro\n\ntext") {
+		t.Errorf("contents[1] = %#v, want the document", contents[1])
+	}
+
+	// 标题少于阈值时不生成目录
+	for _, opts := range [][]Option{
+		{WithTOC(true), WithTOCMinHeadings(5)},
+		{WithTOC(false)},
+	} {
+		contents, err := Process(context.Background(), md, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if contents[0].GetContentTrace().SourceType == ContentTypeTOC {
+			t.Errorf("Process() generated a table of contents with %d options", len(opts))
+		}
+	}
+	contents, err = Process(context.Background(), "# One\n\n## Two", WithTOC(true), WithTOCMinHeadings(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contents[0].GetContentTrace().SourceType != ContentTypeTOC {
+		t.Error("WithTOCMinHeadings(2) did not generate a table of contents for two headings")
+	}
+
+	// 超出长度上限的行被省略
+	contents, err = Process(context.Background(), md, WithTOC(true), WithMaxMessageLength(30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if toc := contents[0].(*Text); toc.Text != "📌 Intro\n  📝 Setup" {
+		t.Errorf("capped TOC = %q", toc.Text)
+	}
+}
+
+// TestSplitPerHeading 测试按标题切分：每个顶层 H1/H2 一条消息，实体偏移按各自消息重新计算
+func TestSplitPerHeading(t *testing.T) {
+	md := "# Intro 🎉\n\nwelcome **bold**\n\n## Install\n\nrun `go get`\n\n### Linux\n\nuse apt\n\n" +
+		"## Usage\n\n*call* it\n\n## FAQ\n\n[docs](https://example.com)\n\n# End\n\nbye"
+
+	contents, err := Process(context.Background(), md, WithSplitStrategy(SplitPerHeading))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantStarts := []string{"📌 Intro 🎉", "📝 Install", "📝 Usage", "📝 FAQ", "📌 End"}
+	if len(contents) != len(wantStarts) {
+		t.Fatalf("Process() returned %d contents, want %d: %+v", len(contents), len(wantStarts), contents)
+	}
+	for i, c := range contents {
+		text := c.(*Text)
+		if !strings.HasPrefix(text.Text, wantStarts[i]) {
+			t.Errorf("contents[%d] = %q, want it to start with %q", i, text.Text, wantStarts[i])
+		}
+		if errs := ValidateEntities(text.Text, text.Entities); len(errs) > 0 {
+			t.Errorf("contents[%d] entities invalid: %v", i, errs)
+		}
+	}
+	if !strings.Contains(contents[1].(*Text).Text, "📋 Linux") {
+		t.Errorf("H3 should stay in its section: %q", contents[1].(*Text).Text)
+	}
+	checks := []struct {
+		index int
+		etype string
+		want  string
+	}{
+		{0, EntityBold, "Intro 🎉"},
+		{1, EntityCode, "go get"},
+		{2, EntityItalic, "call"},
+		{3, EntityTextLink, "docs"},
+		{4, EntityBold, "End"},
+	}
+	for _, c := range checks {
+		text := contents[c.index].(*Text)
+		found := false
+		for _, e := range findEntities(text.Entities, c.etype) {
+			if extractEntityText(text.Text, &e) == c.want {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("contents[%d] has no %s entity over %q: %+v", c.index, c.etype, c.want, text.Entities)
+		}
+	}
+
+	// 短于 MinSectionLength 的部分并入下一部分
+	contents, err = Process(context.Background(), md, WithSplitStrategy(SplitPerHeading), WithMinSectionLength(40))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var starts []string
+	for _, c := range contents {
+		starts = append(starts, strings.SplitN(c.(*Text).Text, "\n", 2)[0])
+	}
+	if want := []string{"📌 Intro 🎉", "📝 Usage"}; !reflect.DeepEqual(starts, want) {
+		t.Errorf("sections with MinSectionLength = %q, want %q", starts, want)
+	}
+
+	// 默认仍按长度贪心打包
+	contents, err = Process(context.Background(), md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contents) != 1 {
+		t.Errorf("greedy Process() returned %d contents, want 1", len(contents))
+	}
+}
+
+// TestPanicRecovery 测试转换和管道中的 panic 以错误返回
+func TestPanicRecovery(t *testing.T) {
+	saved := renderMermaid
+	renderMermaid = func(ctx context.Context, code string) (*bytes.Buffer, string, error) {
+		panic("renderer bug")
+	}
+	defer func() { renderMermaid = saved }()
+
+	contents, err := Process(context.Background(), "```mermaid\ngraph TD\n  A-->B\n```")
+	var pe *PanicError
+	if !errors.As(err, &pe) || pe.Value != "renderer bug" || len(pe.Stack) == 0 {
+		t.Fatalf("Process() = %v, %v, want a *PanicError with a stack", contents, err)
+	}
+
+	// 没有 MarkdownSymbol 的配置会在渲染标题时 panic
+	broken := &RenderConfig{}
+	if _, _, err := ConvertE("# Title", false, broken); !errors.As(err, &pe) {
+		t.Errorf("ConvertE() error = %v, want *PanicError", err)
+	}
+	var rtErr runtime.Error
+	if _, err := ProcessMarkdown(context.Background(), "# Title", 4096, false, broken); !errors.As(err, &rtErr) {
+		t.Errorf("ProcessMarkdown() error = %v, want it to unwrap to a runtime.Error", err)
+	}
+	if text, _, err := ConvertE("# Title", false, nil); err != nil || text != "📌 Title" {
+		t.Errorf("ConvertE() = %q, %v", text, err)
+	}
+
+	// Convert 保持原有行为继续 panic，但先记录日志
+	h := newRecordHandler()
+	c := NewConverter(WithLogger(slog.New(h)), WithConfig(broken))
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Convert() did not panic")
+			}
+		}()
+		c.Convert("# Title")
+	}()
+	if level, attrs, ok := h.find("conversion panicked"); !ok || level != slog.LevelError || attrs["stack"] == "" {
+		t.Errorf("log record = %v %v %v, want an error with the stack", level, attrs, ok)
+	}
+}
+
+// TestHeaderFooter 测试 header/footer 占用拆分预算并按位置添加
+func TestHeaderFooter(t *testing.T) {
+	md := strings.Repeat("word ", 19) + "**end**" // 渲染后 98 个 UTF-16 单位
+	contents, err := Process(context.Background(), md, WithMaxMessageLength(110))
+	if err != nil || len(contents) != 1 {
+		t.Fatalf("without header: %d contents, err = %v", len(contents), err)
+	}
+
+	header := "🧑 Alice wrote:"
+	headerEntities := []MessageEntity{{Type: EntityBold, Offset: 3, Length: 5}}
+	footer := "— sent via bot"
+	contents, err = Process(context.Background(), md,
+		WithMaxMessageLength(110),
+		WithHeader(header, headerEntities),
+		WithFooter(footer, nil),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contents) != 2 {
+		t.Fatalf("got %d contents, want 2", len(contents))
+	}
+	first, last := contents[0].(*Text), contents[1].(*Text)
+	for i, text := range []*Text{first, last} {
+		if n := UTF16Len(text.Text); n > 110 {
+			t.Errorf("chunk %d has %d UTF-16 units, limit is 110", i, n)
+		}
+		if !EntitiesValid(text.Text, text.Entities) {
+			t.Errorf("chunk %d entities invalid: %v", i, ValidateEntities(text.Text, text.Entities))
+		}
+	}
+	if !strings.HasPrefix(first.Text, header+"\n") || strings.Contains(first.Text, footer) {
+		t.Errorf("first chunk = %q, want the header only", first.Text)
+	}
+	if !strings.HasSuffix(last.Text, "\n"+footer) || strings.Contains(last.Text, header) {
+		t.Errorf("last chunk = %q, want the footer only", last.Text)
+	}
+	if e := findEntity(first.Entities, EntityBold); e == nil || extractEntityText(first.Text, e) != "Alice" {
+		t.Errorf("header entity = %+v", e)
+	}
+	if e := findEntity(last.Entities, EntityBold); e == nil || extractEntityText(last.Text, e) != "end" {
+		t.Errorf("body entity in last chunk = %+v, want it shifted onto \"end\"", e)
+	}
+
+	// PlaceEvery 给每条消息都加上
+	contents, err = Process(context.Background(), md,
+		WithMaxMessageLength(110),
+		WithHeader(header, nil), WithHeaderPlacement(PlaceEvery),
+		WithFooter(footer, nil), WithFooterPlacement(PlaceEvery),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range contents {
+		text := c.(*Text).Text
+		if !strings.HasPrefix(text, header+"\n") || !strings.HasSuffix(text, "\n"+footer) || UTF16Len(text) > 110 {
+			t.Errorf("chunk %d = %q", i, text)
+		}
+	}
+
+	if _, err := Process(context.Background(), md, WithMaxMessageLength(10), WithHeader(header, nil)); err == nil {
+		t.Error("Process() with a header longer than the limit should fail")
+	}
+}
+
+// TestDedupe 测试 WithDedupe 对重复的 mermaid 图片和代码文件的处理
+func TestDedupe(t *testing.T) {
+	saved := renderMermaid
+	renderMermaid = func(ctx context.Context, code string) (*bytes.Buffer, string, error) {
+		return bytes.NewBufferString("image of " + code), "", nil
+	}
+	defer func() { renderMermaid = saved }()
+
+	diagram := "```mermaid\ngraph TD\n  A-->B\n```\n\n"
+	other := "```mermaid\ngraph TD\n  B-->C\n```\n\n"
+	code := "```python\n" + strings.Repeat("print(1)\n", 60) + "```\n\n"
+	md := "first\n\n" + diagram + "again\n\n" + diagram + other + code + code + "end"
+
+	kinds := func(contents []Content) string {
+		var parts []string
+		for _, c := range contents {
+			switch v := c.(type) {
+			case *Text:
+				parts = append(parts, v.Text)
+			case *File:
+				parts = append(parts, "file:"+v.FileName)
+			case *Photo:
+				parts = append(parts, "photo")
+			}
+		}
+		return strings.Join(parts, " | ")
+	}
+
+	contents, err := Process(context.Background(), md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := kinds(contents), "first | photo | again | photo | photo | file:readable.py | file:readable.py | end"; got != want {
+		t.Errorf("without dedupe: %s, want %s", got, want)
+	}
+
+	contents, err = Process(context.Background(), md, WithDedupe(DedupeReference))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "first | photo | again | 📎 (same as attachment mermaid.webp above) | photo | file:readable.py | 📎 (same as attachment readable.py above) | end"
+	if got := kinds(contents); got != want {
+		t.Errorf("reference: %s, want %s", got, want)
+	}
+	if n := contents[1].GetContentTrace().Extra[TraceKeyDuplicates]; n != 1 {
+		t.Errorf("first diagram duplicates = %v, want 1", n)
+	}
+	if trace := contents[3].GetContentTrace(); trace.SourceType != ContentTypeDuplicate || trace.Extra[TraceKeyDuplicateOf] != "mermaid.webp" {
+		t.Errorf("reference trace = %+v", trace)
+	}
+	if n := contents[4].GetContentTrace().Extra[TraceKeyDuplicates]; n != nil {
+		t.Errorf("different diagram duplicates = %v, want none", n)
+	}
+
+	contents, err = Process(context.Background(), md, WithDedupe(DedupeDrop))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := kinds(contents), "first | photo | again | photo | file:readable.py | end"; got != want {
+		t.Errorf("drop: %s, want %s", got, want)
+	}
+}
+
+// TestOverflow 测试超过消息数上限的文档改为摘要加文件发送，且只有拆分模式会提取代码块和图表
+func TestOverflow(t *testing.T) {
+	rendered := 0
+	saved := renderMermaid
+	renderMermaid = func(ctx context.Context, code string) (*bytes.Buffer, string, error) {
+		rendered++
+		return bytes.NewBufferString("image"), "", nil
+	}
+	defer func() { renderMermaid = saved }()
+
+	paragraph := strings.Repeat("lorem ipsum ", 15) + "\n\n"
+	md := "Intro with **bold** and a [link](https://example.com).\n\nmore\n\n" +
+		strings.Repeat(paragraph, 4) + "```mermaid\ngraph TD\n  A-->B\n```\n\n" +
+		"```python\n" + strings.Repeat("print(1)\n", 60) + "```\n\n" + strings.Repeat(paragraph, 6)
+	const limit = 400
+
+	split, err := Process(context.Background(), md, WithMaxMessageLength(limit))
+	if err != nil {
+		t.Fatal(err)
+	}
+	texts := 0
+	for _, c := range split {
+		if _, ok := c.(*Text); ok {
+			texts++
+		}
+	}
+	if texts != 5 || len(split) != 7 || rendered != 1 {
+		t.Fatalf("split mode: %d texts in %d items, %d renders; want 5 texts, a photo and a file", texts, len(split), rendered)
+	}
+
+	rendered = 0
+	contents, err := Process(context.Background(), md, WithMaxMessageLength(limit), WithOverflow(OverflowSummaryFile, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contents) != 2 || rendered != 0 {
+		t.Fatalf("summary+file: %d items, %d renders; want a summary and a file without rendering", len(contents), rendered)
+	}
+	summary, ok := contents[0].(*Text)
+	if !ok || summary.Text != "Intro with bold and a link." {
+		t.Fatalf("summary = %#v", contents[0])
+	}
+	if bold := findEntity(summary.Entities, EntityBold); bold == nil || EntityText(summary.Text, *bold) != "bold" {
+		t.Errorf("summary entities = %+v", summary.Entities)
+	}
+	if link := findEntity(summary.Entities, EntityTextLink); link == nil || link.URL != "https://example.com" {
+		t.Errorf("summary entities = %+v", summary.Entities)
+	}
+	file, ok := contents[1].(*File)
+	if !ok || file.FileName != "message.md" || string(file.FileData) != md || file.ContentTrace.SourceType != ContentTypeOverflow {
+		t.Errorf("overflow file = %#v", contents[1])
+	}
+
+	contents, _ = Process(context.Background(), md, WithMaxMessageLength(limit), WithOverflow(OverflowFile, 3), WithOverflowPlainText(true))
+	if len(contents) != 1 {
+		t.Fatalf("file mode: %d items, want 1", len(contents))
+	}
+	if file, ok := contents[0].(*File); !ok || file.FileName != "message.txt" || !strings.HasPrefix(string(file.FileData), "Intro with bold") || !strings.Contains(string(file.FileData), "print(1)") {
+		t.Errorf("plain text overflow file = %#v", contents[0])
+	}
+
+	// 未超过上限时与拆分模式相同
+	contents, _ = Process(context.Background(), md, WithMaxMessageLength(limit), WithOverflow(OverflowFile, 5))
+	if len(contents) != len(split) {
+		t.Errorf("below the limit: %d items, want %d", len(contents), len(split))
+	}
+
+	if stats, _ := Stats(md, WithMaxMessageLength(limit), WithOverflow(OverflowSummaryFile, 3)); stats.Messages != 2 {
+		t.Errorf("Stats().Messages = %d, want 2", stats.Messages)
+	}
+}
+
+// TestProcess_MinTailSize 测试管道默认把过短的最后一条消息与前一条重新分配，WithMinTailSize(-1) 保持贪心拆分
+func TestProcess_MinTailSize(t *testing.T) {
+	var paras []string
+	for i := 0; i < 12; i++ {
+		paras = append(paras, fmt.Sprintf("Paragraph %d%s", i, strings.Repeat(" word", 60)))
+	}
+	md := strings.Join(paras, "\n\n") + "\n\n以上。"
+	// 每条消息正好容纳三段，结尾的 "以上。" 单独成为最后一条
+	budget := len(strings.Join(paras[9:], "\n\n")) + 2
+	texts := func(opts ...Option) []string {
+		t.Helper()
+		contents, err := Process(context.Background(), md, append([]Option{WithMaxMessageLength(budget)}, opts...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, c := range contents {
+			out = append(out, c.(*Text).Text)
+		}
+		return out
+	}
+
+	greedy := texts(WithMinTailSize(-1))
+	if last := greedy[len(greedy)-1]; last != "以上。" {
+		t.Fatalf("greedy last message = %q, want the orphan", last)
+	}
+	balanced := texts()
+	if len(balanced) != len(greedy) {
+		t.Errorf("rebalanced into %d messages, want %d", len(balanced), len(greedy))
+	}
+	last := balanced[len(balanced)-1]
+	if UTF16Len(last) < DefaultMinTailSize || !strings.HasSuffix(last, "以上。") {
+		t.Errorf("last message = %q, want at least %d units ending with the orphan", last, DefaultMinTailSize)
+	}
+	if strings.Join(balanced, "\n\n") != strings.Join(greedy, "\n\n") {
+		t.Error("rebalancing changed the text")
+	}
+	stats, err := Stats(md, WithMaxMessageLength(budget))
+	if err != nil || stats.Messages != len(balanced) {
+		t.Errorf("Stats().Messages = %d, %v, want %d", stats.Messages, err, len(balanced))
+	}
+}
+
+// TestProcess_CustomRuleStartsChunk 测试管道按配置的分隔线文字识别分隔线，不让它留在消息末尾
+func TestProcess_CustomRuleStartsChunk(t *testing.T) {
+	config := DefaultConfig()
+	config.MarkdownSymbol.Rule = "· · ·"
+	md := "first paragraph words\n\n---\n\nsecond paragraph"
+	contents, err := Process(context.Background(), md, WithConfig(config), WithMaxMessageLength(30), WithMinTailSize(-1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range contents {
+		got = append(got, c.(*Text).Text)
+	}
+	if want := []string{"first paragraph words", "· · ·\n\nsecond paragraph"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Process() texts = %q, want %q", got, want)
+	}
+}
+
+// TestProcess_EmptyContent 测试没有可发送内容的输入一律返回 ErrEmptyContent，
+// 包括空白、空代码块、空 Mermaid 图表和只有 HTML 注释的输入；带 header 时 Stats 的消息数也与之一致
+func TestProcess_EmptyContent(t *testing.T) {
+	inputs := []string{
+		"",
+		"   \n\t\n\n",
+		"\ufeff\n",
+		"```\n```",
+		"```go\n\n\n```",
+		"```mermaid\n```",
+		"<!-- draft -->",
+		"<!-- a -->\n\n<!-- b -->\n",
+		"```\n```\n\n<!-- note -->\n\n   ",
+	}
+	for _, md := range inputs {
+		contents, err := Process(context.Background(), md, WithHeader("header", nil))
+		if !errors.Is(err, ErrEmptyContent) || contents != nil {
+			t.Errorf("Process(%q) = %+v, %v, want ErrEmptyContent", md, contents, err)
+		}
+		if _, err := TelegramifyReader(context.Background(), strings.NewReader(md)); !errors.Is(err, ErrEmptyContent) {
+			t.Errorf("TelegramifyReader(%q) error = %v, want ErrEmptyContent", md, err)
+		}
+		if _, err := Plan(context.Background(), md); !errors.Is(err, ErrEmptyContent) {
+			t.Errorf("Plan(%q) error = %v, want ErrEmptyContent", md, err)
+		}
+		if stats, err := Stats(md, WithHeader("header", nil)); err != nil || stats.Messages != 0 {
+			t.Errorf("Stats(%q) = %+v, %v, want 0 messages", md, stats, err)
+		}
+	}
+
+	for _, md := range []string{"x", "```\ncode\n```", "<!-- note -->\n\ntext"} {
+		if contents, err := Process(context.Background(), md); err != nil || len(contents) != 1 {
+			t.Errorf("Process(%q) = %+v, %v, want one content", md, contents, err)
+		}
+		contents, err := Process(context.Background(), md, WithHeader("header", nil))
+		if stats, statsErr := Stats(md, WithHeader("header", nil)); err != nil || statsErr != nil || stats.Messages != len(contents) {
+			t.Errorf("Stats(%q) = %+v, %v with a header, Process() produced %d", md, stats, statsErr, len(contents))
+		}
+	}
+}
+
+// TestMermaidInContainers 测试列表项和引用中的 mermaid 图表：提取后前一条消息
+// 不留下孤立的列表符号，各条消息的实体都落在文本之内且覆盖原来的文字
+func TestMermaidInContainers(t *testing.T) {
+	saved := renderMermaid
+	renderMermaid = func(ctx context.Context, code string) (*bytes.Buffer, string, error) {
+		return bytes.NewBufferString("image of " + code), "", nil
+	}
+	defer func() { renderMermaid = saved }()
+
+	diagram := "```mermaid\ngraph TD\n  A-->B\n```"
+	indented := strings.ReplaceAll(diagram, "\n", "\n  ")
+	tests := []struct {
+		name string
+		md   string
+		want []string
+	}{
+		{"second bullet", "- **first** item\n- " + indented + "\n- third *item*", []string{"⦁ first item", "photo", "⦁ third item"}},
+		{"ordered", "1. one\n2. " + strings.ReplaceAll(diagram, "\n", "\n   ") + "\n3. three", []string{"1. one", "photo", "3. three"}},
+		{"nested", "- outer\n  - " + strings.ReplaceAll(diagram, "\n", "\n    ") + "\n  - inner", []string{"⦁ outer", "photo", "  ⦁ inner"}},
+		{"second paragraph", "- first\n- second\n\n  " + indented + "\n- third", []string{"⦁ first\n⦁ second", "photo", "⦁ third"}},
+		{"quote", "> intro **bold**\n>\n> " + strings.ReplaceAll(diagram, "\n", "\n> ") + "\n>\n> outro", []string{"intro bold", "photo", "outro"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contents, err := Process(context.Background(), tt.md)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, c := range contents {
+				switch v := c.(type) {
+				case *Text:
+					got = append(got, v.Text)
+					for i, e := range v.Entities {
+						if e.Offset < 0 || e.Length <= 0 || e.Offset+e.Length > UTF16Len(v.Text) {
+							t.Errorf("entity %+v outside %q", e, v.Text)
+						}
+						if s := extractEntityText(v.Text, &v.Entities[i]); strings.TrimSpace(s) != s || s == "" {
+							t.Errorf("entity %+v covers %q in %q", e, s, v.Text)
+						}
+					}
+				case *Photo:
+					got = append(got, "photo")
+				default:
+					got = append(got, fmt.Sprintf("%T", c))
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Process() = %q, want %q", got, tt.want)
+			}
+			if stats, err := Stats(tt.md); err != nil || stats.Messages != len(contents) {
+				t.Errorf("Stats() = %+v, %v, want %d messages", stats, err, len(contents))
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package telegramify
+
+import "context"
+
+// traceKeyURL is the ContentTrace.Extra key under which a dry run records
+// the address a photo would have been downloaded from.
+const traceKeyURL = "url"
+
+// PlannedItem describes one Content that Process would produce.
+type PlannedItem struct {
+	Type     ContentType
+	FileName string
+	// Size is the UTF-16 length of a text or the byte size of a file. Photos
+	// are not downloaded during planning, so their size is 0.
+	Size int
+	// URL is the address a photo would be fetched from.
+	URL string
+}
+
+// PlanResult summarizes what Process would send for a document.
+type PlanResult struct {
+	Items []PlannedItem
+
+	Texts  int
+	Files  int
+	Photos int
+	// TotalUTF16 is the summed UTF-16 length of all texts.
+	TotalUTF16 int
+	// URLs lists the external addresses the real run would request, in order.
+	URLs []string
+}
+
+// Plan runs the Process pipeline in dry-run mode and reports how many
+// messages the content would become, without rendering mermaid diagrams or
+// fetching anything over the network. Like Process it returns
+// ErrEmptyContent when there is nothing to send.
+func Plan(ctx context.Context, content string, opts ...Option) (PlanResult, error) {
+	options := applyOptions(opts...)
+	options.dryRun = true
+
+	contents, err := processMarkdown(ctx, []byte(content), options)
+	if err != nil {
+		return PlanResult{}, err
+	}
+
+	plan := PlanResult{Items: make([]PlannedItem, 0, len(contents))}
+	for _, c := range contents {
+		item := PlannedItem{Type: c.GetContentType()}
+		switch v := c.(type) {
+		case *Text:
+			item.Size = UTF16Len(v.Text)
+			plan.Texts++
+			plan.TotalUTF16 += item.Size
+		case *File:
+			item.FileName = v.FileName
+			item.Size = int(v.DataSize())
+			plan.Files++
+		case *Photo:
+			item.FileName = v.FileName
+			item.Size = len(v.FileData)
+			if url, ok := v.ContentTrace.Extra[traceKeyURL].(string); ok {
+				item.URL = url
+				plan.URLs = append(plan.URLs, url)
+			}
+			plan.Photos++
+		}
+		plan.Items = append(plan.Items, item)
+	}
+	return plan, nil
+}
@@ -0,0 +1,160 @@
+package telegramify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestPlan_MatchesProcess 测试 Plan 的结果与真实运行的结构一致
+func TestPlan_MatchesProcess(t *testing.T) {
+	md := "# Report\n\nintro text\n\n" +
+		"```mermaid\ngraph TD\n  A-->B\n```\n\n" +
+		"middle text\n\n" +
+		"```python\n" + strings.Repeat("print(1)\n", 60) + "```\n\n" +
+		"```mermaid\nsequenceDiagram\n  A->>B: hi\n```\n\n" +
+		"outro"
+
+	plan, err := Plan(context.Background(), md)
+	if err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+	if plan.Texts != 3 || plan.Files != 1 || plan.Photos != 2 {
+		t.Errorf("Plan() counts = %d texts, %d files, %d photos; want 3, 1, 2", plan.Texts, plan.Files, plan.Photos)
+	}
+	if len(plan.URLs) != 2 || !strings.HasPrefix(plan.URLs[0], "https://mermaid.ink/img/") {
+		t.Errorf("Plan() URLs = %v", plan.URLs)
+	}
+
+	// 用假的渲染器运行真实管道，避免网络请求
+	saved := renderMermaid
+	renderMermaid = func(ctx context.Context, code string) (*bytes.Buffer, string, error) {
+		return bytes.NewBufferString("img"), "caption", nil
+	}
+	defer func() { renderMermaid = saved }()
+
+	contents, err := Process(context.Background(), md)
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if len(contents) != len(plan.Items) {
+		t.Fatalf("Process() returned %d contents, plan has %d items", len(contents), len(plan.Items))
+	}
+	total := 0
+	for i, c := range contents {
+		item := plan.Items[i]
+		if c.GetContentType() != item.Type {
+			t.Errorf("item %d type = %v, plan says %v", i, c.GetContentType(), item.Type)
+		}
+		switch v := c.(type) {
+		case *Text:
+			total += UTF16Len(v.Text)
+			if item.Size != UTF16Len(v.Text) {
+				t.Errorf("item %d size = %d, plan says %d", i, UTF16Len(v.Text), item.Size)
+			}
+		case *File:
+			if item.FileName != v.FileName || item.Size != len(v.FileData) {
+				t.Errorf("item %d = %s (%d bytes), plan says %s (%d bytes)", i, v.FileName, len(v.FileData), item.FileName, item.Size)
+			}
+		}
+	}
+	if plan.TotalUTF16 != total {
+		t.Errorf("Plan() TotalUTF16 = %d, want %d", plan.TotalUTF16, total)
+	}
+}
+
+// TestPlan_NoMermaid 测试关闭 mermaid 渲染时不记录 URL
+func TestPlan_NoMermaid(t *testing.T) {
+	plan, err := Plan(context.Background(), "```mermaid\ngraph TD\n  A-->B\n```", WithMermaid(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Photos != 0 || len(plan.URLs) != 0 || plan.Texts != 1 {
+		t.Errorf("Plan() = %+v, want a single text and no URLs", plan)
+	}
+}
+
+// TestStats 测试 Stats 的消息数估算与 ProcessMarkdown 实际生成的 Text 数一致，
+// 空文档为 0 条且 ProcessMarkdown 返回 ErrEmptyContent
+func TestStats(t *testing.T) {
+	long := strings.Repeat("A paragraph of **bold** text with [a link](https://example.com).\n\n", 80)
+	docs := []string{
+		"",
+		"short *text*",
+		long,
+		"# One\n\n" + long + "# Two\n\nshort\n\n## Three\n\n" + long,
+		"`" + strings.Repeat("QUJD", 2500) + "`",
+		"intro\n\n```go\n" + strings.Repeat("x := 1\n", 40) + "```\n\n" + long,
+		"![logo](https://example.com/logo.png)\n\n- [ ] task\n- [x] done",
+	}
+	for _, budget := range []int{200, 1000, 4096} {
+		for i, md := range docs {
+			stats, err := Stats(md, WithMaxMessageLength(budget))
+			if err != nil {
+				t.Fatal(err)
+			}
+			contents, err := ProcessMarkdown(context.Background(), md, budget, true, nil)
+			if err != nil && !errors.Is(err, ErrEmptyContent) {
+				t.Fatal(err)
+			}
+			if stats.Messages != len(contents) {
+				t.Errorf("doc %d at %d: Stats().Messages = %d, ProcessMarkdown() produced %d", i, budget, stats.Messages, len(contents))
+			}
+		}
+	}
+
+	// 按章节拆分时同样一致
+	md := docs[3]
+	stats, _ := Stats(md, WithSplitStrategy(SplitPerHeading))
+	contents, _ := Process(context.Background(), md, WithSplitStrategy(SplitPerHeading))
+	if stats.Messages != len(contents) {
+		t.Errorf("per-heading: Stats().Messages = %d, Process() produced %d", stats.Messages, len(contents))
+	}
+
+	md = "# Title\n\nSee [docs](https://example.com/docs) ![img](https://example.com/a.png)\n\n" +
+		"```mermaid\ngraph TD\n  A-->B\n```\n\n```go\nfmt.Println(1)\nfmt.Println(2)\n```\n\n" +
+		"```python\n" + strings.Repeat("print(1)\n", 60) + "```"
+	stats, err := Stats(md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, entities := Convert(md, true, nil)
+	want := ConvertStats{
+		UTF16Length:     UTF16Len(text),
+		Characters:      len([]rune(text)),
+		Words:           len(strings.Fields(text)),
+		Messages:        4,
+		Entities:        len(entities),
+		CodeBlocks:      2,
+		CodeLines:       62,
+		MermaidDiagrams: 1,
+		Images:          1,
+	}
+	if stats != want {
+		t.Errorf("Stats() = %+v, want %+v", stats, want)
+	}
+
+	// 重复的代码块：DedupeDrop 删除的附件和占位说明不计入
+	block := "```python\n" + strings.Repeat("print(1)\n", 60) + "```\n\n"
+	md = "intro\n\n" + block + "again\n\n" + block + block + "```go\n" + strings.Repeat("x := 1\n", 60) + "```"
+	for _, opts := range [][]Option{
+		{WithDedupe(DedupeOff)},
+		{WithDedupe(DedupeReference)},
+		{WithDedupe(DedupeDrop)},
+		{WithDedupe(DedupeDrop), WithAttachmentPlaceholders(true)},
+	} {
+		stats, err := Stats(md, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, err := Process(context.Background(), md, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Messages != len(contents) {
+			t.Errorf("%s: Stats().Messages = %d, Process() produced %d", applyOptions(opts...).Dedupe, stats.Messages, len(contents))
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package telegramify
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"sync"
+)
+
+// maxPooledBufferSize caps the buffers kept for reuse so that one huge input
+// does not pin its memory for the lifetime of the process.
+const maxPooledBufferSize = 4 << 20
+
+var readBufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// readPooled reads r into a pooled buffer. The caller must hand the buffer
+// back with releaseBuffer once nothing references its bytes any more.
+func readPooled(r io.Reader) (*bytes.Buffer, error) {
+	buf := readBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	if _, err := buf.ReadFrom(r); err != nil {
+		releaseBuffer(buf)
+		return nil, err
+	}
+	return buf, nil
+}
+
+func releaseBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	readBufferPool.Put(buf)
+}
+
+// ConvertReader converts Markdown read from r into (plain_text, entities).
+//
+// The input is read into a reused buffer and parsed in place, so large
+// documents are not copied again into a string first. Like ConvertE it
+// reports a panic as a *PanicError and a document over the safety limits of
+// the RenderConfig as a *LimitError.
+func ConvertReader(r io.Reader, opts ...Option) (string, []MessageEntity, error) {
+	options := applyOptions(opts...)
+	buf, err := readPooled(r)
+	if err != nil {
+		return "", nil, err
+	}
+	defer releaseBuffer(buf)
+
+	return converterFor(options).convertE(buf.Bytes(), options.LatexEscape, options.Config)
+}
+
+// TelegramifyReader is like Process but reads the Markdown from r.
+func TelegramifyReader(ctx context.Context, r io.Reader, opts ...Option) ([]Content, error) {
+	options := applyOptions(opts...)
+	buf, err := readPooled(r)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseBuffer(buf)
+
+	return processMarkdown(ctx, buf.Bytes(), options)
+}
+
+// TelegramifyFile is like Process but reads the Markdown from path in fsys,
+// which makes it easy to relay documents bundled with embed.FS.
+func TelegramifyFile(ctx context.Context, fsys fs.FS, path string, opts ...Option) ([]Content, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return TelegramifyReader(ctx, f, opts...)
+}
@@ -0,0 +1,114 @@
+package telegramify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"testing/iotest"
+)
+
+// TestConvertReader_MatchesConvert 测试 ConvertReader 与 Convert 输出一致
+func TestConvertReader_MatchesConvert(t *testing.T) {
+	docs := []string{
+		"# Title\n\nplain **bold** text",
+		"formula \\(x^2 + \\frac{1}{2}\\) here",
+		"this is ||secret|| text",
+		"",
+	}
+	for _, md := range docs {
+		wantText, wantEntities := Convert(md, true, nil)
+		gotText, gotEntities, err := ConvertReader(strings.NewReader(md))
+		if err != nil {
+			t.Fatalf("ConvertReader(%q) error = %v", md, err)
+		}
+		if gotText != wantText {
+			t.Errorf("ConvertReader(%q) text = %q, want %q", md, gotText, wantText)
+		}
+		if len(gotEntities) != len(wantEntities) {
+			t.Errorf("ConvertReader(%q) entities = %+v, want %+v", md, gotEntities, wantEntities)
+		}
+	}
+}
+
+// TestConvertReader_BufferReuse 测试缓冲区复用不会破坏之前的结果
+func TestConvertReader_BufferReuse(t *testing.T) {
+	first, _, err := ConvertReader(strings.NewReader("first *document* with `code`"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, _, err := ConvertReader(strings.NewReader(strings.Repeat("zzzz ", 20))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if first != "first document with code" {
+		t.Errorf("earlier result changed after buffer reuse: %q", first)
+	}
+}
+
+// TestConvertReader_Error 测试读取错误被返回
+func TestConvertReader_Error(t *testing.T) {
+	boom := errors.New("boom")
+	if _, _, err := ConvertReader(iotest.ErrReader(boom)); !errors.Is(err, boom) {
+		t.Errorf("ConvertReader() error = %v, want %v", err, boom)
+	}
+	if _, err := TelegramifyReader(context.Background(), iotest.ErrReader(boom)); !errors.Is(err, boom) {
+		t.Errorf("TelegramifyReader() error = %v, want %v", err, boom)
+	}
+}
+
+// TestTelegramifyFile 测试从 fs.FS 读取
+func TestTelegramifyFile(t *testing.T) {
+	fsys := fstest.MapFS{
+		"docs/intro.md": {Data: []byte("## Intro\n\nWelcome to **docs**.")},
+	}
+	contents, err := TelegramifyFile(context.Background(), fsys, "docs/intro.md", WithMermaid(false))
+	if err != nil {
+		t.Fatalf("TelegramifyFile() error = %v", err)
+	}
+	if len(contents) != 1 {
+		t.Fatalf("TelegramifyFile() returned %d contents, want 1", len(contents))
+	}
+	if text := contents[0].(*Text).Text; text != "📝 Intro\n\nWelcome to docs." {
+		t.Errorf("TelegramifyFile() text = %q", text)
+	}
+
+	if _, err := TelegramifyFile(context.Background(), fsys, "missing.md"); err == nil {
+		t.Error("TelegramifyFile() on missing file should fail")
+	}
+}
+
+func largeMarkdown() string {
+	var sb strings.Builder
+	for sb.Len() < 64<<10 {
+		sb.WriteString("## Section\n\nSome **bold** text with a [link](https://example.com) and `code`.\n\n- item one\n- item two\n\n")
+	}
+	return sb.String()
+}
+
+// BenchmarkConvert_LargeFromReader 基线：先读成 string 再 Convert
+func BenchmarkConvert_LargeFromReader(b *testing.B) {
+	data := []byte(largeMarkdown())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		raw, _ := io.ReadAll(bytes.NewReader(data))
+		Convert(string(raw), true, nil)
+	}
+}
+
+// BenchmarkConvertReader_Large 直接从 io.Reader 转换
+func BenchmarkConvertReader_Large(b *testing.B) {
+	data := []byte(largeMarkdown())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := ConvertReader(bytes.NewReader(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
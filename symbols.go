@@ -0,0 +1,156 @@
+package telegramify
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Names of the built-in symbol presets.
+const (
+	// SymbolPresetDefault is the emoji set of DefaultConfig.
+	SymbolPresetDefault = "default"
+	// SymbolPresetASCII uses Markdown-like ASCII markers such as "#", ">",
+	// "[x]", "[ ]" and a rule of dashes.
+	SymbolPresetASCII = "ascii"
+	// SymbolPresetMinimal drops heading, quote and image symbols, leaving
+	// the formatting to entities, marks tasks with "✓" and "○" and draws
+	// rules as "···".
+	SymbolPresetMinimal = "minimal"
+	// SymbolPresetHighContrast uses bold geometric shapes that stay
+	// distinguishable at small sizes and in monochrome themes.
+	SymbolPresetHighContrast = "high-contrast"
+)
+
+// symbolPresets holds the built-in presets. Entries are copied on lookup.
+var symbolPresets = map[string]Symbol{
+	SymbolPresetDefault: *DefaultConfig().MarkdownSymbol,
+	SymbolPresetASCII: {
+		HeadingLevel1:   "#",
+		HeadingLevel2:   "##",
+		HeadingLevel3:   "###",
+		HeadingLevel4:   "####",
+		HeadingLevel5:   "#####",
+		HeadingLevel6:   "######",
+		Quote:           ">",
+		Image:           "[image]",
+		TaskCompleted:   "[x]",
+		TaskUncompleted: "[ ]",
+		Rule:            "--------",
+	},
+	SymbolPresetMinimal: {
+		TaskCompleted:   "✓",
+		TaskUncompleted: "○",
+		Rule:            "···",
+	},
+	SymbolPresetHighContrast: {
+		HeadingLevel1:   "█",
+		HeadingLevel2:   "▌",
+		HeadingLevel3:   "▶",
+		HeadingLevel4:   "▷",
+		HeadingLevel5:   "●",
+		HeadingLevel6:   "○",
+		Quote:           "▍",
+		Image:           "▣",
+		TaskCompleted:   "■",
+		TaskUncompleted: "□",
+		Rule:            "━━━━━━━━",
+	},
+}
+
+// SymbolPreset returns a copy of the built-in preset with the given name
+// (SymbolPresetDefault, SymbolPresetASCII, SymbolPresetMinimal or
+// SymbolPresetHighContrast). Use it with WithSymbols or as the
+// MarkdownSymbol of a RenderConfig:
+//
+//	ascii, _ := telegramify.SymbolPreset(telegramify.SymbolPresetASCII)
+//	contents, err := telegramify.Process(ctx, markdown, telegramify.WithSymbols(ascii))
+func SymbolPreset(name string) (*Symbol, error) {
+	preset, ok := symbolPresets[name]
+	if !ok {
+		return nil, fmt.Errorf("telegramify: unknown symbol preset %q", name)
+	}
+	return &preset, nil
+}
+
+// SymbolPresets returns the names of the built-in presets, sorted.
+func SymbolPresets() []string {
+	return presetNames(symbolPresets)
+}
+
+// presetNames returns the sorted keys of presets.
+func presetNames(presets map[string]Symbol) []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WithSymbols replaces all symbols of the render configuration with a copy
+// of symbols, such as a preset returned by SymbolPreset. Like
+// WithSymbolOverride it combines with WithConfig in any order, and later
+// overrides such as WithTaskSymbols still apply. Nil leaves the symbols
+// unchanged.
+func WithSymbols(symbols *Symbol) Option {
+	if symbols == nil {
+		return func(*ConvertOptions) {}
+	}
+	preset := *symbols
+	return WithSymbolOverride(func(s *Symbol) {
+		*s = preset
+	})
+}
+
+// converterPresets are the symbol presets registered on a Converter.
+type converterPresets struct {
+	mu      sync.RWMutex
+	presets map[string]Symbol
+}
+
+// RegisterSymbolPreset adds a named symbol preset to c, or replaces one
+// registered before; it may also shadow a built-in name for this Converter.
+// The symbols are copied and validated like those of a RenderConfig.
+func (c *Converter) RegisterSymbolPreset(name string, symbols *Symbol) error {
+	if symbols == nil {
+		return fmt.Errorf("telegramify: symbol preset %q is nil", name)
+	}
+	if err := symbols.Validate(); err != nil {
+		return err
+	}
+	c.symbolPresets.mu.Lock()
+	defer c.symbolPresets.mu.Unlock()
+	if c.symbolPresets.presets == nil {
+		c.symbolPresets.presets = make(map[string]Symbol)
+	}
+	c.symbolPresets.presets[name] = *symbols
+	return nil
+}
+
+// SymbolPreset returns a copy of the preset registered on c under name,
+// falling back to the built-in presets.
+func (c *Converter) SymbolPreset(name string) (*Symbol, error) {
+	c.symbolPresets.mu.RLock()
+	preset, ok := c.symbolPresets.presets[name]
+	c.symbolPresets.mu.RUnlock()
+	if ok {
+		return &preset, nil
+	}
+	return SymbolPreset(name)
+}
+
+// SymbolPresets returns the names of the presets available on c, built-in
+// and registered, sorted.
+func (c *Converter) SymbolPresets() []string {
+	c.symbolPresets.mu.RLock()
+	defer c.symbolPresets.mu.RUnlock()
+	all := make(map[string]Symbol, len(symbolPresets)+len(c.symbolPresets.presets))
+	for name, preset := range symbolPresets {
+		all[name] = preset
+	}
+	for name, preset := range c.symbolPresets.presets {
+		all[name] = preset
+	}
+	return presetNames(all)
+}
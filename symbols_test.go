@@ -0,0 +1,86 @@
+package telegramify
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestSymbolPreset 测试同一任务列表和标题在各预设下的符号，以及符号长度不同时实体偏移正确
+func TestSymbolPreset(t *testing.T) {
+	md := "# **Title**\n\n- [x] **done**\n- [ ] `todo`"
+	for _, name := range SymbolPresets() {
+		t.Run(name, func(t *testing.T) {
+			symbols, err := SymbolPreset(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			config := DefaultConfig()
+			config.MarkdownSymbol = symbols
+			text, entities := Convert(md, false, config)
+
+			heading := "Title"
+			if symbols.HeadingLevel1 != "" {
+				heading = symbols.HeadingLevel1 + " Title"
+			}
+			want := heading + "\n\n" + symbols.TaskCompleted + " done\n" + symbols.TaskUncompleted + " todo\n"
+			if text != want {
+				t.Fatalf("Convert() = %q, want %q", text, want)
+			}
+			if e := findEntity(entities, EntityCode); e == nil || extractEntityText(text, e) != "todo" {
+				t.Errorf("code entity = %+v in %q", e, text)
+			}
+			bold := findEntities(entities, EntityBold)
+			var got []string
+			for i := range bold {
+				got = append(got, extractEntityText(text, &bold[i]))
+			}
+			if !strings.Contains(strings.Join(got, "|"), "done") {
+				t.Errorf("bold entities cover %q in %q, want one covering \"done\"", got, text)
+			}
+		})
+	}
+
+	ascii, _ := SymbolPreset(SymbolPresetASCII)
+	ascii.TaskCompleted = "changed"
+	if again, _ := SymbolPreset(SymbolPresetASCII); again.TaskCompleted != "[x]" {
+		t.Errorf("SymbolPreset shares its result: TaskCompleted = %q", again.TaskCompleted)
+	}
+	if _, err := SymbolPreset("nope"); err == nil {
+		t.Error("SymbolPreset(\"nope\") succeeded")
+	}
+}
+
+// TestConverter_RegisterSymbolPreset 测试在 Converter 上注册的预设，以及 WithSymbols 与其他符号选项的组合
+func TestConverter_RegisterSymbolPreset(t *testing.T) {
+	c := NewConverter()
+	german := &Symbol{TaskCompleted: "[erledigt]", TaskUncompleted: "[offen]"}
+	if err := c.RegisterSymbolPreset("de", german); err != nil {
+		t.Fatal(err)
+	}
+	german.TaskCompleted = "changed"
+	if err := c.RegisterSymbolPreset("broken", &Symbol{Quote: "\n"}); err == nil {
+		t.Error("RegisterSymbolPreset accepted a symbol with a line break")
+	}
+
+	symbols, err := c.SymbolPreset("de")
+	if err != nil || symbols.TaskCompleted != "[erledigt]" {
+		t.Fatalf("SymbolPreset(\"de\") = %+v, %v", symbols, err)
+	}
+	if _, err := c.SymbolPreset(SymbolPresetASCII); err != nil {
+		t.Errorf("built-in preset not found on Converter: %v", err)
+	}
+	if _, err := NewConverter().SymbolPreset("de"); err == nil {
+		t.Error("preset registered on one Converter is visible on another")
+	}
+	if names := strings.Join(c.SymbolPresets(), ","); names != "ascii,de,default,high-contrast,minimal" {
+		t.Errorf("SymbolPresets() = %s", names)
+	}
+
+	text, entities := NewConverter(WithSymbols(symbols), WithTaskSymbols("[ja]", "[offen]")).Convert("- [x] **a**\n- [ ] b")
+	if text != "[ja] a\n[offen] b\n" {
+		t.Errorf("Convert() = %q", text)
+	}
+	if e := findEntity(entities, EntityBold); e == nil || e.Offset != len("[ja] ") || extractEntityText(text, e) != "a" {
+		t.Errorf("bold entity = %+v in %q", e, text)
+	}
+}
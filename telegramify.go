@@ -43,7 +43,7 @@ import (
 // 代码块提取和 Mermaid 渲染。对于较低级别的纯文本转换，使用 Convert()。
 //
 // 参数：
-//   - ctx: 上下文
+//   - ctx: 上下文，用于 Mermaid 渲染的网络请求；为 nil 时视为 context.Background()
 //   - content: 原始 Markdown 文本
 //   - maxMessageLength: 每条文本消息的最大 UTF-16 code units（Telegram 限制为 4096）
 //   - latexEscape: 是否将 LaTeX \(...\) 和 \[...\] 转换为 Unicode
@@ -62,3 +62,17 @@ func Telegramify(
 	return ProcessMarkdown(ctx, content, maxMessageLength, latexEscape, config)
 }
 
+
+// Process 与 Telegramify 相同，但通过 Option 配置
+//
+// 默认启用 LaTeX 转换和 Mermaid 渲染，每条消息最多 4096 个 UTF-16 code units。
+//
+// 示例：
+//
+//	contents, err := telegramify.Process(ctx, markdown,
+//	    telegramify.WithMaxMessageLength(2000),
+//	    telegramify.WithMermaid(false),
+//	)
+func Process(ctx context.Context, content string, opts ...Option) ([]Content, error) {
+	return processMarkdown(ctx, []byte(content), applyOptions(opts...))
+}
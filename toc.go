@@ -0,0 +1,89 @@
+package telegramify
+
+import (
+	"strings"
+
+	"github.com/riverfjs/telegramify-go/internal/converter"
+)
+
+// defaultTOCMinHeadings is used when ConvertOptions.TOCMinHeadings is zero.
+const defaultTOCMinHeadings = 3
+
+// buildTOC renders the outline of headings as a Text: one line per heading,
+// indented by its level relative to the shallowest heading and prefixed with
+// its heading symbol, with the heading text in bold unless bold entities
+// are disabled. Lines that would push
+// the outline past maxLength are left out. It returns nil when there are
+// fewer than minHeadings headings.
+func buildTOC(headings []converter.Heading, minHeadings, maxLength int, config *RenderConfig) *Text {
+	if minHeadings <= 0 {
+		minHeadings = defaultTOCMinHeadings
+	}
+	if len(headings) < minHeadings {
+		return nil
+	}
+	top := headings[0].Level
+	for _, h := range headings {
+		top = min(top, h.Level)
+	}
+
+	var b strings.Builder
+	var entities []MessageEntity
+	length := 0
+	for _, h := range headings {
+		if h.Text == "" {
+			continue
+		}
+		prefix := strings.Repeat("  ", h.Level-top)
+		if symbol := headingSymbol(config.MarkdownSymbol, h.Level); symbol != "" {
+			prefix += symbol + " "
+		}
+		line := prefix + h.Text
+		if b.Len() > 0 {
+			line = "\n" + line
+		}
+		lineLength := UTF16Len(line)
+		if length+lineLength > maxLength {
+			break
+		}
+		if !config.EntityDisabled(EntityBold) {
+			entities = append(entities, MessageEntity{
+				Type:   EntityBold,
+				Offset: length + lineLength - UTF16Len(h.Text),
+				Length: UTF16Len(h.Text),
+			})
+		}
+		b.WriteString(line)
+		length += lineLength
+	}
+	if b.Len() == 0 {
+		return nil
+	}
+	return &Text{
+		Text:         b.String(),
+		Entities:     entities,
+		ContentTrace: ContentTrace{SourceType: ContentTypeTOC},
+	}
+}
+
+// headingSymbol returns the configured prefix of headings of the given level.
+func headingSymbol(symbols *Symbol, level int) string {
+	if symbols == nil {
+		return ""
+	}
+	switch level {
+	case 1:
+		return symbols.HeadingLevel1
+	case 2:
+		return symbols.HeadingLevel2
+	case 3:
+		return symbols.HeadingLevel3
+	case 4:
+		return symbols.HeadingLevel4
+	case 5:
+		return symbols.HeadingLevel5
+	case 6:
+		return symbols.HeadingLevel6
+	}
+	return ""
+}
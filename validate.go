@@ -0,0 +1,216 @@
+package telegramify
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// MaxEntitiesPerMessage is the maximum number of entities Telegram accepts in one message.
+const MaxEntitiesPerMessage = 100
+
+// maxCustomEmojiLength bounds the UTF-16 length of a custom_emoji entity.
+// The longest emoji sequences (ZWJ families with skin tones) stay well below this.
+const maxCustomEmojiLength = 16
+
+// knownEntityTypes lists the entity types accepted by the Bot API.
+var knownEntityTypes = map[string]bool{
+	EntityMention:              true,
+	EntityHashtag:              true,
+	EntityCashtag:              true,
+	EntityBotCommand:           true,
+	EntityURL:                  true,
+	EntityEmail:                true,
+	EntityPhoneNumber:          true,
+	EntityBold:                 true,
+	EntityItalic:               true,
+	EntityUnderline:            true,
+	EntityStrikethrough:        true,
+	EntitySpoiler:              true,
+	EntityBlockquote:           true,
+	EntityExpandableBlockquote: true,
+	EntityCode:                 true,
+	EntityPre:                  true,
+	EntityTextLink:             true,
+	EntityTextMention:          true,
+	EntityCustomEmoji:          true,
+}
+
+// EntityError describes a single entity that Telegram would reject.
+//
+// Index is the position of the offending entity in the validated slice,
+// or -1 when the problem concerns the entity set as a whole.
+type EntityError struct {
+	Index  int
+	Entity MessageEntity
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *EntityError) Error() string {
+	if e.Index < 0 {
+		return "entities: " + e.Reason
+	}
+	return fmt.Sprintf("entity %d (%s @%d+%d): %s", e.Index, e.Entity.Type, e.Entity.Offset, e.Entity.Length, e.Reason)
+}
+
+// ValidateEntities checks entities against the constraints the Bot API enforces
+// on sendMessage and returns one error per violation (nil if the set is valid).
+//
+// Checked rules:
+//   - offsets and lengths are non-negative, lengths are positive, and every
+//     entity lies within the UTF-16 length of text
+//   - at most MaxEntitiesPerMessage entities
+//   - pre and code entities neither contain nor partially overlap other entities
+//     (they may themselves sit inside e.g. bold or text_link)
+//   - custom_emoji entities carry a numeric id and cover a single short emoji
+//   - text_link URLs are syntactically valid absolute URLs
+//   - blockquote / expandable_blockquote entities start at a line boundary and
+//     are not nested in or overlapping with each other
+func ValidateEntities(text string, entities []MessageEntity) []error {
+	var errs []error
+	fail := func(i int, reason string, args ...interface{}) {
+		e := &EntityError{Index: i, Reason: fmt.Sprintf(reason, args...)}
+		if i >= 0 {
+			e.Entity = entities[i]
+		}
+		errs = append(errs, e)
+	}
+
+	if len(entities) > MaxEntitiesPerMessage {
+		fail(-1, "%d entities exceed the limit of %d", len(entities), MaxEntitiesPerMessage)
+	}
+
+	total := UTF16Len(text)
+	inBounds := make([]bool, len(entities))
+
+	for i, ent := range entities {
+		if !knownEntityTypes[ent.Type] {
+			fail(i, "unknown entity type %q", ent.Type)
+		}
+		if ent.Offset < 0 {
+			fail(i, "negative offset")
+			continue
+		}
+		if ent.Length <= 0 {
+			fail(i, "non-positive length")
+			continue
+		}
+		if ent.Offset+ent.Length > total {
+			fail(i, "ends at %d, beyond text length %d", ent.Offset+ent.Length, total)
+			continue
+		}
+		inBounds[i] = true
+
+		switch ent.Type {
+		case EntityTextLink:
+			if reason := checkEntityURL(ent.URL); reason != "" {
+				fail(i, "%s", reason)
+			}
+		case EntityCustomEmoji:
+			if !isNumeric(ent.CustomEmojiID) {
+				fail(i, "custom_emoji_id %q is not numeric", ent.CustomEmojiID)
+			}
+			if ent.Length > maxCustomEmojiLength {
+				fail(i, "custom_emoji covers %d UTF-16 units, more than one emoji", ent.Length)
+			}
+		case EntityBlockquote, EntityExpandableBlockquote:
+			if ent.Offset > 0 && !precededByNewline(text, ent.Offset) {
+				fail(i, "%s does not start at the beginning of a line", ent.Type)
+			}
+		}
+	}
+
+	for i, a := range entities {
+		if !inBounds[i] {
+			continue
+		}
+		for j := i + 1; j < len(entities); j++ {
+			if !inBounds[j] {
+				continue
+			}
+			b := entities[j]
+			if !entitiesOverlap(a, b) {
+				continue
+			}
+			if (isCodeEntity(a.Type) && !entityContains(b, a)) || (isCodeEntity(b.Type) && !entityContains(a, b)) {
+				fail(j, "overlaps %s entity %d; pre and code cannot contain or cross other entities", a.Type, i)
+			}
+			if isQuoteEntity(a.Type) && isQuoteEntity(b.Type) {
+				fail(j, "nested in or overlapping %s entity %d", a.Type, i)
+			}
+		}
+	}
+
+	return errs
+}
+
+// EntitiesValid reports whether ValidateEntities finds no problems.
+func EntitiesValid(text string, entities []MessageEntity) bool {
+	return len(ValidateEntities(text, entities)) == 0
+}
+
+// checkEntityURL returns a non-empty reason if rawURL is not acceptable for a text_link.
+func checkEntityURL(rawURL string) string {
+	if rawURL == "" {
+		return "text_link without url"
+	}
+	if strings.ContainsAny(rawURL, " \t\n") {
+		return fmt.Sprintf("url %q contains whitespace", rawURL)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Sprintf("invalid url: %v", err)
+	}
+	if u.Scheme == "" {
+		return fmt.Sprintf("url %q has no scheme", rawURL)
+	}
+	if (u.Scheme == "http" || u.Scheme == "https") && u.Host == "" {
+		return fmt.Sprintf("url %q has no host", rawURL)
+	}
+	return ""
+}
+
+// precededByNewline reports whether the character right before utf16Offset is '\n'.
+func precededByNewline(text string, utf16Offset int) bool {
+	pos := 0
+	prev := rune(-1)
+	for _, r := range text {
+		if pos >= utf16Offset {
+			break
+		}
+		prev = r
+		if r > 0xFFFF {
+			pos += 2
+		} else {
+			pos++
+		}
+	}
+	return prev == '\n'
+}
+
+func entitiesOverlap(a, b MessageEntity) bool {
+	return a.Offset < b.Offset+b.Length && b.Offset < a.Offset+a.Length
+}
+
+// entityContains reports whether outer covers the whole range of inner.
+func entityContains(outer, inner MessageEntity) bool {
+	return outer.Offset <= inner.Offset && inner.Offset+inner.Length <= outer.Offset+outer.Length
+}
+
+func isNumeric(s string) bool {
+	for _, ch := range s {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isCodeEntity(entityType string) bool {
+	return entityType == EntityPre || entityType == EntityCode
+}
+
+func isQuoteEntity(entityType string) bool {
+	return entityType == EntityBlockquote || entityType == EntityExpandableBlockquote
+}
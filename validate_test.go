@@ -0,0 +1,244 @@
+package telegramify
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// TestValidateEntities_Broken 测试各种非法 entity 集合
+func TestValidateEntities_Broken(t *testing.T) {
+	tooMany := make([]MessageEntity, 0, 101)
+	for i := 0; i < 101; i++ {
+		tooMany = append(tooMany, MessageEntity{Type: EntityBold, Offset: i, Length: 1})
+	}
+
+	tests := []struct {
+		name     string
+		text     string
+		entities []MessageEntity
+		want     string
+	}{
+		{
+			name:     "negative offset",
+			text:     "hello",
+			entities: []MessageEntity{{Type: EntityBold, Offset: -1, Length: 2}},
+			want:     "negative offset",
+		},
+		{
+			name:     "zero length",
+			text:     "hello",
+			entities: []MessageEntity{{Type: EntityBold, Offset: 1, Length: 0}},
+			want:     "non-positive length",
+		},
+		{
+			name:     "past end",
+			text:     "hello",
+			entities: []MessageEntity{{Type: EntityItalic, Offset: 3, Length: 3}},
+			want:     "beyond text length 5",
+		},
+		{
+			name:     "past end with astral char",
+			text:     "📌a",
+			entities: []MessageEntity{{Type: EntityItalic, Offset: 0, Length: 4}},
+			want:     "beyond text length 3",
+		},
+		{
+			name:     "too many entities",
+			text:     strings.Repeat("x", 200),
+			entities: tooMany,
+			want:     "exceed the limit of 100",
+		},
+		{
+			name:     "unknown type",
+			text:     "hello",
+			entities: []MessageEntity{{Type: "blockqoute", Offset: 0, Length: 5}},
+			want:     "unknown entity type",
+		},
+		{
+			name: "bold inside pre",
+			text: "some code",
+			entities: []MessageEntity{
+				{Type: EntityPre, Offset: 0, Length: 9},
+				{Type: EntityBold, Offset: 0, Length: 4},
+			},
+			want: "pre and code cannot contain",
+		},
+		{
+			name: "italic crossing code",
+			text: "abc def",
+			entities: []MessageEntity{
+				{Type: EntityItalic, Offset: 0, Length: 5},
+				{Type: EntityCode, Offset: 4, Length: 3},
+			},
+			want: "pre and code cannot contain",
+		},
+		{
+			name:     "custom emoji without numeric id",
+			text:     "😀",
+			entities: []MessageEntity{{Type: EntityCustomEmoji, Offset: 0, Length: 2, CustomEmojiID: "abc"}},
+			want:     "not numeric",
+		},
+		{
+			name:     "custom emoji too long",
+			text:     strings.Repeat("😀", 10),
+			entities: []MessageEntity{{Type: EntityCustomEmoji, Offset: 0, Length: 20, CustomEmojiID: "5368324170671202286"}},
+			want:     "more than one emoji",
+		},
+		{
+			name:     "text link without scheme",
+			text:     "docs",
+			entities: []MessageEntity{{Type: EntityTextLink, Offset: 0, Length: 4, URL: "./docs/x.md"}},
+			want:     "has no scheme",
+		},
+		{
+			name:     "text link with spaces",
+			text:     "docs",
+			entities: []MessageEntity{{Type: EntityTextLink, Offset: 0, Length: 4, URL: "https://ex.com/a b"}},
+			want:     "contains whitespace",
+		},
+		{
+			name:     "text link without host",
+			text:     "docs",
+			entities: []MessageEntity{{Type: EntityTextLink, Offset: 0, Length: 4, URL: "https:///path"}},
+			want:     "has no host",
+		},
+		{
+			name:     "blockquote mid-line",
+			text:     "ab\ncd",
+			entities: []MessageEntity{{Type: EntityExpandableBlockquote, Offset: 1, Length: 4}},
+			want:     "beginning of a line",
+		},
+		{
+			name: "nested blockquotes",
+			text: "ab\ncd",
+			entities: []MessageEntity{
+				{Type: EntityBlockquote, Offset: 0, Length: 5},
+				{Type: EntityExpandableBlockquote, Offset: 3, Length: 2},
+			},
+			want: "nested in or overlapping",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateEntities(tt.text, tt.entities)
+			if len(errs) == 0 {
+				t.Fatalf("ValidateEntities() returned no errors, want one containing %q", tt.want)
+			}
+			found := false
+			for _, err := range errs {
+				if strings.Contains(err.Error(), tt.want) {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("ValidateEntities() = %v, want an error containing %q", errs, tt.want)
+			}
+			if EntitiesValid(tt.text, tt.entities) {
+				t.Error("EntitiesValid() = true, want false")
+			}
+		})
+	}
+}
+
+// TestValidateEntities_Valid 测试合法集合不会误报
+func TestValidateEntities_Valid(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		entities []MessageEntity
+	}{
+		{
+			name: "nested bold italic",
+			text: "bold italic bold",
+			entities: []MessageEntity{
+				{Type: EntityItalic, Offset: 5, Length: 6},
+				{Type: EntityBold, Offset: 0, Length: 16},
+			},
+		},
+		{
+			name: "code inside bold and link",
+			text: "use print() here",
+			entities: []MessageEntity{
+				{Type: EntityCode, Offset: 4, Length: 7},
+				{Type: EntityBold, Offset: 0, Length: 16},
+				{Type: EntityTextLink, Offset: 4, Length: 7, URL: "https://example.com"},
+			},
+		},
+		{
+			name: "custom emoji and tg link",
+			text: "😀 hi",
+			entities: []MessageEntity{
+				{Type: EntityCustomEmoji, Offset: 0, Length: 2, CustomEmojiID: "5368324170671202286"},
+				{Type: EntityTextLink, Offset: 3, Length: 2, URL: "tg://user?id=1"},
+			},
+		},
+		{
+			name: "blockquote after newline",
+			text: "intro\nquoted",
+			entities: []MessageEntity{
+				{Type: EntityBlockquote, Offset: 6, Length: 6},
+				{Type: EntityItalic, Offset: 6, Length: 6},
+			},
+		},
+		{
+			name:     "empty",
+			text:     "",
+			entities: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if errs := ValidateEntities(tt.text, tt.entities); len(errs) != 0 {
+				t.Errorf("ValidateEntities() = %v, want no errors", errs)
+			}
+		})
+	}
+}
+
+// TestValidateEntities_ConvertOutput 测试 Convert 输出通过校验
+func TestValidateEntities_ConvertOutput(t *testing.T) {
+	docs := []string{
+		"**bold *italic* bold**",
+		"# Title\n\nSome `code` and [link](https://example.com).",
+		"> quote line\n> second line\n\nafter",
+		"- [x] done\n- [ ] todo\n  - nested **bold**",
+		"| a | b |\n|---|---|\n| 1 | 2 |",
+		"```go\nfmt.Println(1)\n```\n\n||spoiler|| ~~strike~~",
+	}
+	for _, md := range docs {
+		text, entities := Convert(md, false, nil)
+		if errs := ValidateEntities(text, entities); len(errs) != 0 {
+			t.Errorf("Convert(%q) produced invalid entities: %v", md, errs)
+		}
+	}
+}
+
+// TestProcessMarkdown_DebugDiagnostics 测试 debug 模式附加诊断信息
+func TestProcessMarkdown_DebugDiagnostics(t *testing.T) {
+	// 自定义表情只能覆盖单个 emoji，这里覆盖了 17 个字符
+	md := "see [seventeen letters](tg://emoji?id=5368324170671202286) for details"
+
+	config := &RenderConfig{
+		MarkdownSymbol: DefaultConfig().MarkdownSymbol,
+		CiteExpandable: true,
+		Debug:          true,
+	}
+	contents, err := ProcessMarkdown(context.Background(), md, 4096, false, config)
+	if err != nil {
+		t.Fatalf("ProcessMarkdown() error = %v", err)
+	}
+	text := contents[0].(*Text)
+	diags := text.ContentTrace.Diagnostics()
+	if len(diags) != 1 || !strings.Contains(diags[0].Error(), "more than one emoji") {
+		t.Errorf("Diagnostics() = %v, want one 'more than one emoji' error", diags)
+	}
+
+	// 非 debug 模式不附加诊断
+	contents, _ = ProcessMarkdown(context.Background(), md, 4096, false, nil)
+	if diags := contents[0].GetContentTrace().Diagnostics(); diags != nil {
+		t.Errorf("Diagnostics() without debug = %v, want nil", diags)
+	}
+}
@@ -1,5 +1,11 @@
 package telegramify
 
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+)
+
 // CountText 计算文本在 Telegram 中的有效长度（UTF-16 code units）
 //
 // 由于使用 entity-based 方法，发送给 Telegram 的文本是纯文本
@@ -15,3 +21,145 @@ func CountText(text string) int {
 	return UTF16Len(text)
 }
 
+
+// ConvertStats 是 Stats 对一份 Markdown 的统计结果
+type ConvertStats struct {
+	// UTF16Length 转换后文本的 UTF-16 长度，链接地址存放在实体中，不计入
+	UTF16Length int
+	// Characters 转换后文本的字符（rune）数
+	Characters int
+	// Words 转换后文本中以空白分隔的词数
+	Words int
+	// Messages 估算 Process 会发送的消息数：拆分后的 Text，加上提取为文件或图片的片段
+	// （DedupeDrop 删除的重复附件除外）和目录。没有片段被提取时与 Process 生成的 Text 数一致
+	Messages int
+	// Entities 实体数量
+	Entities int
+	// CodeBlocks 和 CodeLines 是代码块（不含 Mermaid）的数量和总行数
+	CodeBlocks int
+	CodeLines  int
+	// MermaidDiagrams Mermaid 图的数量
+	MermaidDiagrams int
+	// Images 图片数量，不含自定义表情
+	Images int
+}
+
+// Stats 统计 Markdown 转换后的长度、消息数和各类内容的数量，用于在运行完整管道前做配额检查
+//
+// 只做转换和拆分估算，不渲染 Mermaid，也不发起任何网络请求。
+// opts 与 Process 相同，MaxMessageLength、header/footer、SplitStrategy 和 TOC 都会影响 Messages。
+// 没有可发送的内容（Process 返回 ErrEmptyContent）时 Messages 为 0。
+func Stats(markdown string, opts ...Option) (stats ConvertStats, err error) {
+	defer recoverPanic(&err)
+	options := applyOptions(opts...)
+	budget, err := messageBudget(options)
+	if err != nil {
+		return ConvertStats{}, err
+	}
+	config := options.Config
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if err := config.MarkdownSymbol.Validate(); err != nil {
+		return ConvertStats{}, err
+	}
+	doc := converterFor(options).convertDocument([]byte(markdown), options.LatexEscape, config)
+	if err := doc.limitError(config); err != nil {
+		return ConvertStats{}, err
+	}
+
+	stats = ConvertStats{
+		UTF16Length: UTF16Len(doc.text),
+		Characters:  utf8.RuneCountInString(doc.text),
+		Words:       len(strings.Fields(doc.text)),
+		Entities:    len(doc.entities),
+		Images:      doc.images,
+	}
+	for _, s := range doc.segments {
+		if s.Kind == SegmentMermaid {
+			stats.MermaidDiagrams++
+		} else {
+			stats.CodeBlocks++
+			stats.CodeLines += strings.Count(s.RawCode, "\n") + 1
+		}
+	}
+
+	extractable := selectExtractable(context.Background(), discardLogger, doc.segments, options)
+	if overflows(doc, options, extractable, budget) {
+		stats.Messages = len(decorate(overflowContents(nil, doc, options, budget), options))
+		return stats, nil
+	}
+	// 与管道相同，DedupeDrop 删除重复的附件及其占位说明
+	attachments := len(extractable)
+	var dropped []bool
+	if options.Dedupe == DedupeDrop {
+		dropped = droppedAttachments(plannedAttachments(extractable, options))
+		for _, d := range dropped {
+			if d {
+				attachments--
+			}
+		}
+	}
+	texts := countTexts(doc, options, extractable, dropped, budget)
+	// 只有提取的片段时 header/footer 单独成一条；什么都没有时 Process 返回 ErrEmptyContent
+	if texts == 0 && len(extractable) > 0 && (options.Header.Text != "" || options.Footer.Text != "") {
+		texts = 1
+	}
+	stats.Messages = texts + attachments
+	if options.GenerateTOC && buildTOC(doc.headings, options.TOCMinHeadings, budget, config) != nil {
+		stats.Messages++
+	}
+	return stats, nil
+}
+
+// plannedAttachments 返回各提取片段在 dry-run 中生成的附件，Mermaid 图不渲染，以图片地址代替内容
+func plannedAttachments(extractable []Segment, options *ConvertOptions) [][]Content {
+	attachments := make([][]Content, len(extractable))
+	for i, seg := range extractable {
+		if seg.Kind == SegmentMermaid {
+			planMermaid(&attachments[i], seg)
+		} else if seg.Kind == SegmentCodeBlock {
+			handleCodeBlockAsFile(&attachments[i], seg, options.LanguageExtensions)
+		}
+	}
+	return attachments
+}
+
+// countTexts 返回管道会为 doc 生成的 Text 数，不含目录和单独的 header/footer
+//
+// 与管道相同：在提取的片段处断开，各段分别按章节和预算拆分。dropped 标记 DedupeDrop 删除的片段，
+// 这些片段不加占位说明，可以为 nil。
+func countTexts(doc document, options *ConvertOptions, extractable []Segment, dropped []bool, budget int) int {
+	texts := 0
+	prefixes, suffixes := attachmentNotes(doc.text, extractable, dropped, options)
+	countRange := func(rg textRange, k int) {
+		for _, t := range rangeTexts(doc, options, rg, prefixes[k], suffixes[k]) {
+			texts += countChunks(t.text, t.entities, budget, splitOptions(options))
+		}
+	}
+	cursor, cursorUTF16 := 0, 0
+	for i, seg := range extractable {
+		if cutStart, cutUTF16Start := segmentCut(seg); cutStart > cursor {
+			countRange(textRange{cursor, cutStart, cursorUTF16, cutUTF16Start}, i)
+		}
+		cursor, cursorUTF16 = seg.TextEnd, seg.UTF16End
+	}
+	if cursor < len(doc.text) {
+		countRange(textRange{cursor, len(doc.text), cursorUTF16, UTF16Len(doc.text)}, len(extractable))
+	}
+	if texts == 0 && len(extractable) == 0 && strings.TrimSpace(doc.text) != "" {
+		texts = countChunks(strings.TrimSpace(doc.text), doc.entities, budget, splitOptions(options))
+	}
+	return texts
+}
+
+// countChunks 返回 text 按预算拆分后非空的块数
+func countChunks(text string, entities []MessageEntity, budget int, split SplitOptions) int {
+	n := 0
+	for _, chunk := range SplitEntitiesWith(text, entities, budget, split) {
+		if chunkText, _ := stripNewlinesAdjust(chunk.Text, chunk.Entities); chunkText != "" {
+			n++
+		}
+	}
+	return n
+}